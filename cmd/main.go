@@ -1,7 +1,14 @@
 package main
 
-import "github.com/samantonio28/subscriber-inf/internal/delivery"
+import (
+	"log"
+	"os"
+
+	"github.com/samantonio28/subscriber-inf/internal/delivery"
+)
 
 func main() {
-	delivery.App()
+	if err := delivery.Run(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,176 @@
+package delivery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/logger"
+	"github.com/samantonio28/subscriber-inf/internal/service"
+	"github.com/samantonio28/subscriber-inf/internal/service/repotest"
+	"github.com/samantonio28/subscriber-inf/pkg/config"
+)
+
+// apiRepo is the repository the API runs on.
+type apiRepo interface {
+	domain.SubscriptionRepository
+	domain.ServiceRepository
+	domain.UserRepository
+}
+
+// testAPI is the router of newServer on a repository of its own.
+type testAPI struct {
+	repo    apiRepo
+	logger  *logger.LogrusLogger
+	handler http.Handler
+}
+
+func newTestAPI(t *testing.T, repo apiRepo, auth *Authenticator) *testAPI {
+	t.Helper()
+	lg, err := logger.NewLogrusLogger(filepath.Join(t.TempDir(), "access.log"))
+	if err != nil {
+		t.Fatalf("NewLogrusLogger(): %v", err)
+	}
+	t.Cleanup(func() { _ = lg.Close() })
+	rates, err := service.NewStaticRates(config.RatesConfig{Base: domain.DefaultCurrency})
+	if err != nil {
+		t.Fatalf("NewStaticRates(): %v", err)
+	}
+	handler, err := NewSubsHandler(repo, rates, time.Hour, lg)
+	if err != nil {
+		t.Fatalf("NewSubsHandler(): %v", err)
+	}
+	services, err := NewServicesHandler(repo, lg)
+	if err != nil {
+		t.Fatalf("NewServicesHandler(): %v", err)
+	}
+	users, err := NewUsersHandler(repo, lg)
+	if err != nil {
+		t.Fatalf("NewUsersHandler(): %v", err)
+	}
+
+	r := mux.NewRouter()
+	r.Use(RequestMetaMiddleware)
+	r.Use(AccessLogMiddleware(lg))
+	if auth != nil {
+		r.Use(AuthMiddleware(auth))
+	}
+	routes(r, handler, services, users)
+	return &testAPI{repo: repo, logger: lg, handler: r}
+}
+
+// forEachRepo runs f against the API on a MemSubRepo and on a SubRepo,
+// the latter only when repotest.EnvPostgresDSN is set.
+func forEachRepo(t *testing.T, f func(t *testing.T, api *testAPI)) {
+	t.Helper()
+	forEachRepoWithAuth(t, nil, f)
+}
+
+// forEachRepoWithAuth is forEachRepo with the API behind auth.
+func forEachRepoWithAuth(t *testing.T, auth *Authenticator, f func(t *testing.T, api *testAPI)) {
+	t.Helper()
+	t.Run("Mem", func(t *testing.T) {
+		f(t, newTestAPI(t, service.NewMemSubRepo(), auth))
+	})
+	t.Run("Postgres", func(t *testing.T) {
+		f(t, newTestAPI(t, newPgRepo(t), auth))
+	})
+}
+
+// newPgRepo returns a SubRepo on a database of its own, t is skipped
+// without Postgres.
+func newPgRepo(t *testing.T) *service.SubRepo {
+	t.Helper()
+	repo, err := service.NewSubRepo(repotest.PgPool(t), 5*time.Second)
+	if err != nil {
+		t.Fatalf("NewSubRepo(): %v", err)
+	}
+	return repo
+}
+
+// do serves a request with body and the headers given as name, value
+// pairs.
+func (a *testAPI) do(t *testing.T, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// mustDo is do failing t unless the answer has status.
+func (a *testAPI) mustDo(t *testing.T, status int, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := a.do(t, method, target, body, header...)
+	if rec.Code != status {
+		t.Fatalf("%s %s = %d %s, want %d", method, target, rec.Code, rec.Body, status)
+	}
+	return rec
+}
+
+// decode reads the JSON answer of rec into v.
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("invalid answer %s: %v", rec.Body, err)
+	}
+}
+
+// errorCode is the code of the ErrorResponse of rec.
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp ErrorResponse
+	decode(t, rec, &resp)
+	return resp.Code
+}
+
+// createSub creates a subscription of user and returns its id.
+func (a *testAPI) createSub(t *testing.T, user, serviceName string, price int, start string) int {
+	t.Helper()
+	body := fmt.Sprintf(`{"service_name":%q,"price":%d,"user_id":%q,"start_date":%q}`, serviceName, price, user, start)
+	return createdSubId(t, a.mustDo(t, http.StatusCreated, http.MethodPost, "/subscriptions", body))
+}
+
+// createdSubId is the id of the subscription created by the request of
+// rec.
+func createdSubId(t *testing.T, rec *httptest.ResponseRecorder) int {
+	t.Helper()
+	id, err := parseCreatedSubId(rec)
+	if err != nil {
+		t.Fatalf("no sub_id in %s: %v", rec.Body, err)
+	}
+	return id
+}
+
+func parseCreatedSubId(rec *httptest.ResponseRecorder) (int, error) {
+	var resp struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		return 0, err
+	}
+	var id int
+	_, err := fmt.Sscanf(resp.Message, "new sub_id: %d", &id)
+	return id, err
+}
+
+// getSub returns subscription id, failing t unless it is found.
+func (a *testAPI) getSub(t *testing.T, id int) HandlingSub {
+	t.Helper()
+	var sub HandlingSub
+	decode(t, a.mustDo(t, http.StatusOK, http.MethodGet, fmt.Sprintf("/subscriptions/%d", id), ""), &sub)
+	return sub
+}
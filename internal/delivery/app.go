@@ -2,70 +2,237 @@ package delivery
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
-	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
 	"github.com/samantonio28/subscriber-inf/internal/logger"
 	"github.com/samantonio28/subscriber-inf/internal/service"
+	"github.com/samantonio28/subscriber-inf/internal/usecase"
 	"github.com/samantonio28/subscriber-inf/pkg/config"
 )
 
-func App() {
-	cfg, err := config.LoadConfig("configs/postgres.yaml")
+// App runs the server until SIGINT or SIGTERM and shuts it down
+// gracefully. args are the command line flags, see config.Load.
+func App(args []string) error {
+	cfg, _, done, err := loadConfig(flag.NewFlagSet("subscriber serve", flag.ContinueOnError), args)
+	if err != nil || done {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	server, err := NewApp(ctx, cfg)
 	if err != nil {
-		log.Fatal("Failed to load config:", err)
+		return err
 	}
+	return server.Run(ctx)
+}
 
-	poolConfig, err := cfg.Postgres.ToPgxPoolConfig()
+// loadConfig parses the flags of a command, defined on fs, together
+// with the config flags and validates the config. rest are the
+// positional arguments. done means that the command has nothing left to
+// do: help or the config were printed.
+func loadConfig(fs *flag.FlagSet, args []string) (cfg *config.Config, rest []string, done bool, err error) {
+	cfg, opts, err := config.Load(fs, args, os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil, nil, true, nil
+	}
 	if err != nil {
-		log.Fatal("Failed to create pool config:", err)
+		return nil, nil, false, fmt.Errorf("failed to load config: %w", err)
+	}
+	if opts.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			return nil, nil, false, err
+		}
 	}
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, false, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return cfg, opts.Args, opts.PrintConfig, nil
+}
 
-	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+// newPool connects to the database of cfg.
+func newPool(ctx context.Context, cfg *config.Config) (*pgxpool.Pool, error) {
+	poolConfig, err := cfg.Postgres.ToPgxPoolConfig()
 	if err != nil {
-		log.Fatal("Failed to connect to PostgreSQL:", err)
+		return nil, fmt.Errorf("failed to create pool config: %w", err)
 	}
-	defer pool.Close()
 
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
 	log.Println("Successfully connected to PostgreSQL!")
+	return pool, nil
+}
 
-	repo, err := service.NewSubRepo(pool)
+// NewApp wires the server from a validated config. The resources it
+// opens are closed on error and by the server's Shutdown otherwise.
+func NewApp(ctx context.Context, cfg *config.Config) (*Server, error) {
+	httpCfg, err := ServerConfigFrom(cfg.HTTP)
 	if err != nil {
-		log.Fatal("Failed to create sub repo:", err)
+		return nil, fmt.Errorf("invalid server config: %w", err)
+	}
+	queryTimeout, err := cfg.Postgres.ParseQueryTimeout()
+	if err != nil {
+		return nil, fmt.Errorf("invalid postgres.query_timeout: %w", err)
+	}
+	rates, err := service.NewStaticRates(cfg.Rates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rate provider: %w", err)
+	}
+
+	pool, err := newPool(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Postgres.AutoMigrate {
+		if err := migrateUp(ctx, pool); err != nil {
+			pool.Close()
+			return nil, err
+		}
 	}
 
-	logger, err := logger.NewLogrusLogger("logs/access.log")
+	logger, err := newLogger(cfg.Log)
 	if err != nil {
-		fmt.Printf("Failed to initialize logger: %v\n", err)
-		return
+		pool.Close()
+		return nil, fmt.Errorf("failed to initialize logger: %w", err)
+	}
+
+	server, err := newServer(httpCfg, cfg.Purge, cfg.Idempotency, cfg.Auth, pool, queryTimeout, rates, logger)
+	if err != nil {
+		pool.Close()
+		_ = logger.Close()
+		return nil, err
+	}
+	return server, nil
+}
+
+func newServer(cfg ServerConfig, purgeCfg config.PurgeConfig, idemCfg config.IdempotencyConfig, authCfg config.AuthConfig, pool *pgxpool.Pool, queryTimeout time.Duration, rates *service.StaticRates, logger *logger.LogrusLogger) (*Server, error) {
+	repo, err := service.NewSubRepo(pool, queryTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sub repo: %w", err)
+	}
+
+	keyTTL, err := idemCfg.ParseTTL()
+	if err != nil {
+		return nil, fmt.Errorf("invalid idempotency.ttl: %w", err)
+	}
+	keysInterval, err := idemCfg.ParseInterval()
+	if err != nil {
+		return nil, fmt.Errorf("invalid idempotency.interval: %w", err)
+	}
+	handler, err := NewSubsHandler(repo, rates, keyTTL, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sub handler: %w", err)
+	}
+	services, err := NewServicesHandler(repo, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service handler: %w", err)
+	}
+	users, err := NewUsersHandler(repo, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user handler: %w", err)
 	}
 
 	r := mux.NewRouter()
+	r.Use(RequestMetaMiddleware)
+	r.Use(TimeoutMiddleware(cfg.RequestTimeout, cfg.RouteTimeouts))
 	r.Use(AccessLogMiddleware(logger))
+	if authCfg.Enabled() {
+		auth, err := AuthenticatorFrom(authCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create authenticator: %w", err)
+		}
+		r.Use(AuthMiddleware(auth))
+	} else {
+		logger.Warn("auth.disabled is set, requests are not authenticated")
+	}
+	routes(r, handler, services, users)
 
-	handler, err := NewSubsHandler(repo, logger)
+	server, err := NewServer(cfg, r, pool, logger)
 	if err != nil {
-		log.Fatal("Failed to create sub hander:", err)
+		return nil, err
 	}
+	if purgeCfg.Enabled() {
+		purge, interval, err := newPurgeSubsUC(purgeCfg, repo, logger)
+		if err != nil {
+			return nil, err
+		}
+		server.AddJob(func(ctx context.Context) { purge.Run(ctx, interval) })
+	}
+	purgeKeys, err := usecase.NewPurgeKeysUC(repo, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create purge of idempotency keys: %w", err)
+	}
+	server.AddJob(func(ctx context.Context) { purgeKeys.Run(ctx, keysInterval) })
+	return server, nil
+}
 
-	r.Use(AccessLogMiddleware(logger))
+// routes registers the endpoints of the API on r.
+func routes(r *mux.Router, handler *SubsHandler, services *ServicesHandler, users *UsersHandler) {
 	r.HandleFunc("/subscriptions", handler.CreateSubscription).Methods("POST")
 	r.HandleFunc("/subscriptions", handler.GetSubscriptions).Methods("GET")
+	r.HandleFunc("/subscriptions:batch", handler.BatchSubscriptions).Methods("POST")
+	r.HandleFunc("/subscriptions/import", handler.ImportSubscriptions).Methods("POST")
+	r.HandleFunc("/subscriptions/export", handler.ExportSubscriptions).Methods("GET")
 	r.HandleFunc("/subscriptions/{id}", handler.DeleteSubscription).Methods("DELETE")
 	r.HandleFunc("/subscriptions/{id}", handler.GetSubscription).Methods("GET")
 	r.HandleFunc("/subscriptions/{id}", handler.UpdateSubscription).Methods("PUT")
+	r.HandleFunc("/subscriptions/{id}", handler.PatchSubscription).Methods("PATCH")
+	r.HandleFunc("/subscriptions/{id}/restore", handler.RestoreSubscription).Methods("POST")
+	r.HandleFunc("/subscriptions/{id}/history", handler.GetSubscriptionHistory).Methods("GET")
+	r.HandleFunc("/audit", handler.GetAuditLog).Methods("GET")
 	r.HandleFunc("/total_costs", handler.GetTotalCosts).Methods("GET")
+	r.HandleFunc("/total_costs/timeseries", handler.GetTotalCostsTimeSeries).Methods("GET")
+	r.HandleFunc("/admin/subscriptions", handler.ListSubscriptions).Methods("GET")
+	r.HandleFunc("/services", services.CreateService).Methods("POST")
+	r.HandleFunc("/services", services.GetServices).Methods("GET")
+	// Before /services/{id}, which matches it too.
+	r.HandleFunc("/services/search", services.SearchServices).Methods("GET")
+	r.HandleFunc("/services/{id}", services.GetService).Methods("GET")
+	r.HandleFunc("/services/{id}", services.UpdateService).Methods("PUT")
+	r.HandleFunc("/services/{id}", services.DeleteService).Methods("DELETE")
+	r.HandleFunc("/services/{id}/merge", services.MergeServices).Methods("POST")
+	r.HandleFunc("/services/{id}/aliases", services.GetServiceAliases).Methods("GET")
+	r.HandleFunc("/services/{id}/aliases", services.CreateServiceAlias).Methods("POST")
+	r.HandleFunc("/services/{id}/aliases/{alias}", services.DeleteServiceAlias).Methods("DELETE")
+	r.HandleFunc("/users", users.CreateUser).Methods("POST")
+	r.HandleFunc("/users", users.GetUsers).Methods("GET")
+	r.HandleFunc("/users/{id}", users.GetUser).Methods("GET")
+	r.HandleFunc("/users/{id}", users.UpdateUser).Methods("PUT")
+	r.HandleFunc("/users/{id}", users.DeleteUser).Methods("DELETE")
+}
 
-	server := http.Server{
-		Addr:         ":8080",
-		Handler:      r,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+// newLogger opens the log of a validated config.
+func newLogger(cfg config.LogConfig) (*logger.LogrusLogger, error) {
+	return logger.NewLogrusLoggerWith(logger.Options{Path: cfg.Path, Level: cfg.Level, Format: cfg.Format})
+}
+
+// newPurgeSubsUC builds the purge of an enabled validated config and
+// returns its interval.
+func newPurgeSubsUC(cfg config.PurgeConfig, repo domain.SubscriptionRepository, logger *logger.LogrusLogger) (*usecase.PurgeSubsUC, time.Duration, error) {
+	retention, err := cfg.ParseRetention()
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid purge.retention: %w", err)
+	}
+	interval, err := cfg.ParseInterval()
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid purge.interval: %w", err)
+	}
+	purge, err := usecase.NewPurgeSubsUC(repo, logger, retention)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create purge: %w", err)
 	}
-	fmt.Println("starting server at :8080")
-	fmt.Println(fmt.Errorf("server ended with error: %v", server.ListenAndServe()))
+	return purge, interval, nil
 }
@@ -0,0 +1,138 @@
+package delivery
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/usecase"
+	"github.com/samantonio28/subscriber-inf/pkg/utils"
+)
+
+// HandlingAuditEntry is a change of a subscription, Old is absent for
+// creations.
+type HandlingAuditEntry struct {
+	Id        int64        `json:"id"`
+	SubId     int          `json:"sub_id"`
+	UserId    string       `json:"user_id"`
+	Action    string       `json:"action"`
+	Actor     string       `json:"actor"`
+	RequestId string       `json:"request_id,omitempty"`
+	Old       *HandlingSub `json:"old,omitempty"`
+	New       *HandlingSub `json:"new"`
+	At        string       `json:"at"`
+}
+
+type AuditPageResponse struct {
+	Items []HandlingAuditEntry `json:"items"`
+	// NextAfterId is the after_id of the next page, absent on the last one.
+	NextAfterId int64 `json:"next_after_id,omitempty"`
+}
+
+func DeserializeAuditEntries(entries []usecase.AuditEntryDTO) []HandlingAuditEntry {
+	res := make([]HandlingAuditEntry, 0, len(entries))
+	for _, e := range entries {
+		he := HandlingAuditEntry{
+			Id:        e.Id,
+			SubId:     e.SubId,
+			UserId:    e.UserId.String(),
+			Action:    e.Action,
+			Actor:     e.Actor,
+			RequestId: e.RequestId,
+			At:        e.At.UTC().Format(time.RFC3339Nano),
+		}
+		if e.Old != nil {
+			old := DeserializeSub(*e.Old)
+			he.Old = &old
+		}
+		if e.New != nil {
+			cur := DeserializeSub(*e.New)
+			he.New = &cur
+		}
+		res = append(res, he)
+	}
+	return res
+}
+
+// parseAuditQuery reads the parameters of /audit: user_id, from and to
+// (RFC 3339 times or dates, see utils.ParseDate), after_id and limit.
+func parseAuditQuery(q url.Values) (usecase.AuditQueryDTO, error) {
+	var dto usecase.AuditQueryDTO
+	var err error
+
+	if v := q.Get("user_id"); v != "" {
+		dto.UserID, err = uuid.Parse(v)
+		if err != nil {
+			return dto, domain.NewValidationError("user_id", "can't parse uuid: "+err.Error())
+		}
+	}
+	times := map[string]*time.Time{"from": &dto.From, "to": &dto.To}
+	for name, dst := range times {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		if *dst, err = time.Parse(time.RFC3339, v); err == nil {
+			continue
+		}
+		if *dst, err = utils.ParseDate(v); err != nil {
+			return dto, domain.NewValidationError(name, err.Error())
+		}
+	}
+	if v := q.Get("after_id"); v != "" {
+		dto.AfterId, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return dto, domain.NewValidationError("after_id", "must be an integer")
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		dto.Limit, err = strconv.Atoi(v)
+		if err != nil {
+			return dto, domain.NewValidationError("limit", "must be an integer")
+		}
+	}
+	return dto, nil
+}
+
+// auditPage tells the next page apart by a full one.
+func auditPage(entries []usecase.AuditEntryDTO, limit int) AuditPageResponse {
+	if limit == 0 {
+		limit = domain.DefaultListLimit
+	}
+	page := AuditPageResponse{Items: DeserializeAuditEntries(entries)}
+	if len(entries) == limit {
+		page.NextAfterId = entries[len(entries)-1].Id
+	}
+	return page
+}
+
+func (h *SubsHandler) GetSubscriptionHistory(w http.ResponseWriter, r *http.Request) {
+	subId, err := subIdFromPath(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	entries, err := h.SubHistoryUC.SubHistory(r.Context(), subId)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	utils.MakeResponse(w, http.StatusOK, DeserializeAuditEntries(entries))
+}
+
+func (h *SubsHandler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	input, err := parseAuditQuery(r.URL.Query())
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	entries, err := h.AuditLogUC.AuditLog(r.Context(), input)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	utils.MakeResponse(w, http.StatusOK, auditPage(entries, input.Limit))
+}
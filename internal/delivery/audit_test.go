@@ -0,0 +1,73 @@
+package delivery
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestAuditTrail(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, api *testAPI) {
+		user := uuid.NewString()
+		meta := []string{HeaderActor, "bob", HeaderRequestID, "req-1"}
+		body := fmt.Sprintf(`{"service_name":"Netflix","price":100,"user_id":%q,"start_date":"07-2025"}`, user)
+		id := createdSubId(t, api.mustDo(t, http.StatusCreated, http.MethodPost, "/subscriptions", body, meta...))
+		path := fmt.Sprintf("/subscriptions/%d", id)
+		api.mustDo(t, http.StatusOK, http.MethodPut, path, fmt.Sprintf(`{"price":200,"user_id":%q}`, user), meta...)
+		api.mustDo(t, http.StatusNoContent, http.MethodDelete, path, "", meta...)
+		api.mustDo(t, http.StatusOK, http.MethodPost, path+"/restore", "", meta...)
+
+		var history []HandlingAuditEntry
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, path+"/history", ""), &history)
+		actions := []string{"create", "update", "delete", "restore"}
+		if len(history) != len(actions) {
+			t.Fatalf("history = %+v, want %v", history, actions)
+		}
+		for i, e := range history {
+			if e.Action != actions[i] || e.SubId != id || e.UserId != user || e.Actor != "bob" || e.RequestId != "req-1" || e.New == nil {
+				t.Errorf("history[%d] = %+v, want %s by bob", i, e, actions[i])
+			}
+		}
+		if history[0].Old != nil || history[0].New.Price != 100 {
+			t.Errorf("create entry = %+v", history[0])
+		}
+		if update := history[1]; update.Old == nil || update.Old.Price != 100 || update.New.Price != 200 {
+			t.Errorf("update entry = %+v, want price 100 -> 200", update)
+		}
+		if del := history[2]; del.Old == nil || del.Old.DeletedAt != "" || del.New.DeletedAt == "" {
+			t.Errorf("delete entry = %+v", del)
+		}
+
+		var page AuditPageResponse
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, "/audit?limit=3&user_id="+user, ""), &page)
+		if len(page.Items) != 3 || page.NextAfterId == 0 {
+			t.Fatalf("first audit page = %+v, want 3 items and more", page)
+		}
+		var last AuditPageResponse
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, fmt.Sprintf("/audit?limit=3&user_id=%s&after_id=%d", user, page.NextAfterId), ""), &last)
+		if len(last.Items) != 1 || last.NextAfterId != 0 {
+			t.Fatalf("second audit page = %+v, want the last item", last)
+		}
+		seen := make(map[int64]bool)
+		for _, e := range append(page.Items, last.Items...) {
+			if seen[e.Id] {
+				t.Errorf("audit entry %d on two pages", e.Id)
+			}
+			seen[e.Id] = true
+		}
+
+		var future AuditPageResponse
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, "/audit?from=2100-01-01&user_id="+user, ""), &future)
+		if len(future.Items) != 0 {
+			t.Errorf("audit from the future = %+v", future.Items)
+		}
+		if rec := api.do(t, http.MethodGet, "/audit?from=2030-01-01T00:00:00Z&to=2020-01-01", ""); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("audit with to before from = %d %s, want 422", rec.Code, rec.Body)
+		}
+		if rec := api.do(t, http.MethodGet, fmt.Sprintf("/subscriptions/%d/history", id+100), ""); rec.Code != http.StatusNotFound {
+			t.Errorf("history of missing = %d %s, want 404", rec.Code, rec.Body)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/pkg/config"
+)
+
+// Headers of AuthMiddleware.
+const (
+	HeaderAuthorization   = "Authorization"
+	HeaderWWWAuthenticate = "WWW-Authenticate"
+)
+
+// errUnauthorized marks requests without a valid bearer token.
+var errUnauthorized = errors.New("unauthorized")
+
+func unauthorized(msg string) error {
+	return &domain.FieldError{Kind: errUnauthorized, Msg: msg}
+}
+
+// Authenticator maps bearer tokens to principals: sub is the user id,
+// the admin role in the roles claim makes an admin.
+type Authenticator struct {
+	verifier  *TokenVerifier
+	adminRole string
+}
+
+func NewAuthenticator(verifier *TokenVerifier, adminRole string) (*Authenticator, error) {
+	if verifier == nil {
+		return nil, errors.New("token verifier is not defined")
+	}
+	if adminRole == "" {
+		return nil, errors.New("admin role is not defined")
+	}
+	return &Authenticator{verifier: verifier, adminRole: adminRole}, nil
+}
+
+// AuthenticatorFrom builds the authenticator of an enabled validated
+// config, reading its JWKS file.
+func AuthenticatorFrom(cfg config.AuthConfig) (*Authenticator, error) {
+	keys, err := LoadJWKS(cfg.JWKSFile)
+	if err != nil {
+		return nil, err
+	}
+	leeway, err := cfg.ParseLeeway()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := NewTokenVerifier(keys, cfg.Issuer, cfg.Audience, leeway)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuthenticator(verifier, cfg.AdminRole)
+}
+
+func (a *Authenticator) Authenticate(token string) (domain.Principal, error) {
+	claims, err := a.verifier.Verify(token)
+	if err != nil {
+		return domain.Principal{}, unauthorized(err.Error())
+	}
+	userId, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return domain.Principal{}, unauthorized("sub must be a user uuid")
+	}
+	return domain.Principal{UserID: userId, Admin: slices.Contains(claims.Roles, a.adminRole)}, nil
+}
+
+// bearerToken reads the token of the Authorization header, the scheme
+// is case-insensitive.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get(HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// AuthMiddleware rejects requests without a valid bearer token with 401
+// and puts the domain.Principal of the token into the context of the
+// others. The token's user replaces the X-Actor of the audit meta, so
+// it has to run after RequestMetaMiddleware.
+func AuthMiddleware(auth *Authenticator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				w.Header().Set(HeaderWWWAuthenticate, "Bearer")
+				MakeErrorResponse(w, unauthorized("bearer token required"))
+				return
+			}
+			p, err := auth.Authenticate(token)
+			if err != nil {
+				w.Header().Set(HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+				MakeErrorResponse(w, err)
+				return
+			}
+			ctx := domain.WithPrincipal(r.Context(), p)
+			meta := domain.AuditMetaFrom(ctx)
+			meta.Actor = p.UserID.String()
+			next.ServeHTTP(w, r.WithContext(domain.WithAuditMeta(ctx, meta)))
+		})
+	}
+}
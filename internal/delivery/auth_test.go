@@ -0,0 +1,166 @@
+package delivery
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAuth(t *testing.T) {
+	keys := newTestKeys(t)
+	verifier, err := NewTokenVerifier(keys.jwks, "", "subscriber", time.Minute)
+	if err != nil {
+		t.Fatalf("NewTokenVerifier(): %v", err)
+	}
+	auth, err := NewAuthenticator(verifier, "admin")
+	if err != nil {
+		t.Fatalf("NewAuthenticator(): %v", err)
+	}
+	claims := func(user string, roles ...string) map[string]any {
+		return map[string]any{"sub": user, "aud": "subscriber", "exp": time.Now().Add(time.Hour).Unix(), "roles": roles}
+	}
+	bearer := func(token string) []string {
+		return []string{HeaderAuthorization, "Bearer " + token}
+	}
+	as := func(user string, roles ...string) []string {
+		return bearer(signToken(t, AlgHS256, "hmac", claims(user, roles...), hs256(keys.secret)))
+	}
+
+	forEachRepoWithAuth(t, auth, func(t *testing.T, api *testAPI) {
+		alice, bob := uuid.NewString(), uuid.NewString()
+		asAlice, asBob, asAdmin := as(alice), as(bob), as(uuid.NewString(), "admin")
+		sub := `{"service_name":"Netflix","price":100,"start_date":"07-2025"}`
+
+		rec := api.do(t, http.MethodGet, "/subscriptions/1", "")
+		if rec.Code != http.StatusUnauthorized || rec.Header().Get(HeaderWWWAuthenticate) == "" || errorCode(t, rec) != CodeUnauthorized {
+			t.Errorf("request without a token = %d %v %s, want 401", rec.Code, rec.Header(), rec.Body)
+		}
+		// The tokens the verifier rejects are in TestTokenVerifier, the
+		// middleware wants a user uuid as the subject too.
+		expired := claims(alice)
+		expired["exp"] = time.Now().Add(-time.Hour).Unix()
+		for name, header := range map[string][]string{
+			"Garbage":    bearer("garbage"),
+			"Expired":    bearer(signToken(t, AlgHS256, "hmac", expired, hs256(keys.secret))),
+			"SubNotUUID": bearer(signToken(t, AlgHS256, "hmac", claims("alice"), hs256(keys.secret))),
+			"NotBearer":  {HeaderAuthorization, "Basic " + b64([]byte("alice:secret"))},
+		} {
+			rec := api.do(t, http.MethodGet, "/subscriptions/1", "", header...)
+			if rec.Code != http.StatusUnauthorized || rec.Header().Get(HeaderWWWAuthenticate) == "" {
+				t.Errorf("request with token %s = %d %v %s, want 401", name, rec.Code, rec.Header(), rec.Body)
+			}
+		}
+
+		// Without user_id the subscription is the caller's, the token
+		// and not X-Actor names the author.
+		aliceSub := createdSubId(t, api.mustDo(t, http.StatusCreated, http.MethodPost, "/subscriptions", sub, append([]string{HeaderActor, "spoofed"}, asAlice...)...))
+		var got HandlingSub
+		aliceRSA := bearer(signToken(t, AlgRS256, "rsa", claims(alice), rs256(keys.rsa)))
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, fmt.Sprintf("/subscriptions/%d", aliceSub), "", aliceRSA...), &got)
+		if got.UserId != alice {
+			t.Errorf("subscription created by alice = %+v, want hers", got)
+		}
+		bobSub := createdSubId(t, api.mustDo(t, http.StatusCreated, http.MethodPost, "/subscriptions",
+			fmt.Sprintf(`{"service_name":"Okko","price":50,"start_date":"07-2025","user_id":%q}`, bob), asAdmin...))
+
+		forBob := fmt.Sprintf(`{"service_name":"Netflix","price":100,"start_date":"07-2025","user_id":%q}`, bob)
+		for _, req := range []struct{ method, target, body string }{
+			{http.MethodPost, "/subscriptions", forBob},
+			{http.MethodGet, "/subscriptions?uuid=" + bob, ""},
+			{http.MethodGet, "/audit?user_id=" + bob, ""},
+			{http.MethodGet, "/total_costs", fmt.Sprintf(`{"start_date":"07-2025","end_date":"08-2025","filter":{"user_id":%q}}`, bob)},
+			{http.MethodGet, "/total_costs/timeseries?start_date=07-2025&end_date=08-2025&user_id=" + bob, ""},
+			{http.MethodGet, "/users/" + bob, ""},
+			{http.MethodGet, "/admin/subscriptions", ""},
+			{http.MethodGet, "/users", ""},
+			{http.MethodPost, "/services", `{"service_name":"Kion"}`},
+		} {
+			rec := api.do(t, req.method, req.target, req.body, asAlice...)
+			if rec.Code != http.StatusForbidden || errorCode(t, rec) != CodeForbidden {
+				t.Errorf("%s %s by alice = %d %s, want 403", req.method, req.target, rec.Code, rec.Body)
+			}
+		}
+
+		// The subscriptions of other users look missing.
+		bobPath := fmt.Sprintf("/subscriptions/%d", bobSub)
+		for _, req := range []struct{ method, target, body string }{
+			{http.MethodGet, bobPath, ""},
+			{http.MethodPut, bobPath, fmt.Sprintf(`{"service_name":"Okko","price":1,"start_date":"07-2025","user_id":%q}`, alice)},
+			{http.MethodPatch, bobPath, `{"price":1}`},
+			{http.MethodDelete, bobPath, ""},
+			{http.MethodPost, bobPath + "/restore", ""},
+			{http.MethodGet, bobPath + "/history", ""},
+		} {
+			header := asAlice
+			if req.method == http.MethodPatch {
+				header = append([]string{"Content-Type", ContentTypeMergePatch}, asAlice...)
+			}
+			rec := api.do(t, req.method, req.target, req.body, header...)
+			if rec.Code != http.StatusNotFound || errorCode(t, rec) != CodeNotFound {
+				t.Errorf("%s %s by alice = %d %s, want 404", req.method, req.target, rec.Code, rec.Body)
+			}
+		}
+		// A batch reports the errors of its operations.
+		for op, code := range map[string]string{
+			fmt.Sprintf(`{"op":"create","service_name":"Netflix","price":100,"start_date":"07-2025","user_id":%q}`, bob): CodeForbidden,
+			fmt.Sprintf(`{"op":"update","sub_id":%d,"user_id":%q,"price":1}`, bobSub, alice):                             CodeNotFound,
+			fmt.Sprintf(`{"op":"delete","sub_id":%d}`, bobSub):                                                           CodeNotFound,
+		} {
+			var resp BatchResponse
+			decode(t, api.mustDo(t, http.StatusUnprocessableEntity, http.MethodPost, "/subscriptions:batch", `{"operations":[`+op+`]}`, asAlice...), &resp)
+			if len(resp.Results) != 1 || resp.Results[0].Error == nil || resp.Results[0].Error.Code != code {
+				t.Errorf("batch %s by alice = %+v, want %s", op, resp.Results, code)
+			}
+		}
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, bobPath, "", asBob...), &got)
+		if got.Price != 50 || got.DeletedAt != "" {
+			t.Errorf("subscription of bob after alice's requests = %+v, want it untouched", got)
+		}
+
+		var subs []HandlingSub
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, "/subscriptions?uuid="+alice, "", asAlice...), &subs)
+		if len(subs) != 1 || subs[0].SubId != aliceSub {
+			t.Errorf("subscriptions of alice = %+v, want %d", subs, aliceSub)
+		}
+		var costs TotalCostsResponse
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, "/total_costs", `{"start_date":"07-2025","end_date":"08-2025"}`, asAlice...), &costs)
+		if len(costs.SubIds) != 1 || costs.SubIds[0] != aliceSub {
+			t.Errorf("costs of alice = %+v, want only %d", costs, aliceSub)
+		}
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, "/total_costs", `{"start_date":"07-2025","end_date":"08-2025"}`, asAdmin...), &costs)
+		if len(costs.SubIds) != 2 {
+			t.Errorf("costs of the admin = %+v, want both subscriptions", costs)
+		}
+		var audit AuditPageResponse
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, "/audit", "", asAlice...), &audit)
+		if len(audit.Items) != 1 || audit.Items[0].SubId != aliceSub || audit.Items[0].Actor != alice {
+			t.Errorf("audit of alice = %+v, want the creation of %d by her", audit.Items, aliceSub)
+		}
+
+		// The export is not for admins only, it holds the caller's own.
+		rec = api.mustDo(t, http.StatusOK, http.MethodGet, "/subscriptions/export?format=jsonl", "", asAlice...)
+		if lines := strings.Count(rec.Body.String(), "\n"); lines != 1 || !strings.Contains(rec.Body.String(), alice) {
+			t.Errorf("export of alice = %s, want her subscription only", rec.Body)
+		}
+
+		api.mustDo(t, http.StatusOK, http.MethodGet, "/admin/subscriptions", "", asAdmin...)
+		api.mustDo(t, http.StatusOK, http.MethodGet, "/users/"+alice, "", asAlice...)
+		api.mustDo(t, http.StatusNoContent, http.MethodDelete, bobPath, "", asBob...)
+
+		// Idempotency keys are per caller: bob's key doesn't replay alice's.
+		keyed := func(who []string) []string { return append([]string{HeaderIdempotencyKey, "shared"}, who...) }
+		first := createdSubId(t, api.mustDo(t, http.StatusCreated, http.MethodPost, "/subscriptions", sub, keyed(asAlice)...))
+		rec = api.mustDo(t, http.StatusCreated, http.MethodPost, "/subscriptions", sub, keyed(asBob)...)
+		if rec.Header().Get(HeaderReplayed) != "" || createdSubId(t, rec) == first {
+			t.Errorf("create by bob with alice's key = %v %s, want a new subscription", rec.Header(), rec.Body)
+		}
+		rec = api.mustDo(t, http.StatusCreated, http.MethodPost, "/subscriptions", sub, keyed(asAlice)...)
+		if rec.Header().Get(HeaderReplayed) != "true" || createdSubId(t, rec) != first {
+			t.Errorf("repeated create by alice = %v %s, want %d replayed", rec.Header(), rec.Body, first)
+		}
+	})
+}
@@ -0,0 +1,259 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/logger"
+	"github.com/samantonio28/subscriber-inf/internal/service"
+	"github.com/samantonio28/subscriber-inf/pkg/config"
+)
+
+const usage = `usage: subscriber <command> [flags] [args]
+
+commands:
+  serve                      run the HTTP server (the default)
+  migrate up|down|status|to N|baseline N
+  subs create                add a subscription
+  subs get ID                show a subscription
+  subs list                  list subscriptions
+  subs update ID             change the given fields of a subscription
+  subs delete ID             delete a subscription, it can be restored until purged
+  subs restore ID            bring back a deleted subscription
+  subs history ID            changes of a subscription
+  costs                      total costs of a period
+  import FILE                add subscriptions from a CSV or JSONL file
+  export [FILE]              write subscriptions as CSV or JSONL
+  purge                      remove subscriptions deleted before the retention
+  audit                      changes of all subscriptions
+  services list              list the service catalog
+  services merge FROM INTO   move the subscriptions of a service to another one
+  users delete ID            delete a user with all their subscriptions
+
+Every command takes the config flags of serve, see subscriber serve -h.
+The commands except serve and migrate print a table or, with
+--output json, JSON.`
+
+// Output formats of the commands.
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+)
+
+// Run runs the command line of the binary without the program name.
+func Run(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return App(args)
+	}
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "serve":
+		return App(args)
+	case "migrate":
+		return migrateCommand(args)
+	case "subs":
+		if len(args) == 0 {
+			return fmt.Errorf("subs needs a command\n%s", usage)
+		}
+		sub, args := args[0], args[1:]
+		switch sub {
+		case "create":
+			return subsCreateCommand(args)
+		case "get":
+			return subsGetCommand(args)
+		case "list":
+			return subsListCommand(args)
+		case "update":
+			return subsUpdateCommand(args)
+		case "delete":
+			return subsDeleteCommand(args)
+		case "restore":
+			return subsRestoreCommand(args)
+		case "history":
+			return subsHistoryCommand(args)
+		}
+		return fmt.Errorf("unknown command subs %s\n%s", sub, usage)
+	case "costs":
+		return costsCommand(args)
+	case "import":
+		return importCommand(args)
+	case "export":
+		return exportCommand(args)
+	case "purge":
+		return purgeCommand(args)
+	case "audit":
+		return auditCommand(args)
+	case "services":
+		if len(args) == 0 {
+			return fmt.Errorf("services needs a command\n%s", usage)
+		}
+		sub, args := args[0], args[1:]
+		switch sub {
+		case "list":
+			return servicesListCommand(args)
+		case "merge":
+			return servicesMergeCommand(args)
+		}
+		return fmt.Errorf("unknown command services %s\n%s", sub, usage)
+	case "users":
+		if len(args) == 0 {
+			return fmt.Errorf("users needs a command\n%s", usage)
+		}
+		sub, args := args[0], args[1:]
+		if sub == "delete" {
+			return usersDeleteCommand(args)
+		}
+		return fmt.Errorf("unknown command users %s\n%s", sub, usage)
+	case "help":
+		fmt.Println(usage)
+		return nil
+	}
+	return fmt.Errorf("unknown command %q\n%s", cmd, usage)
+}
+
+// command is a command working with the use cases. Its flags are
+// defined on fs before run is called.
+type command struct {
+	fs     *flag.FlagSet
+	output string
+}
+
+func newCommand(name string) *command {
+	c := &command{fs: flag.NewFlagSet("subscriber "+name, flag.ContinueOnError)}
+	c.fs.StringVar(&c.output, "output", OutputTable, "output format: table or json")
+	return c
+}
+
+// cliEnv holds what the commands need, the use cases are those of
+// the HTTP handlers.
+type cliEnv struct {
+	*SubsHandler
+	services *ServicesHandler
+	users    *UsersHandler
+	repo     domain.SubscriptionRepository
+	purge    config.PurgeConfig
+	pool     *pgxpool.Pool
+	logger   *logger.LogrusLogger
+	out      io.Writer
+	output   string
+}
+
+func (e *cliEnv) close() {
+	e.pool.Close()
+	_ = e.logger.Close()
+}
+
+// run parses args, connects to the database and calls f with the
+// positional arguments.
+func (c *command) run(args []string, f func(ctx context.Context, env *cliEnv, args []string) error) error {
+	cfg, rest, done, err := loadConfig(c.fs, args)
+	if err != nil || done {
+		return err
+	}
+	if c.output != OutputTable && c.output != OutputJSON {
+		return fmt.Errorf("unknown output format %q", c.output)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx = domain.WithAuditMeta(ctx, domain.AuditMeta{Actor: cliActor()})
+
+	env, err := newCLIEnv(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer env.close()
+	env.output = c.output
+	return f(ctx, env, rest)
+}
+
+func newCLIEnv(ctx context.Context, cfg *config.Config) (*cliEnv, error) {
+	queryTimeout, err := cfg.Postgres.ParseQueryTimeout()
+	if err != nil {
+		return nil, fmt.Errorf("invalid postgres.query_timeout: %w", err)
+	}
+	rates, err := service.NewStaticRates(cfg.Rates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rate provider: %w", err)
+	}
+	pool, err := newPool(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	logger, err := newLogger(cfg.Log)
+	if err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	env := &cliEnv{purge: cfg.Purge, pool: pool, logger: logger, out: os.Stdout}
+
+	repo, err := service.NewSubRepo(pool, queryTimeout)
+	if err != nil {
+		env.close()
+		return nil, fmt.Errorf("failed to create sub repo: %w", err)
+	}
+	env.repo = repo
+	keyTTL, err := cfg.Idempotency.ParseTTL()
+	if err != nil {
+		env.close()
+		return nil, fmt.Errorf("invalid idempotency.ttl: %w", err)
+	}
+	env.SubsHandler, err = NewSubsHandler(repo, rates, keyTTL, logger)
+	if err != nil {
+		env.close()
+		return nil, fmt.Errorf("failed to create sub handler: %w", err)
+	}
+	if env.services, err = NewServicesHandler(repo, logger); err != nil {
+		env.close()
+		return nil, fmt.Errorf("failed to create service handler: %w", err)
+	}
+	if env.users, err = NewUsersHandler(repo, logger); err != nil {
+		env.close()
+		return nil, fmt.Errorf("failed to create user handler: %w", err)
+	}
+	return env, nil
+}
+
+// printJSON writes v the way the API answers, indented.
+func (e *cliEnv) printJSON(v any) error {
+	enc := json.NewEncoder(e.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printTable writes rows aligned in columns under header.
+func (e *cliEnv) printTable(header []string, rows [][]string) error {
+	w := tabwriter.NewWriter(e.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// printMessage writes a message as a line or as {"message": ...}.
+func (e *cliEnv) printMessage(msg string) error {
+	if e.output == OutputJSON {
+		return e.printJSON(map[string]string{"message": msg})
+	}
+	_, err := fmt.Fprintln(e.out, msg)
+	return err
+}
+
+// oneArg checks that the command got exactly one positional argument.
+func oneArg(args []string, name string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("expected %s as the only argument, got %d arguments", name, len(args))
+	}
+	return args[0], nil
+}
@@ -0,0 +1,98 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// cliActor is the actor of the changes made by the commands.
+func cliActor() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
+
+func subsHistoryCommand(args []string) error {
+	c := newCommand("subs history")
+	return c.run(args, func(ctx context.Context, env *cliEnv, args []string) error {
+		subId, err := subIdArg(args)
+		if err != nil {
+			return err
+		}
+		entries, err := env.SubHistoryUC.SubHistory(ctx, subId)
+		if err != nil {
+			return err
+		}
+		return env.printAudit(DeserializeAuditEntries(entries))
+	})
+}
+
+func auditCommand(args []string) error {
+	c := newCommand("audit")
+	// The flags are the query parameters of /audit with dashes.
+	params := []struct{ name, usage string }{
+		{"user_id", "owner of the subscriptions"},
+		{"from", "earliest time, RFC 3339 or a date"},
+		{"to", "exclusive latest time"},
+		{"after_id", "next_after_id of the previous page"},
+		{"limit", "page size"},
+	}
+	vals := make(map[string]*string, len(params))
+	for _, p := range params {
+		vals[p.name] = c.fs.String(strings.ReplaceAll(p.name, "_", "-"), "", p.usage)
+	}
+	return c.run(args, func(ctx context.Context, env *cliEnv, args []string) error {
+		if len(args) != 0 {
+			return fmt.Errorf("unexpected arguments %v", args)
+		}
+		q := url.Values{}
+		for name, v := range vals {
+			if *v != "" {
+				q.Set(name, *v)
+			}
+		}
+		input, err := parseAuditQuery(q)
+		if err != nil {
+			return err
+		}
+		entries, err := env.AuditLogUC.AuditLog(ctx, input)
+		if err != nil {
+			return err
+		}
+		page := auditPage(entries, input.Limit)
+		if env.output == OutputJSON {
+			return env.printJSON(page)
+		}
+		if err := env.printAudit(page.Items); err != nil {
+			return err
+		}
+		if page.NextAfterId != 0 {
+			_, err = fmt.Fprintf(env.out, "next page: --after-id %d\n", page.NextAfterId)
+		}
+		return err
+	})
+}
+
+// printAudit writes entries as JSON or one line per change.
+func (e *cliEnv) printAudit(entries []HandlingAuditEntry) error {
+	if e.output == OutputJSON {
+		return e.printJSON(entries)
+	}
+	rows := make([][]string, 0, len(entries))
+	for _, entry := range entries {
+		rows = append(rows, []string{
+			strconv.FormatInt(entry.Id, 10),
+			strconv.Itoa(entry.SubId),
+			entry.Action,
+			entry.Actor,
+			entry.RequestId,
+			entry.At,
+		})
+	}
+	return e.printTable([]string{"ID", "SUB_ID", "ACTION", "ACTOR", "REQUEST_ID", "AT"}, rows)
+}
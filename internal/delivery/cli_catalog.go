@@ -0,0 +1,99 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+var serviceColumns = []string{"SERVICE_ID", "SERVICE", "DISPLAY_NAME", "CATEGORY", "DEFAULT_PRICE", "SUBS"}
+
+func serviceRow(s HandlingService) []string {
+	price := ""
+	if s.DefaultPrice != nil {
+		price = fmt.Sprintf("%d %s", *s.DefaultPrice, s.DefaultCurrency)
+	}
+	return []string{
+		strconv.Itoa(s.ServiceId),
+		s.ServiceName,
+		s.DisplayName,
+		s.Category,
+		price,
+		strconv.Itoa(s.SubsCount),
+	}
+}
+
+func servicesListCommand(args []string) error {
+	c := newCommand("services list")
+	var category string
+	c.fs.StringVar(&category, "category", "", "list only the services of the category")
+	return c.run(args, func(ctx context.Context, env *cliEnv, args []string) error {
+		if len(args) != 0 {
+			return fmt.Errorf("unexpected arguments %v", args)
+		}
+		services, err := env.services.ServicesUC.Services(ctx, category)
+		if err != nil {
+			return err
+		}
+		res := make([]HandlingService, 0, len(services))
+		rows := make([][]string, 0, len(services))
+		for _, s := range services {
+			hs := DeserializeService(s)
+			res = append(res, hs)
+			rows = append(rows, serviceRow(hs))
+		}
+		if env.output == OutputJSON {
+			return env.printJSON(res)
+		}
+		return env.printTable(serviceColumns, rows)
+	})
+}
+
+func servicesMergeCommand(args []string) error {
+	c := newCommand("services merge")
+	return c.run(args, func(ctx context.Context, env *cliEnv, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("expected FROM and INTO service ids, got %d arguments", len(args))
+		}
+		ids := make([]int, 2)
+		for i, arg := range args {
+			id, err := strconv.Atoi(arg)
+			if err != nil {
+				return badRequest("invalid service id: " + err.Error())
+			}
+			ids[i] = id
+		}
+		svc, moved, err := env.services.ServicesUC.MergeServices(ctx, ids[0], ids[1])
+		if err != nil {
+			return err
+		}
+		if env.output == OutputJSON {
+			return env.printJSON(MergeServicesResponse{Service: DeserializeService(svc), MovedSubs: moved})
+		}
+		return env.printMessage(fmt.Sprintf("%d subscriptions moved to service %d", moved, svc.Id))
+	})
+}
+
+func usersDeleteCommand(args []string) error {
+	c := newCommand("users delete")
+	return c.run(args, func(ctx context.Context, env *cliEnv, args []string) error {
+		arg, err := oneArg(args, "ID")
+		if err != nil {
+			return err
+		}
+		id, err := uuid.Parse(arg)
+		if err != nil {
+			return badRequest("invalid user id: " + err.Error())
+		}
+		deleted, err := env.users.UsersUC.DeleteUser(ctx, id)
+		if err != nil {
+			return err
+		}
+		if env.output == OutputJSON {
+			return env.printJSON(DeleteUserResponse{DeletedSubs: deleted})
+		}
+		return env.printMessage(fmt.Sprintf("user %s deleted with %d subscriptions", id, deleted))
+	})
+}
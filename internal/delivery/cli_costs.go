@@ -0,0 +1,87 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+func intsString(ids []int) string {
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.Itoa(id))
+	}
+	return strings.Join(parts, ",")
+}
+
+func costsCommand(args []string) error {
+	c := newCommand("costs")
+	var req CostsFilter
+	var monthly bool
+	c.fs.StringVar(&req.StartDate, "start", "", "start of the period: MM-YYYY or YYYY-MM-DD")
+	c.fs.StringVar(&req.EndDate, "end", "", "exclusive end of the period, the current month by default")
+	c.fs.StringVar(&req.Filter.UserId, "user", "", "costs of one user")
+	c.fs.StringVar(&req.Filter.ServiceName, "service", "", "costs of one service")
+	c.fs.StringVar(&req.GroupBy, "group-by", "", "breakdown: service, user or month")
+	c.fs.StringVar(&req.Currency, "currency", "", "currency of the report, RUB by default")
+	c.fs.BoolVar(&req.ProRata, "pro-rata", false, "bill the days of billing periods within the period")
+	c.fs.BoolVar(&monthly, "monthly", false, "costs of every month, as /total_costs/timeseries")
+	return c.run(args, func(ctx context.Context, env *cliEnv, args []string) error {
+		if len(args) != 0 {
+			return fmt.Errorf("unexpected arguments %v", args)
+		}
+		if monthly {
+			return env.printTimeSeries(ctx, req)
+		}
+		ans, err := env.totalCosts(ctx, req)
+		if err != nil {
+			return err
+		}
+		if env.output == OutputJSON {
+			return env.printJSON(ans)
+		}
+		if ans.GroupBy != "" {
+			rows := make([][]string, 0, len(ans.Groups))
+			for _, g := range ans.Groups {
+				rows = append(rows, []string{g.Key, formatAmount(g.TotalSum), intsString(g.SubIds)})
+			}
+			if err := env.printTable([]string{strings.ToUpper(ans.GroupBy), "TOTAL", "SUB_IDS"}, rows); err != nil {
+				return err
+			}
+			fmt.Fprintln(env.out)
+		}
+		_, err = fmt.Fprintf(env.out, "total: %s %s\n", formatAmount(ans.TotalSum), ans.Currency)
+		return err
+	})
+}
+
+func (e *cliEnv) printTimeSeries(ctx context.Context, req CostsFilter) error {
+	if req.GroupBy != "" || req.ProRata {
+		return badRequest("--monthly can't be used with --group-by or --pro-rata")
+	}
+	ans, err := e.timeSeries(ctx, req)
+	if err != nil {
+		return err
+	}
+	if e.output == OutputJSON {
+		return e.printJSON(ans)
+	}
+	rows := make([][]string, 0, len(ans.Months))
+	for _, m := range ans.Months {
+		ids := make([]int, 0, len(m.Subs))
+		for _, s := range m.Subs {
+			ids = append(ids, s.SubId)
+		}
+		rows = append(rows, []string{m.Month, formatAmount(m.TotalSum), intsString(ids)})
+	}
+	if err := e.printTable([]string{"MONTH", "TOTAL", "SUB_IDS"}, rows); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.out, "\ntotal: %s %s\n", formatAmount(ans.TotalSum), ans.Currency)
+	return err
+}
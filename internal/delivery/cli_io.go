@@ -0,0 +1,128 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// fileFormat is format or, when it is empty, the one of the file
+// extension. CSV is the default.
+func fileFormat(format, path string) string {
+	if format != "" {
+		return format
+	}
+	switch filepath.Ext(path) {
+	case ".jsonl", ".ndjson":
+		return FormatJSONL
+	}
+	return FormatCSV
+}
+
+func importCommand(args []string) error {
+	c := newCommand("import")
+	var format, mode string
+	var dryRun bool
+	c.fs.StringVar(&format, "format", "", "csv or jsonl, by the file extension by default")
+	c.fs.StringVar(&mode, "mode", "all_or_nothing", "all_or_nothing or best_effort")
+	c.fs.BoolVar(&dryRun, "dry-run", false, "only validate the rows")
+	return c.run(args, func(ctx context.Context, env *cliEnv, args []string) error {
+		path, err := oneArg(args, "FILE (- for the standard input)")
+		if err != nil {
+			return err
+		}
+		in := io.Reader(os.Stdin)
+		if path != "-" {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		r, err := NewSubsReader(in, fileFormat(format, path))
+		if err != nil {
+			return err
+		}
+
+		report, err := env.importSubs(ctx, r, mode, dryRun)
+		if err != nil {
+			return err
+		}
+
+		if env.output == OutputJSON {
+			if err := env.printJSON(report); err != nil {
+				return err
+			}
+		} else {
+			rows := make([][]string, 0, len(report.Rows))
+			for _, res := range report.Rows {
+				status, id := "ok", ""
+				if res.SubId != 0 {
+					id = strconv.Itoa(res.SubId)
+				}
+				if res.Error != nil {
+					status = res.Error.Message
+					if res.Error.Field != "" {
+						status = res.Error.Field + ": " + status
+					}
+				}
+				rows = append(rows, []string{strconv.Itoa(res.Row), id, status})
+			}
+			if err := env.printTable([]string{"ROW", "SUB_ID", "STATUS"}, rows); err != nil {
+				return err
+			}
+		}
+		if report.Failed > 0 {
+			return fmt.Errorf("%d of %d rows failed, %d imported", report.Failed, report.Total, report.Imported)
+		}
+		return nil
+	})
+}
+
+func exportCommand(args []string) error {
+	c := newCommand("export")
+	var format, userId, serviceName string
+	c.fs.StringVar(&format, "format", "", "csv or jsonl, by the file extension by default")
+	c.fs.StringVar(&userId, "user", "", "subscriptions of one user")
+	c.fs.StringVar(&serviceName, "service", "", "subscriptions of one service")
+	return c.run(args, func(ctx context.Context, env *cliEnv, args []string) error {
+		path := "-"
+		if len(args) > 1 {
+			return fmt.Errorf("unexpected arguments %v", args[1:])
+		}
+		if len(args) == 1 {
+			path = args[0]
+		}
+		out := io.Writer(os.Stdout)
+		if path != "-" {
+			f, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		w, err := NewSubsWriter(out, fileFormat(format, path))
+		if err != nil {
+			return err
+		}
+
+		q := url.Values{}
+		if userId != "" {
+			q.Set("user_id", userId)
+		}
+		if serviceName != "" {
+			q.Set("service_name", serviceName)
+		}
+		input, err := parseListQuery(q)
+		if err != nil {
+			return err
+		}
+		return env.exportSubs(ctx, input, w)
+	})
+}
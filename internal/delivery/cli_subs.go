@@ -0,0 +1,259 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// subFlags defines the flags of the subscription fields on c.
+func subFlags(c *command, req *HandlingSub) {
+	c.fs.StringVar(&req.ServiceName, "service", "", "service name")
+	c.fs.IntVar(&req.Price, "price", 0, "price per billing period")
+	c.fs.StringVar(&req.Currency, "currency", "", "currency of the price, RUB by default")
+	c.fs.StringVar(&req.BillingPeriod, "period", "", "billing period: weekly, monthly, quarterly or yearly")
+	c.fs.StringVar(&req.UserId, "user", "", "user id")
+	c.fs.StringVar(&req.StartDate, "start", "", "start date: MM-YYYY or YYYY-MM-DD")
+	c.fs.StringVar(&req.EndDate, "end", "", "exclusive end date")
+}
+
+func subIdArg(args []string) (int, error) {
+	arg, err := oneArg(args, "ID")
+	if err != nil {
+		return 0, err
+	}
+	subId, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, badRequest("invalid sub id: " + err.Error())
+	}
+	return subId, nil
+}
+
+var subColumns = []string{"SUB_ID", "SERVICE", "PRICE", "CURRENCY", "PERIOD", "USER_ID", "START", "END"}
+
+func subRow(s HandlingSub) []string {
+	return []string{
+		strconv.Itoa(s.SubId),
+		s.ServiceName,
+		strconv.Itoa(s.Price),
+		s.Currency,
+		s.BillingPeriod,
+		s.UserId,
+		s.StartDate,
+		s.EndDate,
+	}
+}
+
+func (e *cliEnv) printSubs(subs []HandlingSub) error {
+	rows := make([][]string, 0, len(subs))
+	for _, s := range subs {
+		rows = append(rows, subRow(s))
+	}
+	return e.printTable(subColumns, rows)
+}
+
+func subsCreateCommand(args []string) error {
+	c := newCommand("subs create")
+	var req HandlingSub
+	subFlags(c, &req)
+	var key string
+	c.fs.StringVar(&key, "idempotency-key", "", "create once for the key, repeating the command prints the same sub_id")
+	return c.run(args, func(ctx context.Context, env *cliEnv, args []string) error {
+		if len(args) != 0 {
+			return fmt.Errorf("unexpected arguments %v", args)
+		}
+		subDTO, err := SerializeSub(req)
+		if err != nil {
+			return err
+		}
+		var subId int
+		if key != "" {
+			subId, _, err = env.CreateSubUC.NewSubOnce(ctx, key, subDTO)
+		} else {
+			subId, err = env.CreateSubUC.NewSub(ctx, subDTO)
+		}
+		if err != nil {
+			return err
+		}
+		if env.output == OutputJSON {
+			return env.printJSON(map[string]int{"sub_id": subId})
+		}
+		return env.printMessage(fmt.Sprintf("new sub_id: %d", subId))
+	})
+}
+
+func subsGetCommand(args []string) error {
+	c := newCommand("subs get")
+	var includeDeleted bool
+	c.fs.BoolVar(&includeDeleted, "include-deleted", false, "find a deleted subscription too")
+	return c.run(args, func(ctx context.Context, env *cliEnv, args []string) error {
+		subId, err := subIdArg(args)
+		if err != nil {
+			return err
+		}
+		sub, err := env.GetSubUC.SubById(ctx, subId, includeDeleted)
+		if err != nil {
+			return err
+		}
+		if env.output == OutputJSON {
+			return env.printJSON(DeserializeSub(sub))
+		}
+		return env.printSubs([]HandlingSub{DeserializeSub(sub)})
+	})
+}
+
+func subsListCommand(args []string) error {
+	c := newCommand("subs list")
+	// The flags are the query parameters of /admin/subscriptions with
+	// dashes: --user-id, --min-price and so on.
+	params := []struct{ name, usage string }{
+		{"user_id", "user id"},
+		{"service_name", "service name"},
+		{"min_price", "minimal price"},
+		{"max_price", "maximal price"},
+		{"active_at", "date the subscription is active at"},
+		{"start_from", "earliest start date"},
+		{"start_to", "latest start date"},
+		{"end_from", "earliest end date"},
+		{"end_to", "latest end date"},
+		{"sort", "sort field, - prefix for descending order"},
+		{"limit", "page size"},
+		{"offset", "rows to skip"},
+		{"cursor", "next cursor of the previous page"},
+		{"include_deleted", "true to list deleted subscriptions too"},
+	}
+	vals := make(map[string]*string, len(params))
+	for _, p := range params {
+		vals[p.name] = c.fs.String(strings.ReplaceAll(p.name, "_", "-"), "", p.usage)
+	}
+	return c.run(args, func(ctx context.Context, env *cliEnv, args []string) error {
+		if len(args) != 0 {
+			return fmt.Errorf("unexpected arguments %v", args)
+		}
+		q := url.Values{}
+		for name, v := range vals {
+			if *v != "" {
+				q.Set(name, *v)
+			}
+		}
+		input, err := parseListQuery(q)
+		if err != nil {
+			return err
+		}
+		page, err := env.ListSubsUC.ListSubs(ctx, input)
+		if err != nil {
+			return err
+		}
+		resp := SubsPageResponse{
+			Items:      make([]HandlingSub, 0, len(page.Subs)),
+			NextCursor: encodeCursor(page.Next),
+			Total:      page.Total,
+		}
+		for _, s := range page.Subs {
+			resp.Items = append(resp.Items, DeserializeSub(s))
+		}
+		if env.output == OutputJSON {
+			return env.printJSON(resp)
+		}
+		if err := env.printSubs(resp.Items); err != nil {
+			return err
+		}
+		fmt.Fprintf(env.out, "\ntotal: %d\n", resp.Total)
+		if resp.NextCursor != "" {
+			fmt.Fprintf(env.out, "next page: --cursor %s\n", resp.NextCursor)
+		}
+		return nil
+	})
+}
+
+func subsUpdateCommand(args []string) error {
+	c := newCommand("subs update")
+	var req HandlingSub
+	subFlags(c, &req)
+	var version int
+	c.fs.IntVar(&version, "if-version", 0, "update only this version of the subscription")
+	var clearEnd bool
+	c.fs.BoolVar(&clearEnd, "clear-end", false, "remove the end date")
+	return c.run(args, func(ctx context.Context, env *cliEnv, args []string) error {
+		subId, err := subIdArg(args)
+		if err != nil {
+			return err
+		}
+		subDTO, err := SerializeSubUpdate(req)
+		if err != nil {
+			return err
+		}
+		subDTO.Version = version
+		if clearEnd {
+			if subDTO.EndDate != nil {
+				return badRequest("--clear-end and --end are exclusive")
+			}
+			subDTO.EndDate = &time.Time{}
+		}
+		if err := env.UpdateSubUC.UpdateSub(ctx, subId, subDTO); err != nil {
+			return err
+		}
+		return env.printMessage("subscription updated")
+	})
+}
+
+func subsDeleteCommand(args []string) error {
+	c := newCommand("subs delete")
+	var version int
+	c.fs.IntVar(&version, "if-version", 0, "delete only this version of the subscription")
+	return c.run(args, func(ctx context.Context, env *cliEnv, args []string) error {
+		subId, err := subIdArg(args)
+		if err != nil {
+			return err
+		}
+		if err := env.DeleteSubUC.DeleteSub(ctx, subId, version); err != nil {
+			return err
+		}
+		return env.printMessage(fmt.Sprintf("subscription %d deleted", subId))
+	})
+}
+
+func subsRestoreCommand(args []string) error {
+	c := newCommand("subs restore")
+	return c.run(args, func(ctx context.Context, env *cliEnv, args []string) error {
+		subId, err := subIdArg(args)
+		if err != nil {
+			return err
+		}
+		sub, err := env.RestoreSubUC.RestoreSub(ctx, subId)
+		if err != nil {
+			return err
+		}
+		if env.output == OutputJSON {
+			return env.printJSON(DeserializeSub(sub))
+		}
+		return env.printSubs([]HandlingSub{DeserializeSub(sub)})
+	})
+}
+
+// purgeCommand purges once, the way the server does every
+// purge.interval.
+func purgeCommand(args []string) error {
+	c := newCommand("purge")
+	return c.run(args, func(ctx context.Context, env *cliEnv, args []string) error {
+		if len(args) != 0 {
+			return fmt.Errorf("unexpected arguments %v", args)
+		}
+		if !env.purge.Enabled() {
+			return errors.New("purge.retention is not set")
+		}
+		purge, _, err := newPurgeSubsUC(env.purge, env.repo, env.logger)
+		if err != nil {
+			return err
+		}
+		purged, err := purge.Purge(ctx, time.Now())
+		if err != nil {
+			return err
+		}
+		return env.printMessage(fmt.Sprintf("%d subscriptions purged", purged))
+	})
+}
@@ -0,0 +1,112 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/pkg/utils"
+)
+
+// Error codes of ErrorResponse.
+const (
+	CodeBadRequest     = "bad_request"
+	CodeNotFound       = "not_found"
+	CodeConflict       = "conflict"
+	CodeValidation     = "validation_error"
+	CodeImmutableField = "immutable_field"
+	CodePrecondition   = "precondition_failed"
+	CodeKeyReused      = "idempotency_key_reused"
+	CodeUnauthorized   = "unauthorized"
+	CodeForbidden      = "forbidden"
+	CodeInternal       = "internal_error"
+	CodeTimeout        = "timeout"
+	CodeCancelled      = "cancelled"
+	CodeTooLarge       = "too_large"
+)
+
+// StatusClientClosedRequest is written for requests cancelled by the
+// client. Nobody reads it, but it shows up in the access log.
+const StatusClientClosedRequest = 499
+
+// errBadRequest marks requests that could not be read at all,
+// like malformed json or a non-numeric id in the path.
+var errBadRequest = errors.New("bad request")
+
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+}
+
+func badRequest(msg string) error {
+	return &domain.FieldError{Kind: errBadRequest, Msg: msg}
+}
+
+// errorRecorder is a ResponseWriter keeping the errors behind 500s for
+// the access log, as the client doesn't get their details.
+type errorRecorder interface {
+	recordError(err error)
+}
+
+// MakeErrorResponse writes err as ErrorResponse with the status code
+// matching its kind. Errors of unknown kind are reported as 500
+// without details, AccessLogMiddleware logs them.
+func MakeErrorResponse(w http.ResponseWriter, err error) {
+	status, resp := errorResponse(err)
+	if rec, ok := w.(errorRecorder); ok && status == http.StatusInternalServerError {
+		rec.recordError(err)
+	}
+	utils.MakeResponse(w, status, resp)
+}
+
+func errorResponse(err error) (int, ErrorResponse) {
+	resp := ErrorResponse{Message: err.Error()}
+	var fe *domain.FieldError
+	if errors.As(err, &fe) {
+		resp.Message = fe.Msg
+		resp.Field = fe.Field
+	}
+
+	switch {
+	case errors.Is(err, errBadRequest):
+		resp.Code = CodeBadRequest
+		return http.StatusBadRequest, resp
+	case errors.Is(err, domain.ErrNotFound):
+		resp.Code = CodeNotFound
+		return http.StatusNotFound, resp
+	case errors.Is(err, errUnauthorized):
+		resp.Code = CodeUnauthorized
+		return http.StatusUnauthorized, resp
+	case errors.Is(err, domain.ErrForbidden):
+		resp.Code = CodeForbidden
+		return http.StatusForbidden, resp
+	case errors.Is(err, domain.ErrConflict):
+		resp.Code = CodeConflict
+		return http.StatusConflict, resp
+	case errors.Is(err, domain.ErrPreconditionFailed):
+		resp.Code = CodePrecondition
+		return http.StatusPreconditionFailed, resp
+	case errors.Is(err, domain.ErrKeyReused):
+		resp.Code = CodeKeyReused
+		return http.StatusUnprocessableEntity, resp
+	case errors.Is(err, domain.ErrImmutableField):
+		resp.Code = CodeImmutableField
+		return http.StatusUnprocessableEntity, resp
+	case errors.Is(err, domain.ErrValidation):
+		resp.Code = CodeValidation
+		return http.StatusUnprocessableEntity, resp
+	case errors.As(err, new(*http.MaxBytesError)):
+		resp.Code = CodeTooLarge
+		return http.StatusRequestEntityTooLarge, resp
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, ErrorResponse{Code: CodeTimeout, Message: "request timed out"}
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest, ErrorResponse{Code: CodeCancelled, Message: "request cancelled"}
+	}
+	return http.StatusInternalServerError, ErrorResponse{
+		Code:    CodeInternal,
+		Message: "internal server error",
+	}
+}
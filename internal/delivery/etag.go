@@ -0,0 +1,55 @@
+package delivery
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+)
+
+// Headers of the optimistic locking of subscriptions.
+const (
+	HeaderETag    = "ETag"
+	HeaderIfMatch = "If-Match"
+)
+
+// subETag is the entity tag of a version of a subscription.
+func subETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// setSubETag tags a response holding sub.
+func setSubETag(w http.ResponseWriter, sub HandlingSub) {
+	if sub.Version > 0 {
+		w.Header().Set(HeaderETag, subETag(sub.Version))
+	}
+}
+
+// ifMatchVersion reads the version an If-Match header asks to change,
+// zero when there is no header or it is "*". One entity tag is taken.
+// Weak and foreign tags never match the strong ones of subETag, so they
+// fail the precondition right away.
+func ifMatchVersion(r *http.Request) (int, error) {
+	v := strings.TrimSpace(r.Header.Get(HeaderIfMatch))
+	if v == "" || v == "*" {
+		return 0, nil
+	}
+	if strings.Contains(v, ",") {
+		return 0, badRequest("If-Match: only one entity tag is supported")
+	}
+	weak := strings.HasPrefix(v, "W/")
+	tag := strings.TrimPrefix(v, "W/")
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, badRequest("If-Match: malformed entity tag " + v)
+	}
+	version, err := strconv.Atoi(tag[1 : len(tag)-1])
+	if weak || err != nil || version <= 0 {
+		return 0, &domain.FieldError{
+			Kind:  domain.ErrPreconditionFailed,
+			Field: HeaderIfMatch,
+			Msg:   "entity tag " + v + " does not match",
+		}
+	}
+	return version, nil
+}
@@ -0,0 +1,86 @@
+package delivery
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSubETags(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, api *testAPI) {
+		user := uuid.NewString()
+		id := api.createSub(t, user, "Netflix", 100, "07-2025")
+		path := fmt.Sprintf("/subscriptions/%d", id)
+		put := func(price int) string {
+			return fmt.Sprintf(`{"price":%d,"user_id":%q}`, price, user)
+		}
+
+		rec := api.mustDo(t, http.StatusOK, http.MethodGet, path, "")
+		etag := rec.Header().Get(HeaderETag)
+		if etag != `"1"` {
+			t.Fatalf("ETag of a new subscription = %q, want \"1\"", etag)
+		}
+
+		api.mustDo(t, http.StatusOK, http.MethodPut, path, put(200), HeaderIfMatch, etag)
+		if got := api.mustDo(t, http.StatusOK, http.MethodGet, path, "").Header().Get(HeaderETag); got != `"2"` {
+			t.Errorf("ETag after PUT = %q, want \"2\"", got)
+		}
+		rec = api.do(t, http.MethodPut, path, put(300), HeaderIfMatch, etag)
+		if rec.Code != http.StatusPreconditionFailed || errorCode(t, rec) != CodePrecondition {
+			t.Errorf("PUT with stale If-Match = %d %s, want 412", rec.Code, rec.Body)
+		}
+		for _, bad := range []string{`W/"2"`, `"0"`, `"x"`} {
+			if rec := api.do(t, http.MethodPut, path, put(300), HeaderIfMatch, bad); rec.Code != http.StatusPreconditionFailed {
+				t.Errorf("PUT with If-Match %s = %d %s, want 412", bad, rec.Code, rec.Body)
+			}
+		}
+		for _, bad := range []string{`"1", "2"`, `abc`} {
+			if rec := api.do(t, http.MethodPut, path, put(300), HeaderIfMatch, bad); rec.Code != http.StatusBadRequest {
+				t.Errorf("PUT with If-Match %s = %d %s, want 400", bad, rec.Code, rec.Body)
+			}
+		}
+		if sub := api.getSub(t, id); sub.Price != 200 || sub.Version != 2 {
+			t.Errorf("after rejected PUTs = %+v, want price 200 of version 2", sub)
+		}
+
+		api.mustDo(t, http.StatusOK, http.MethodPut, path, put(300), HeaderIfMatch, "*")
+
+		// Only one of concurrent PUTs of version 3 may win.
+		const n = 8
+		codes := make(chan int, n)
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(price int) {
+				defer wg.Done()
+				codes <- api.do(t, http.MethodPut, path, put(price), HeaderIfMatch, `"3"`).Code
+			}(400 + i)
+		}
+		wg.Wait()
+		close(codes)
+		won := 0
+		for code := range codes {
+			switch code {
+			case http.StatusOK:
+				won++
+			case http.StatusPreconditionFailed:
+			default:
+				t.Errorf("concurrent PUT = %d, want 200 or 412", code)
+			}
+		}
+		if won != 1 {
+			t.Errorf("%d concurrent PUTs of one version won, want 1", won)
+		}
+		if rec := api.do(t, http.MethodDelete, path, "", HeaderIfMatch, `"3"`); rec.Code != http.StatusPreconditionFailed {
+			t.Errorf("DELETE with stale If-Match = %d %s, want 412", rec.Code, rec.Body)
+		}
+		api.getSub(t, id)
+		api.mustDo(t, http.StatusNoContent, http.MethodDelete, path, "", HeaderIfMatch, `"4"`)
+		if rec := api.do(t, http.MethodGet, path, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("GET after DELETE = %d, want 404", rec.Code)
+		}
+	})
+}
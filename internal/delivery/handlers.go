@@ -2,12 +2,11 @@ package delivery
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,8 +17,6 @@ import (
 	"github.com/samantonio28/subscriber-inf/pkg/utils"
 )
 
-var ZeroDateString = "01-0001"
-
 type SubsHandler struct {
 	CreateSubUC  usecase.CreateSubUC
 	DeleteSubUC  usecase.DeleteSubUC
@@ -27,15 +24,29 @@ type SubsHandler struct {
 	GetSubsUC    usecase.GetSubsUC
 	TotalCostsUC usecase.TotalCostsUC
 	UpdateSubUC  usecase.UpdateSubUC
+	ListSubsUC   usecase.ListSubsUC
+	ImportSubsUC usecase.ImportSubsUC
+	BatchSubsUC  usecase.BatchSubsUC
+	RestoreSubUC usecase.RestoreSubUC
+	SubHistoryUC usecase.SubHistoryUC
+	AuditLogUC   usecase.AuditLogUC
 	logger       *logger.LogrusLogger
 }
 
 type HandlingSub struct {
-	ServiceName string `json:"service_name"`
-	Price       int    `json:"price"`
-	UserId      string `json:"user_id"`
-	StartDate   string `json:"start_date"`
-	EndDate     string `json:"end_date"`
+	SubId         int    `json:"sub_id,omitempty"`
+	ServiceName   string `json:"service_name"`
+	Price         int    `json:"price"`
+	Currency      string `json:"currency"`
+	BillingPeriod string `json:"billing_period"`
+	UserId        string `json:"user_id"`
+	StartDate     string `json:"start_date"`
+	EndDate       string `json:"end_date"`
+	// DeletedAt is set in responses for soft-deleted subscriptions.
+	DeletedAt string `json:"deleted_at,omitempty"`
+	// Version is set in responses, it is ignored in requests: updates
+	// and deletes take it in If-Match.
+	Version int `json:"version,omitempty"`
 }
 
 type CostsFilter struct {
@@ -45,10 +56,36 @@ type CostsFilter struct {
 		UserId      string `json:"user_id"`
 		ServiceName string `json:"service_name"`
 	} `json:"filter"`
+	GroupBy string `json:"group_by"`
+	// Currency is the currency of the report, RUB by default.
+	Currency string `json:"currency"`
+	// ProRata bills the days of billing periods within the period
+	// instead of whole periods starting in it.
+	ProRata bool `json:"pro_rata"`
+}
+
+type SubCost struct {
+	SubId    int    `json:"sub_id"`
+	Amount   int    `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+type MonthCosts struct {
+	Month    string    `json:"month"`
+	TotalSum float64   `json:"total_sum"`
+	Subs     []SubCost `json:"subs"`
+}
+
+type CostsGroup struct {
+	Key      string  `json:"key"`
+	TotalSum float64 `json:"total_sum"`
+	SubIds   []int   `json:"sub_ids"`
 }
 
-func NewSubsHandler(repo domain.SubscriptionRepository, logger *logger.LogrusLogger) (*SubsHandler, error) {
-	createSubUC, err := usecase.NewCreateSubUC(repo, logger)
+// NewSubsHandler returns the handlers of repo, an Idempotency-Key
+// replays its creation for keyTTL.
+func NewSubsHandler(repo domain.SubscriptionRepository, rates domain.RateProvider, keyTTL time.Duration, logger *logger.LogrusLogger) (*SubsHandler, error) {
+	createSubUC, err := usecase.NewCreateSubUC(repo, logger, keyTTL)
 	if err != nil {
 		return nil, err
 	}
@@ -64,7 +101,7 @@ func NewSubsHandler(repo domain.SubscriptionRepository, logger *logger.LogrusLog
 	if err != nil {
 		return nil, err
 	}
-	totalCostsUC, err := usecase.NewTotalCostsUC(repo, logger)
+	totalCostsUC, err := usecase.NewTotalCostsUC(repo, rates, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -72,6 +109,30 @@ func NewSubsHandler(repo domain.SubscriptionRepository, logger *logger.LogrusLog
 	if err != nil {
 		return nil, err
 	}
+	listSubsUC, err := usecase.NewListSubsUC(repo, logger)
+	if err != nil {
+		return nil, err
+	}
+	importSubsUC, err := usecase.NewImportSubsUC(repo, logger)
+	if err != nil {
+		return nil, err
+	}
+	batchSubsUC, err := usecase.NewBatchSubsUC(repo, logger)
+	if err != nil {
+		return nil, err
+	}
+	restoreSubUC, err := usecase.NewRestoreSubUC(repo, logger)
+	if err != nil {
+		return nil, err
+	}
+	subHistoryUC, err := usecase.NewSubHistoryUC(repo, logger)
+	if err != nil {
+		return nil, err
+	}
+	auditLogUC, err := usecase.NewAuditLogUC(repo, logger)
+	if err != nil {
+		return nil, err
+	}
 	return &SubsHandler{
 		CreateSubUC:  *createSubUC,
 		DeleteSubUC:  *deleteSubUC,
@@ -79,6 +140,12 @@ func NewSubsHandler(repo domain.SubscriptionRepository, logger *logger.LogrusLog
 		GetSubsUC:    *getSubsUC,
 		TotalCostsUC: *totalCostsUC,
 		UpdateSubUC:  *updateSubUC,
+		ListSubsUC:   *listSubsUC,
+		ImportSubsUC: *importSubsUC,
+		BatchSubsUC:  *batchSubsUC,
+		RestoreSubUC: *restoreSubUC,
+		SubHistoryUC: *subHistoryUC,
+		AuditLogUC:   *auditLogUC,
 		logger:       logger,
 	}, nil
 }
@@ -86,69 +153,195 @@ func NewSubsHandler(repo domain.SubscriptionRepository, logger *logger.LogrusLog
 func SerializeSub(req HandlingSub) (usecase.SubscriptionDTO, error) {
 	var err error
 	if req.ServiceName == "" {
-		return usecase.SubscriptionDTO{}, fmt.Errorf("service name mustn't be empty")
+		return usecase.SubscriptionDTO{}, domain.NewValidationError("service_name", "mustn't be empty")
 	}
 	if req.Price < 0 {
-		return usecase.SubscriptionDTO{}, fmt.Errorf("price must be zero or positive")
+		return usecase.SubscriptionDTO{}, domain.NewValidationError("price", "must be zero or positive")
+	}
+	currency := strings.ToUpper(req.Currency)
+	if currency == "" {
+		currency = domain.DefaultCurrency
+	}
+	billingPeriod := strings.ToLower(req.BillingPeriod)
+	if billingPeriod == "" {
+		billingPeriod = string(domain.DefaultBillingPeriod)
 	}
 
 	var uID uuid.UUID
 	if req.UserId != "" {
 		uID, err = uuid.Parse(req.UserId)
 		if err != nil {
-			return usecase.SubscriptionDTO{}, fmt.Errorf("can't parse uuid: %v", err)
+			return usecase.SubscriptionDTO{}, domain.NewValidationError("user_id", "can't parse uuid: "+err.Error())
 		}
 	} else {
 		uID = uuid.Nil
 	}
 
-	stDate, err := utils.ParseMonthYear(req.StartDate)
+	stDate, err := utils.ParseDate(req.StartDate)
 	if err != nil {
-		return usecase.SubscriptionDTO{}, fmt.Errorf("parsing start date: %v", err)
+		return usecase.SubscriptionDTO{}, domain.NewValidationError("start_date", err.Error())
 	}
 	var enDate time.Time
 	if req.EndDate != "" {
-		enDate, err = utils.ParseMonthYear(req.EndDate)
+		enDate, err = utils.ParseDate(req.EndDate)
 		if err != nil {
-			return usecase.SubscriptionDTO{}, fmt.Errorf("parsing end date: %v", err)
+			return usecase.SubscriptionDTO{}, domain.NewValidationError("end_date", err.Error())
 		}
-	} else {
-		enDate, _ = utils.ParseMonthYear(ZeroDateString)
 	}
 
 	subDTO := usecase.SubscriptionDTO{
-		SubId:       0,
-		UserId:      uID,
-		ServiceName: req.ServiceName,
-		Price:       req.Price,
+		SubId:         0,
+		UserId:        uID,
+		ServiceName:   req.ServiceName,
+		Price:         req.Price,
+		Currency:      currency,
+		BillingPeriod: billingPeriod,
+		StartDate:     stDate,
+		EndDate:       enDate,
+	}
+	return subDTO, nil
+}
+
+// SerializeSubUpdate reads the fields of a PUT: empty ones and a zero
+// price are left as they are. user_id is required.
+func SerializeSubUpdate(req HandlingSub) (usecase.SubscriptionPatchDTO, error) {
+	var dto usecase.SubscriptionPatchDTO
+	var uID uuid.UUID
+	if req.UserId != "" {
+		var err error
+		uID, err = uuid.Parse(req.UserId)
+		if err != nil {
+			return dto, domain.NewValidationError("user_id", "can't parse uuid: "+err.Error())
+		}
+	}
+	dto.UserId = &uID
+	if req.ServiceName != "" {
+		dto.ServiceName = &req.ServiceName
+	}
+	if req.Price != 0 {
+		dto.Price = &req.Price
+	}
+	if req.Currency != "" {
+		currency := strings.ToUpper(req.Currency)
+		dto.Currency = &currency
+	}
+	if req.BillingPeriod != "" {
+		period := strings.ToLower(req.BillingPeriod)
+		dto.BillingPeriod = &period
+	}
+	if req.StartDate != "" {
+		stDate, err := utils.ParseDate(req.StartDate)
+		if err != nil {
+			return dto, domain.NewValidationError("start_date", err.Error())
+		}
+		dto.StartDate = &stDate
+	}
+	if req.EndDate != "" {
+		enDate, err := utils.ParseDate(req.EndDate)
+		if err != nil {
+			return dto, domain.NewValidationError("end_date", err.Error())
+		}
+		dto.EndDate = &enDate
+	}
+	return dto, nil
+}
+
+func DeserializeSub(sub usecase.SubscriptionDTO) HandlingSub {
+	var deletedAt string
+	if !sub.DeletedAt.IsZero() {
+		deletedAt = sub.DeletedAt.UTC().Format(time.RFC3339)
+	}
+	return HandlingSub{
+		SubId:         sub.SubId,
+		ServiceName:   sub.ServiceName,
+		Price:         sub.Price,
+		Currency:      sub.Currency,
+		BillingPeriod: sub.BillingPeriod,
+		UserId:        sub.UserId.String(),
+		StartDate:     utils.FormatDate(sub.StartDate),
+		EndDate:       utils.FormatDate(sub.EndDate),
+		DeletedAt:     deletedAt,
+		Version:       sub.Version,
+	}
+}
+
+func SerializeCostsFilter(req CostsFilter) (usecase.SubsFilterDTO, error) {
+	stDate, err := utils.ParseDate(req.StartDate)
+	if err != nil {
+		return usecase.SubsFilterDTO{}, domain.NewValidationError("start_date", err.Error())
+	}
+	var enDate time.Time
+	if req.EndDate != "" {
+		enDate, err = utils.ParseDate(req.EndDate)
+		if err != nil {
+			return usecase.SubsFilterDTO{}, domain.NewValidationError("end_date", err.Error())
+		}
+	}
+
+	var uID uuid.UUID
+	if req.Filter.UserId != "" {
+		uID, err = uuid.Parse(req.Filter.UserId)
+		if err != nil {
+			return usecase.SubsFilterDTO{}, domain.NewValidationError("filter.user_id", "can't parse uuid: "+err.Error())
+		}
+	} else {
+		uID = uuid.Nil
+	}
+	return usecase.SubsFilterDTO{
 		StartDate:   stDate,
 		EndDate:     enDate,
+		UserID:      uID,
+		ServiceName: req.Filter.ServiceName,
+		ProRata:     req.ProRata,
+	}, nil
+}
+
+// subIdFromPath reads the {id} route variable.
+func subIdFromPath(r *http.Request) (int, error) {
+	subIdSt, ok := mux.Vars(r)["id"]
+	if !ok {
+		return 0, badRequest("has no valid id in query")
 	}
-	return subDTO, nil
+	subId, err := strconv.Atoi(subIdSt)
+	if err != nil {
+		return 0, badRequest("invalid sub id: " + err.Error())
+	}
+	return subId, nil
 }
 
+// Headers of the retries of creations. A request repeating the one
+// that first sent the key is answered with the same sub_id and
+// Idempotent-Replayed set.
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	HeaderReplayed       = "Idempotent-Replayed"
+)
+
 func (h *SubsHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
-	var err error
 	var req HandlingSub
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-			"message": "invalid json",
-		})
+		MakeErrorResponse(w, badRequest("invalid json"))
+		return
 	}
 
 	subDTO, err := SerializeSub(req)
 	if err != nil {
-		utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-			"message": "bad with serializing sub: " + err.Error(),
-		})
+		MakeErrorResponse(w, err)
 		return
 	}
 
-	subId, err := h.CreateSubUC.NewSub(context.Background(), subDTO)
+	var subId int
+	if key := r.Header.Get(HeaderIdempotencyKey); key != "" {
+		var replayed bool
+		subId, replayed, err = h.CreateSubUC.NewSubOnce(r.Context(), key, subDTO)
+		if replayed {
+			w.Header().Set(HeaderReplayed, "true")
+		}
+	} else {
+		subId, err = h.CreateSubUC.NewSub(r.Context(), subDTO)
+	}
 	if err != nil {
-		utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-			"message": "bad with creating new sub: " + err.Error(),
-		})
+		MakeErrorResponse(w, err)
 		return
 	}
 	utils.MakeResponse(w, http.StatusCreated, map[string]string{
@@ -157,32 +350,19 @@ func (h *SubsHandler) CreateSubscription(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *SubsHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	subIdSt, ok := vars["id"]
-	if !ok {
-		utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-			"message": "has no valid id in query",
-		})
+	subId, err := subIdFromPath(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
 		return
 	}
-	subId, err := strconv.Atoi(subIdSt)
+	version, err := ifMatchVersion(r)
 	if err != nil {
-		utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-			"message": "has no valid id in query:" + err.Error(),
-		})
+		MakeErrorResponse(w, err)
 		return
 	}
-	err = h.DeleteSubUC.DeleteSub(context.Background(), subId)
+	err = h.DeleteSubUC.DeleteSub(r.Context(), subId, version)
 	if err != nil {
-		if err.Error() == "no subs deleted" {
-			utils.MakeResponse(w, http.StatusNotFound, map[string]string{
-				"message": "bad deleting sub:" + err.Error(),
-			})
-			return
-		}
-		utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-			"message": "bad deleting sub:" + err.Error(),
-		})
+		MakeErrorResponse(w, err)
 		return
 	}
 	utils.MakeResponse(w, http.StatusNoContent, map[string]string{
@@ -191,219 +371,239 @@ func (h *SubsHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *SubsHandler) GetSubscription(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	subIdSt, ok := vars["id"]
-	if !ok {
-		utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-			"message": "has no valid id in query",
-		})
+	subId, err := subIdFromPath(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
 		return
 	}
-	subId, err := strconv.Atoi(subIdSt)
+	includeDeleted, err := boolParam(r.URL.Query(), "include_deleted")
 	if err != nil {
-		utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-			"message": "bad sub id: " + err.Error(),
-		})
+		MakeErrorResponse(w, err)
 		return
 	}
-	sub, err := h.GetSubUC.SubById(context.Background(), subId)
+	sub, err := h.GetSubUC.SubById(r.Context(), subId, includeDeleted)
 	if err != nil {
-		utils.MakeResponse(w, http.StatusNotFound, map[string]string{
-			"message": "bad getting sub: " + err.Error(),
-		})
+		MakeErrorResponse(w, err)
 		return
 	}
 
-	stDate := utils.DateString(sub.StartDate)
-	enDate := utils.DateString(sub.EndDate)
-
-	hSub := HandlingSub{
-		ServiceName: sub.ServiceName,
-		Price:       sub.Price,
-		UserId:      sub.UserId.String(),
-		StartDate:   stDate,
-		EndDate:     enDate,
-	}
-	utils.MakeResponse(w, http.StatusOK, hSub)
+	resp := DeserializeSub(sub)
+	setSubETag(w, resp)
+	utils.MakeResponse(w, http.StatusOK, resp)
 }
 
 func (h *SubsHandler) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
 	userId, err := uuid.Parse(r.URL.Query().Get("uuid"))
 	if err != nil {
-		utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-			"message": "invalid user id: " + err.Error(),
-		})
+		MakeErrorResponse(w, domain.NewValidationError("uuid", "invalid user id: "+err.Error()))
 		return
 	}
-	subs, err := h.GetSubsUC.SubsByUserId(context.Background(), userId)
+	includeDeleted, err := boolParam(r.URL.Query(), "include_deleted")
 	if err != nil {
-		utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-			"message": "bad getting subs: " + err.Error(),
-		})
+		MakeErrorResponse(w, err)
+		return
+	}
+	subs, err := h.GetSubsUC.SubsByUserId(r.Context(), userId, includeDeleted)
+	if err != nil {
+		MakeErrorResponse(w, err)
 		return
 	}
 	hSubs := make([]HandlingSub, 0, len(subs))
 	for _, s := range subs {
-		stDate := utils.DateString(s.StartDate)
-		enDate := utils.DateString(s.EndDate)
-
-		hSub := HandlingSub{
-			ServiceName: s.ServiceName,
-			Price:       s.Price,
-			UserId:      s.UserId.String(),
-			StartDate:   stDate,
-			EndDate:     enDate,
-		}
-		hSubs = append(hSubs, hSub)
+		hSubs = append(hSubs, DeserializeSub(s))
 	}
 	utils.MakeResponse(w, http.StatusOK, hSubs)
 }
 
-func (h *SubsHandler) GetTotalCosts(w http.ResponseWriter, r *http.Request) {
-	var req CostsFilter
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-			"message": "invalid json",
-		})
+// RestoreSubscription brings back a deleted subscription until it is
+// purged.
+func (h *SubsHandler) RestoreSubscription(w http.ResponseWriter, r *http.Request) {
+	subId, err := subIdFromPath(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
 		return
 	}
-	stDate, err := utils.ParseMonthYear(req.StartDate)
+	sub, err := h.RestoreSubUC.RestoreSub(r.Context(), subId)
 	if err != nil {
-		utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-			"message": "bad start date: " + err.Error(),
-		})
+		MakeErrorResponse(w, err)
 		return
 	}
-	var enDate time.Time
-	if req.EndDate != "" {
-		enDate, err = utils.ParseMonthYear(req.EndDate)
-		if err != nil {
-			utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-				"message": "parsing end date: " + err.Error(),
-			})
-			return
-		}
-	} else {
-		enDate, _ = utils.ParseMonthYear(ZeroDateString)
-	}
+	resp := DeserializeSub(sub)
+	setSubETag(w, resp)
+	utils.MakeResponse(w, http.StatusOK, resp)
+}
 
-	if req.Filter.ServiceName == "" {
-		utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-			"message": "service name mustn't be empty",
-		})
+func (h *SubsHandler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	input, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		MakeErrorResponse(w, err)
 		return
 	}
-	var uID uuid.UUID
-	if req.Filter.UserId != "" {
-		uID, err = uuid.Parse(req.Filter.UserId)
-		if err != nil {
-			utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-				"message": "can't parse uuid:" + err.Error(),
-			})
-			return
-		}
-	} else {
-		uID = uuid.Nil
-	}
-	filter := usecase.SubsFilterDTO{
-		StartDate:   stDate,
-		EndDate:     enDate,
-		UserID:      uID,
-		ServiceName: req.Filter.ServiceName,
-	}
-	sum, subIds, err := h.TotalCostsUC.TotalCosts(context.Background(), filter)
+	page, err := h.ListSubsUC.ListSubs(r.Context(), input)
 	if err != nil {
-		utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-			"message": "bad getting total costs: " + err.Error(),
-		})
+		MakeErrorResponse(w, err)
 		return
 	}
-	var ans struct {
-		TotalSum int   `json:"total_sum"`
-		SubIds   []int `json:"sub_ids"`
+	resp := SubsPageResponse{
+		Items:      make([]HandlingSub, 0, len(page.Subs)),
+		NextCursor: encodeCursor(page.Next),
+		Total:      page.Total,
 	}
-	ans.TotalSum = sum
-	ans.SubIds = subIds
-	utils.MakeResponse(w, http.StatusOK, ans)
+	for _, s := range page.Subs {
+		resp.Items = append(resp.Items, DeserializeSub(s))
+	}
+	utils.MakeResponse(w, http.StatusOK, resp)
 }
 
-func (h *SubsHandler) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
-	var req HandlingSub
+// TotalCostsResponse is the answer of /total_costs.
+type TotalCostsResponse struct {
+	TotalSum float64            `json:"total_sum"`
+	Currency string             `json:"currency"`
+	Rates    map[string]float64 `json:"rates"`
+	SubIds   []int              `json:"sub_ids"`
+	GroupBy  string             `json:"group_by,omitempty"`
+	Groups   []CostsGroup       `json:"groups,omitempty"`
+}
+
+// TimeSeriesResponse is the answer of /total_costs/timeseries.
+type TimeSeriesResponse struct {
+	TotalSum float64            `json:"total_sum"`
+	Currency string             `json:"currency"`
+	Rates    map[string]float64 `json:"rates"`
+	Months   []MonthCosts       `json:"months"`
+}
+
+func (h *SubsHandler) GetTotalCosts(w http.ResponseWriter, r *http.Request) {
+	var req CostsFilter
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-			"message": "invalid json",
-		})
+		MakeErrorResponse(w, badRequest("invalid json"))
 		return
 	}
-	vars := mux.Vars(r)
-	subId, err := strconv.Atoi(vars["id"])
+	ans, err := h.totalCosts(r.Context(), req)
 	if err != nil {
-		utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-			"message": "invalid sub id: " + err.Error(),
-		})
+		MakeErrorResponse(w, err)
 		return
 	}
+	utils.MakeResponse(w, http.StatusOK, ans)
+}
 
-	if req.ServiceName == "" {
-		req.ServiceName = " "
+func (h *SubsHandler) totalCosts(ctx context.Context, req CostsFilter) (TotalCostsResponse, error) {
+	filter, err := SerializeCostsFilter(req)
+	if err != nil {
+		return TotalCostsResponse{}, err
+	}
+	if req.GroupBy != "" {
+		return h.costsByGroup(ctx, filter, req)
+	}
+	costs, err := h.TotalCostsUC.TotalCosts(ctx, filter, strings.ToUpper(req.Currency))
+	if err != nil {
+		return TotalCostsResponse{}, err
 	}
+	return TotalCostsResponse{
+		TotalSum: costs.Total,
+		Currency: costs.Currency,
+		Rates:    costs.Rates,
+		SubIds:   costs.SubIds,
+	}, nil
+}
 
-	var uID uuid.UUID
-	if req.UserId != "" {
-		uID, err = uuid.Parse(req.UserId)
-		if err != nil {
-			utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-				"message": "can't parse uuid: " + err.Error(),
-			})
-			return
-		}
-	} else {
-		uID = uuid.Nil
+// costsByGroup answers a costs request with group_by: the total is the
+// sum of the groups, so both are of the same data.
+func (h *SubsHandler) costsByGroup(ctx context.Context, filter usecase.SubsFilterDTO, req CostsFilter) (TotalCostsResponse, error) {
+	costs, groups, err := h.TotalCostsUC.CostsByGroup(ctx, filter, req.GroupBy, strings.ToUpper(req.Currency))
+	if err != nil {
+		return TotalCostsResponse{}, err
+	}
+	ans := TotalCostsResponse{
+		TotalSum: costs.Total,
+		Currency: costs.Currency,
+		Rates:    costs.Rates,
+		SubIds:   costs.SubIds,
+		GroupBy:  req.GroupBy,
+		Groups:   make([]CostsGroup, 0, len(groups)),
+	}
+	for _, g := range groups {
+		ans.Groups = append(ans.Groups, CostsGroup{
+			Key:      g.Key,
+			TotalSum: g.Total,
+			SubIds:   g.SubIds,
+		})
 	}
+	return ans, nil
+}
 
-	stDate, err := utils.ParseMonthYear(req.StartDate)
+func (h *SubsHandler) GetTotalCostsTimeSeries(w http.ResponseWriter, r *http.Request) {
+	var req CostsFilter
+	q := r.URL.Query()
+	req.StartDate = q.Get("start_date")
+	req.EndDate = q.Get("end_date")
+	req.Filter.UserId = q.Get("user_id")
+	req.Filter.ServiceName = q.Get("service_name")
+	req.Currency = q.Get("currency")
+
+	ans, err := h.timeSeries(r.Context(), req)
 	if err != nil {
-		if err.Error() == "empty date" {
-			stDate, _ = utils.ParseMonthYear(ZeroDateString)
-		} else {
-			utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-				"message": "bad parsing start date: " + err.Error(),
-			})
-			return
-		}
+		MakeErrorResponse(w, err)
+		return
 	}
-	var enDate time.Time
-	if req.EndDate != "" {
-		enDate, err = utils.ParseMonthYear(req.EndDate)
-		if err != nil && err.Error() != "empty date" {
-			utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-				"message": "bad parsing end date: " + err.Error(),
-			})
-			return
+	utils.MakeResponse(w, http.StatusOK, ans)
+}
+
+func (h *SubsHandler) timeSeries(ctx context.Context, req CostsFilter) (TimeSeriesResponse, error) {
+	filter, err := SerializeCostsFilter(req)
+	if err != nil {
+		return TimeSeriesResponse{}, err
+	}
+	series, err := h.TotalCostsUC.TimeSeries(ctx, filter, strings.ToUpper(req.Currency))
+	if err != nil {
+		return TimeSeriesResponse{}, err
+	}
+
+	ans := TimeSeriesResponse{
+		TotalSum: series.Total,
+		Currency: series.Currency,
+		Rates:    series.Rates,
+		Months:   make([]MonthCosts, 0, len(series.Months)),
+	}
+	for _, mc := range series.Months {
+		m := MonthCosts{
+			Month:    utils.DateString(mc.Month),
+			TotalSum: mc.Total,
+			Subs:     make([]SubCost, 0, len(mc.Subs)),
 		}
-	} else {
-		enDate, _ = utils.ParseMonthYear(ZeroDateString)
+		for _, s := range mc.Subs {
+			m.Subs = append(m.Subs, SubCost{SubId: s.SubId, Amount: s.Amount, Currency: s.Currency})
+		}
+		ans.Months = append(ans.Months, m)
 	}
+	return ans, nil
+}
 
-	subDTO := usecase.SubscriptionDTO{
-		SubId:       0,
-		UserId:      uID,
-		ServiceName: req.ServiceName,
-		Price:       req.Price,
-		StartDate:   stDate,
-		EndDate:     enDate,
+func (h *SubsHandler) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
+	var req HandlingSub
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		MakeErrorResponse(w, badRequest("invalid json"))
+		return
+	}
+	subId, err := subIdFromPath(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
 	}
 
-	if err := h.UpdateSubUC.UpdateSub(context.Background(), subId, subDTO); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			utils.MakeResponse(w, http.StatusNotFound, map[string]string{
-				"message": "subscription not found",
-			})
-			return
-		}
-		utils.MakeResponse(w, http.StatusBadRequest, map[string]string{
-			"message": "bad updating sub: " + err.Error(),
-		})
+	subDTO, err := SerializeSubUpdate(req)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	subDTO.Version, err = ifMatchVersion(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+
+	if err := h.UpdateSubUC.UpdateSub(r.Context(), subId, subDTO); err != nil {
+		MakeErrorResponse(w, err)
 		return
 	}
 	utils.MakeResponse(w, http.StatusOK, map[string]string{
@@ -0,0 +1,88 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samantonio28/subscriber-inf/internal/usecase"
+)
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, api *testAPI) {
+		user := uuid.NewString()
+		deleted := api.createSub(t, user, "Netflix", 100, "07-2025")
+		kept := api.createSub(t, user, "Spotify", 50, "07-2025")
+		path := fmt.Sprintf("/subscriptions/%d", deleted)
+
+		api.mustDo(t, http.StatusNoContent, http.MethodDelete, path, "")
+		if rec := api.do(t, http.MethodGet, path, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("GET of deleted = %d, want 404", rec.Code)
+		}
+		if rec := api.do(t, http.MethodDelete, path, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("second DELETE = %d, want 404", rec.Code)
+		}
+		var sub HandlingSub
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, path+"?include_deleted=true", ""), &sub)
+		if sub.DeletedAt == "" {
+			t.Errorf("deleted subscription = %+v, want deleted_at", sub)
+		}
+
+		var subs []HandlingSub
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, "/subscriptions?uuid="+user, ""), &subs)
+		if len(subs) != 1 || subs[0].SubId != kept {
+			t.Errorf("subscriptions of user = %+v, want only %d", subs, kept)
+		}
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, "/subscriptions?include_deleted=true&uuid="+user, ""), &subs)
+		if len(subs) != 2 {
+			t.Errorf("subscriptions of user with deleted = %+v, want 2", subs)
+		}
+
+		var restored HandlingSub
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodPost, path+"/restore", ""), &restored)
+		if restored.SubId != deleted || restored.DeletedAt != "" || restored.Price != 100 {
+			t.Errorf("restored = %+v", restored)
+		}
+		api.getSub(t, deleted)
+		rec := api.do(t, http.MethodPost, path+"/restore", "")
+		if rec.Code != http.StatusConflict || errorCode(t, rec) != CodeConflict {
+			t.Errorf("restore of not deleted = %d %s, want 409", rec.Code, rec.Body)
+		}
+		if rec := api.do(t, http.MethodPost, fmt.Sprintf("/subscriptions/%d/restore", kept+100), ""); rec.Code != http.StatusNotFound {
+			t.Errorf("restore of missing = %d, want 404", rec.Code)
+		}
+	})
+}
+
+func TestPurgeSubs(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, api *testAPI) {
+		user := uuid.NewString()
+		deleted := api.createSub(t, user, "Netflix", 100, "07-2025")
+		kept := api.createSub(t, user, "Spotify", 50, "07-2025")
+		path := fmt.Sprintf("/subscriptions/%d", deleted)
+		api.mustDo(t, http.StatusNoContent, http.MethodDelete, path, "")
+
+		purge, err := usecase.NewPurgeSubsUC(api.repo, api.logger, time.Hour)
+		if err != nil {
+			t.Fatalf("NewPurgeSubsUC(): %v", err)
+		}
+		if n, err := purge.Purge(context.Background(), time.Now()); err != nil || n != 0 {
+			t.Errorf("Purge() within retention = %d, %v, want 0", n, err)
+		}
+		api.mustDo(t, http.StatusOK, http.MethodGet, path+"?include_deleted=true", "")
+
+		if n, err := purge.Purge(context.Background(), time.Now().Add(2*time.Hour)); err != nil || n != 1 {
+			t.Errorf("Purge() after retention = %d, %v, want 1", n, err)
+		}
+		if rec := api.do(t, http.MethodGet, path+"?include_deleted=true", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("GET of purged = %d, want 404", rec.Code)
+		}
+		if rec := api.do(t, http.MethodPost, path+"/restore", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("restore of purged = %d, want 404", rec.Code)
+		}
+		api.getSub(t, kept)
+	})
+}
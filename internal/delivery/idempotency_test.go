@@ -0,0 +1,91 @@
+package delivery
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestIdempotentCreate(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, api *testAPI) {
+		user := uuid.NewString()
+		body := fmt.Sprintf(`{"service_name":"Netflix","price":100,"user_id":%q,"start_date":"07-2025"}`, user)
+		create := func(key, body string) *httptest.ResponseRecorder {
+			t.Helper()
+			return api.do(t, http.MethodPost, "/subscriptions", body, HeaderIdempotencyKey, key)
+		}
+
+		rec := create("a", body)
+		if rec.Code != http.StatusCreated || rec.Header().Get(HeaderReplayed) != "" {
+			t.Fatalf("first create = %d %v %s, want 201", rec.Code, rec.Header(), rec.Body)
+		}
+		id := createdSubId(t, rec)
+
+		// The same request written differently is replayed.
+		same := fmt.Sprintf(`{ "price": 100, "start_date": "07-2025", "user_id": %q, "service_name": "Netflix" }`, user)
+		rec = create("a", same)
+		if rec.Code != http.StatusCreated || rec.Header().Get(HeaderReplayed) != "true" || createdSubId(t, rec) != id {
+			t.Errorf("replayed create = %d %v %s, want 201 of %d", rec.Code, rec.Header(), rec.Body, id)
+		}
+
+		rec = create("a", strings.Replace(body, "100", "200", 1))
+		if rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != CodeKeyReused {
+			t.Errorf("create reusing the key = %d %s, want 422 %s", rec.Code, rec.Body, CodeKeyReused)
+		}
+		if rec := create(strings.Repeat("b", 256), body); rec.Code == http.StatusCreated {
+			t.Errorf("create with a too long key = %d %s", rec.Code, rec.Body)
+		}
+
+		// Failed requests don't take the key.
+		if rec := create("c", strings.Replace(body, "100", "-1", 1)); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("invalid create = %d %s, want 422", rec.Code, rec.Body)
+		}
+		rec = create("c", body)
+		if rec.Code != http.StatusCreated || rec.Header().Get(HeaderReplayed) != "" || createdSubId(t, rec) == id {
+			t.Errorf("create after a failed one = %d %v %s, want a new subscription", rec.Code, rec.Header(), rec.Body)
+		}
+
+		// Concurrent requests with one key create one subscription.
+		const n = 8
+		ids := make(chan int, n)
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rec := create("d", body)
+				if rec.Code != http.StatusCreated {
+					t.Errorf("concurrent create = %d %s, want 201", rec.Code, rec.Body)
+					return
+				}
+				id, err := parseCreatedSubId(rec)
+				if err != nil {
+					t.Errorf("concurrent create answered %s: %v", rec.Body, err)
+				}
+				ids <- id
+			}()
+		}
+		wg.Wait()
+		close(ids)
+		first := 0
+		for id := range ids {
+			if first == 0 {
+				first = id
+			}
+			if id != first {
+				t.Errorf("concurrent creates with one key made subscriptions %d and %d", first, id)
+			}
+		}
+
+		var subs []HandlingSub
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, "/subscriptions?uuid="+user, ""), &subs)
+		if len(subs) != 3 {
+			t.Errorf("user has %d subscriptions, want 3", len(subs))
+		}
+	})
+}
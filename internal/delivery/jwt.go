@@ -0,0 +1,277 @@
+package delivery
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Signing algorithms of the bearer tokens.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+)
+
+// Smallest keys accepted in a JWKS: RFC 7518 requires HMAC keys of the
+// hash size at least, RSA keys shorter than 2048 bits are breakable.
+const (
+	minHMACKeyLen = sha256.Size
+	minRSAKeyBits = 2048
+)
+
+// jwk is a verification key of a JWKS.
+type jwk struct {
+	kid  string
+	alg  string
+	hmac []byte
+	rsa  *rsa.PublicKey
+}
+
+// jwkJSON is a key as RFC 7517 writes it, the binary fields are
+// base64url without padding.
+type jwkJSON struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKS are the keys verifying bearer tokens: kty oct keys for HS256
+// and RSA keys for RS256. A key is only used with its own algorithm,
+// so a public RSA key can't verify an HS256 token.
+type JWKS struct {
+	keys []jwk
+}
+
+func LoadJWKS(path string) (*JWKS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jwks: %w", err)
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// ParseJWKS reads a JWK set. Encryption keys are skipped, keys of other
+// types or algorithms fail the set.
+func ParseJWKS(data []byte) (*JWKS, error) {
+	var set struct {
+		Keys []jwkJSON `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid jwks: %w", err)
+	}
+	res := &JWKS{}
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := parseJWK(k)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %d of jwks: %w", i, err)
+		}
+		res.keys = append(res.keys, key)
+	}
+	if len(res.keys) == 0 {
+		return nil, errors.New("jwks has no signing keys")
+	}
+	return res, nil
+}
+
+func parseJWK(k jwkJSON) (jwk, error) {
+	key := jwk{kid: k.Kid, alg: k.Alg}
+	switch k.Kty {
+	case "oct":
+		if key.alg == "" {
+			key.alg = AlgHS256
+		}
+		if key.alg != AlgHS256 {
+			return jwk{}, fmt.Errorf("unsupported alg %q of an oct key", k.Alg)
+		}
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return jwk{}, fmt.Errorf("invalid k: %w", err)
+		}
+		if len(secret) < minHMACKeyLen {
+			return jwk{}, fmt.Errorf("k must be at least %d bytes long", minHMACKeyLen)
+		}
+		key.hmac = secret
+	case "RSA":
+		if key.alg == "" {
+			key.alg = AlgRS256
+		}
+		if key.alg != AlgRS256 {
+			return jwk{}, fmt.Errorf("unsupported alg %q of an RSA key", k.Alg)
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return jwk{}, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return jwk{}, fmt.Errorf("invalid e: %w", err)
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return jwk{}, errors.New("invalid e")
+		}
+		key.rsa = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}
+		if key.rsa.N.BitLen() < minRSAKeyBits {
+			return jwk{}, fmt.Errorf("n must be at least %d bits long", minRSAKeyBits)
+		}
+	default:
+		return jwk{}, fmt.Errorf("unsupported kty %q", k.Kty)
+	}
+	return key, nil
+}
+
+// verify checks sig of signed with the key.
+func (k jwk) verify(signed, sig []byte) bool {
+	switch k.alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, k.hmac)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), sig)
+	case AlgRS256:
+		sum := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(k.rsa, crypto.SHA256, sum[:], sig) == nil
+	}
+	return false
+}
+
+// audience is the aud claim, a string or an array of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(data, []byte(`"`)) {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*a = audience{s}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// TokenClaims are the claims of a bearer token the server reads. The
+// times are seconds since the epoch.
+type TokenClaims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	Roles     []string `json:"roles"`
+}
+
+// TokenVerifier verifies JWS compact tokens signed with the keys of a
+// JWKS. Empty issuer and audience are not checked.
+type TokenVerifier struct {
+	keys     *JWKS
+	issuer   string
+	audience string
+	leeway   time.Duration
+	now      func() time.Time
+}
+
+func NewTokenVerifier(keys *JWKS, issuer, audience string, leeway time.Duration) (*TokenVerifier, error) {
+	if keys == nil || len(keys.keys) == 0 {
+		return nil, errors.New("jwks is not defined")
+	}
+	if leeway < 0 {
+		return nil, errors.New("leeway must not be negative")
+	}
+	return &TokenVerifier{keys: keys, issuer: issuer, audience: audience, leeway: leeway, now: time.Now}, nil
+}
+
+// Verify checks the signature and the registered claims of token and
+// returns its claims. Tokens without exp or sub are rejected, so are
+// the unsigned ones.
+func (v *TokenVerifier) Verify(token string) (TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return TokenClaims{}, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return TokenClaims{}, fmt.Errorf("invalid header: %w", err)
+	}
+	if header.Alg != AlgHS256 && header.Alg != AlgRS256 {
+		return TokenClaims{}, fmt.Errorf("unsupported alg %q", header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return TokenClaims{}, errors.New("invalid signature")
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, k := range v.keys.keys {
+		if k.alg != header.Alg || (header.Kid != "" && k.kid != header.Kid) {
+			continue
+		}
+		if verified = k.verify(signed, sig); verified {
+			break
+		}
+	}
+	if !verified {
+		return TokenClaims{}, errors.New("invalid signature")
+	}
+
+	var claims TokenClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return TokenClaims{}, fmt.Errorf("invalid claims: %w", err)
+	}
+	now := v.now()
+	if claims.ExpiresAt == nil {
+		return TokenClaims{}, errors.New("exp is missing")
+	}
+	if !now.Before(unixTime(*claims.ExpiresAt).Add(v.leeway)) {
+		return TokenClaims{}, errors.New("token expired")
+	}
+	if claims.NotBefore != nil && now.Add(v.leeway).Before(unixTime(*claims.NotBefore)) {
+		return TokenClaims{}, errors.New("token not valid yet")
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return TokenClaims{}, errors.New("unexpected iss")
+	}
+	if v.audience != "" && !slices.Contains(claims.Audience, v.audience) {
+		return TokenClaims{}, errors.New("unexpected aud")
+	}
+	if claims.Subject == "" {
+		return TokenClaims{}, errors.New("sub is missing")
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func unixTime(sec float64) time.Time {
+	return time.UnixMilli(int64(sec * 1000))
+}
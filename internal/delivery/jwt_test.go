@@ -0,0 +1,202 @@
+package delivery
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testKeys are the keys the tokens of the tests are signed with.
+type testKeys struct {
+	secret []byte
+	rsa    *rsa.PrivateKey
+	jwks   *JWKS
+}
+
+// newTestKeys returns an HS256 key of kid "hmac" and an RS256 one of kid
+// "rsa".
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey(): %v", err)
+	}
+	keys := testKeys{secret: []byte(strings.Repeat("k", 32)), rsa: key}
+	keys.jwks, err = ParseJWKS([]byte(fmt.Sprintf(`{"keys": [
+		{"kty": "oct", "kid": "hmac", "k": %q},
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": %q, "e": %q},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "", "e": ""}
+	]}`, b64(keys.secret), b64(key.N.Bytes()), b64(big.NewInt(int64(key.E)).Bytes()))))
+	if err != nil {
+		t.Fatalf("ParseJWKS(): %v", err)
+	}
+	return keys
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signToken makes a JWS compact token of claims, sign gets the signing
+// input.
+func signToken(t *testing.T, alg, kid string, claims map[string]any, sign func([]byte) []byte) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := b64(header) + "." + b64(payload)
+	return input + "." + b64(sign([]byte(input)))
+}
+
+func hs256(secret []byte) func([]byte) []byte {
+	return func(input []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(input)
+		return mac.Sum(nil)
+	}
+}
+
+func rs256(key *rsa.PrivateKey) func([]byte) []byte {
+	return func(input []byte) []byte {
+		sum := sha256.Sum256(input)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+		if err != nil {
+			panic(err)
+		}
+		return sig
+	}
+}
+
+func TestTokenVerifier(t *testing.T) {
+	keys := newTestKeys(t)
+	now := time.Unix(1_750_000_000, 0)
+	const leeway = 30 * time.Second
+	v, err := NewTokenVerifier(keys.jwks, "https://issuer", "subscriber", leeway)
+	if err != nil {
+		t.Fatalf("NewTokenVerifier(): %v", err)
+	}
+	v.now = func() time.Time { return now }
+
+	at := func(d time.Duration) int64 { return now.Add(d).Unix() }
+	claims := func(extra map[string]any) map[string]any {
+		c := map[string]any{"sub": "user", "iss": "https://issuer", "aud": "subscriber", "exp": at(time.Hour)}
+		for k, v := range extra {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+	hmacKey, rsaKey := hs256(keys.secret), rs256(keys.rsa)
+	valid := signToken(t, AlgHS256, "hmac", claims(nil), hmacKey)
+	parts := strings.Split(valid, ".")
+	tampered := parts[0] + "." + b64([]byte(`{"sub":"admin","aud":"subscriber","iss":"https://issuer","exp":9999999999}`)) + "." + parts[2]
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"HS256", valid, true},
+		{"RS256", signToken(t, AlgRS256, "rsa", claims(nil), rsaKey), true},
+		{"NoKid", signToken(t, AlgRS256, "", claims(nil), rsaKey), true},
+		{"AudienceList", signToken(t, AlgHS256, "hmac", claims(map[string]any{"aud": []string{"other", "subscriber"}}), hmacKey), true},
+		{"Malformed", "a.b", false},
+		{"Tampered", tampered, false},
+		{"WrongSecret", signToken(t, AlgHS256, "hmac", claims(nil), hs256([]byte(strings.Repeat("x", 32)))), false},
+		// The public RSA key must not pass as an HMAC secret, whatever
+		// the kid says.
+		{"AlgConfusion", signToken(t, AlgHS256, "rsa", claims(nil), hs256(keys.rsa.N.Bytes())), false},
+		{"AlgConfusionNoKid", signToken(t, AlgHS256, "", claims(nil), hs256(keys.rsa.N.Bytes())), false},
+		{"KidOfOtherAlg", signToken(t, AlgRS256, "hmac", claims(nil), rsaKey), false},
+		{"UnknownKid", signToken(t, AlgHS256, "other", claims(nil), hmacKey), false},
+		{"EncryptionKid", signToken(t, AlgRS256, "enc", claims(nil), rsaKey), false},
+		{"AlgNone", signToken(t, "none", "", claims(nil), func([]byte) []byte { return nil }), false},
+		{"AlgHS512", signToken(t, "HS512", "hmac", claims(nil), hmacKey), false},
+		{"Expired", signToken(t, AlgHS256, "hmac", claims(map[string]any{"exp": at(-leeway - time.Second)}), hmacKey), false},
+		{"ExpiredAtLeeway", signToken(t, AlgHS256, "hmac", claims(map[string]any{"exp": at(-leeway)}), hmacKey), false},
+		{"ExpiredWithinLeeway", signToken(t, AlgHS256, "hmac", claims(map[string]any{"exp": at(-leeway + time.Second)}), hmacKey), true},
+		{"NotYet", signToken(t, AlgHS256, "hmac", claims(map[string]any{"nbf": at(leeway + time.Second)}), hmacKey), false},
+		{"NotYetWithinLeeway", signToken(t, AlgHS256, "hmac", claims(map[string]any{"nbf": at(leeway)}), hmacKey), true},
+		{"NoExp", signToken(t, AlgHS256, "hmac", claims(map[string]any{"exp": nil}), hmacKey), false},
+		{"WrongIssuer", signToken(t, AlgHS256, "hmac", claims(map[string]any{"iss": "https://other"}), hmacKey), false},
+		{"NoIssuer", signToken(t, AlgHS256, "hmac", claims(map[string]any{"iss": nil}), hmacKey), false},
+		{"WrongAudience", signToken(t, AlgHS256, "hmac", claims(map[string]any{"aud": "other"}), hmacKey), false},
+		{"NoAudience", signToken(t, AlgHS256, "hmac", claims(map[string]any{"aud": nil}), hmacKey), false},
+		{"NoSubject", signToken(t, AlgHS256, "hmac", claims(map[string]any{"sub": nil}), hmacKey), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := v.Verify(tc.token)
+			if tc.ok && err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if !tc.ok {
+				if err == nil {
+					t.Fatalf("Verify() = %+v, want an error", got)
+				}
+				return
+			}
+			if got.Subject != "user" {
+				t.Errorf("Verify() subject = %q, want user", got.Subject)
+			}
+		})
+	}
+
+	// Without iss and aud configured, the claims are not checked.
+	open, err := NewTokenVerifier(keys.jwks, "", "", 0)
+	if err != nil {
+		t.Fatalf("NewTokenVerifier(): %v", err)
+	}
+	open.now = v.now
+	token := signToken(t, AlgHS256, "hmac", claims(map[string]any{"iss": nil, "aud": nil}), hmacKey)
+	if _, err := open.Verify(token); err != nil {
+		t.Errorf("Verify() without iss and aud error = %v", err)
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	keys := newTestKeys(t)
+	n, e := b64(keys.rsa.N.Bytes()), b64(big.NewInt(int64(keys.rsa.E)).Bytes())
+	short, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey(): %v", err)
+	}
+	for name, jwks := range map[string]string{
+		"invalid json":        `{"keys":`,
+		"no keys":             `{"keys": []}`,
+		"only encryption":     fmt.Sprintf(`{"keys": [{"kty": "RSA", "use": "enc", "n": %q, "e": %q}]}`, n, e),
+		"short secret":        fmt.Sprintf(`{"keys": [{"kty": "oct", "k": %q}]}`, b64([]byte("short"))),
+		"short rsa key":       fmt.Sprintf(`{"keys": [{"kty": "RSA", "n": %q, "e": %q}]}`, b64(short.N.Bytes()), e),
+		"rsa key as hmac":     fmt.Sprintf(`{"keys": [{"kty": "RSA", "alg": "HS256", "n": %q, "e": %q}]}`, n, e),
+		"hmac key as rsa":     fmt.Sprintf(`{"keys": [{"kty": "oct", "alg": "RS256", "k": %q}]}`, b64(keys.secret)),
+		"unsupported kty":     `{"keys": [{"kty": "EC", "crv": "P-256"}]}`,
+		"invalid exponent":    fmt.Sprintf(`{"keys": [{"kty": "RSA", "n": %q, "e": %q}]}`, n, b64([]byte{1})),
+		"invalid base64 of k": `{"keys": [{"kty": "oct", "k": "not base64!"}]}`,
+	} {
+		if _, err := ParseJWKS([]byte(jwks)); err == nil {
+			t.Errorf("%s: ParseJWKS() succeeded, want an error", name)
+		}
+	}
+	if _, err := NewTokenVerifier(keys.jwks, "", "", -time.Second); err == nil {
+		t.Error("NewTokenVerifier() with a negative leeway succeeded")
+	}
+	if _, err := NewTokenVerifier(nil, "", "", 0); err == nil {
+		t.Error("NewTokenVerifier() without keys succeeded")
+	}
+}
@@ -0,0 +1,140 @@
+package delivery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/usecase"
+	"github.com/samantonio28/subscriber-inf/pkg/utils"
+)
+
+type SubsPageResponse struct {
+	Items      []HandlingSub `json:"items"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+	Total      int           `json:"total"`
+}
+
+// listCursor is the json form of domain.SubsCursor behind the opaque
+// next_cursor token.
+type listCursor struct {
+	SubId       int       `json:"id"`
+	Price       int       `json:"p,omitempty"`
+	StartDate   time.Time `json:"sd,omitempty"`
+	ServiceName string    `json:"sn,omitempty"`
+}
+
+func encodeCursor(c *domain.SubsCursor) string {
+	if c == nil {
+		return ""
+	}
+	data, _ := json.Marshal(listCursor{
+		SubId:       int(c.SubId),
+		Price:       c.Price,
+		StartDate:   c.StartDate,
+		ServiceName: c.ServiceName,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*domain.SubsCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, domain.NewValidationError("cursor", "malformed cursor")
+	}
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, domain.NewValidationError("cursor", "malformed cursor")
+	}
+	return &domain.SubsCursor{
+		SubId:       domain.SubID(c.SubId),
+		Price:       c.Price,
+		StartDate:   c.StartDate,
+		ServiceName: c.ServiceName,
+	}, nil
+}
+
+// parseListQuery reads the listing parameters:
+//
+//	user_id, service_name, min_price, max_price,
+//	active_at, start_from, start_to, end_from, end_to (see utils.ParseDate),
+//	sort (field name, "-" prefix for descending order),
+//	limit, offset, cursor, include_deleted.
+func parseListQuery(q url.Values) (usecase.SubsListDTO, error) {
+	var dto usecase.SubsListDTO
+	var err error
+
+	if v := q.Get("user_id"); v != "" {
+		dto.UserID, err = uuid.Parse(v)
+		if err != nil {
+			return dto, domain.NewValidationError("user_id", "can't parse uuid: "+err.Error())
+		}
+	}
+	dto.ServiceName = q.Get("service_name")
+
+	ints := map[string]*int{
+		"min_price": &dto.MinPrice,
+		"max_price": &dto.MaxPrice,
+		"limit":     &dto.Limit,
+		"offset":    &dto.Offset,
+	}
+	for name, dst := range ints {
+		if v := q.Get(name); v != "" {
+			*dst, err = strconv.Atoi(v)
+			if err != nil {
+				return dto, domain.NewValidationError(name, "must be an integer")
+			}
+		}
+	}
+
+	dates := map[string]*time.Time{
+		"active_at":  &dto.ActiveAt,
+		"start_from": &dto.StartFrom,
+		"start_to":   &dto.StartTo,
+		"end_from":   &dto.EndFrom,
+		"end_to":     &dto.EndTo,
+	}
+	for name, dst := range dates {
+		if v := q.Get(name); v != "" {
+			*dst, err = utils.ParseDate(v)
+			if err != nil {
+				return dto, domain.NewValidationError(name, err.Error())
+			}
+		}
+	}
+
+	if sort := q.Get("sort"); sort != "" {
+		dto.Desc = strings.HasPrefix(sort, "-")
+		dto.SortBy = strings.TrimPrefix(sort, "-")
+	}
+	if v := q.Get("cursor"); v != "" {
+		dto.After, err = decodeCursor(v)
+		if err != nil {
+			return dto, err
+		}
+	}
+	dto.IncludeDeleted, err = boolParam(q, "include_deleted")
+	if err != nil {
+		return dto, err
+	}
+	return dto, nil
+}
+
+// boolParam reads the boolean query parameter name, false when it is
+// absent.
+func boolParam(q url.Values, name string) (bool, error) {
+	v := q.Get(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, domain.NewValidationError(name, "must be true or false")
+	}
+	return b, nil
+}
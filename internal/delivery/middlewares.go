@@ -1,33 +1,136 @@
 package delivery
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
 	"github.com/samantonio28/subscriber-inf/internal/logger"
+	"github.com/sirupsen/logrus"
 )
 
+// Outcomes of a request in the access log.
+const (
+	OutcomeCompleted = "completed"
+	OutcomeCancelled = "cancelled"
+	OutcomeTimedOut  = "timed_out"
+)
+
+// statusRecorder remembers the status code written by a handler and
+// the error of a 500.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	err    error
+}
+
+func (r *statusRecorder) recordError(err error) {
+	r.err = err
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func requestOutcome(ctx context.Context) string {
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		return OutcomeCancelled
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return OutcomeTimedOut
+	}
+	return OutcomeCompleted
+}
+
+// Headers of RequestMetaMiddleware.
+const (
+	HeaderRequestID = "X-Request-ID"
+	HeaderActor     = "X-Actor"
+)
+
+// maxRequestIDLen bounds the request IDs taken from clients.
+const maxRequestIDLen = 128
+
+// RequestMetaMiddleware puts the domain.AuditMeta of a request into its
+// context: the X-Request-ID header, generated when absent and echoed in
+// the response, and the actor from X-Actor. Longer IDs than
+// maxRequestIDLen are replaced. It has to run first for
+// the access log to have the request ID.
+func RequestMetaMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(HeaderRequestID)
+		if requestID == "" || len(requestID) > maxRequestIDLen {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(HeaderRequestID, requestID)
+		meta := domain.AuditMeta{Actor: r.Header.Get(HeaderActor), RequestID: requestID}
+		next.ServeHTTP(w, r.WithContext(domain.WithAuditMeta(r.Context(), meta)))
+	})
+}
+
 func AccessLogMiddleware(logger logger.Logger) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 
-			requestID := ""
-			if ctxVal := r.Context().Value("request_id"); ctxVal != nil {
-				requestID = ctxVal.(string)
-			}
+			requestID := domain.AuditMetaFrom(r.Context()).RequestID
 
-			next.ServeHTTP(w, r)
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
 
-			logger.WithFields(map[string]any{
+			outcome := requestOutcome(r.Context())
+			entry := (*logrus.Entry)(logger.WithFields(map[string]any{
 				"method":      r.Method,
 				"path":        r.URL.Path,
 				"remote_addr": r.RemoteAddr,
 				"user_agent":  r.UserAgent(),
 				"request_id":  requestID,
 				"duration":    time.Since(start).String(),
-			}).Logger.Info("request completed")
+				"status":      rec.status,
+				"outcome":     outcome,
+			}))
+			if rec.err != nil {
+				entry = entry.WithError(rec.err)
+			}
+			if outcome != OutcomeCompleted {
+				entry.Warn("request " + outcome)
+				return
+			}
+			if rec.err != nil {
+				entry.Error("request failed")
+				return
+			}
+			entry.Info("request completed")
+		})
+	}
+}
+
+// TimeoutMiddleware puts the deadline of the matched route into the
+// request context: routes[path template] or def. Zero means no deadline.
+// It has to run before AccessLogMiddleware for timeouts to be logged.
+func TimeoutMiddleware(def time.Duration, routes map[string]time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout := def
+			if route := mux.CurrentRoute(r); route != nil {
+				if tpl, err := route.GetPathTemplate(); err == nil {
+					if d, ok := routes[tpl]; ok {
+						timeout = d
+					}
+				}
+			}
+			if timeout <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
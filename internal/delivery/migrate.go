@@ -0,0 +1,143 @@
+package delivery
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samantonio28/subscriber-inf/internal/migrate"
+	"github.com/samantonio28/subscriber-inf/internal/service"
+	"github.com/samantonio28/subscriber-inf/migrations"
+)
+
+const migrateUsage = `usage: subscriber migrate [flags] up|down|status|to N|baseline N
+
+  up          apply all pending migrations
+  down        revert the last applied migration
+  status      list migrations and whether they are applied
+  to N        apply or revert migrations until N is the last applied one
+  baseline N  mark migrations up to N as applied without running them`
+
+// migrateCommand runs the migrate command, args follow "migrate" on
+// the command line.
+func migrateCommand(args []string) error {
+	cfg, rest, done, err := loadConfig(flag.NewFlagSet("subscriber migrate", flag.ContinueOnError), args)
+	if err != nil || done {
+		return err
+	}
+	if len(rest) == 0 {
+		return fmt.Errorf("%s", migrateUsage)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	pool, err := newPool(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	m, err := migrate.NewMigrator(pool, migrations.FS, service.MigrationSteps)
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	cmd, rest := rest[0], rest[1:]
+	version := func() (int, error) {
+		if len(rest) != 1 {
+			return 0, fmt.Errorf("%s needs a version\n%s", cmd, migrateUsage)
+		}
+		v, err := strconv.Atoi(rest[0])
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid version %q", rest[0])
+		}
+		return v, nil
+	}
+
+	var ran []migrate.Migration
+	verb := "applied"
+	switch cmd {
+	case "up":
+		ran, err = m.Up(ctx)
+	case "down":
+		verb = "reverted"
+		ran, err = m.Down(ctx)
+	case "to":
+		v, verr := version()
+		if verr != nil {
+			return verr
+		}
+		cur, verr := m.Version(ctx)
+		if verr != nil {
+			return verr
+		}
+		if v < cur {
+			verb = "reverted"
+		}
+		ran, err = m.To(ctx, v)
+	case "baseline":
+		v, verr := version()
+		if verr != nil {
+			return verr
+		}
+		return m.Baseline(ctx, v)
+	case "status":
+		return printStatus(ctx, m)
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", cmd, migrateUsage)
+	}
+	for _, mig := range ran {
+		fmt.Printf("%s %03d_%s\n", verb, mig.Version, mig.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(ran) == 0 {
+		fmt.Println("nothing to do")
+	}
+	return nil
+}
+
+func printStatus(ctx context.Context, m *migrate.Migrator) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range statuses {
+		appliedAt := "pending"
+		if s.Applied {
+			appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+		}
+		name := s.Name
+		if name == "" {
+			name = "(unknown)"
+		}
+		fmt.Fprintf(w, "%03d\t%s\t%s\n", s.Version, name, appliedAt)
+	}
+	return w.Flush()
+}
+
+// migrateUp applies the pending migrations on startup.
+func migrateUp(ctx context.Context, pool *pgxpool.Pool) error {
+	m, err := migrate.NewMigrator(pool, migrations.FS, service.MigrationSteps)
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+	ran, err := m.Up(ctx)
+	for _, mig := range ran {
+		log.Printf("Applied migration %03d_%s", mig.Version, mig.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to migrate: %w", err)
+	}
+	return nil
+}
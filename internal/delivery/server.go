@@ -0,0 +1,237 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/logger"
+	"github.com/samantonio28/subscriber-inf/pkg/config"
+)
+
+var (
+	ErrInvalidPool    = errors.New("postgres pool is not defined")
+	ErrInvalidHandler = errors.New("http handler is not defined")
+)
+
+type ServerConfig struct {
+	Addr         string
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// DrainTimeout bounds waiting for in-flight requests on shutdown.
+	DrainTimeout time.Duration
+	// RequestTimeout is the deadline of a request unless RouteTimeouts
+	// has one for its route path template. Zero means no deadline.
+	RequestTimeout time.Duration
+	RouteTimeouts  map[string]time.Duration
+	// TLSCertFile and TLSKeyFile switch the server to HTTPS.
+	TLSCertFile string
+	TLSKeyFile  string
+}
+
+// ServerConfigFrom parses cfg, filling in the defaults for empty fields.
+func ServerConfigFrom(cfg config.HTTPConfig) (ServerConfig, error) {
+	res := ServerConfig{
+		Addr:           ":8080",
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		DrainTimeout:   5 * time.Second,
+		RequestTimeout: 8 * time.Second,
+		RouteTimeouts:  make(map[string]time.Duration),
+	}
+	if cfg.Addr != "" {
+		res.Addr = cfg.Addr
+	}
+	if cfg.TLS.Enabled() {
+		res.TLSCertFile = cfg.TLS.CertFile
+		res.TLSKeyFile = cfg.TLS.KeyFile
+	}
+	durations := []struct {
+		name string
+		val  string
+		dst  *time.Duration
+	}{
+		{"read_timeout", cfg.ReadTimeout, &res.ReadTimeout},
+		{"write_timeout", cfg.WriteTimeout, &res.WriteTimeout},
+		{"drain_timeout", cfg.DrainTimeout, &res.DrainTimeout},
+		{"request_timeout", cfg.RequestTimeout, &res.RequestTimeout},
+	}
+	for _, d := range durations {
+		if d.val == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.val)
+		if err != nil {
+			return ServerConfig{}, fmt.Errorf("http.%s: %w", d.name, err)
+		}
+		*d.dst = v
+	}
+	for route, val := range cfg.RouteTimeouts {
+		v, err := time.ParseDuration(val)
+		if err != nil {
+			return ServerConfig{}, fmt.Errorf("http.route_timeouts[%s]: %w", route, err)
+		}
+		res.RouteTimeouts[route] = v
+	}
+	return res, nil
+}
+
+// Server serves the API and owns the resources behind it: Shutdown
+// drains the requests, stops the background jobs, then closes the pool
+// and the log file.
+type Server struct {
+	http         *http.Server
+	pool         *pgxpool.Pool
+	logger       *logger.LogrusLogger
+	drainTimeout time.Duration
+	tlsCertFile  string
+	tlsKeyFile   string
+
+	jobs     []func(ctx context.Context)
+	jobsCtx  context.Context
+	stopJobs context.CancelFunc
+	jobsDone sync.WaitGroup
+
+	ln           net.Listener
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+func NewServer(cfg ServerConfig, handler http.Handler, pool *pgxpool.Pool, logger *logger.LogrusLogger) (*Server, error) {
+	if handler == nil {
+		return nil, ErrInvalidHandler
+	}
+	if pool == nil {
+		return nil, ErrInvalidPool
+	}
+	if logger == nil {
+		return nil, domain.ErrInvalidLogger
+	}
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	return &Server{
+		http: &http.Server{
+			Addr:         cfg.Addr,
+			Handler:      handler,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+		},
+		pool:         pool,
+		logger:       logger,
+		drainTimeout: cfg.DrainTimeout,
+		tlsCertFile:  cfg.TLSCertFile,
+		tlsKeyFile:   cfg.TLSKeyFile,
+		jobsCtx:      jobsCtx,
+		stopJobs:     stopJobs,
+	}, nil
+}
+
+// AddJob registers a job run in the background by Run. The context of
+// the job is cancelled on Shutdown, which waits for it to return before
+// closing the pool. Jobs must be added before Run.
+func (s *Server) AddJob(job func(ctx context.Context)) {
+	s.jobs = append(s.jobs, job)
+}
+
+// Listen binds the address of the server. Run calls it when it was not
+// called before.
+func (s *Server) Listen() error {
+	ln, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return fmt.Errorf("can't listen on %s: %w", s.http.Addr, err)
+	}
+	s.ln = ln
+	return nil
+}
+
+// Addr is the address the server listens on, nil before Listen.
+func (s *Server) Addr() net.Addr {
+	if s.ln == nil {
+		return nil
+	}
+	return s.ln.Addr()
+}
+
+// Run serves until ctx is done and then shuts the server down within
+// the drain timeout. It returns nil after a clean shutdown.
+func (s *Server) Run(ctx context.Context) error {
+	if s.ln == nil {
+		if err := s.Listen(); err != nil {
+			_ = s.Shutdown(context.Background())
+			return err
+		}
+	}
+	s.logger.Info("server started", "addr", s.Addr().String(), "tls", s.tlsCertFile != "")
+	for _, job := range s.jobs {
+		s.jobsDone.Add(1)
+		go func() {
+			defer s.jobsDone.Done()
+			job(s.jobsCtx)
+		}()
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		if s.tlsCertFile != "" {
+			served <- s.http.ServeTLS(s.ln, s.tlsCertFile, s.tlsKeyFile)
+			return
+		}
+		served <- s.http.Serve(s.ln)
+	}()
+
+	var serveErr error
+	select {
+	case serveErr = <-served:
+	case <-ctx.Done():
+		s.logger.Info("shutting down", "cause", context.Cause(ctx))
+	}
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), s.drainTimeout)
+	defer cancel()
+	err := s.Shutdown(drainCtx)
+	if serveErr == nil {
+		serveErr = <-served
+	}
+	if !errors.Is(serveErr, http.ErrServerClosed) {
+		return fmt.Errorf("server ended with error: %w", serveErr)
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests
+// until ctx is done, dropping the ones left. Then it stops the jobs and
+// closes the pool and the log file. Only the first call has an effect,
+// the others return its result.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		if err := s.http.Shutdown(ctx); err != nil {
+			s.logger.Error("requests were not drained in time", "error", err)
+			s.shutdownErr = fmt.Errorf("drain requests: %w", err)
+			if err := s.http.Close(); err != nil {
+				s.logger.Error("can't close connections", "error", err)
+			}
+		}
+		s.stopJobs()
+		s.jobsDone.Wait()
+		if err := s.closeResources(); err != nil && s.shutdownErr == nil {
+			s.shutdownErr = err
+		}
+	})
+	return s.shutdownErr
+}
+
+// closeResources closes the pool first: requests still running after the
+// drain timeout can log their failures.
+func (s *Server) closeResources() error {
+	s.pool.Close()
+	s.logger.Info("server stopped")
+	if err := s.logger.Close(); err != nil {
+		return fmt.Errorf("close log file: %w", err)
+	}
+	return nil
+}
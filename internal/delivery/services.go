@@ -0,0 +1,290 @@
+package delivery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/logger"
+	"github.com/samantonio28/subscriber-inf/internal/usecase"
+	"github.com/samantonio28/subscriber-inf/pkg/utils"
+)
+
+type ServicesHandler struct {
+	ServicesUC usecase.ServicesUC
+	logger     *logger.LogrusLogger
+}
+
+// HandlingService is a service of the catalog. DefaultPrice is absent
+// for services without one, DefaultCurrency is RUB by default.
+type HandlingService struct {
+	ServiceId       int    `json:"service_id,omitempty"`
+	ServiceName     string `json:"service_name"`
+	DisplayName     string `json:"display_name"`
+	Category        string `json:"category"`
+	DefaultPrice    *int   `json:"default_price,omitempty"`
+	DefaultCurrency string `json:"default_currency,omitempty"`
+	// SubsCount is set in responses, it is ignored in requests.
+	SubsCount int `json:"subs_count"`
+}
+
+type MergeServicesRequest struct {
+	Into int `json:"into"`
+}
+
+type MergeServicesResponse struct {
+	Service   HandlingService `json:"service"`
+	MovedSubs int             `json:"moved_subs"`
+}
+
+// HandlingServiceAlias is another name of a service, responses have it
+// normalized.
+type HandlingServiceAlias struct {
+	Alias string `json:"alias"`
+}
+
+func NewServicesHandler(repo domain.ServiceRepository, logger *logger.LogrusLogger) (*ServicesHandler, error) {
+	servicesUC, err := usecase.NewServicesUC(repo, logger)
+	if err != nil {
+		return nil, err
+	}
+	return &ServicesHandler{ServicesUC: *servicesUC, logger: logger}, nil
+}
+
+func SerializeService(s HandlingService) (usecase.ServiceDTO, error) {
+	dto := usecase.ServiceDTO{
+		Name:        s.ServiceName,
+		DisplayName: s.DisplayName,
+		Category:    s.Category,
+	}
+	if s.DefaultPrice == nil {
+		if s.DefaultCurrency != "" {
+			return dto, domain.NewValidationError("default_price", "must be set with default_currency")
+		}
+		return dto, nil
+	}
+	dto.DefaultPrice = *s.DefaultPrice
+	dto.DefaultCurrency = s.DefaultCurrency
+	if dto.DefaultCurrency == "" {
+		dto.DefaultCurrency = domain.DefaultCurrency
+	}
+	return dto, nil
+}
+
+func DeserializeService(s usecase.ServiceDTO) HandlingService {
+	hs := HandlingService{
+		ServiceId:   s.Id,
+		ServiceName: s.Name,
+		DisplayName: s.DisplayName,
+		Category:    s.Category,
+		SubsCount:   s.SubsCount,
+	}
+	if s.DefaultCurrency != "" {
+		price := s.DefaultPrice
+		hs.DefaultPrice = &price
+		hs.DefaultCurrency = s.DefaultCurrency
+	}
+	return hs
+}
+
+func serviceIdFromPath(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		return 0, badRequest("invalid service id: " + err.Error())
+	}
+	return id, nil
+}
+
+// readService reads the service of the request body.
+func readService(r *http.Request) (usecase.ServiceDTO, error) {
+	var req HandlingService
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return usecase.ServiceDTO{}, badRequest("invalid json")
+	}
+	return SerializeService(req)
+}
+
+func (h *ServicesHandler) CreateService(w http.ResponseWriter, r *http.Request) {
+	input, err := readService(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	id, err := h.ServicesUC.NewService(r.Context(), input)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	utils.MakeResponse(w, http.StatusCreated, map[string]string{
+		"message": fmt.Sprintf("new service_id: %d", id),
+	})
+}
+
+func (h *ServicesHandler) GetServices(w http.ResponseWriter, r *http.Request) {
+	services, err := h.ServicesUC.Services(r.Context(), r.URL.Query().Get("category"))
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	res := make([]HandlingService, 0, len(services))
+	for _, s := range services {
+		res = append(res, DeserializeService(s))
+	}
+	utils.MakeResponse(w, http.StatusOK, res)
+}
+
+// SearchServices serves autocomplete: services by the start of a name or
+// a similar one in q, up to limit of them.
+func (h *ServicesHandler) SearchServices(w http.ResponseWriter, r *http.Request) {
+	var limit int
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil {
+			MakeErrorResponse(w, domain.NewValidationError("limit", "must be an integer"))
+			return
+		}
+	}
+	services, err := h.ServicesUC.SearchServices(r.Context(), r.URL.Query().Get("q"), limit)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	res := make([]HandlingService, 0, len(services))
+	for _, s := range services {
+		res = append(res, DeserializeService(s))
+	}
+	utils.MakeResponse(w, http.StatusOK, res)
+}
+
+func (h *ServicesHandler) GetService(w http.ResponseWriter, r *http.Request) {
+	id, err := serviceIdFromPath(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	svc, err := h.ServicesUC.Service(r.Context(), id)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	utils.MakeResponse(w, http.StatusOK, DeserializeService(svc))
+}
+
+// UpdateService replaces all the fields of a service, a new
+// service_name renames it.
+func (h *ServicesHandler) UpdateService(w http.ResponseWriter, r *http.Request) {
+	id, err := serviceIdFromPath(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	input, err := readService(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	if err := h.ServicesUC.UpdateService(r.Context(), id, input); err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	svc, err := h.ServicesUC.Service(r.Context(), id)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	utils.MakeResponse(w, http.StatusOK, DeserializeService(svc))
+}
+
+func (h *ServicesHandler) DeleteService(w http.ResponseWriter, r *http.Request) {
+	id, err := serviceIdFromPath(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	if err := h.ServicesUC.DeleteService(r.Context(), id); err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MergeServices moves the subscriptions of the service of the path to
+// the one of the body and deletes it.
+func (h *ServicesHandler) MergeServices(w http.ResponseWriter, r *http.Request) {
+	id, err := serviceIdFromPath(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	var req MergeServicesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		MakeErrorResponse(w, badRequest("invalid json"))
+		return
+	}
+	if req.Into == 0 {
+		MakeErrorResponse(w, domain.NewValidationError("into", "must be set"))
+		return
+	}
+	svc, moved, err := h.ServicesUC.MergeServices(r.Context(), id, req.Into)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	utils.MakeResponse(w, http.StatusOK, MergeServicesResponse{
+		Service:   DeserializeService(svc),
+		MovedSubs: moved,
+	})
+}
+
+func (h *ServicesHandler) GetServiceAliases(w http.ResponseWriter, r *http.Request) {
+	id, err := serviceIdFromPath(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	aliases, err := h.ServicesUC.ServiceAliases(r.Context(), id)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	res := make([]HandlingServiceAlias, 0, len(aliases))
+	for _, a := range aliases {
+		res = append(res, HandlingServiceAlias{Alias: a})
+	}
+	utils.MakeResponse(w, http.StatusOK, res)
+}
+
+func (h *ServicesHandler) CreateServiceAlias(w http.ResponseWriter, r *http.Request) {
+	id, err := serviceIdFromPath(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	var req HandlingServiceAlias
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		MakeErrorResponse(w, badRequest("invalid json"))
+		return
+	}
+	alias, err := h.ServicesUC.NewServiceAlias(r.Context(), id, req.Alias)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	utils.MakeResponse(w, http.StatusCreated, HandlingServiceAlias{Alias: alias})
+}
+
+func (h *ServicesHandler) DeleteServiceAlias(w http.ResponseWriter, r *http.Request) {
+	id, err := serviceIdFromPath(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	if err := h.ServicesUC.DeleteServiceAlias(r.Context(), id, mux.Vars(r)["alias"]); err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,193 @@
+package delivery
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// createService creates a service and returns its id.
+func (a *testAPI) createService(t *testing.T, body string) int {
+	t.Helper()
+	rec := a.mustDo(t, http.StatusCreated, http.MethodPost, "/services", body)
+	var resp struct {
+		Message string `json:"message"`
+	}
+	decode(t, rec, &resp)
+	var id int
+	if _, err := fmt.Sscanf(resp.Message, "new service_id: %d", &id); err != nil {
+		t.Fatalf("no service_id in %s", rec.Body)
+	}
+	return id
+}
+
+func TestServices(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, api *testAPI) {
+		netflix := api.createService(t, `{"service_name":"Netflix","display_name":"Netflix","category":"video","default_price":999,"default_currency":"RUB"}`)
+		spotify := api.createService(t, `{"service_name":"Spotify","category":"music"}`)
+		for _, body := range []string{
+			`{"service_name":"Kion","default_currency":"USD"}`,
+			`{"service_name":"Kion","default_price":-1}`,
+			`{"service_name":""}`,
+		} {
+			if rec := api.do(t, http.MethodPost, "/services", body); rec.Code != http.StatusUnprocessableEntity {
+				t.Errorf("POST /services %s = %d %s, want 422", body, rec.Code, rec.Body)
+			}
+		}
+		if rec := api.do(t, http.MethodPost, "/services", `{"service_name":"NETFLIX"}`); rec.Code != http.StatusConflict {
+			t.Errorf("POST of an existing service = %d %s, want 409", rec.Code, rec.Body)
+		}
+
+		user := uuid.NewString()
+		api.createSub(t, user, "netflix", 100, "07-2025")
+		api.createSub(t, user, "Spotify", 50, "07-2025")
+
+		var svc HandlingService
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, fmt.Sprintf("/services/%d", netflix), ""), &svc)
+		if svc.ServiceName != "netflix" || svc.DisplayName != "Netflix" || svc.Category != "video" ||
+			svc.DefaultPrice == nil || *svc.DefaultPrice != 999 || svc.DefaultCurrency != "RUB" || svc.SubsCount != 1 {
+			t.Errorf("GET /services/%d = %+v", netflix, svc)
+		}
+		var services []HandlingService
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, "/services?category=music", ""), &services)
+		if len(services) != 1 || services[0].ServiceId != spotify {
+			t.Errorf("services of music = %+v, want %d", services, spotify)
+		}
+
+		var updated HandlingService
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodPut, fmt.Sprintf("/services/%d", spotify), `{"service_name":"Spotify","display_name":"Spotify Premium","category":"audio"}`), &updated)
+		if updated.ServiceId != spotify || updated.DisplayName != "Spotify Premium" || updated.Category != "audio" || updated.SubsCount != 1 {
+			t.Errorf("PUT /services/%d = %+v", spotify, updated)
+		}
+		rec := api.do(t, http.MethodDelete, fmt.Sprintf("/services/%d", netflix), "")
+		if rec.Code != http.StatusConflict || errorCode(t, rec) != CodeConflict {
+			t.Errorf("DELETE of a service with subscriptions = %d %s, want 409", rec.Code, rec.Body)
+		}
+
+		var merged MergeServicesResponse
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodPost, fmt.Sprintf("/services/%d/merge", spotify), fmt.Sprintf(`{"into":%d}`, netflix)), &merged)
+		if merged.MovedSubs != 1 || merged.Service.ServiceId != netflix || merged.Service.SubsCount != 2 {
+			t.Errorf("merge = %+v, want 1 subscription moved into %d", merged, netflix)
+		}
+		if rec := api.do(t, http.MethodGet, fmt.Sprintf("/services/%d", spotify), ""); rec.Code != http.StatusNotFound {
+			t.Errorf("GET of merged service = %d, want 404", rec.Code)
+		}
+		var subs []HandlingSub
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, "/subscriptions?uuid="+user, ""), &subs)
+		for _, s := range subs {
+			if s.ServiceName != "netflix" {
+				t.Errorf("subscription after merge = %+v, want netflix", s)
+			}
+		}
+		if rec := api.do(t, http.MethodPost, fmt.Sprintf("/services/%d/merge", netflix), fmt.Sprintf(`{"into":%d}`, netflix)); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("merge into itself = %d %s, want 422", rec.Code, rec.Body)
+		}
+
+		empty := api.createService(t, `{"service_name":"Kion"}`)
+		api.mustDo(t, http.StatusNoContent, http.MethodDelete, fmt.Sprintf("/services/%d", empty), "")
+		for _, rec := range []*httptest.ResponseRecorder{
+			api.do(t, http.MethodGet, fmt.Sprintf("/services/%d", empty), ""),
+			api.do(t, http.MethodDelete, fmt.Sprintf("/services/%d", empty), ""),
+		} {
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("request of deleted service = %d %s, want 404", rec.Code, rec.Body)
+			}
+		}
+	})
+}
+
+func TestServiceAliases(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, api *testAPI) {
+		user := uuid.NewString()
+		yandex := api.createService(t, `{"service_name":"  Yandex   PLUS "}`)
+		aliases := fmt.Sprintf("/services/%d/aliases", yandex)
+
+		var alias HandlingServiceAlias
+		decode(t, api.mustDo(t, http.StatusCreated, http.MethodPost, aliases, `{"alias":" Яндекс  Плюс"}`), &alias)
+		if alias.Alias != "яндекс плюс" {
+			t.Errorf("created alias = %q, want it normalized", alias.Alias)
+		}
+		for body, status := range map[string]int{
+			`{"alias":"YANDEX plus"}`: http.StatusConflict,
+			`{"alias":"ЯНДЕКС ПЛЮС"}`: http.StatusConflict,
+			`{"alias":"  "}`:          http.StatusUnprocessableEntity,
+		} {
+			if rec := api.do(t, http.MethodPost, aliases, body); rec.Code != status {
+				t.Errorf("POST %s %s = %d %s, want %d", aliases, body, rec.Code, rec.Body, status)
+			}
+		}
+		if rec := api.do(t, http.MethodPost, "/services/999999/aliases", `{"alias":"kinopoisk"}`); rec.Code != http.StatusNotFound {
+			t.Errorf("alias of a missing service = %d %s, want 404", rec.Code, rec.Body)
+		}
+
+		byName := api.createSub(t, user, "yandex plus", 100, "07-2025")
+		byAlias := api.createSub(t, user, "ЯНДЕКС плюс", 200, "07-2025")
+		if sub := api.getSub(t, byAlias); sub.ServiceName != "yandex plus" {
+			t.Errorf("subscription created by alias = %+v, want yandex plus", sub)
+		}
+		var costs TotalCostsResponse
+		body := fmt.Sprintf(`{"start_date":"07-2025","end_date":"08-2025","filter":{"user_id":%q,"service_name":"Яндекс плюс"}}`, user)
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, "/total_costs", body), &costs)
+		if costs.TotalSum != 300 || len(costs.SubIds) != 2 {
+			t.Errorf("costs filtered by alias = %+v, want subscriptions %d and %d", costs, byName, byAlias)
+		}
+
+		var list []HandlingServiceAlias
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, aliases, ""), &list)
+		if len(list) != 1 || list[0].Alias != "яндекс плюс" {
+			t.Errorf("GET %s = %+v", aliases, list)
+		}
+		if rec := api.do(t, http.MethodDelete, fmt.Sprintf("/services/%d/aliases/%s", yandex+1, "%D1%8F%D0%BD%D0%B4%D0%B5%D0%BA%D1%81%20%D0%BF%D0%BB%D1%8E%D1%81"), ""); rec.Code != http.StatusNotFound {
+			t.Errorf("DELETE of an alias of another service = %d %s, want 404", rec.Code, rec.Body)
+		}
+		api.mustDo(t, http.StatusNoContent, http.MethodDelete, aliases+"/%D0%AF%D0%BD%D0%B4%D0%B5%D0%BA%D1%81%20%D0%BF%D0%BB%D1%8E%D1%81", "")
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, aliases, ""), &list)
+		if len(list) != 0 {
+			t.Errorf("aliases after the delete = %+v, want none", list)
+		}
+		if sub := api.getSub(t, api.createSub(t, user, "Яндекс Плюс", 100, "07-2025")); sub.ServiceName != "яндекс плюс" {
+			t.Errorf("subscription of the deleted alias = %+v, want a service of its own", sub)
+		}
+	})
+}
+
+func TestSearchServices(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, api *testAPI) {
+		user := uuid.NewString()
+		api.createSub(t, user, "Yandex Plus", 100, "07-2025")
+		api.createSub(t, user, "Yandex Music", 100, "07-2025")
+		api.createSub(t, user, "Yandex Music", 100, "07-2025")
+		kinopoisk := api.createService(t, `{"service_name":"Kinopoisk"}`)
+		api.mustDo(t, http.StatusCreated, http.MethodPost, fmt.Sprintf("/services/%d/aliases", kinopoisk), `{"alias":"Кинопоиск"}`)
+
+		// The services with more subscriptions come first.
+		cases := map[string][]string{
+			"q=YAN":                      {"yandex music", "yandex plus"},
+			"q=%20%20Yandex%20%20MUSIC":  {"yandex music", "yandex plus"},
+			"q=yandex%20pluss&limit=1":   {"yandex plus"},
+			"q=%D0%BA%D0%B8%D0%BD%D0%BE": {"kinopoisk"},
+			"q=netflix":                  {},
+		}
+		for query, want := range cases {
+			var services []HandlingService
+			decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, "/services/search?"+query, ""), &services)
+			got := make([]string, 0, len(services))
+			for _, s := range services {
+				got = append(got, s.ServiceName)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("search %s = %v, want %v", query, got, want)
+			}
+		}
+
+		for _, query := range []string{"q=%20", "q=y&limit=51", "q=y&limit=-1", "q=y&limit=x"} {
+			rec := api.do(t, http.MethodGet, "/services/search?"+query, "")
+			if rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != CodeValidation {
+				t.Errorf("search %s = %d %s, want 422", query, rec.Code, rec.Body)
+			}
+		}
+	})
+}
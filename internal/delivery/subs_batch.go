@@ -0,0 +1,115 @@
+package delivery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/usecase"
+	"github.com/samantonio28/subscriber-inf/pkg/utils"
+)
+
+// maxBatchOps is the number of operations a batch may have.
+const maxBatchOps = 1000
+
+// BatchOp is an operation of /subscriptions:batch. Create takes the
+// fields of a new subscription, update takes sub_id and the fields to
+// change as PUT does, delete takes only sub_id.
+type BatchOp struct {
+	Op string `json:"op"`
+	HandlingSub
+	// Version is the version an update or delete expects to change, as
+	// If-Match of PUT and DELETE. Zero skips the check.
+	Version int `json:"version,omitempty"`
+}
+
+type BatchRequest struct {
+	// Mode is atomic (the default) or partial.
+	Mode       string    `json:"mode"`
+	Operations []BatchOp `json:"operations"`
+}
+
+// BatchResult is the outcome of an operation, SubId is the subscription
+// created, updated or deleted. Status is the one a failed operation would
+// get on its own, like 412 for a stale version.
+type BatchResult struct {
+	Index  int            `json:"index"`
+	Op     string         `json:"op"`
+	SubId  int            `json:"sub_id,omitempty"`
+	Status int            `json:"status,omitempty"`
+	Error  *ErrorResponse `json:"error,omitempty"`
+}
+
+// BatchResponse is the answer of /subscriptions:batch. Committed tells
+// whether anything was written.
+type BatchResponse struct {
+	Mode      string        `json:"mode"`
+	Committed bool          `json:"committed"`
+	Total     int           `json:"total"`
+	Applied   int           `json:"applied"`
+	Failed    int           `json:"failed"`
+	Results   []BatchResult `json:"results"`
+}
+
+func serializeBatchOp(op BatchOp) usecase.SubOpDTO {
+	in := usecase.SubOpDTO{Op: op.Op, SubId: op.SubId, Version: op.Version}
+	switch op.Op {
+	case string(domain.SubOpCreate):
+		in.Sub, in.Err = SerializeSub(op.HandlingSub)
+	case string(domain.SubOpUpdate):
+		in.Patch, in.Err = SerializeSubUpdate(op.HandlingSub)
+	}
+	return in
+}
+
+// BatchSubscriptions runs a list of creates, updates and deletes in one
+// transaction. The answer has the result of every operation, with
+// status 422 when an atomic batch wrote nothing because of failed ones.
+func (h *SubsHandler) BatchSubscriptions(w http.ResponseWriter, r *http.Request) {
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		MakeErrorResponse(w, badRequest("invalid json"))
+		return
+	}
+	if len(req.Operations) == 0 {
+		MakeErrorResponse(w, badRequest("no operations"))
+		return
+	}
+	if len(req.Operations) > maxBatchOps {
+		MakeErrorResponse(w, badRequest(fmt.Sprintf("more than %d operations", maxBatchOps)))
+		return
+	}
+
+	input := make([]usecase.SubOpDTO, 0, len(req.Operations))
+	for _, op := range req.Operations {
+		input = append(input, serializeBatchOp(op))
+	}
+	res, err := h.BatchSubsUC.BatchSubs(r.Context(), input, req.Mode)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+
+	resp := BatchResponse{
+		Mode:      res.Mode,
+		Committed: res.Committed,
+		Total:     len(res.Rows),
+		Applied:   res.Applied,
+		Failed:    res.Failed,
+		Results:   make([]BatchResult, 0, len(res.Rows)),
+	}
+	for i, row := range res.Rows {
+		br := BatchResult{Index: i, Op: req.Operations[i].Op, SubId: row.SubId}
+		if row.Err != nil {
+			status, errResp := errorResponse(row.Err)
+			br.Status, br.Error = status, &errResp
+		}
+		resp.Results = append(resp.Results, br)
+	}
+	status := http.StatusOK
+	if resp.Failed > 0 && resp.Mode == usecase.BatchAtomic {
+		status = http.StatusUnprocessableEntity
+	}
+	utils.MakeResponse(w, status, resp)
+}
@@ -0,0 +1,96 @@
+package delivery
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBatchSubscriptions(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, api *testAPI) {
+		user := uuid.NewString()
+		kept := api.createSub(t, user, "Netflix", 100, "07-2025")
+		deleted := api.createSub(t, user, "Spotify", 50, "07-2025")
+		missing := deleted + 100
+
+		ops := fmt.Sprintf(`[
+			{"op":"create","service_name":"Kion","price":10,"user_id":%[1]q,"start_date":"07-2025"},
+			{"op":"update","sub_id":%[2]d,"user_id":%[1]q,"price":999},
+			{"op":"delete","sub_id":%[3]d},
+			{"op":"delete","sub_id":%[4]d}
+		]`, user, kept, deleted, missing)
+
+		var resp BatchResponse
+		decode(t, api.mustDo(t, http.StatusUnprocessableEntity, http.MethodPost, "/subscriptions:batch", `{"operations":`+ops+`}`), &resp)
+		if resp.Mode != "atomic" || resp.Committed || resp.Total != 4 || resp.Applied != 0 || resp.Failed != 1 {
+			t.Errorf("atomic batch = %+v", resp)
+		}
+		if len(resp.Results) != 4 || resp.Results[3].Error == nil || resp.Results[3].Error.Code != CodeNotFound {
+			t.Errorf("atomic batch results = %+v, want the last one not found", resp.Results)
+		}
+		if sub := api.getSub(t, kept); sub.Price != 100 {
+			t.Errorf("price after failed atomic batch = %d, want 100", sub.Price)
+		}
+		api.getSub(t, deleted)
+
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodPost, "/subscriptions:batch", `{"mode":"partial","operations":`+ops+`}`), &resp)
+		if !resp.Committed || resp.Applied != 3 || resp.Failed != 1 {
+			t.Fatalf("partial batch = %+v", resp)
+		}
+		created := resp.Results[0].SubId
+		if created == 0 || resp.Results[1].SubId != kept || resp.Results[2].SubId != deleted || resp.Results[3].Error == nil {
+			t.Errorf("partial batch results = %+v", resp.Results)
+		}
+		if sub := api.getSub(t, created); sub.ServiceName != "kion" || sub.UserId != user {
+			t.Errorf("created by batch = %+v", sub)
+		}
+		if sub := api.getSub(t, kept); sub.Price != 999 {
+			t.Errorf("price after partial batch = %d, want 999", sub.Price)
+		}
+		if rec := api.do(t, http.MethodGet, fmt.Sprintf("/subscriptions/%d", deleted), ""); rec.Code != http.StatusNotFound {
+			t.Errorf("GET of deleted by batch = %d, want 404", rec.Code)
+		}
+
+		version := api.getSub(t, kept).Version
+		stale := fmt.Sprintf(`{"mode":"partial","operations":[
+			{"op":"update","sub_id":%[1]d,"user_id":%[2]q,"price":1,"version":%[3]d},
+			{"op":"delete","sub_id":%[1]d,"version":%[3]d}
+		]}`, kept, user, version-1)
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodPost, "/subscriptions:batch", stale), &resp)
+		for i, r := range resp.Results {
+			if r.Status != http.StatusPreconditionFailed || r.Error == nil || r.Error.Code != CodePrecondition {
+				t.Errorf("stale version result %d = %+v, want 412", i, r)
+			}
+		}
+		current := fmt.Sprintf(`{"operations":[{"op":"update","sub_id":%d,"user_id":%q,"price":1,"version":%d}]}`, kept, user, version)
+		resp = BatchResponse{}
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodPost, "/subscriptions:batch", current), &resp)
+		if resp.Applied != 1 || resp.Results[0].Status != 0 {
+			t.Errorf("batch of the current version = %+v", resp)
+		}
+		if sub := api.getSub(t, kept); sub.Price != 1 || sub.Version != version+1 {
+			t.Errorf("sub after versioned batch = %+v, want price 1 at version %d", sub, version+1)
+		}
+
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodPost, "/subscriptions:batch", `{"mode":"partial","operations":[{"op":"frob"},{"op":"update","sub_id":1,"price":-1}]}`), &resp)
+		if resp.Applied != 0 || resp.Failed != 2 || resp.Results[0].Error == nil || resp.Results[0].Error.Field != "op" {
+			t.Errorf("batch of invalid operations = %+v", resp)
+		}
+		decode(t, api.mustDo(t, http.StatusUnprocessableEntity, http.MethodPost, "/subscriptions:batch", fmt.Sprintf(`{"operations":[{"op":"delete","sub_id":%d,"version":-1}]}`, kept)), &resp)
+		if resp.Results[0].Status != http.StatusUnprocessableEntity || resp.Results[0].Error.Field != "version" {
+			t.Errorf("batch with a negative version = %+v", resp.Results)
+		}
+
+		for _, body := range []string{`{"operations":[]}`, `{"operations":`} {
+			if rec := api.do(t, http.MethodPost, "/subscriptions:batch", body); rec.Code != http.StatusBadRequest {
+				t.Errorf("batch %s = %d %s, want 400", body, rec.Code, rec.Body)
+			}
+		}
+		rec := api.do(t, http.MethodPost, "/subscriptions:batch", `{"mode":"bad","operations":`+ops+`}`)
+		if rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != CodeValidation {
+			t.Errorf("batch with unknown mode = %d %s, want 422", rec.Code, rec.Body)
+		}
+	})
+}
@@ -0,0 +1,217 @@
+package delivery
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+)
+
+// Formats of subscription files, both hold HandlingSub rows.
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// csvColumns is the header of the CSV format. Imported files may omit
+// columns and list them in any order.
+var csvColumns = []string{"sub_id", "service_name", "price", "currency", "billing_period", "user_id", "start_date", "end_date"}
+
+// RowError is a row of a subscriptions file that can't be read, Err
+// is a bad request. The rows after it can still be read.
+type RowError struct {
+	Row int
+	Err error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// SubsReader reads subscriptions row by row. Read returns io.EOF after
+// the last row and *RowError for a malformed row.
+type SubsReader interface {
+	Read() (HandlingSub, error)
+	// Row is the number of the row read last, starting from 1 for the
+	// first subscription.
+	Row() int
+}
+
+type SubsWriter interface {
+	Write(sub HandlingSub) error
+	Flush() error
+}
+
+func NewSubsReader(r io.Reader, format string) (SubsReader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVSubsReader(r)
+	case FormatJSONL:
+		return &jsonlSubsReader{s: bufio.NewScanner(r)}, nil
+	}
+	return nil, badRequest("unsupported format " + strconv.Quote(format))
+}
+
+func NewSubsWriter(w io.Writer, format string) (SubsWriter, error) {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvColumns); err != nil {
+			return nil, err
+		}
+		return &csvSubsWriter{w: cw}, nil
+	case FormatJSONL:
+		bw := bufio.NewWriter(w)
+		return &jsonlSubsWriter{w: bw, enc: json.NewEncoder(bw)}, nil
+	}
+	return nil, badRequest("unsupported format " + strconv.Quote(format))
+}
+
+type csvSubsReader struct {
+	r       *csv.Reader
+	columns []string
+	row     int
+}
+
+func newCSVSubsReader(r io.Reader) (*csvSubsReader, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, badRequest("empty csv: no header")
+	}
+	if err != nil {
+		return nil, badRequest("invalid csv header: " + err.Error())
+	}
+	for _, col := range header {
+		if !slices.Contains(csvColumns, col) {
+			return nil, badRequest("unknown csv column " + strconv.Quote(col))
+		}
+	}
+	return &csvSubsReader{r: cr, columns: header}, nil
+}
+
+func (r *csvSubsReader) Row() int {
+	return r.row
+}
+
+func (r *csvSubsReader) Read() (HandlingSub, error) {
+	record, err := r.r.Read()
+	if errors.Is(err, io.EOF) {
+		return HandlingSub{}, io.EOF
+	}
+	r.row++
+	if err != nil {
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			return HandlingSub{}, &RowError{Row: r.row, Err: badRequest(perr.Err.Error())}
+		}
+		return HandlingSub{}, err
+	}
+
+	var sub HandlingSub
+	for i, col := range r.columns {
+		val := record[i]
+		switch col {
+		case "sub_id", "price":
+			if val == "" {
+				continue
+			}
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				return HandlingSub{}, &RowError{Row: r.row, Err: &domain.FieldError{Kind: errBadRequest, Field: col, Msg: "must be an integer"}}
+			}
+			if col == "price" {
+				sub.Price = n
+			} else {
+				sub.SubId = n
+			}
+		case "service_name":
+			sub.ServiceName = val
+		case "currency":
+			sub.Currency = val
+		case "billing_period":
+			sub.BillingPeriod = val
+		case "user_id":
+			sub.UserId = val
+		case "start_date":
+			sub.StartDate = val
+		case "end_date":
+			sub.EndDate = val
+		}
+	}
+	return sub, nil
+}
+
+type jsonlSubsReader struct {
+	s   *bufio.Scanner
+	row int
+}
+
+func (r *jsonlSubsReader) Row() int {
+	return r.row
+}
+
+func (r *jsonlSubsReader) Read() (HandlingSub, error) {
+	for r.s.Scan() {
+		line := r.s.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		r.row++
+		var sub HandlingSub
+		if err := json.Unmarshal(line, &sub); err != nil {
+			return HandlingSub{}, &RowError{Row: r.row, Err: badRequest("invalid json")}
+		}
+		return sub, nil
+	}
+	if err := r.s.Err(); err != nil {
+		return HandlingSub{}, err
+	}
+	return HandlingSub{}, io.EOF
+}
+
+type csvSubsWriter struct {
+	w *csv.Writer
+}
+
+func (w *csvSubsWriter) Write(sub HandlingSub) error {
+	return w.w.Write([]string{
+		strconv.Itoa(sub.SubId),
+		sub.ServiceName,
+		strconv.Itoa(sub.Price),
+		sub.Currency,
+		sub.BillingPeriod,
+		sub.UserId,
+		sub.StartDate,
+		sub.EndDate,
+	})
+}
+
+func (w *csvSubsWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type jsonlSubsWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (w *jsonlSubsWriter) Write(sub HandlingSub) error {
+	return w.enc.Encode(sub)
+}
+
+func (w *jsonlSubsWriter) Flush() error {
+	return w.w.Flush()
+}
@@ -0,0 +1,233 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/usecase"
+	"github.com/samantonio28/subscriber-inf/pkg/utils"
+)
+
+// Limits of an import request.
+const (
+	maxImportRows  = 10000
+	maxImportBytes = 10 << 20
+)
+
+// exportPageSize is the number of subscriptions read from the database
+// at once by export.
+const exportPageSize = 500
+
+// ImportRowResult is the outcome of a row of an import.
+type ImportRowResult struct {
+	Row   int            `json:"row"`
+	SubId int            `json:"sub_id,omitempty"`
+	Error *ErrorResponse `json:"error,omitempty"`
+}
+
+// ImportReport is the answer of /subscriptions/import. Committed tells
+// whether anything was stored, Imported is the number of stored rows.
+type ImportReport struct {
+	Mode      string            `json:"mode"`
+	DryRun    bool              `json:"dry_run"`
+	Committed bool              `json:"committed"`
+	Total     int               `json:"total"`
+	Imported  int               `json:"imported"`
+	Failed    int               `json:"failed"`
+	Rows      []ImportRowResult `json:"rows"`
+}
+
+// importSubs reads all rows of r and imports them at once. Malformed
+// and invalid rows are reported with the rest, the error is returned
+// only when the file can't be read or stored at all.
+func (h *SubsHandler) importSubs(ctx context.Context, r SubsReader, mode string, dryRun bool) (ImportReport, error) {
+	var input []usecase.ImportRowInputDTO
+	for {
+		req, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var rowErr *RowError
+		if err != nil && !errors.As(err, &rowErr) {
+			return ImportReport{}, err
+		}
+		if len(input) == maxImportRows {
+			return ImportReport{}, badRequest(fmt.Sprintf("more than %d rows", maxImportRows))
+		}
+		var in usecase.ImportRowInputDTO
+		if rowErr != nil {
+			in.Err = rowErr.Err
+		} else {
+			in.Sub, in.Err = SerializeSub(req)
+		}
+		input = append(input, in)
+	}
+
+	res, err := h.ImportSubsUC.ImportSubs(ctx, input, mode, dryRun)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	report := ImportReport{
+		Mode:      res.Mode,
+		DryRun:    res.DryRun,
+		Committed: res.Committed,
+		Total:     len(res.Rows),
+		Imported:  res.Imported,
+		Failed:    res.Failed,
+		Rows:      make([]ImportRowResult, 0, len(res.Rows)),
+	}
+	for i, row := range res.Rows {
+		// Both readers number the rows they return from 1.
+		rr := ImportRowResult{Row: i + 1, SubId: row.SubId}
+		if row.Err != nil {
+			_, resp := errorResponse(row.Err)
+			rr.Error = &resp
+		}
+		report.Rows = append(report.Rows, rr)
+	}
+	return report, nil
+}
+
+// exportSubs writes the subscriptions matching input to w page by
+// page, ignoring its paging parameters.
+func (h *SubsHandler) exportSubs(ctx context.Context, input usecase.SubsListDTO, w SubsWriter) error {
+	input.Limit = exportPageSize
+	input.Offset = 0
+	input.After = nil
+	// Nobody reads the totals, counting every page would be wasted.
+	input.NoTotal = true
+	for {
+		page, err := h.ListSubsUC.ExportSubs(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, s := range page.Subs {
+			if err := w.Write(DeserializeSub(s)); err != nil {
+				return err
+			}
+		}
+		if page.Next == nil {
+			break
+		}
+		input.After = page.Next
+	}
+	return w.Flush()
+}
+
+// formatContentTypes are the content types of the file formats.
+var formatContentTypes = map[string]string{
+	FormatCSV:   "text/csv",
+	FormatJSONL: "application/x-ndjson",
+}
+
+// requestFormat is the format query parameter or the one of the
+// Content-Type header. CSV is the default.
+func requestFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format, nil
+	}
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return FormatCSV, nil
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return "", badRequest("invalid content type")
+	}
+	switch mt {
+	case "text/csv":
+		return FormatCSV, nil
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return FormatJSONL, nil
+	}
+	return "", badRequest("unsupported content type " + strconv.Quote(mt))
+}
+
+// ImportSubscriptions adds the subscriptions of a CSV or JSONL body.
+// The answer is the report of all rows, with status 422 when an
+// all-or-nothing import stored nothing because of failed rows.
+func (h *SubsHandler) ImportSubscriptions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	dryRun, err := boolParam(q, "dry_run")
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	format, err := requestFormat(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+	reader, err := NewSubsReader(body, format)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	report, err := h.importSubs(r.Context(), reader, q.Get("mode"), dryRun)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	status := http.StatusOK
+	if report.Failed > 0 && !report.DryRun && !report.Committed && report.Mode == string(domain.TxAllOrNothing) {
+		status = http.StatusUnprocessableEntity
+	}
+	utils.MakeResponse(w, status, report)
+}
+
+// exportWriter remembers whether anything was written to the response,
+// an error can't be reported as ErrorResponse after that.
+type exportWriter struct {
+	w     http.ResponseWriter
+	wrote bool
+}
+
+func (e *exportWriter) Write(p []byte) (int, error) {
+	e.wrote = true
+	return e.w.Write(p)
+}
+
+// ExportSubscriptions streams the subscriptions matching the listing
+// parameters as CSV or JSONL.
+func (h *SubsHandler) ExportSubscriptions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = FormatCSV
+	}
+	contentType, ok := formatContentTypes[format]
+	if !ok {
+		MakeErrorResponse(w, badRequest("unsupported format "+strconv.Quote(format)))
+		return
+	}
+	input, err := parseListQuery(q)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+
+	ew := &exportWriter{w: w}
+	sw, err := NewSubsWriter(ew, format)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "subscriptions."+format))
+	if err := h.exportSubs(r.Context(), input, sw); err != nil {
+		if !ew.wrote {
+			w.Header().Del("Content-Disposition")
+			MakeErrorResponse(w, err)
+			return
+		}
+		h.logger.Error("ExportSubscriptions", "error", err)
+	}
+}
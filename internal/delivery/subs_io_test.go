@@ -0,0 +1,149 @@
+package delivery
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+const importCSV = `service_name,price,user_id,start_date
+Netflix,100,%[1]s,07-2025
+Yandex,abc,%[1]s,07-2025
+Spotify,50,%[1]s,08-2025
+`
+
+func TestImportSubscriptions(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, api *testAPI) {
+		user := uuid.NewString()
+		body := fmt.Sprintf(importCSV, user)
+		csvHeader := []string{"Content-Type", "text/csv"}
+
+		var report ImportReport
+		decode(t, api.mustDo(t, http.StatusUnprocessableEntity, http.MethodPost, "/subscriptions/import", body, csvHeader...), &report)
+		if report.Mode != "all_or_nothing" || report.Committed || report.Total != 3 || report.Imported != 0 || report.Failed != 1 {
+			t.Errorf("all-or-nothing import = %+v", report)
+		}
+		if len(report.Rows) != 3 || report.Rows[1].Error == nil || report.Rows[1].Error.Field != "price" {
+			t.Errorf("all-or-nothing import rows = %+v, want row 2 failing on price", report.Rows)
+		}
+
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodPost, "/subscriptions/import?mode=best_effort&dry_run=true", body, csvHeader...), &report)
+		if !report.DryRun || report.Committed || report.Imported != 0 || report.Failed != 1 {
+			t.Errorf("dry run import = %+v", report)
+		}
+		if rows := exportCSV(t, api, "user_id="+user); len(rows) != 0 {
+			t.Fatalf("export after failed imports = %v, want no subscriptions", rows)
+		}
+
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodPost, "/subscriptions/import?mode=best_effort", body, csvHeader...), &report)
+		if !report.Committed || report.Imported != 2 || report.Failed != 1 {
+			t.Fatalf("best-effort import = %+v", report)
+		}
+		if report.Rows[0].SubId == 0 || report.Rows[1].SubId != 0 || report.Rows[2].SubId == 0 {
+			t.Errorf("best-effort import rows = %+v, want ids of rows 1 and 3", report.Rows)
+		}
+
+		rows := exportCSV(t, api, "user_id="+user)
+		if len(rows) != 2 || rows[0][1] != "netflix" || rows[0][2] != "100" || rows[1][1] != "spotify" || rows[1][6] != "08-2025" {
+			t.Errorf("export after import = %v", rows)
+		}
+
+		jsonl := `{"service_name":"Kion","price":10,"user_id":"` + user + `","start_date":"07-2025"}` + "\n\n{bad\n"
+		decode(t, api.mustDo(t, http.StatusUnprocessableEntity, http.MethodPost, "/subscriptions/import", jsonl, "Content-Type", "application/x-ndjson"), &report)
+		if report.Total != 2 || report.Failed != 1 || report.Rows[1].Error == nil || report.Rows[1].Error.Code != CodeBadRequest {
+			t.Errorf("jsonl import = %+v, want row 2 malformed", report)
+		}
+
+		rec := api.do(t, http.MethodPost, "/subscriptions/import?mode=bad", body, csvHeader...)
+		if rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != CodeValidation {
+			t.Errorf("import with unknown mode = %d %s, want 422", rec.Code, rec.Body)
+		}
+		rec = api.do(t, http.MethodPost, "/subscriptions/import", body, "Content-Type", "application/xml")
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("import of xml = %d %s, want 400", rec.Code, rec.Body)
+		}
+	})
+}
+
+func TestExportSubscriptions(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, api *testAPI) {
+		user := uuid.NewString()
+		// More than a page of the export.
+		n := exportPageSize + 3
+		var b strings.Builder
+		b.WriteString("service_name,price,user_id,start_date\n")
+		for i := 0; i < n; i++ {
+			name := "Netflix"
+			if i%2 == 1 {
+				name = "Spotify"
+			}
+			fmt.Fprintf(&b, "%s,%d,%s,01-2025\n", name, i+1, user)
+		}
+		var report ImportReport
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodPost, "/subscriptions/import", b.String(), "Content-Type", "text/csv"), &report)
+		if report.Imported != n {
+			t.Fatalf("import = %+v, want %d rows imported", report, n)
+		}
+
+		rows := exportCSV(t, api, "user_id="+user)
+		if len(rows) != n {
+			t.Fatalf("export returned %d subscriptions, want %d", len(rows), n)
+		}
+		seen := make(map[string]bool, n)
+		for _, row := range rows {
+			if seen[row[0]] {
+				t.Fatalf("export returned subscription %s twice", row[0])
+			}
+			seen[row[0]] = true
+		}
+
+		rec := api.mustDo(t, http.StatusOK, http.MethodGet, "/subscriptions/export?format=jsonl&service_name=Spotify&user_id="+user, "")
+		if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("jsonl export Content-Type = %q", ct)
+		}
+		count := 0
+		s := bufio.NewScanner(rec.Body)
+		for s.Scan() {
+			var sub HandlingSub
+			if err := json.Unmarshal(s.Bytes(), &sub); err != nil {
+				t.Fatalf("invalid jsonl line %q: %v", s.Text(), err)
+			}
+			if sub.ServiceName != "spotify" || sub.UserId != user {
+				t.Errorf("jsonl export returned %+v", sub)
+			}
+			count++
+		}
+		if want := n / 2; count != want {
+			t.Errorf("jsonl export returned %d subscriptions, want %d", count, want)
+		}
+
+		rec = api.do(t, http.MethodGet, "/subscriptions/export?format=xml", "")
+		if rec.Code != http.StatusBadRequest || rec.Header().Get("Content-Disposition") != "" {
+			t.Errorf("export as xml = %d %v, want 400", rec.Code, rec.Header())
+		}
+	})
+}
+
+// exportCSV exports the subscriptions matching query as CSV and returns
+// the rows after the header.
+func exportCSV(t *testing.T, api *testAPI, query string) [][]string {
+	t.Helper()
+	rec := api.mustDo(t, http.StatusOK, http.MethodGet, "/subscriptions/export?"+query, "")
+	if ct := rec.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Errorf("export Content-Type = %q, want text/csv", ct)
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid csv %s: %v", rec.Body, err)
+	}
+	if len(rows) == 0 || strings.Join(rows[0], ",") != strings.Join(csvColumns, ",") {
+		t.Fatalf("export header = %v, want %v", rows, csvColumns)
+	}
+	return rows[1:]
+}
@@ -0,0 +1,182 @@
+package delivery
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/usecase"
+	"github.com/samantonio28/subscriber-inf/pkg/utils"
+)
+
+// ContentTypeMergePatch is the media type of PATCH bodies, RFC 7396.
+const ContentTypeMergePatch = "application/merge-patch+json"
+
+// maxPatchBytes bounds the body of a PATCH.
+const maxPatchBytes = 64 << 10
+
+// readOnlySubFields are the fields of HandlingSub a patch can't set.
+var readOnlySubFields = map[string]bool{"sub_id": true, "deleted_at": true, "version": true}
+
+// SerializeSubPatch reads a merge patch of a subscription: absent fields
+// are left as they are and null clears end_date. The other fields can't
+// be cleared, user_id can only be the owner.
+func SerializeSubPatch(body []byte) (usecase.SubscriptionPatchDTO, error) {
+	var dto usecase.SubscriptionPatchDTO
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		return dto, badRequest("merge patch must be a json object")
+	}
+
+	// Sorted for the same error on every call.
+	for _, name := range slices.Sorted(maps.Keys(patch)) {
+		raw := patch[name]
+		_, isString := patchStrings[name]
+		isNull := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+		switch {
+		case readOnlySubFields[name]:
+			return dto, domain.NewImmutableFieldError(name)
+		case !isString && name != "price" && name != "end_date":
+			return dto, domain.NewValidationError(name, "unknown field")
+		case name == "end_date":
+			var enDate time.Time
+			if !isNull {
+				var err error
+				if enDate, err = patchDate(name, raw); err != nil {
+					return dto, err
+				}
+			}
+			dto.EndDate = &enDate
+		case isNull:
+			return dto, domain.NewValidationError(name, "cannot be null")
+		case name == "price":
+			var price int
+			if err := json.Unmarshal(raw, &price); err != nil {
+				return dto, domain.NewValidationError(name, "must be an integer")
+			}
+			dto.Price = &price
+		default:
+			var v string
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return dto, domain.NewValidationError(name, "must be a string")
+			}
+			if err := patchStrings[name](&dto, v); err != nil {
+				return dto, err
+			}
+		}
+	}
+	return dto, nil
+}
+
+// patchStrings set the string fields of a patch.
+var patchStrings = map[string]func(dto *usecase.SubscriptionPatchDTO, v string) error{
+	"service_name": func(dto *usecase.SubscriptionPatchDTO, v string) error {
+		dto.ServiceName = &v
+		return nil
+	},
+	"currency": func(dto *usecase.SubscriptionPatchDTO, v string) error {
+		v = strings.ToUpper(v)
+		dto.Currency = &v
+		return nil
+	},
+	"billing_period": func(dto *usecase.SubscriptionPatchDTO, v string) error {
+		v = strings.ToLower(v)
+		dto.BillingPeriod = &v
+		return nil
+	},
+	"user_id": func(dto *usecase.SubscriptionPatchDTO, v string) error {
+		uID, err := uuid.Parse(v)
+		if err != nil {
+			return domain.NewValidationError("user_id", "can't parse uuid: "+err.Error())
+		}
+		dto.UserId = &uID
+		return nil
+	},
+	"start_date": func(dto *usecase.SubscriptionPatchDTO, v string) error {
+		stDate, err := utils.ParseDate(v)
+		if err != nil {
+			return domain.NewValidationError("start_date", err.Error())
+		}
+		dto.StartDate = &stDate
+		return nil
+	},
+}
+
+func patchDate(name string, raw json.RawMessage) (time.Time, error) {
+	var v string
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return time.Time{}, domain.NewValidationError(name, "must be a string or null")
+	}
+	d, err := utils.ParseDate(v)
+	if err != nil {
+		return time.Time{}, domain.NewValidationError(name, err.Error())
+	}
+	return d, nil
+}
+
+// checkPatchContentType accepts merge patches and, for clients that
+// don't know the type, plain json.
+func checkPatchContentType(r *http.Request) error {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return nil
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return badRequest("invalid content type")
+	}
+	if mt != ContentTypeMergePatch && mt != "application/json" {
+		return badRequest("unsupported content type " + strconv.Quote(mt) + ", want " + ContentTypeMergePatch)
+	}
+	return nil
+}
+
+// PatchSubscription applies a JSON merge patch to a subscription and
+// answers with the result. It honours If-Match like PUT does.
+func (h *SubsHandler) PatchSubscription(w http.ResponseWriter, r *http.Request) {
+	subId, err := subIdFromPath(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	if err := checkPatchContentType(r); err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(http.MaxBytesReader(w, r.Body, maxPatchBytes)); err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	patch, err := SerializeSubPatch(body.Bytes())
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	patch.Version, err = ifMatchVersion(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+
+	if err := h.UpdateSubUC.UpdateSub(r.Context(), subId, patch); err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	sub, err := h.GetSubUC.SubById(r.Context(), subId, false)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	resp := DeserializeSub(sub)
+	setSubETag(w, resp)
+	utils.MakeResponse(w, http.StatusOK, resp)
+}
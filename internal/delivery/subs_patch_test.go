@@ -0,0 +1,79 @@
+package delivery
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPatchSubscription(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, api *testAPI) {
+		user := uuid.NewString()
+		body := fmt.Sprintf(`{"service_name":"Netflix","price":100,"user_id":%q,"start_date":"07-2025","end_date":"12-2025"}`, user)
+		id := createdSubId(t, api.mustDo(t, http.StatusCreated, http.MethodPost, "/subscriptions", body))
+		path := fmt.Sprintf("/subscriptions/%d", id)
+		patch := func(body string, header ...string) *HandlingSub {
+			t.Helper()
+			rec := api.mustDo(t, http.StatusOK, http.MethodPatch, path, body, append([]string{"Content-Type", ContentTypeMergePatch}, header...)...)
+			var sub HandlingSub
+			decode(t, rec, &sub)
+			if etag := rec.Header().Get(HeaderETag); etag != subETag(sub.Version) {
+				t.Errorf("ETag of PATCH = %q, want %q", etag, subETag(sub.Version))
+			}
+			return &sub
+		}
+
+		// Zero price is set, null clears end_date.
+		sub := patch(`{"price":0,"end_date":null}`)
+		if sub.Price != 0 || sub.EndDate != "" || sub.ServiceName != "netflix" || sub.Version != 2 {
+			t.Errorf("after PATCH of price and end_date = %+v", sub)
+		}
+		sub = patch(`{"end_date":"01-2026","currency":"usd"}`, HeaderIfMatch, `"2"`)
+		if sub.Price != 0 || sub.EndDate != "01-2026" || sub.Currency != "USD" || sub.Version != 3 {
+			t.Errorf("after PATCH of end_date and currency = %+v", sub)
+		}
+		// The owner may be named, plain json is accepted.
+		if rec := api.do(t, http.MethodPatch, path, fmt.Sprintf(`{"user_id":%q,"price":5}`, user)); rec.Code != http.StatusOK {
+			t.Errorf("PATCH as json naming the owner = %d %s, want 200", rec.Code, rec.Body)
+		}
+
+		cases := []struct {
+			body   string
+			status int
+			code   string
+			field  string
+		}{
+			{`{"price":null}`, http.StatusUnprocessableEntity, CodeValidation, "price"},
+			{`{"price":"x"}`, http.StatusUnprocessableEntity, CodeValidation, "price"},
+			{`{"foo":1}`, http.StatusUnprocessableEntity, CodeValidation, "foo"},
+			{`{"sub_id":1}`, http.StatusUnprocessableEntity, CodeImmutableField, "sub_id"},
+			{`{"version":9}`, http.StatusUnprocessableEntity, CodeImmutableField, "version"},
+			{fmt.Sprintf(`{"user_id":%q}`, uuid.NewString()), http.StatusUnprocessableEntity, CodeImmutableField, "user_id"},
+			{`{"start_date":"02-2026"}`, http.StatusUnprocessableEntity, CodeValidation, "end_date"},
+			{`{}`, http.StatusUnprocessableEntity, CodeValidation, ""},
+			{`[1]`, http.StatusBadRequest, CodeBadRequest, ""},
+		}
+		for _, c := range cases {
+			rec := api.do(t, http.MethodPatch, path, c.body, "Content-Type", ContentTypeMergePatch)
+			var resp ErrorResponse
+			decode(t, rec, &resp)
+			if rec.Code != c.status || resp.Code != c.code || resp.Field != c.field {
+				t.Errorf("PATCH %s = %d %+v, want %d %s on %q", c.body, rec.Code, resp, c.status, c.code, c.field)
+			}
+		}
+		if rec := api.do(t, http.MethodPatch, path, `{"price":1}`, "Content-Type", "text/plain"); rec.Code != http.StatusBadRequest {
+			t.Errorf("PATCH as text = %d %s, want 400", rec.Code, rec.Body)
+		}
+		if rec := api.do(t, http.MethodPatch, path, `{"price":1}`, "Content-Type", ContentTypeMergePatch, HeaderIfMatch, `"2"`); rec.Code != http.StatusPreconditionFailed {
+			t.Errorf("PATCH with stale If-Match = %d %s, want 412", rec.Code, rec.Body)
+		}
+		if rec := api.do(t, http.MethodPatch, fmt.Sprintf("/subscriptions/%d", id+100), `{"price":1}`, "Content-Type", ContentTypeMergePatch); rec.Code != http.StatusNotFound {
+			t.Errorf("PATCH of missing = %d %s, want 404", rec.Code, rec.Body)
+		}
+		if sub := api.getSub(t, id); sub.Price != 5 || sub.EndDate != "01-2026" || sub.StartDate != "07-2025" {
+			t.Errorf("after rejected PATCHes = %+v", sub)
+		}
+	})
+}
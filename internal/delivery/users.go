@@ -0,0 +1,197 @@
+package delivery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/logger"
+	"github.com/samantonio28/subscriber-inf/internal/usecase"
+	"github.com/samantonio28/subscriber-inf/pkg/utils"
+)
+
+type UsersHandler struct {
+	UsersUC usecase.UsersUC
+	logger  *logger.LogrusLogger
+}
+
+// HandlingUser is a user with the profile. The times are set in
+// responses, they are ignored in requests.
+type HandlingUser struct {
+	UserId    string            `json:"user_id"`
+	Name      string            `json:"name"`
+	Email     string            `json:"email"`
+	Metadata  map[string]string `json:"metadata"`
+	CreatedAt string            `json:"created_at,omitempty"`
+	UpdatedAt string            `json:"updated_at,omitempty"`
+}
+
+type DeleteUserResponse struct {
+	DeletedSubs int `json:"deleted_subs"`
+}
+
+func NewUsersHandler(repo domain.UserRepository, logger *logger.LogrusLogger) (*UsersHandler, error) {
+	usersUC, err := usecase.NewUsersUC(repo, logger)
+	if err != nil {
+		return nil, err
+	}
+	return &UsersHandler{UsersUC: *usersUC, logger: logger}, nil
+}
+
+// SerializeUser reads the profile of u, an empty user_id is left nil.
+func SerializeUser(u HandlingUser) (usecase.UserDTO, error) {
+	dto := usecase.UserDTO{
+		Name:     u.Name,
+		Email:    u.Email,
+		Metadata: u.Metadata,
+	}
+	if u.UserId != "" {
+		id, err := uuid.Parse(u.UserId)
+		if err != nil {
+			return dto, domain.NewValidationError("user_id", "can't parse uuid: "+err.Error())
+		}
+		dto.Id = id
+	}
+	return dto, nil
+}
+
+func DeserializeUser(u usecase.UserDTO) HandlingUser {
+	return HandlingUser{
+		UserId:    u.Id.String(),
+		Name:      u.Name,
+		Email:     u.Email,
+		Metadata:  u.Metadata,
+		CreatedAt: u.CreatedAt.UTC().Format(time.RFC3339Nano),
+		UpdatedAt: u.UpdatedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+func userIdFromPath(r *http.Request) (uuid.UUID, error) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		return uuid.Nil, badRequest("invalid user id: " + err.Error())
+	}
+	return id, nil
+}
+
+func readUser(r *http.Request) (usecase.UserDTO, error) {
+	var req HandlingUser
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return usecase.UserDTO{}, badRequest("invalid json")
+	}
+	return SerializeUser(req)
+}
+
+// parsePageQuery reads limit and offset.
+func parsePageQuery(q url.Values) (limit, offset int, err error) {
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			return 0, 0, domain.NewValidationError("limit", "must be an integer")
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil {
+			return 0, 0, domain.NewValidationError("offset", "must be an integer")
+		}
+	}
+	return limit, offset, nil
+}
+
+// CreateUser adds a user, the id is generated unless the body has one.
+func (h *UsersHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	input, err := readUser(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	id, err := h.UsersUC.NewUser(r.Context(), input)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	utils.MakeResponse(w, http.StatusCreated, map[string]string{
+		"message": fmt.Sprintf("new user_id: %s", id),
+	})
+}
+
+func (h *UsersHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePageQuery(r.URL.Query())
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	users, err := h.UsersUC.Users(r.Context(), limit, offset)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	res := make([]HandlingUser, 0, len(users))
+	for _, u := range users {
+		res = append(res, DeserializeUser(u))
+	}
+	utils.MakeResponse(w, http.StatusOK, res)
+}
+
+func (h *UsersHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	id, err := userIdFromPath(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	user, err := h.UsersUC.User(r.Context(), id)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	utils.MakeResponse(w, http.StatusOK, DeserializeUser(user))
+}
+
+// UpdateUser replaces the profile of a user, a user_id of the body
+// must match the path.
+func (h *UsersHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	id, err := userIdFromPath(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	input, err := readUser(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	if input.Id != uuid.Nil && input.Id != id {
+		MakeErrorResponse(w, domain.NewImmutableFieldError("user_id"))
+		return
+	}
+	if err := h.UsersUC.UpdateUser(r.Context(), id, input); err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	user, err := h.UsersUC.User(r.Context(), id)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	utils.MakeResponse(w, http.StatusOK, DeserializeUser(user))
+}
+
+// DeleteUser removes a user with all their subscriptions for good.
+func (h *UsersHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, err := userIdFromPath(r)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	deleted, err := h.UsersUC.DeleteUser(r.Context(), id)
+	if err != nil {
+		MakeErrorResponse(w, err)
+		return
+	}
+	utils.MakeResponse(w, http.StatusOK, DeleteUserResponse{DeletedSubs: deleted})
+}
@@ -0,0 +1,78 @@
+package delivery
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestUsers(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, api *testAPI) {
+		owner := uuid.NewString()
+		kept := api.createSub(t, owner, "Netflix", 100, "07-2025")
+		api.createSub(t, owner, "Spotify", 50, "07-2025")
+
+		// Subscriptions of unknown users create them.
+		var user HandlingUser
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, "/users/"+owner, ""), &user)
+		if user.UserId != owner || user.Name != "" || user.CreatedAt == "" {
+			t.Errorf("GET of subscription owner = %+v", user)
+		}
+
+		body := `{"name":"Ivan","email":"ivan@example.com","metadata":{"team":"a"}}`
+		var updated HandlingUser
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodPut, "/users/"+owner, body), &updated)
+		if updated.Name != "Ivan" || updated.Email != "ivan@example.com" || updated.Metadata["team"] != "a" || updated.CreatedAt != user.CreatedAt {
+			t.Errorf("PUT /users/%s = %+v", owner, updated)
+		}
+		for _, bad := range []string{
+			`{"name":"Ivan","email":"bad"}`,
+			fmt.Sprintf(`{"user_id":%q,"name":"Ivan"}`, uuid.NewString()),
+		} {
+			if rec := api.do(t, http.MethodPut, "/users/"+owner, bad); rec.Code != http.StatusUnprocessableEntity {
+				t.Errorf("PUT /users %s = %d %s, want 422", bad, rec.Code, rec.Body)
+			}
+		}
+
+		rec := api.mustDo(t, http.StatusCreated, http.MethodPost, "/users", `{"name":"Petr"}`)
+		var created struct {
+			Message string `json:"message"`
+		}
+		decode(t, rec, &created)
+		petr, ok := strings.CutPrefix(created.Message, "new user_id: ")
+		if _, err := uuid.Parse(petr); !ok || err != nil {
+			t.Fatalf("POST /users = %s, want the new id", rec.Body)
+		}
+		if rec := api.do(t, http.MethodPost, "/users", fmt.Sprintf(`{"user_id":%q}`, owner)); rec.Code != http.StatusConflict {
+			t.Errorf("POST of an existing user = %d %s, want 409", rec.Code, rec.Body)
+		}
+
+		var users []HandlingUser
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, "/users?limit=10", ""), &users)
+		if len(users) != 2 {
+			t.Errorf("GET /users = %+v, want 2 users", users)
+		}
+		var page []HandlingUser
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodGet, "/users?limit=1&offset=1", ""), &page)
+		if len(page) != 1 || len(users) == 2 && page[0].UserId != users[1].UserId {
+			t.Errorf("GET /users?offset=1 = %+v, want %+v", page, users[1:])
+		}
+
+		var deleted DeleteUserResponse
+		decode(t, api.mustDo(t, http.StatusOK, http.MethodDelete, "/users/"+owner, ""), &deleted)
+		if deleted.DeletedSubs != 2 {
+			t.Errorf("DELETE /users/%s = %+v, want 2 subscriptions deleted", owner, deleted)
+		}
+		for _, path := range []string{"/users/" + owner, fmt.Sprintf("/subscriptions/%d?include_deleted=true", kept)} {
+			if rec := api.do(t, http.MethodGet, path, ""); rec.Code != http.StatusNotFound {
+				t.Errorf("GET %s after the user is deleted = %d, want 404", path, rec.Code)
+			}
+		}
+		if rec := api.do(t, http.MethodGet, "/users/bad", ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET /users/bad = %d, want 400", rec.Code)
+		}
+	})
+}
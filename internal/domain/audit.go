@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditAction is the kind of a change in the audit log.
+type AuditAction string
+
+const (
+	AuditCreate  AuditAction = "create"
+	AuditUpdate  AuditAction = "update"
+	AuditDelete  AuditAction = "delete"
+	AuditRestore AuditAction = "restore"
+)
+
+// AuditEntry is a change of a subscription. Old is nil for creations,
+// New is the state right after the change. UserID is the owner of the
+// subscription.
+type AuditEntry struct {
+	Id        int64
+	SubId     SubID
+	UserID    uuid.UUID
+	Action    AuditAction
+	Actor     string
+	RequestID string
+	Old       *Subscription
+	New       *Subscription
+	At        time.Time
+}
+
+// AuditFilter selects the entries of the audit log in the order they
+// were written. Zero fields are not applied, From is inclusive and To is
+// exclusive. AfterId continues after the last entry of a page.
+type AuditFilter struct {
+	UserID  uuid.UUID
+	From    time.Time
+	To      time.Time
+	AfterId int64
+	Limit   int
+}
+
+func NewAuditFilter(userId uuid.UUID, from, to time.Time, afterId int64, limit int) (*AuditFilter, error) {
+	if limit == 0 {
+		limit = DefaultListLimit
+	}
+	if limit < 0 || limit > MaxListLimit {
+		return nil, NewValidationError("limit", "must be between 1 and 500")
+	}
+	if afterId < 0 {
+		return nil, NewValidationError("after_id", "must not be negative")
+	}
+	if !from.IsZero() && !to.IsZero() && !to.After(from) {
+		return nil, NewValidationError("to", "must be after from")
+	}
+	return &AuditFilter{UserID: userId, From: from, To: to, AfterId: afterId, Limit: limit}, nil
+}
+
+// Matches reports whether e passes the filter, apart from the limit.
+func (f AuditFilter) Matches(e AuditEntry) bool {
+	if f.UserID != uuid.Nil && e.UserID != f.UserID {
+		return false
+	}
+	if !f.From.IsZero() && e.At.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !e.At.Before(f.To) {
+		return false
+	}
+	return e.Id > f.AfterId
+}
+
+// AuditMeta is who makes the changes of a context and on behalf of
+// which request, the repositories record it with every change.
+type AuditMeta struct {
+	Actor     string
+	RequestID string
+}
+
+type auditMetaKey struct{}
+
+func WithAuditMeta(ctx context.Context, meta AuditMeta) context.Context {
+	return context.WithValue(ctx, auditMetaKey{}, meta)
+}
+
+// AuditMetaFrom returns the meta of ctx, zero when it has none.
+func AuditMetaFrom(ctx context.Context) AuditMeta {
+	meta, _ := ctx.Value(auditMetaKey{}).(AuditMeta)
+	return meta
+}
@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Principal is the authenticated caller of a context. The use cases
+// limit a principal to the subscriptions of its user unless it is an
+// admin. Contexts without a principal, the ones of the command line and
+// of the background jobs, are not limited.
+type Principal struct {
+	UserID uuid.UUID
+	Admin  bool
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the principal of ctx, false when it has none.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// RestrictedTo returns the user the caller of ctx is limited to, false
+// for admins and contexts without a principal.
+func RestrictedTo(ctx context.Context) (uuid.UUID, bool) {
+	p, ok := PrincipalFrom(ctx)
+	if !ok || p.Admin {
+		return uuid.Nil, false
+	}
+	return p.UserID, true
+}
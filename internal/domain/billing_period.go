@@ -0,0 +1,119 @@
+package domain
+
+import (
+	"math/big"
+	"time"
+)
+
+// BillingPeriod is how often a subscription is charged its price,
+// starting at its start date.
+type BillingPeriod string
+
+const (
+	BillingWeekly    BillingPeriod = "weekly"
+	BillingMonthly   BillingPeriod = "monthly"
+	BillingQuarterly BillingPeriod = "quarterly"
+	BillingYearly    BillingPeriod = "yearly"
+)
+
+// DefaultBillingPeriod is the period of subscriptions created without one.
+const DefaultBillingPeriod = BillingMonthly
+
+func (p BillingPeriod) Valid() bool {
+	switch p {
+	case BillingWeekly, BillingMonthly, BillingQuarterly, BillingYearly:
+		return true
+	}
+	return false
+}
+
+// Step returns the length of the period in months and days,
+// exactly one of them is not zero.
+func (p BillingPeriod) Step() (months, days int) {
+	switch p {
+	case BillingWeekly:
+		return 0, 7
+	case BillingQuarterly:
+		return 3, 0
+	case BillingYearly:
+		return 12, 0
+	}
+	return 1, 0
+}
+
+// Charge returns the date of the n-th charge of a subscription started at
+// start, counting from zero. Month steps are taken from start itself and
+// clamped to the end of shorter months, like date + interval in Postgres.
+func (p BillingPeriod) Charge(start time.Time, n int) time.Time {
+	months, days := p.Step()
+	if days != 0 {
+		return start.AddDate(0, 0, n*days)
+	}
+	y, m := start.Year(), start.Month()+time.Month(n*months)
+	first := time.Date(y, m, 1, 0, 0, 0, 0, start.Location())
+	day := start.Day()
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// Charges returns the dates sub is charged at in [from, to). The end
+// of the subscription is exclusive as well.
+func (s Subscription) Charges(from, to time.Time) []time.Time {
+	if !s.EndDate.IsZero() && s.EndDate.Before(to) {
+		to = s.EndDate
+	}
+	var res []time.Time
+	for n := 0; ; n++ {
+		c := s.BillingPeriod.Charge(s.StartDate, n)
+		if !c.Before(to) {
+			return res
+		}
+		if !c.Before(from) {
+			res = append(res, c)
+		}
+	}
+}
+
+// Cost returns what sub is billed in [from, to). Without proRata it is
+// the price times the number of Charges. With proRata every billing period
+// costs its price times the share of its days within [from, to) and before
+// the end of the subscription, the sum is rounded half away from zero.
+func (s Subscription) Cost(from, to time.Time, proRata bool) int {
+	if !proRata {
+		return s.Price * len(s.Charges(from, to))
+	}
+	if !s.EndDate.IsZero() && s.EndDate.Before(to) {
+		to = s.EndDate
+	}
+	sum := new(big.Rat)
+	for n := 0; ; n++ {
+		start := s.BillingPeriod.Charge(s.StartDate, n)
+		if !start.Before(to) {
+			break
+		}
+		end := s.BillingPeriod.Charge(s.StartDate, n+1)
+		lo, hi := start, end
+		if lo.Before(from) {
+			lo = from
+		}
+		if hi.After(to) {
+			hi = to
+		}
+		if !lo.Before(hi) {
+			continue
+		}
+		sum.Add(sum, big.NewRat(int64(s.Price)*days(lo, hi), days(start, end)))
+	}
+	// floor(sum + 1/2) for the non-negative sum.
+	num := new(big.Int).Mul(sum.Num(), big.NewInt(2))
+	num.Add(num, sum.Denom())
+	den := new(big.Int).Mul(sum.Denom(), big.NewInt(2))
+	return int(num.Quo(num, den).Int64())
+}
+
+// days counts the calendar days in [from, to).
+func days(from, to time.Time) int64 {
+	return int64(to.Sub(from).Round(24*time.Hour) / (24 * time.Hour))
+}
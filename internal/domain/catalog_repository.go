@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// ServiceRepository manages the service catalog. Storing a subscription
+// adds its service to the catalog when it is new, a name that is an
+// alias refers to the service of the alias.
+type ServiceRepository interface {
+	Service(ctx context.Context, id ServiceID) (Service, error)
+	// Services lists the services of category, or all of them for an
+	// empty one, by name.
+	Services(ctx context.Context, category string) ([]Service, error)
+	// SearchServices returns the services with a name or an alias that
+	// starts with the query first, by the number of subscriptions, then
+	// the ones with a similar one by trigrams, the closest first.
+	SearchServices(ctx context.Context, search ServiceSearch) ([]Service, error)
+	// StoreService and UpdateService fail with ErrConflict for a name
+	// another service has, those are merged instead, or an alias. Renaming a service
+	// renames it in all its subscriptions.
+	StoreService(ctx context.Context, svc Service) (ServiceID, error)
+	UpdateService(ctx context.Context, svc Service) error
+	// DeleteService fails with ErrConflict while subscriptions refer to
+	// the service, deleted ones included.
+	DeleteService(ctx context.Context, id ServiceID) error
+	// MergeServices moves the subscriptions of from to into and deletes
+	// from, returning the number of moved subscriptions. The moves are
+	// updates of the subscriptions in the audit log. The name and the
+	// aliases of from become aliases of into.
+	MergeServices(ctx context.Context, from, into ServiceID) (int, error)
+	// ServiceAliases lists the aliases of a service by name.
+	ServiceAliases(ctx context.Context, id ServiceID) ([]string, error)
+	// StoreServiceAlias fails with ErrConflict for a service name or an
+	// alias another service has.
+	StoreServiceAlias(ctx context.Context, alias ServiceAlias) error
+	DeleteServiceAlias(ctx context.Context, alias ServiceAlias) error
+}
+
+// UserRepository manages the users and their profiles.
+type UserRepository interface {
+	User(ctx context.Context, id uuid.UUID) (User, error)
+	// Users lists the users by id.
+	Users(ctx context.Context, limit, offset int) ([]User, error)
+	// StoreUser fails with ErrConflict for an existing user, the users
+	// stored with subscriptions are updated instead.
+	StoreUser(ctx context.Context, user User) error
+	UpdateUser(ctx context.Context, user User) error
+	// DeleteUser removes a user with all their subscriptions for good and
+	// returns the number of the subscriptions. The live ones are
+	// deleted in the audit log first.
+	DeleteUser(ctx context.Context, id uuid.UUID) (int, error)
+}
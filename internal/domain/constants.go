@@ -1,8 +1,79 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidSubRepo      = errors.New("subscription repository not defined")
+	ErrInvalidLogger       = errors.New("logger is not defined")
+	ErrInvalidRateProvider = errors.New("exchange rate provider is not defined")
+	ErrInvalidServiceRepo  = errors.New("service repository not defined")
+	ErrInvalidUserRepo     = errors.New("user repository not defined")
+)
 
+// Error kinds returned by repositories and use cases. Check them with errors.Is.
 var (
-	ErrInvalidSubRepo = errors.New("subscription repository not defined")
-	ErrInvalidLogger  = errors.New("logger is not defined")
+	ErrNotFound       = errors.New("not found")
+	ErrValidation     = errors.New("validation failed")
+	ErrConflict       = errors.New("conflict")
+	ErrImmutableField = errors.New("field cannot be changed")
+	// ErrPreconditionFailed is returned for a write of a version of a
+	// subscription that is not the stored one anymore.
+	ErrPreconditionFailed = errors.New("precondition failed")
+	// ErrKeyReused is returned for an idempotency key sent again with
+	// another request.
+	ErrKeyReused = errors.New("idempotency key reused")
+	// ErrForbidden is returned for a caller acting on behalf of another
+	// user or doing what only admins may do.
+	ErrForbidden = errors.New("forbidden")
 )
+
+// FieldError is an error of one of the kinds above caused by a particular field.
+type FieldError struct {
+	Kind  error
+	Field string
+	Msg   string
+}
+
+func (e *FieldError) Error() string {
+	if e.Field == "" {
+		return e.Msg
+	}
+	return e.Field + ": " + e.Msg
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Kind
+}
+
+func NewValidationError(field, msg string) error {
+	return &FieldError{Kind: ErrValidation, Field: field, Msg: msg}
+}
+
+func NewImmutableFieldError(field string) error {
+	return &FieldError{Kind: ErrImmutableField, Field: field, Msg: "cannot be changed"}
+}
+
+func NewConflictError(field, msg string) error {
+	return &FieldError{Kind: ErrConflict, Field: field, Msg: msg}
+}
+
+// NewVersionMismatchError reports a write of version want of subscription
+// subId that is at version cur.
+func NewVersionMismatchError(subId SubID, want, cur int) error {
+	return &FieldError{
+		Kind:  ErrPreconditionFailed,
+		Field: "version",
+		Msg:   fmt.Sprintf("subscription %d is at version %d, not %d", subId, cur, want),
+	}
+}
+
+func NewForbiddenError(field, msg string) error {
+	return &FieldError{Kind: ErrForbidden, Field: field, Msg: msg}
+}
+
+func NewKeyReusedError() error {
+	return &FieldError{Kind: ErrKeyReused, Field: "idempotency_key", Msg: "was used with another request"}
+}
@@ -0,0 +1,24 @@
+package domain
+
+import "context"
+
+// DefaultCurrency is the currency of subscriptions created without one
+// and of costs reports that don't ask for another.
+const DefaultCurrency = "RUB"
+
+var currencies = map[string]bool{
+	"RUB": true,
+	"USD": true,
+	"EUR": true,
+}
+
+// ValidCurrency reports whether subscriptions can be paid in the
+// ISO 4217 currency code.
+func ValidCurrency(code string) bool {
+	return currencies[code]
+}
+
+type RateProvider interface {
+	// Rate returns the price of one unit of from in units of to.
+	Rate(ctx context.Context, from, to string) (float64, error)
+}
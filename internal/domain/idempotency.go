@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// MaxIdempotencyKeyLen is the longest key a client may send.
+const MaxIdempotencyKeyLen = 255
+
+// IdempotencyKey makes the retries of a creation safe: the first request
+// with Key stores the subscription, the ones repeating it until
+// ExpiresAt get the same id back. RequestHash tells a repeat from another
+// request reusing the key. Keys are per Owner, the user sending them:
+// the same key of two users never meets.
+type IdempotencyKey struct {
+	Owner       uuid.UUID
+	Key         string
+	RequestHash string
+	ExpiresAt   time.Time
+}
+
+func NewIdempotencyKey(owner uuid.UUID, key, requestHash string, expiresAt time.Time) (*IdempotencyKey, error) {
+	if key == "" {
+		return nil, NewValidationError("idempotency_key", "must not be empty")
+	}
+	if len(key) > MaxIdempotencyKeyLen {
+		return nil, NewValidationError("idempotency_key", "must be at most 255 bytes")
+	}
+	for _, r := range key {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return nil, NewValidationError("idempotency_key", "must be printable ASCII")
+		}
+	}
+	if requestHash == "" {
+		return nil, NewValidationError("request_hash", "must not be empty")
+	}
+	if expiresAt.IsZero() {
+		return nil, NewValidationError("expires_at", "must be set")
+	}
+	return &IdempotencyKey{Owner: owner, Key: key, RequestHash: requestHash, ExpiresAt: expiresAt}, nil
+}
@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+type ServiceID int
+
+// Service is an entry of the service catalog. Name is the normalized
+// one the subscriptions refer to, DisplayName is how clients show it. The
+// default price is a hint for new subscriptions in DefaultCurrency,
+// empty DefaultCurrency means there is none.
+type Service struct {
+	Id              ServiceID
+	Name            string
+	DisplayName     string
+	Category        string
+	DefaultPrice    int
+	DefaultCurrency string
+	// SubsCount is the number of live subscriptions of the service, it
+	// is set on reads.
+	SubsCount int
+}
+
+// MaxCategoryLen is the longest category of a service.
+const MaxCategoryLen = 50
+
+func NewService(id ServiceID, name, displayName, category string, defaultPrice int, defaultCurrency string) (*Service, error) {
+	if id < 0 {
+		return nil, NewValidationError("service_id", "must be greater than 0")
+	}
+	name = NormalizeServiceName(name)
+	if name == "" {
+		return nil, NewValidationError("service_name", "must not be empty")
+	}
+	if utf8.RuneCountInString(category) > MaxCategoryLen {
+		return nil, NewValidationError("category", "must not be longer than 50 characters")
+	}
+	if defaultPrice < 0 {
+		return nil, NewValidationError("default_price", "must not be negative")
+	}
+	if defaultCurrency == "" && defaultPrice != 0 {
+		return nil, NewValidationError("default_currency", "must be set with default_price")
+	}
+	if defaultCurrency != "" && !ValidCurrency(defaultCurrency) {
+		return nil, NewValidationError("default_currency", "unsupported currency "+defaultCurrency)
+	}
+	return &Service{
+		Id:              id,
+		Name:            name,
+		DisplayName:     displayName,
+		Category:        category,
+		DefaultPrice:    defaultPrice,
+		DefaultCurrency: defaultCurrency,
+	}, nil
+}
+
+// NormalizeServiceName is the form service names are stored and compared
+// in: NFKC, case folded, without leading, trailing and repeated spaces.
+// "Yandex  Plus" and "YANDEX PLUS" are both "yandex plus".
+func NormalizeServiceName(name string) string {
+	name = cases.Fold().String(norm.NFKC.String(name))
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// ServiceAlias is another name of a service, e.g. a transliteration.
+// Subscriptions and filters with the alias refer to the service.
+type ServiceAlias struct {
+	Alias     string
+	ServiceId ServiceID
+}
+
+func NewServiceAlias(serviceId ServiceID, alias string) (*ServiceAlias, error) {
+	if serviceId <= 0 {
+		return nil, NewValidationError("service_id", "must be greater than 0")
+	}
+	alias = NormalizeServiceName(alias)
+	if alias == "" {
+		return nil, NewValidationError("alias", "must not be empty")
+	}
+	return &ServiceAlias{Alias: alias, ServiceId: serviceId}, nil
+}
+
+const (
+	DefaultSearchLimit = 10
+	MaxSearchLimit     = 50
+)
+
+// ServiceSearch looks services up by the start of a name or a similar
+// name, aliases included. Query is normalized like the names.
+type ServiceSearch struct {
+	Query string
+	Limit int
+}
+
+func NewServiceSearch(query string, limit int) (*ServiceSearch, error) {
+	query = NormalizeServiceName(query)
+	if query == "" {
+		return nil, NewValidationError("q", "must not be empty")
+	}
+	if limit == 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit < 0 || limit > MaxSearchLimit {
+		return nil, NewValidationError("limit", "must be between 1 and 50")
+	}
+	return &ServiceSearch{Query: query, Limit: limit}, nil
+}
@@ -0,0 +1,46 @@
+package domain
+
+// TxMode says what happens to the other subscriptions of a write of
+// many when one of them fails.
+type TxMode string
+
+const (
+	// TxAllOrNothing writes nothing if any subscription fails.
+	TxAllOrNothing TxMode = "all_or_nothing"
+	// TxBestEffort writes the subscriptions that don't fail.
+	TxBestEffort TxMode = "best_effort"
+)
+
+func (m TxMode) Valid() bool {
+	return m == TxAllOrNothing || m == TxBestEffort
+}
+
+// StoreResult is the outcome of one subscription of StoreSubs: the id
+// it was stored with or the validation or conflict error it failed with.
+type StoreResult struct {
+	SubId SubID
+	Err   error
+}
+
+// SubOpKind is the kind of a write of ApplySubs.
+type SubOpKind string
+
+const (
+	SubOpCreate SubOpKind = "create"
+	SubOpUpdate SubOpKind = "update"
+	SubOpDelete SubOpKind = "delete"
+)
+
+func (k SubOpKind) Valid() bool {
+	return k == SubOpCreate || k == SubOpUpdate || k == SubOpDelete
+}
+
+// SubOp is one write of ApplySubs. Sub is the subscription to create,
+// Update is the update as taken by UpdateSub or holds only the SubId
+// and the Version to delete. Versions are checked against the
+// subscriptions as they were before the batch.
+type SubOp struct {
+	Kind   SubOpKind
+	Sub    Subscription
+	Update SubUpdate
+}
@@ -2,15 +2,54 @@ package domain
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+// SubscriptionRepository records every write of subscriptions in the
+// audit log within the same transaction, with the AuditMeta of ctx.
 type SubscriptionRepository interface {
-	Sub(ctx context.Context, subId SubID) (Subscription, error)
-	UserSubs(ctx context.Context, userId uuid.UUID) ([]Subscription, error)
+	// Sub and UserSubs skip the soft-deleted subscriptions unless
+	// includeDeleted is set, the costs always skip them.
+	Sub(ctx context.Context, subId SubID, includeDeleted bool) (Subscription, error)
+	UserSubs(ctx context.Context, userId uuid.UUID, includeDeleted bool) ([]Subscription, error)
 	StoreSub(ctx context.Context, sub Subscription) (SubID, error)
-	UpdateSub(ctx context.Context, sub Subscription) error
-	DeleteSub(ctx context.Context, subId SubID) error
-	SubsTotalCosts(ctx context.Context, filter SubsFilter) (int, []SubID, error)
+	// StoreSubOnce is StoreSub for the first call with the key until the
+	// key expires. The later ones with the same request hash return the
+	// id stored by the first one and replayed set, those with another
+	// hash fail with ErrKeyReused. A failed store doesn't keep the key.
+	StoreSubOnce(ctx context.Context, key IdempotencyKey, sub Subscription) (subId SubID, replayed bool, err error)
+	// PurgeIdempotencyKeys removes the keys expired before expiredBefore
+	// and returns their number.
+	PurgeIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int, error)
+	// StoreSubs stores subs in one transaction, results follow the order
+	// of subs. Results have ids only when the subscriptions were written:
+	// not on a dry run and not in TxAllOrNothing mode with failed ones.
+	// The error is returned when the call failed as a whole.
+	StoreSubs(ctx context.Context, subs []Subscription, mode TxMode, dryRun bool) ([]StoreResult, error)
+	// UpdateSub and DeleteSub check the version to change, unless it is
+	// zero, under the lock of the subscription and fail with
+	// ErrPreconditionFailed on a mismatch.
+	UpdateSub(ctx context.Context, upd SubUpdate) error
+	// ApplySubs runs ops in one transaction, results follow the order of
+	// ops and have the ids of the created, updated or deleted
+	// subscriptions. In TxAllOrNothing mode a failed op leaves nothing
+	// written and no ids, the ops after it may be left unchecked.
+	ApplySubs(ctx context.Context, ops []SubOp, mode TxMode) ([]StoreResult, error)
+	// DeleteSub soft-deletes a subscription, RestoreSub brings it back
+	// and PurgeSubs removes the ones deleted before deletedBefore for
+	// good, returning their number.
+	DeleteSub(ctx context.Context, subId SubID, version int) error
+	RestoreSub(ctx context.Context, subId SubID) error
+	PurgeSubs(ctx context.Context, deletedBefore time.Time) (int, error)
+	// SubsTotalCosts returns the costs by currency.
+	SubsTotalCosts(ctx context.Context, filter SubsFilter) (map[string]int, []SubID, error)
+	SubsCostsByGroup(ctx context.Context, filter SubsFilter, groupBy CostsGroupBy) ([]CostsGroup, error)
+	SubsMonthlyCosts(ctx context.Context, filter SubsFilter) ([]MonthCosts, error)
+	ListSubs(ctx context.Context, query SubsListQuery) (SubsPage, error)
+	// SubHistory returns the audit log of a subscription, the oldest
+	// entry first. It outlives the purge of the subscription.
+	SubHistory(ctx context.Context, subId SubID) ([]AuditEntry, error)
+	AuditLog(ctx context.Context, filter AuditFilter) ([]AuditEntry, error)
 }
@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SubUpdate changes the non-nil fields of subscription SubId. EndDate
+// pointing to the zero time clears the end date. UserID is never
+// changed: a non-nil one has to be the owner. A non-zero Version is the
+// version to change.
+type SubUpdate struct {
+	SubId         SubID
+	UserID        *uuid.UUID
+	ServiceName   *string
+	Price         *int
+	Currency      *string
+	BillingPeriod *BillingPeriod
+	StartDate     *time.Time
+	EndDate       *time.Time
+	Version       int
+}
+
+// NewSubscriptionUpdate checks the given fields of u on their own, the
+// repository checks the result against the stored subscription.
+func NewSubscriptionUpdate(u SubUpdate) (*SubUpdate, error) {
+	if u.SubId <= 0 {
+		return nil, NewValidationError("sub_id", "must be greater than 0")
+	}
+	if u.UserID != nil && *u.UserID == uuid.Nil {
+		return nil, NewValidationError("user_id", "cannot be nil")
+	}
+	if u.ServiceName != nil {
+		name := NormalizeServiceName(*u.ServiceName)
+		if name == "" {
+			return nil, NewValidationError("service_name", "must not be empty")
+		}
+		u.ServiceName = &name
+	}
+	if u.Price != nil && *u.Price < 0 {
+		return nil, NewValidationError("price", "must not be negative")
+	}
+	if u.Currency != nil && !ValidCurrency(*u.Currency) {
+		return nil, NewValidationError("currency", "unsupported currency "+*u.Currency)
+	}
+	if u.BillingPeriod != nil && !u.BillingPeriod.Valid() {
+		return nil, NewValidationError("billing_period", "must be one of weekly, monthly, quarterly, yearly")
+	}
+	if u.StartDate != nil && u.StartDate.IsZero() {
+		return nil, NewValidationError("start_date", "must not be zero")
+	}
+	if u.StartDate != nil && u.EndDate != nil && !u.EndDate.IsZero() && u.EndDate.Before(*u.StartDate) {
+		return nil, NewValidationError("end_date", "must be greater than start_date")
+	}
+	return &u, nil
+}
+
+// Empty reports whether u changes nothing.
+func (u SubUpdate) Empty() bool {
+	return u.ServiceName == nil && u.Price == nil && u.Currency == nil && u.BillingPeriod == nil &&
+		u.StartDate == nil && u.EndDate == nil
+}
+
+// Apply returns sub with the changes of u.
+func (u SubUpdate) Apply(sub Subscription) Subscription {
+	if u.ServiceName != nil {
+		sub.ServiceName = *u.ServiceName
+	}
+	if u.Price != nil {
+		sub.Price = *u.Price
+	}
+	if u.Currency != nil {
+		sub.Currency = *u.Currency
+	}
+	if u.BillingPeriod != nil {
+		sub.BillingPeriod = *u.BillingPeriod
+	}
+	if u.StartDate != nil {
+		sub.StartDate = *u.StartDate
+	}
+	if u.EndDate != nil {
+		sub.EndDate = *u.EndDate
+	}
+	return sub
+}
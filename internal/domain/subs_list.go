@@ -0,0 +1,162 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+type SubsSortField string
+
+const (
+	SortBySubId       SubsSortField = "sub_id"
+	SortByPrice       SubsSortField = "price"
+	SortByStartDate   SubsSortField = "start_date"
+	SortByServiceName SubsSortField = "service_name"
+)
+
+func (f SubsSortField) Valid() bool {
+	switch f {
+	case SortBySubId, SortByPrice, SortByStartDate, SortByServiceName:
+		return true
+	}
+	return false
+}
+
+// SubsListFilter narrows a listing down. Zero fields are not applied,
+// date ranges are inclusive.
+type SubsListFilter struct {
+	UserID      uuid.UUID
+	ServiceName string
+	MinPrice    int
+	MaxPrice    int
+	// ActiveAt keeps subscriptions charged for that month.
+	ActiveAt  time.Time
+	StartFrom time.Time
+	StartTo   time.Time
+	EndFrom   time.Time
+	EndTo     time.Time
+	// IncludeDeleted keeps the soft-deleted subscriptions.
+	IncludeDeleted bool
+}
+
+// SubsCursor is the position after the last subscription of a page.
+type SubsCursor struct {
+	SubId       SubID
+	Price       int
+	StartDate   time.Time
+	ServiceName string
+}
+
+func CursorAfter(sub Subscription) *SubsCursor {
+	return &SubsCursor{
+		SubId:       sub.SubId,
+		Price:       sub.Price,
+		StartDate:   sub.StartDate,
+		ServiceName: sub.ServiceName,
+	}
+}
+
+type SubsListQuery struct {
+	Filter SubsListFilter
+	SortBy SubsSortField
+	Desc   bool
+	Limit  int
+	Offset int
+	After  *SubsCursor
+	// NoTotal skips counting the matching subscriptions, Total of the
+	// page is 0 then.
+	NoTotal bool
+}
+
+type SubsPage struct {
+	Subs []Subscription
+	// Next is nil on the last page.
+	Next  *SubsCursor
+	Total int
+}
+
+func NewSubsListQuery(filter SubsListFilter, sortBy SubsSortField, desc bool, limit, offset int, after *SubsCursor) (*SubsListQuery, error) {
+	if sortBy == "" {
+		sortBy = SortBySubId
+	}
+	if !sortBy.Valid() {
+		return nil, NewValidationError("sort", "unknown sort field "+string(sortBy))
+	}
+	if limit == 0 {
+		limit = DefaultListLimit
+	}
+	if limit < 0 || limit > MaxListLimit {
+		return nil, NewValidationError("limit", "must be between 1 and 500")
+	}
+	if offset < 0 {
+		return nil, NewValidationError("offset", "must not be negative")
+	}
+	if offset > 0 && after != nil {
+		return nil, NewValidationError("cursor", "can't be used together with offset")
+	}
+	if filter.MinPrice < 0 {
+		return nil, NewValidationError("min_price", "must not be negative")
+	}
+	if filter.MaxPrice < 0 {
+		return nil, NewValidationError("max_price", "must not be negative")
+	}
+	if filter.MaxPrice != 0 && filter.MaxPrice < filter.MinPrice {
+		return nil, NewValidationError("max_price", "must not be less than min_price")
+	}
+	if !filter.StartTo.IsZero() && filter.StartTo.Before(filter.StartFrom) {
+		return nil, NewValidationError("start_to", "must not be before start_from")
+	}
+	if !filter.EndTo.IsZero() && filter.EndTo.Before(filter.EndFrom) {
+		return nil, NewValidationError("end_to", "must not be before end_from")
+	}
+	return &SubsListQuery{
+		Filter: filter,
+		SortBy: sortBy,
+		Desc:   desc,
+		Limit:  limit,
+		Offset: offset,
+		After:  after,
+	}, nil
+}
+
+// Matches reports whether sub passes the filter.
+func (f SubsListFilter) Matches(sub Subscription) bool {
+	if !f.IncludeDeleted && sub.Deleted() {
+		return false
+	}
+	if f.UserID != uuid.Nil && sub.UserID != f.UserID {
+		return false
+	}
+	if f.ServiceName != "" && sub.ServiceName != f.ServiceName {
+		return false
+	}
+	if f.MinPrice != 0 && sub.Price < f.MinPrice {
+		return false
+	}
+	if f.MaxPrice != 0 && sub.Price > f.MaxPrice {
+		return false
+	}
+	if !f.ActiveAt.IsZero() && (sub.StartDate.After(f.ActiveAt) || !sub.EndDate.IsZero() && !sub.EndDate.After(f.ActiveAt)) {
+		return false
+	}
+	if !f.StartFrom.IsZero() && sub.StartDate.Before(f.StartFrom) {
+		return false
+	}
+	if !f.StartTo.IsZero() && sub.StartDate.After(f.StartTo) {
+		return false
+	}
+	// Open subscriptions end after any date.
+	if !f.EndFrom.IsZero() && !sub.EndDate.IsZero() && sub.EndDate.Before(f.EndFrom) {
+		return false
+	}
+	if !f.EndTo.IsZero() && (sub.EndDate.IsZero() || sub.EndDate.After(f.EndTo)) {
+		return false
+	}
+	return true
+}
@@ -1,7 +1,6 @@
 package domain
 
 import (
-	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,58 +9,135 @@ import (
 type SubID int
 
 type Subscription struct {
-	SubId       SubID
-	UserID      uuid.UUID
-	ServiceName string
-	Price       int
-	StartDate   time.Time
-	EndDate     time.Time
+	SubId         SubID
+	UserID        uuid.UUID
+	ServiceName   string
+	Price         int
+	Currency      string
+	BillingPeriod BillingPeriod
+	StartDate     time.Time
+	EndDate       time.Time
+	// DeletedAt is the time of the soft delete, zero for the ones that
+	// were not deleted.
+	DeletedAt time.Time
+	// Version starts at 1 and grows with every write. In an update a
+	// non-zero Version is the one the caller expects to change.
+	Version int
 }
 
-func NewSubscription(subId SubID, userID uuid.UUID, serviceName string, price int, startDate time.Time, endDate time.Time) (*Subscription, error) {
+func (s Subscription) Deleted() bool {
+	return !s.DeletedAt.IsZero()
+}
+
+func NewSubscription(subId SubID, userID uuid.UUID, serviceName string, price int, currency string, billingPeriod BillingPeriod, startDate time.Time, endDate time.Time) (*Subscription, error) {
 	if subId < 0 {
-		return nil, errors.New("subId must be greater than 0")
+		return nil, NewValidationError("sub_id", "must be greater than 0")
 	}
+	serviceName = NormalizeServiceName(serviceName)
 	if serviceName == "" {
-		return nil, errors.New("serviceName must not be empty")
+		return nil, NewValidationError("service_name", "must not be empty")
 	}
 	if price < 0 {
-		return nil, errors.New("price must be greater than 0")
+		return nil, NewValidationError("price", "must not be negative")
+	}
+	if !ValidCurrency(currency) {
+		return nil, NewValidationError("currency", "unsupported currency "+currency)
+	}
+	if !billingPeriod.Valid() {
+		return nil, NewValidationError("billing_period", "must be one of weekly, monthly, quarterly, yearly")
 	}
 	if startDate.IsZero() {
-		return nil, errors.New("startDate must not be zero")
+		return nil, NewValidationError("start_date", "must not be zero")
 	}
 	if !endDate.IsZero() && endDate.Before(startDate) {
-		return nil, errors.New("endDate must be greater than startDate")
+		return nil, NewValidationError("end_date", "must be greater than start_date")
 	}
 	return &Subscription{
-		SubId:       subId,
-		UserID:      userID,
-		ServiceName: serviceName,
-		Price:       price,
-		StartDate:   startDate,
-		EndDate:     endDate,
+		SubId:         subId,
+		UserID:        userID,
+		ServiceName:   serviceName,
+		Price:         price,
+		Currency:      currency,
+		BillingPeriod: billingPeriod,
+		StartDate:     startDate,
+		EndDate:       endDate,
 	}, nil
 }
 
+// SubsFilter selects subscriptions for costs. uuid.Nil UserID and
+// empty ServiceName match all users and all services, ServiceName may
+// be an alias.
 type SubsFilter struct {
 	StartDate   time.Time
 	EndDate     time.Time
 	UserID      uuid.UUID
 	ServiceName string
+	// ProRata bills the part of every billing period within the filter
+	// period instead of the whole price at the start of the period.
+	ProRata bool
+}
+
+// PeriodEnd is the exclusive end of the costs period: EndDate or,
+// when it is open, the current month.
+func (f SubsFilter) PeriodEnd() time.Time {
+	if f.EndDate.IsZero() {
+		now := time.Now()
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return f.EndDate
 }
 
-func NewSubsFilter(startDate time.Time, endDate time.Time, userID uuid.UUID, serviceName string) (*SubsFilter, error) {
+func NewSubsFilter(startDate time.Time, endDate time.Time, userID uuid.UUID, serviceName string, proRata bool) (*SubsFilter, error) {
 	if startDate.IsZero() {
-		return nil, errors.New("startDate must not be zero")
+		return nil, NewValidationError("start_date", "must not be zero")
 	}
 	if !endDate.IsZero() && endDate.Before(startDate) {
-		return nil, errors.New("endDate must be greater than startDate")
+		return nil, NewValidationError("end_date", "must be greater than start_date")
 	}
 	return &SubsFilter{
 		StartDate:   startDate,
 		EndDate:     endDate,
 		UserID:      userID,
-		ServiceName: serviceName,
+		ServiceName: NormalizeServiceName(serviceName),
+		ProRata:     proRata,
 	}, nil
 }
+
+type CostsGroupBy string
+
+const (
+	GroupByNone    CostsGroupBy = ""
+	GroupByService CostsGroupBy = "service"
+	GroupByUser    CostsGroupBy = "user"
+	GroupByMonth   CostsGroupBy = "month"
+)
+
+func (g CostsGroupBy) Valid() bool {
+	switch g {
+	case GroupByNone, GroupByService, GroupByUser, GroupByMonth:
+		return true
+	}
+	return false
+}
+
+// CostsGroup is one row of a costs breakdown. Key is a service name,
+// a user id or a month in MM-YYYY form. Costs of a key in different
+// currencies make separate groups.
+type CostsGroup struct {
+	Key      string
+	Currency string
+	Total    int
+	SubIds   []SubID
+}
+
+type SubCost struct {
+	SubId    SubID
+	Amount   int
+	Currency string
+}
+
+// MonthCosts lists the subscriptions charged for a month.
+type MonthCosts struct {
+	Month time.Time
+	Subs  []SubCost
+}
@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"net/mail"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Limits of the profile metadata of a user.
+const (
+	MaxUserMetadataKeys   = 50
+	MaxUserMetadataKeyLen = 64
+	MaxUserMetadataValLen = 1024
+)
+
+// User is the owner of subscriptions with a profile. Every user id of a
+// subscription has a User, the ones stored with a subscription start
+// with an empty profile.
+type User struct {
+	Id       uuid.UUID
+	Name     string
+	Email    string
+	Metadata map[string]string
+	// CreatedAt and UpdatedAt are set by the repository.
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func NewUser(id uuid.UUID, name, email string, metadata map[string]string) (*User, error) {
+	if id == uuid.Nil {
+		return nil, NewValidationError("user_id", "cannot be nil")
+	}
+	if email != "" {
+		if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+			return nil, NewValidationError("email", "invalid address "+email)
+		}
+	}
+	if len(metadata) > MaxUserMetadataKeys {
+		return nil, NewValidationError("metadata", "must have at most 50 keys")
+	}
+	for k, v := range metadata {
+		if k == "" || len(k) > MaxUserMetadataKeyLen {
+			return nil, NewValidationError("metadata", "keys must be 1 to 64 bytes long")
+		}
+		if len(v) > MaxUserMetadataValLen {
+			return nil, NewValidationError("metadata", "value of "+k+" must be at most 1024 bytes long")
+		}
+	}
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	return &User{Id: id, Name: name, Email: email, Metadata: metadata}, nil
+}
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
@@ -18,28 +19,57 @@ type Logger interface {
 }
 
 type LogrusLogger struct {
-	log *logrus.Logger
+	log  *logrus.Logger
+	file *os.File
 }
 
 type Fields *logrus.Fields
 type Entry *logrus.Entry
 
+// Options describe the log of NewLogrusLoggerWith.
+type Options struct {
+	// Path is the file the log is appended to, or "stdout".
+	Path string
+	// Level is a logrus level name, e.g. "info".
+	Level string
+	// Format is "json" or "text".
+	Format string
+}
+
 func NewLogrusLogger(accessLogPath string) (*LogrusLogger, error) {
+	return NewLogrusLoggerWith(Options{Path: accessLogPath, Level: "info", Format: "json"})
+}
+
+// NewLogrusLoggerWith opens the log described by opts.
+func NewLogrusLoggerWith(opts Options) (*LogrusLogger, error) {
 	var Log LogrusLogger
 	Log.log = logrus.New()
-	Log.log.SetFormatter(&logrus.JSONFormatter{})
+	if opts.Format == "text" {
+		Log.log.SetFormatter(&logrus.TextFormatter{DisableColors: true})
+	} else {
+		Log.log.SetFormatter(&logrus.JSONFormatter{})
+	}
+	level, err := logrus.ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	Log.log.SetLevel(level)
 
-	if err := os.MkdirAll(filepath.Dir(accessLogPath), 0755); err != nil {
+	if opts.Path == "stdout" {
+		Log.log.SetOutput(os.Stdout)
+		return &Log, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(opts.Path), 0755); err != nil {
 		return nil, fmt.Errorf("failed to create log directory: %w", err)
 	}
 
-	accessFile, err := os.OpenFile(accessLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	accessFile, err := os.OpenFile(opts.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
 		return nil, err
 	}
 
+	Log.file = accessFile
 	Log.log.SetOutput(accessFile)
-	Log.log.SetLevel(logrus.InfoLevel)
 
 	return &Log, nil
 }
@@ -67,3 +97,12 @@ func (l *LogrusLogger) Warn(args ...any) {
 func (l *LogrusLogger) Error(args ...any) {
 	l.log.Error(args...)
 }
+
+// Close closes the log file. Nothing is written after that.
+func (l *LogrusLogger) Close() error {
+	l.log.SetOutput(io.Discard)
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
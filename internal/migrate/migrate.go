@@ -0,0 +1,447 @@
+// Package migrate applies the SQL migrations of the database and keeps
+// track of the applied versions in the schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrInvalidPool    = errors.New("postgres pool is not defined")
+	ErrUnknownVersion = errors.New("unknown migration version")
+	ErrSchemaMismatch = errors.New("schema doesn't match the migrations")
+)
+
+// lockID is the key of the advisory lock held while migrating, so that
+// instances starting together don't apply the same migration twice.
+const lockID = 7_301_945_208
+
+// scratchSchema is where Baseline runs the migrations to compare the
+// tables they create with the ones of the database.
+const scratchSchema = "migrate_baseline"
+
+const createVersionsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// Step is the part of a migration SQL can't express. It runs after the
+// up file in the same transaction. A step is of the schema of its own
+// version: it must not rely on code written for later ones.
+type Step func(ctx context.Context, tx pgx.Tx) error
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+	// Step is nil for migrations written in SQL only.
+	Step Step
+}
+
+// Status of a migration, AppliedAt is zero for pending ones.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load reads the migrations from the root of fsys ordered by version.
+// Every version needs both an up and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, f := range files {
+		m := fileName.FindStringSubmatch(path.Base(f))
+		if m == nil {
+			return nil, fmt.Errorf("migration %s: name must be NNN_name.up.sql or NNN_name.down.sql", f)
+		}
+		version, _ := strconv.Atoi(m[1])
+		data, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(data)
+		} else {
+			mig.Down = string(data)
+		}
+	}
+
+	res := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s: both up and down files are required", mig.Version, mig.Name)
+		}
+		res = append(res, *mig)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+	return res, nil
+}
+
+type Migrator struct {
+	p          *pgxpool.Pool
+	migrations []Migration
+}
+
+// NewMigrator runs the migrations of fsys with steps, the Go steps by
+// version.
+func NewMigrator(p *pgxpool.Pool, fsys fs.FS, steps map[int]Step) (*Migrator, error) {
+	if p == nil {
+		return nil, ErrInvalidPool
+	}
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	for version, step := range steps {
+		i := slices.IndexFunc(migrations, func(mig Migration) bool { return mig.Version == version })
+		if i < 0 {
+			return nil, fmt.Errorf("step of %w: %d", ErrUnknownVersion, version)
+		}
+		migrations[i].Step = step
+	}
+	return &Migrator{p: p, migrations: migrations}, nil
+}
+
+// Latest is the version of the last known migration, 0 without any.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status lists the known migrations and the applied ones that are not
+// known any more, ordered by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var res []Status
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			at, ok := applied[mig.Version]
+			res = append(res, Status{Migration: mig, Applied: ok, AppliedAt: at})
+			delete(applied, mig.Version)
+		}
+		for v, at := range applied {
+			res = append(res, Status{Migration: Migration{Version: v}, Applied: true, AppliedAt: at})
+		}
+		return nil
+	})
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+	return res, err
+}
+
+// Version is the last applied version, 0 for an empty database.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	var res int
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		var err error
+		res, err = currentVersion(ctx, conn)
+		return err
+	})
+	return res, err
+}
+
+// Up applies all pending migrations and returns them.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	return m.To(ctx, m.Latest())
+}
+
+// Down reverts the last applied migration, if there is one.
+func (m *Migrator) Down(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		cur, err := currentVersion(ctx, conn)
+		if err != nil || cur == 0 {
+			return err
+		}
+		prev := 0
+		for _, mig := range m.migrations {
+			if mig.Version < cur {
+				prev = mig.Version
+			}
+		}
+		done, err = m.migrateTo(ctx, conn, cur, prev)
+		return err
+	})
+	return done, err
+}
+
+// To applies or reverts migrations until version is the last applied
+// one and returns them in the order they were run. Version 0 reverts
+// everything. Every migration runs in its own transaction: on error the
+// database stays at the last successful one.
+func (m *Migrator) To(ctx context.Context, version int) ([]Migration, error) {
+	if version != 0 && !m.known(version) {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	var done []Migration
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		cur, err := currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		done, err = m.migrateTo(ctx, conn, cur, version)
+		return err
+	})
+	return done, err
+}
+
+// Baseline records the migrations up to version as applied without
+// running them, for databases created before the versions were tracked.
+// It fails with ErrSchemaMismatch unless the tables of the database have
+// the columns the migrations up to version create.
+func (m *Migrator) Baseline(ctx context.Context, version int) error {
+	if !m.known(version) {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	return m.locked(ctx, func(conn *pgxpool.Conn) error {
+		return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if err := m.checkSchema(ctx, tx, version); err != nil {
+				return err
+			}
+			for _, mig := range m.migrations {
+				if mig.Version > version {
+					break
+				}
+				if _, err := tx.Exec(ctx,
+					`INSERT INTO schema_migrations (version, name) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+					mig.Version, mig.Name); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// checkSchema runs the up files up to version in a scratch schema and
+// compares its columns with the ones of the current schema. The scratch
+// schema is created in a savepoint that is always rolled back; steps
+// change data only and are not run.
+func (m *Migrator) checkSchema(ctx context.Context, tx pgx.Tx, version int) error {
+	var live string
+	if err := tx.QueryRow(ctx, `SELECT current_schema()`).Scan(&live); err != nil {
+		return fmt.Errorf("can't read current schema: %w", err)
+	}
+	scratch, err := tx.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = scratch.Rollback(ctx) }()
+
+	if _, err := scratch.Exec(ctx, `CREATE SCHEMA `+scratchSchema); err != nil {
+		return fmt.Errorf("can't create scratch schema: %w", err)
+	}
+	if _, err := scratch.Exec(ctx,
+		`SET LOCAL search_path TO `+scratchSchema+`, `+pgx.Identifier{live}.Sanitize()); err != nil {
+		return err
+	}
+	for _, mig := range m.migrations {
+		if mig.Version > version {
+			break
+		}
+		if _, err := scratch.Exec(ctx, mig.Up); err != nil {
+			return fmt.Errorf("migration %d_%s up in scratch schema: %w", mig.Version, mig.Name, err)
+		}
+	}
+	want, err := columns(ctx, scratch, scratchSchema)
+	if err != nil {
+		return err
+	}
+	got, err := columns(ctx, scratch, live)
+	if err != nil {
+		return err
+	}
+	if diff := diffColumns(got, want); len(diff) > 0 {
+		return fmt.Errorf("%w up to version %d: %s", ErrSchemaMismatch, version, strings.Join(diff, "; "))
+	}
+	return nil
+}
+
+// columns maps the columns of the tables in schema, as table.column, to
+// their type and nullability. schema_migrations is left out.
+func columns(ctx context.Context, tx pgx.Tx, schema string) (map[string]string, error) {
+	rows, err := tx.Query(ctx, `
+SELECT table_name || '.' || column_name,
+       data_type || CASE WHEN is_nullable = 'YES' THEN ' NULL' ELSE ' NOT NULL' END
+FROM information_schema.columns
+WHERE table_schema = $1 AND table_name <> 'schema_migrations'`, schema)
+	if err != nil {
+		return nil, fmt.Errorf("can't read columns of %s: %w", schema, err)
+	}
+	res := make(map[string]string)
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			return nil, err
+		}
+		res[name] = typ
+	}
+	return res, rows.Err()
+}
+
+// diffColumns describes how the columns got differ from want, sorted.
+func diffColumns(got, want map[string]string) []string {
+	var diff []string
+	for name, typ := range want {
+		switch g, ok := got[name]; {
+		case !ok:
+			diff = append(diff, fmt.Sprintf("missing %s %s", name, typ))
+		case g != typ:
+			diff = append(diff, fmt.Sprintf("%s is %s, want %s", name, g, typ))
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			diff = append(diff, "unexpected "+name)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+func (m *Migrator) known(version int) bool {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Migrator) migrateTo(ctx context.Context, conn *pgxpool.Conn, cur, target int) ([]Migration, error) {
+	var done []Migration
+	if target >= cur {
+		for _, mig := range m.migrations {
+			if mig.Version <= cur || mig.Version > target {
+				continue
+			}
+			if err := apply(ctx, conn, mig, true); err != nil {
+				return done, err
+			}
+			done = append(done, mig)
+		}
+		return done, nil
+	}
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mig := m.migrations[i]
+		if mig.Version > cur || mig.Version <= target {
+			continue
+		}
+		if err := apply(ctx, conn, mig, false); err != nil {
+			return done, err
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+func apply(ctx context.Context, conn *pgxpool.Conn, mig Migration, up bool) error {
+	err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if up {
+			if _, err := tx.Exec(ctx, mig.Up); err != nil {
+				return err
+			}
+			if mig.Step != nil {
+				if err := mig.Step(ctx, tx); err != nil {
+					return err
+				}
+			}
+			_, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, mig.Version, mig.Name)
+			return err
+		}
+		if _, err := tx.Exec(ctx, mig.Down); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+		return err
+	})
+	if err != nil {
+		direction := "up"
+		if !up {
+			direction = "down"
+		}
+		return fmt.Errorf("migration %d_%s %s: %w", mig.Version, mig.Name, direction, err)
+	}
+	return nil
+}
+
+// locked runs f on a connection holding the migration lock.
+func (m *Migrator) locked(ctx context.Context, f func(conn *pgxpool.Conn) error) error {
+	conn, err := m.p.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("can't acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return fmt.Errorf("can't take migration lock: %w", err)
+	}
+	defer func() {
+		_, _ = conn.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, lockID)
+	}()
+
+	if _, err := conn.Exec(ctx, createVersionsTable); err != nil {
+		return fmt.Errorf("can't create schema_migrations: %w", err)
+	}
+	return f(conn)
+}
+
+func currentVersion(ctx context.Context, conn *pgxpool.Conn) (int, error) {
+	var v int
+	err := conn.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&v)
+	if err != nil {
+		return 0, fmt.Errorf("can't read schema version: %w", err)
+	}
+	return v, nil
+}
+
+func appliedVersions(ctx context.Context, conn *pgxpool.Conn) (map[int]time.Time, error) {
+	rows, err := conn.Query(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("can't read applied migrations: %w", err)
+	}
+	res := make(map[int]time.Time)
+	for rows.Next() {
+		var v int
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		res[v] = at
+	}
+	return res, rows.Err()
+}
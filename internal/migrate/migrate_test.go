@@ -0,0 +1,374 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samantonio28/subscriber-inf/internal/migrate"
+	"github.com/samantonio28/subscriber-inf/internal/service"
+	"github.com/samantonio28/subscriber-inf/internal/service/repotest"
+	"github.com/samantonio28/subscriber-inf/migrations"
+)
+
+func file(data string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(data)}
+}
+
+// testFS has three migrations: a table, a column of it and a second table.
+var testFS = fstest.MapFS{
+	"001_accounts.up.sql":   file(`CREATE TABLE accounts (id INTEGER PRIMARY KEY)`),
+	"001_accounts.down.sql": file(`DROP TABLE accounts`),
+	"002_name.up.sql":       file(`ALTER TABLE accounts ADD COLUMN name TEXT NOT NULL DEFAULT ''`),
+	"002_name.down.sql":     file(`ALTER TABLE accounts DROP COLUMN name`),
+	"003_orders.up.sql":     file(`CREATE TABLE orders (id INTEGER PRIMARY KEY, account_id INTEGER REFERENCES accounts(id))`),
+	"003_orders.down.sql":   file(`DROP TABLE orders`),
+}
+
+func newMigrator(t *testing.T, pool *pgxpool.Pool, fsys fs.FS, steps map[int]migrate.Step) *migrate.Migrator {
+	t.Helper()
+	m, err := migrate.NewMigrator(pool, fsys, steps)
+	if err != nil {
+		t.Fatalf("NewMigrator(): %v", err)
+	}
+	return m
+}
+
+func versions(migs []migrate.Migration) []int {
+	res := make([]int, 0, len(migs))
+	for _, mig := range migs {
+		res = append(res, mig.Version)
+	}
+	return res
+}
+
+func checkRan(t *testing.T, name string, migs []migrate.Migration, want ...int) {
+	t.Helper()
+	got := versions(migs)
+	if len(got) != len(want) {
+		t.Fatalf("%s ran %v, want %v", name, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s ran %v, want %v", name, got, want)
+		}
+	}
+}
+
+func checkVersion(t *testing.T, m *migrate.Migrator, want int) {
+	t.Helper()
+	got, err := m.Version(context.Background())
+	if err != nil {
+		t.Fatalf("Version(): %v", err)
+	}
+	if got != want {
+		t.Fatalf("Version() = %d, want %d", got, want)
+	}
+}
+
+// hasColumn tells whether table.column exists, or just table when column
+// is empty.
+func hasColumn(t *testing.T, pool *pgxpool.Pool, table, column string) bool {
+	t.Helper()
+	var n int
+	err := pool.QueryRow(context.Background(), `
+SELECT count(*) FROM information_schema.columns
+WHERE table_schema = current_schema() AND table_name = $1 AND ($2 = '' OR column_name = $2)`,
+		table, column).Scan(&n)
+	if err != nil {
+		t.Fatalf("read columns: %v", err)
+	}
+	return n > 0
+}
+
+func TestLoad(t *testing.T) {
+	migs, err := migrate.Load(fstest.MapFS{
+		"010_b.up.sql":   file("SELECT 10"),
+		"010_b.down.sql": file("SELECT -10"),
+		"002_a.up.sql":   file("SELECT 2"),
+		"002_a.down.sql": file("SELECT -2"),
+		"embed.go":       file("package migrations"),
+	})
+	if err != nil {
+		t.Fatalf("Load(): %v", err)
+	}
+	if len(migs) != 2 || migs[0].Version != 2 || migs[1].Version != 10 {
+		t.Fatalf("Load() = %+v, want versions 2 and 10", migs)
+	}
+	if migs[0].Name != "a" || migs[0].Up != "SELECT 2" || migs[0].Down != "SELECT -2" {
+		t.Errorf("Load()[0] = %+v", migs[0])
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		fsys fstest.MapFS
+		want string
+	}{
+		{"Name", fstest.MapFS{"init.sql": file("SELECT 1")}, "name must be"},
+		{"Direction", fstest.MapFS{"001_init.sideways.sql": file("SELECT 1")}, "name must be"},
+		{"TwoNames", fstest.MapFS{"001_a.up.sql": file("SELECT 1"), "001_b.down.sql": file("SELECT 1")}, "two names"},
+		{"NoDown", fstest.MapFS{"001_a.up.sql": file("SELECT 1")}, "both up and down"},
+		{"NoUp", fstest.MapFS{"001_a.down.sql": file("SELECT 1")}, "both up and down"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := migrate.Load(tc.fsys)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Load() error = %v, want one about %s", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestUpDownTo(t *testing.T) {
+	ctx := context.Background()
+	pool := repotest.PgDatabase(t)
+	m := newMigrator(t, pool, testFS, nil)
+
+	checkVersion(t, m, 0)
+	ran, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up(): %v", err)
+	}
+	checkRan(t, "Up()", ran, 1, 2, 3)
+	checkVersion(t, m, 3)
+	if !hasColumn(t, pool, "orders", "account_id") || !hasColumn(t, pool, "accounts", "name") {
+		t.Fatal("Up() didn't create the tables")
+	}
+	if ran, err = m.Up(ctx); err != nil || len(ran) != 0 {
+		t.Fatalf("second Up() = %v, %v, want nothing to run", versions(ran), err)
+	}
+
+	if ran, err = m.Down(ctx); err != nil {
+		t.Fatalf("Down(): %v", err)
+	}
+	checkRan(t, "Down()", ran, 3)
+	checkVersion(t, m, 2)
+	if hasColumn(t, pool, "orders", "") {
+		t.Error("Down() kept orders")
+	}
+
+	if ran, err = m.To(ctx, 0); err != nil {
+		t.Fatalf("To(0): %v", err)
+	}
+	checkRan(t, "To(0)", ran, 2, 1)
+	checkVersion(t, m, 0)
+	if hasColumn(t, pool, "accounts", "") {
+		t.Error("To(0) kept accounts")
+	}
+	if ran, err = m.Down(ctx); err != nil || len(ran) != 0 {
+		t.Fatalf("Down() of an empty database = %v, %v, want nothing to run", versions(ran), err)
+	}
+
+	if ran, err = m.To(ctx, 2); err != nil {
+		t.Fatalf("To(2): %v", err)
+	}
+	checkRan(t, "To(2)", ran, 1, 2)
+	if _, err := m.To(ctx, 4); !errors.Is(err, migrate.ErrUnknownVersion) {
+		t.Errorf("To(4) error = %v, want ErrUnknownVersion", err)
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status(): %v", err)
+	}
+	if len(status) != 3 || !status[0].Applied || !status[1].Applied || status[2].Applied || status[1].AppliedAt.IsZero() {
+		t.Errorf("Status() = %+v, want 1 and 2 applied", status)
+	}
+}
+
+func TestStep(t *testing.T) {
+	ctx := context.Background()
+	pool := repotest.PgDatabase(t)
+	m := newMigrator(t, pool, testFS, map[int]migrate.Step{
+		2: func(ctx context.Context, tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, `INSERT INTO accounts (id, name) VALUES (1, 'from step')`)
+			return err
+		},
+	})
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up(): %v", err)
+	}
+	var name string
+	if err := pool.QueryRow(ctx, `SELECT name FROM accounts WHERE id = 1`).Scan(&name); err != nil || name != "from step" {
+		t.Errorf("account of the step = %q, %v", name, err)
+	}
+
+	if _, err := migrate.NewMigrator(pool, testFS, map[int]migrate.Step{4: nil}); !errors.Is(err, migrate.ErrUnknownVersion) {
+		t.Errorf("NewMigrator() with a step of version 4 error = %v, want ErrUnknownVersion", err)
+	}
+}
+
+func TestFailingMigration(t *testing.T) {
+	failing := fstest.MapFS{
+		"004_broken.up.sql":   file(`CREATE TABLE broken (id INTEGER); SELECT 1/0`),
+		"004_broken.down.sql": file(`DROP TABLE broken`),
+	}
+	for name, f := range testFS {
+		failing[name] = f
+	}
+	failStep := map[int]migrate.Step{
+		3: func(ctx context.Context, tx pgx.Tx) error { return errors.New("step failed") },
+	}
+
+	cases := []struct {
+		name  string
+		fsys  fs.FS
+		steps map[int]migrate.Step
+		// ran are the migrations done before the failing one, table is
+		// the one the failing migration must not leave behind.
+		ran   []int
+		table string
+	}{
+		{"SQL", failing, nil, []int{1, 2, 3}, "broken"},
+		{"Step", testFS, failStep, []int{1, 2}, "orders"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pool := repotest.PgDatabase(t)
+			m := newMigrator(t, pool, tc.fsys, tc.steps)
+			ran, err := m.Up(context.Background())
+			if err == nil {
+				t.Fatal("Up() = nil, want the error of the failing migration")
+			}
+			checkRan(t, "Up()", ran, tc.ran...)
+			checkVersion(t, m, tc.ran[len(tc.ran)-1])
+			if hasColumn(t, pool, tc.table, "") {
+				t.Errorf("the failing migration left %s behind", tc.table)
+			}
+		})
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Matching", func(t *testing.T) {
+		pool := repotest.PgDatabase(t)
+		if _, err := pool.Exec(ctx, `CREATE TABLE accounts (id INTEGER PRIMARY KEY, name TEXT NOT NULL)`); err != nil {
+			t.Fatal(err)
+		}
+		m := newMigrator(t, pool, testFS, nil)
+		if err := m.Baseline(ctx, 2); err != nil {
+			t.Fatalf("Baseline(2): %v", err)
+		}
+		checkVersion(t, m, 2)
+		ran, err := m.Up(ctx)
+		if err != nil {
+			t.Fatalf("Up(): %v", err)
+		}
+		checkRan(t, "Up()", ran, 3)
+		if hasScratch(t, pool) {
+			t.Error("Baseline() left its scratch schema behind")
+		}
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		pool := repotest.PgDatabase(t)
+		if _, err := pool.Exec(ctx, `CREATE TABLE accounts (id TEXT PRIMARY KEY)`); err != nil {
+			t.Fatal(err)
+		}
+		m := newMigrator(t, pool, testFS, nil)
+		err := m.Baseline(ctx, 2)
+		if !errors.Is(err, migrate.ErrSchemaMismatch) {
+			t.Fatalf("Baseline(2) error = %v, want ErrSchemaMismatch", err)
+		}
+		for _, want := range []string{"accounts.id is text", "missing accounts.name"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("Baseline(2) error = %v, want %q in it", err, want)
+			}
+		}
+		checkVersion(t, m, 0)
+		if hasScratch(t, pool) {
+			t.Error("Baseline() left its scratch schema behind")
+		}
+	})
+
+	t.Run("UnknownVersion", func(t *testing.T) {
+		m := newMigrator(t, repotest.PgDatabase(t), testFS, nil)
+		if err := m.Baseline(ctx, 4); !errors.Is(err, migrate.ErrUnknownVersion) {
+			t.Errorf("Baseline(4) error = %v, want ErrUnknownVersion", err)
+		}
+	})
+
+	// The released service created its database from 001_init_db only.
+	t.Run("Released", func(t *testing.T) {
+		pool := repotest.PgDatabase(t)
+		initDB, err := fs.ReadFile(migrations.FS, "001_init_db.up.sql")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pool.Exec(ctx, string(initDB)); err != nil {
+			t.Fatalf("001_init_db: %v", err)
+		}
+		m := newMigrator(t, pool, migrations.FS, service.MigrationSteps)
+		if err := m.Baseline(ctx, 5); !errors.Is(err, migrate.ErrSchemaMismatch) {
+			t.Errorf("Baseline(5) error = %v, want ErrSchemaMismatch", err)
+		}
+		if err := m.Baseline(ctx, 1); err != nil {
+			t.Fatalf("Baseline(1): %v", err)
+		}
+		if _, err := m.Up(ctx); err != nil {
+			t.Fatalf("Up() after Baseline(1): %v", err)
+		}
+		checkVersion(t, m, m.Latest())
+	})
+}
+
+func hasScratch(t *testing.T, pool *pgxpool.Pool) bool {
+	t.Helper()
+	var ok bool
+	err := pool.QueryRow(context.Background(),
+		`SELECT EXISTS (SELECT 1 FROM information_schema.schemata WHERE schema_name = 'migrate_baseline')`).Scan(&ok)
+	if err != nil {
+		t.Fatalf("read schemas: %v", err)
+	}
+	return ok
+}
+
+// TestLock holds the migration lock in a step of one migrator and checks
+// that a second one waits for it.
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	pool := repotest.PgDatabase(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	first := newMigrator(t, pool, testFS, map[int]migrate.Step{
+		1: func(ctx context.Context, tx pgx.Tx) error {
+			close(started)
+			<-release
+			return nil
+		},
+	})
+	second := newMigrator(t, pool, testFS, nil)
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := first.Up(ctx)
+		errc <- err
+	}()
+	<-started
+
+	waitCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if _, err := second.Up(waitCtx); err == nil {
+		t.Fatal("second Up() ran while the first one held the lock")
+	}
+
+	close(release)
+	if err := <-errc; err != nil {
+		t.Fatalf("first Up(): %v", err)
+	}
+	ran, err := second.Up(ctx)
+	if err != nil || len(ran) != 0 {
+		t.Errorf("second Up() after the first = %v, %v, want nothing to run", versions(ran), err)
+	}
+	checkVersion(t, second, 3)
+}
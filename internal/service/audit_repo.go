@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+)
+
+const (
+	// GetCreatedSub reads the subscription added last by the session.
+	GetCreatedSub = GetAllData + `
+WHERE us.sub_id = currval(pg_get_serial_sequence('subscriptions', 'sub_id'));
+`
+	GetSubsByIds = GetAllData + `
+WHERE us.sub_id = ANY($1);
+`
+	PutAuditEntry = `
+INSERT INTO audit_log (sub_id, user_id, action, actor, request_id, old_value, new_value)
+VALUES ($1, $2, $3, $4, $5, $6, $7);
+`
+	getAuditEntries = `
+SELECT audit_id, sub_id, user_id, action, actor, request_id, old_value, new_value, created_at
+FROM audit_log`
+	GetSubHistory = getAuditEntries + `
+WHERE sub_id = $1
+ORDER BY audit_id;
+`
+)
+
+// auditAction is the audit action of a batch op, they share the names.
+func auditAction(kind domain.SubOpKind) domain.AuditAction {
+	return domain.AuditAction(kind)
+}
+
+// auditSub is a state of a subscription in audit_log.
+type auditSub struct {
+	SubId         int        `json:"sub_id"`
+	UserId        uuid.UUID  `json:"user_id"`
+	ServiceName   string     `json:"service_name"`
+	Price         int        `json:"price"`
+	Currency      string     `json:"currency"`
+	BillingPeriod string     `json:"billing_period"`
+	StartDate     string     `json:"start_date"`
+	EndDate       string     `json:"end_date,omitempty"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+	// Version is absent in the entries written before migration 008.
+	Version int `json:"version,omitempty"`
+}
+
+// auditValue is the JSON of sub, nil for no state.
+func auditValue(sub *domain.Subscription) (any, error) {
+	if sub == nil {
+		return nil, nil
+	}
+	v := auditSub{
+		SubId:         int(sub.SubId),
+		UserId:        sub.UserID,
+		ServiceName:   sub.ServiceName,
+		Price:         sub.Price,
+		Currency:      sub.Currency,
+		BillingPeriod: string(sub.BillingPeriod),
+		StartDate:     sub.StartDate.Format(time.DateOnly),
+		Version:       sub.Version,
+	}
+	if !sub.EndDate.IsZero() {
+		v.EndDate = sub.EndDate.Format(time.DateOnly)
+	}
+	if sub.Deleted() {
+		deletedAt := sub.DeletedAt.UTC()
+		v.DeletedAt = &deletedAt
+	}
+	return json.Marshal(v)
+}
+
+func parseAuditValue(data []byte) (*domain.Subscription, error) {
+	if data == nil {
+		return nil, nil
+	}
+	var v auditSub
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("invalid audit value: %w", err)
+	}
+	sub := &domain.Subscription{
+		SubId:         domain.SubID(v.SubId),
+		UserID:        v.UserId,
+		ServiceName:   v.ServiceName,
+		Price:         v.Price,
+		Currency:      v.Currency,
+		BillingPeriod: domain.BillingPeriod(v.BillingPeriod),
+		Version:       v.Version,
+	}
+	var err error
+	if sub.StartDate, err = time.Parse(time.DateOnly, v.StartDate); err != nil {
+		return nil, fmt.Errorf("invalid audit value: %w", err)
+	}
+	if v.EndDate != "" {
+		if sub.EndDate, err = time.Parse(time.DateOnly, v.EndDate); err != nil {
+			return nil, fmt.Errorf("invalid audit value: %w", err)
+		}
+	}
+	if v.DeletedAt != nil {
+		sub.DeletedAt = *v.DeletedAt
+	}
+	return sub, nil
+}
+
+// writeAudit appends entries to the audit log within tx, with the
+// AuditMeta of ctx. Entries without New get the current state of their
+// subscriptions, so it is called after the changes.
+func writeAudit(ctx context.Context, tx pgx.Tx, entries []domain.AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	var ids []int
+	for _, e := range entries {
+		if e.New == nil {
+			ids = append(ids, int(e.SubId))
+		}
+	}
+	cur := make(map[domain.SubID]domain.Subscription, len(ids))
+	if len(ids) > 0 {
+		rows, err := tx.Query(ctx, GetSubsByIds, ids)
+		if err != nil {
+			return fmt.Errorf("failed to read changed subscriptions: %w", err)
+		}
+		subs, err := scanSubs(rows, len(ids))
+		if err != nil {
+			return fmt.Errorf("failed to read changed subscriptions: %w", err)
+		}
+		for _, sub := range subs {
+			cur[sub.SubId] = sub
+		}
+	}
+
+	meta := domain.AuditMetaFrom(ctx)
+	batch := &pgx.Batch{}
+	for _, e := range entries {
+		if e.New == nil {
+			sub, ok := cur[e.SubId]
+			if !ok {
+				return fmt.Errorf("changed subscription %d is missing", e.SubId)
+			}
+			e.New = &sub
+		}
+		oldVal, err := auditValue(e.Old)
+		if err != nil {
+			return err
+		}
+		newVal, err := auditValue(e.New)
+		if err != nil {
+			return err
+		}
+		batch.Queue(PutAuditEntry, int(e.SubId), e.New.UserID, string(e.Action), meta.Actor, meta.RequestID, oldVal, newVal)
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+func scanAuditEntries(rows pgx.Rows) ([]domain.AuditEntry, error) {
+	defer rows.Close()
+
+	res := make([]domain.AuditEntry, 0)
+	for rows.Next() {
+		var e domain.AuditEntry
+		var subId int
+		var action string
+		var oldVal, newVal []byte
+		if err := rows.Scan(&e.Id, &subId, &e.UserID, &action, &e.Actor, &e.RequestID, &oldVal, &newVal, &e.At); err != nil {
+			return nil, err
+		}
+		e.SubId = domain.SubID(subId)
+		e.Action = domain.AuditAction(action)
+		var err error
+		if e.Old, err = parseAuditValue(oldVal); err != nil {
+			return nil, err
+		}
+		if e.New, err = parseAuditValue(newVal); err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return res, nil
+}
+
+// SubHistory of a subscription stored before the audit log existed is
+// empty, not ErrNotFound.
+func (s *SubRepo) SubHistory(ctx context.Context, subId domain.SubID) ([]domain.AuditEntry, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	rows, err := s.p.Query(ctx, GetSubHistory, int(subId))
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	entries, err := scanAuditEntries(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		return entries, nil
+	}
+	var exists bool
+	if err := s.p.QueryRow(ctx, SubExists, int(subId)).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("subscription %d: %w", subId, domain.ErrNotFound)
+	}
+	return entries, nil
+}
+
+func (s *SubRepo) AuditLog(ctx context.Context, f domain.AuditFilter) ([]domain.AuditEntry, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	conds := []string{}
+	args := []any{}
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.UserID != uuid.Nil {
+		add("user_id = $%d", f.UserID)
+	}
+	if !f.From.IsZero() {
+		add("created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("created_at < $%d", f.To)
+	}
+	if f.AfterId > 0 {
+		add("audit_id > $%d", f.AfterId)
+	}
+	query := getAuditEntries + whereSQL(conds) + fmt.Sprintf(" ORDER BY audit_id LIMIT $%d", len(args)+1)
+	args = append(args, f.Limit)
+
+	rows, err := s.p.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return scanAuditEntries(rows)
+}
@@ -0,0 +1,4 @@
+package service
+
+// Similarity exports similarity to the tests against pg_trgm.
+var Similarity = similarity
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+)
+
+const (
+	// PutIdempotencyKey takes the key $2 of user $1 unless a live one
+	// holds it. An insert racing with another waits for its transaction,
+	// so a retry of an unfinished request sees its result.
+	PutIdempotencyKey = `
+INSERT INTO idempotency_keys (user_id, idem_key, request_hash, expires_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, idem_key) DO UPDATE
+SET request_hash = EXCLUDED.request_hash, sub_id = NULL, created_at = now(), expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.expires_at <= now();
+`
+	GetIdempotencyKey = `
+SELECT request_hash, sub_id FROM idempotency_keys WHERE user_id = $1 AND idem_key = $2;
+`
+	SetIdempotencyKeySub = `
+UPDATE idempotency_keys SET sub_id = $3 WHERE user_id = $1 AND idem_key = $2;
+`
+	PurgeIdempotencyKeys = `
+DELETE FROM idempotency_keys WHERE expires_at < $1;
+`
+)
+
+func (s *SubRepo) StoreSubOnce(ctx context.Context, key domain.IdempotencyKey, sub domain.Subscription) (domain.SubID, bool, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer rollback(ctx, tx)
+
+	res, err := tx.Exec(ctx, PutIdempotencyKey, key.Owner, key.Key, key.RequestHash, key.ExpiresAt)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to put idempotency key: %w", err)
+	}
+	if res.RowsAffected() == 0 {
+		subId, err := replaySub(ctx, tx, key)
+		return subId, err == nil, err
+	}
+
+	subId, err := storeSub(ctx, tx, sub)
+	if err != nil {
+		return 0, false, err
+	}
+	if _, err := tx.Exec(ctx, SetIdempotencyKeySub, key.Owner, key.Key, int(subId)); err != nil {
+		return 0, false, fmt.Errorf("failed to save idempotency key: %w", err)
+	}
+	if err := writeAudit(ctx, tx, []domain.AuditEntry{{SubId: subId, Action: domain.AuditCreate}}); err != nil {
+		return 0, false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return subId, false, nil
+}
+
+// replaySub returns the subscription stored with the live key.
+func replaySub(ctx context.Context, tx pgx.Tx, key domain.IdempotencyKey) (domain.SubID, error) {
+	var hash string
+	var subId *int
+	err := tx.QueryRow(ctx, GetIdempotencyKey, key.Owner, key.Key).Scan(&hash, &subId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Purged right after the conflict, it has expired anyway.
+		return 0, fmt.Errorf("idempotency key expired, retry the request: %w", domain.ErrConflict)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read idempotency key: %w", err)
+	}
+	if hash != key.RequestHash {
+		return 0, domain.NewKeyReusedError()
+	}
+	if subId == nil {
+		return 0, fmt.Errorf("idempotency key %q has no subscription", key.Key)
+	}
+	return domain.SubID(*subId), nil
+}
+
+func (s *SubRepo) PurgeIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	res, err := s.p.Exec(ctx, PurgeIdempotencyKeys, expiredBefore)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+	return int(res.RowsAffected()), nil
+}
@@ -0,0 +1,1173 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/pkg/utils"
+)
+
+type memSub struct {
+	subId     domain.SubID
+	userId    uuid.UUID
+	serviceId int
+	price     int
+	currency  string
+	period    domain.BillingPeriod
+	startDate time.Time
+	endDate   time.Time
+	deletedAt time.Time
+	version   int
+}
+
+// MemSubRepo is an in-memory domain.SubscriptionRepository that follows
+// the same rules as SubRepo, including the constraints enforced by the schema.
+type MemSubRepo struct {
+	mu            sync.RWMutex
+	subs          map[domain.SubID]memSub
+	services      map[int]domain.Service
+	serviceIds    map[string]int
+	aliases       map[string]int
+	users         map[uuid.UUID]domain.User
+	lastSubId     int
+	lastServiceId int
+	audit         []domain.AuditEntry
+	keys          map[memKeyID]memKey
+}
+
+// memKeyID identifies an idempotency key, keys are per owner.
+type memKeyID struct {
+	owner uuid.UUID
+	key   string
+}
+
+// memKey is an idempotency key with the subscription it stored.
+type memKey struct {
+	requestHash string
+	subId       domain.SubID
+	expiresAt   time.Time
+}
+
+func NewMemSubRepo() *MemSubRepo {
+	return &MemSubRepo{
+		subs:       make(map[domain.SubID]memSub),
+		services:   make(map[int]domain.Service),
+		serviceIds: make(map[string]int),
+		aliases:    make(map[string]int),
+		users:      make(map[uuid.UUID]domain.User),
+		keys:       make(map[memKeyID]memKey),
+	}
+}
+
+func (s *MemSubRepo) Sub(ctx context.Context, subId domain.SubID, includeDeleted bool) (domain.Subscription, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Subscription{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ms, ok := s.subs[subId]
+	if !ok || !includeDeleted && !ms.deletedAt.IsZero() {
+		return domain.Subscription{}, fmt.Errorf("subscription %d: %w", subId, domain.ErrNotFound)
+	}
+	return s.toDomain(ms), nil
+}
+
+func (s *MemSubRepo) UserSubs(ctx context.Context, userId uuid.UUID, includeDeleted bool) ([]domain.Subscription, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.userSubs(userId, includeDeleted), nil
+}
+
+func (s *MemSubRepo) StoreSub(ctx context.Context, sub domain.Subscription) (domain.SubID, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms, err := newMemSub(sub)
+	if err != nil {
+		return 0, err
+	}
+	return s.putSub(domain.AuditMetaFrom(ctx), ms, sub.ServiceName), nil
+}
+
+func (s *MemSubRepo) StoreSubOnce(ctx context.Context, key domain.IdempotencyKey, sub domain.Subscription) (domain.SubID, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := memKeyID{owner: key.Owner, key: key.Key}
+	if mk, ok := s.keys[id]; ok && mk.expiresAt.After(time.Now()) {
+		if mk.requestHash != key.RequestHash {
+			return 0, false, domain.NewKeyReusedError()
+		}
+		return mk.subId, true, nil
+	}
+	ms, err := newMemSub(sub)
+	if err != nil {
+		return 0, false, err
+	}
+	subId := s.putSub(domain.AuditMetaFrom(ctx), ms, sub.ServiceName)
+	s.keys[id] = memKey{requestHash: key.RequestHash, subId: subId, expiresAt: key.ExpiresAt}
+	return subId, false, nil
+}
+
+// newMemSub checks sub the way the database constraints do.
+func newMemSub(sub domain.Subscription) (memSub, error) {
+	if err := checkServiceName(sub.ServiceName); err != nil {
+		return memSub{}, err
+	}
+	ms := memSub{
+		userId:    sub.UserID,
+		price:     sub.Price,
+		currency:  sub.Currency,
+		period:    sub.BillingPeriod,
+		startDate: dateOnly(sub.StartDate),
+		endDate:   dateOnly(sub.EndDate),
+		version:   1,
+	}
+	if err := checkSubRow(ms); err != nil {
+		return memSub{}, fmt.Errorf("failed to insert sub: %w", err)
+	}
+	return ms, nil
+}
+
+// putSub stores a checked subscription under a new id.
+func (s *MemSubRepo) putSub(meta domain.AuditMeta, ms memSub, serviceName string) domain.SubID {
+	ms.serviceId = s.putServiceName(serviceName)
+	if _, ok := s.users[ms.userId]; !ok {
+		now := time.Now()
+		s.users[ms.userId] = domain.User{Id: ms.userId, Metadata: map[string]string{}, CreatedAt: now, UpdatedAt: now}
+	}
+	s.lastSubId++
+	ms.subId = domain.SubID(s.lastSubId)
+	s.subs[ms.subId] = ms
+	s.record(meta, domain.AuditCreate, ms.subId, nil)
+	return ms.subId
+}
+
+// record appends the change of a stored subscription to the audit log,
+// old is its state before the change.
+func (s *MemSubRepo) record(meta domain.AuditMeta, action domain.AuditAction, subId domain.SubID, old *domain.Subscription) {
+	sub := s.toDomain(s.subs[subId])
+	s.audit = append(s.audit, domain.AuditEntry{
+		Id:        int64(len(s.audit) + 1),
+		SubId:     subId,
+		UserID:    sub.UserID,
+		Action:    action,
+		Actor:     meta.Actor,
+		RequestID: meta.RequestID,
+		Old:       old,
+		New:       &sub,
+		At:        time.Now(),
+	})
+}
+
+func (s *MemSubRepo) StoreSubs(ctx context.Context, subs []domain.Subscription, mode domain.TxMode, dryRun bool) ([]domain.StoreResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]domain.StoreResult, len(subs))
+	checked := make([]memSub, len(subs))
+	failed := false
+	for i, sub := range subs {
+		ms, err := newMemSub(sub)
+		if err != nil {
+			results[i].Err = err
+			failed = true
+			continue
+		}
+		checked[i] = ms
+	}
+	if dryRun || (failed && mode == domain.TxAllOrNothing) {
+		return results, nil
+	}
+	meta := domain.AuditMetaFrom(ctx)
+	for i, sub := range subs {
+		if results[i].Err == nil {
+			results[i].SubId = s.putSub(meta, checked[i], sub.ServiceName)
+		}
+	}
+	return results, nil
+}
+
+func (s *MemSubRepo) UpdateSub(ctx context.Context, upd domain.SubUpdate) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateSub(domain.AuditMetaFrom(ctx), upd)
+}
+
+func (s *MemSubRepo) updateSub(meta domain.AuditMeta, upd domain.SubUpdate) error {
+	ms, ok := s.subs[upd.SubId]
+	if !ok || !ms.deletedAt.IsZero() {
+		return fmt.Errorf("subscription %d: %w", upd.SubId, domain.ErrNotFound)
+	}
+	old := s.toDomain(ms)
+	if err := checkVersion(old, upd.Version); err != nil {
+		return err
+	}
+	if err := checkUpdate(upd, old); err != nil {
+		return err
+	}
+
+	next := upd.Apply(old)
+	updated := ms
+	updated.price = next.Price
+	updated.currency = next.Currency
+	updated.period = next.BillingPeriod
+	updated.startDate = dateOnly(next.StartDate)
+	updated.endDate = dateOnly(next.EndDate)
+	if err := checkSubRow(updated); err != nil {
+		return fmt.Errorf("fail: %w", err)
+	}
+
+	if upd.ServiceName != nil {
+		updated.serviceId = s.putServiceName(*upd.ServiceName)
+	}
+	updated.version++
+	s.subs[upd.SubId] = updated
+	s.record(meta, domain.AuditUpdate, upd.SubId, &old)
+	return nil
+}
+
+func (s *MemSubRepo) DeleteSub(ctx context.Context, subId domain.SubID, version int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteSub(domain.AuditMetaFrom(ctx), subId, version)
+}
+
+func (s *MemSubRepo) deleteSub(meta domain.AuditMeta, subId domain.SubID, version int) error {
+	ms, ok := s.subs[subId]
+	if !ok || !ms.deletedAt.IsZero() {
+		return fmt.Errorf("no subs deleted: subscription %d: %w", subId, domain.ErrNotFound)
+	}
+	old := s.toDomain(ms)
+	if err := checkVersion(old, version); err != nil {
+		return err
+	}
+	ms.deletedAt = time.Now()
+	ms.version++
+	s.subs[subId] = ms
+	s.record(meta, domain.AuditDelete, subId, &old)
+	return nil
+}
+
+func (s *MemSubRepo) RestoreSub(ctx context.Context, subId domain.SubID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms, ok := s.subs[subId]
+	if !ok {
+		return fmt.Errorf("subscription %d: %w", subId, domain.ErrNotFound)
+	}
+	if ms.deletedAt.IsZero() {
+		return domain.NewConflictError("", fmt.Sprintf("subscription %d is not deleted", subId))
+	}
+	old := s.toDomain(ms)
+	ms.deletedAt = time.Time{}
+	ms.version++
+	s.subs[subId] = ms
+	s.record(domain.AuditMetaFrom(ctx), domain.AuditRestore, subId, &old)
+	return nil
+}
+
+func (s *MemSubRepo) PurgeSubs(ctx context.Context, deletedBefore time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for id, ms := range s.subs {
+		if !ms.deletedAt.IsZero() && ms.deletedAt.Before(deletedBefore) {
+			delete(s.subs, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (s *MemSubRepo) PurgeIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for key, mk := range s.keys {
+		if mk.expiresAt.Before(expiredBefore) {
+			delete(s.keys, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (s *MemSubRepo) SubHistory(ctx context.Context, subId domain.SubID) ([]domain.AuditEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := make([]domain.AuditEntry, 0)
+	for _, e := range s.audit {
+		if e.SubId == subId {
+			entries = append(entries, e)
+		}
+	}
+	if _, ok := s.subs[subId]; !ok && len(entries) == 0 {
+		return nil, fmt.Errorf("subscription %d: %w", subId, domain.ErrNotFound)
+	}
+	return entries, nil
+}
+
+func (s *MemSubRepo) AuditLog(ctx context.Context, f domain.AuditFilter) ([]domain.AuditEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := make([]domain.AuditEntry, 0)
+	for _, e := range s.audit {
+		if len(entries) == f.Limit {
+			break
+		}
+		if f.Matches(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// ApplySubs runs ops one by one. In TxAllOrNothing mode it stops at the
+// first failed op and puts back the state before the call.
+func (s *MemSubRepo) ApplySubs(ctx context.Context, ops []domain.SubOp, mode domain.TxMode) ([]domain.StoreResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var saved *MemSubRepo
+	if mode == domain.TxAllOrNothing {
+		saved = s.clone()
+	}
+	// Versions are checked against the state before the batch, like
+	// SubRepo does.
+	before := make(map[domain.SubID]domain.Subscription, len(ops))
+	for _, op := range ops {
+		if ms, ok := s.subs[op.Update.SubId]; ok && op.Kind != domain.SubOpCreate {
+			before[ms.subId] = s.toDomain(ms)
+		}
+	}
+	results := make([]domain.StoreResult, len(ops))
+	meta := domain.AuditMetaFrom(ctx)
+	for i, op := range ops {
+		subId, err := s.applyOp(meta, op, before)
+		if err != nil {
+			results[i].Err = err
+			if saved != nil {
+				s.restore(saved)
+				return withoutIds(results), nil
+			}
+			continue
+		}
+		results[i].SubId = subId
+	}
+	return results, nil
+}
+
+func (s *MemSubRepo) applyOp(meta domain.AuditMeta, op domain.SubOp, before map[domain.SubID]domain.Subscription) (domain.SubID, error) {
+	if op.Kind != domain.SubOpCreate {
+		if cur, ok := before[op.Update.SubId]; ok {
+			if err := checkVersion(cur, op.Update.Version); err != nil {
+				return 0, err
+			}
+		}
+		op.Update.Version = 0
+	}
+	switch op.Kind {
+	case domain.SubOpCreate:
+		ms, err := newMemSub(op.Sub)
+		if err != nil {
+			return 0, err
+		}
+		return s.putSub(meta, ms, op.Sub.ServiceName), nil
+	case domain.SubOpUpdate:
+		return op.Update.SubId, s.updateSub(meta, op.Update)
+	case domain.SubOpDelete:
+		return op.Update.SubId, s.deleteSub(meta, op.Update.SubId, op.Update.Version)
+	}
+	return 0, domain.NewValidationError("op", "unknown operation "+string(op.Kind))
+}
+
+// clone copies the data of s, without the lock.
+func (s *MemSubRepo) clone() *MemSubRepo {
+	return &MemSubRepo{
+		subs:          maps.Clone(s.subs),
+		services:      maps.Clone(s.services),
+		serviceIds:    maps.Clone(s.serviceIds),
+		aliases:       maps.Clone(s.aliases),
+		users:         maps.Clone(s.users),
+		lastSubId:     s.lastSubId,
+		lastServiceId: s.lastServiceId,
+		audit:         slices.Clone(s.audit),
+	}
+}
+
+// restore puts back the data of a clone.
+func (s *MemSubRepo) restore(c *MemSubRepo) {
+	s.subs = c.subs
+	s.services = c.services
+	s.serviceIds = c.serviceIds
+	s.aliases = c.aliases
+	s.users = c.users
+	s.lastSubId = c.lastSubId
+	s.lastServiceId = c.lastServiceId
+	s.audit = c.audit
+}
+
+func (s *MemSubRepo) SubsTotalCosts(ctx context.Context, filter domain.SubsFilter) (map[string]int, []domain.SubID, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	if err := checkCostsFilter(filter); err != nil {
+		return nil, nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	totals, subIds := subsCosts(s.costsSubs(filter), filter)
+	return totals, subIds, nil
+}
+
+func (s *MemSubRepo) SubsCostsByGroup(ctx context.Context, filter domain.SubsFilter, groupBy domain.CostsGroupBy) ([]domain.CostsGroup, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := checkCostsFilter(filter); err != nil {
+		return nil, err
+	}
+	if groupBy == domain.GroupByNone || !groupBy.Valid() {
+		return nil, domain.NewValidationError("group_by", "unknown grouping "+string(groupBy))
+	}
+	if groupBy == domain.GroupByMonth && filter.ProRata {
+		return nil, errProRataByMonth
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return groupCosts(s.costsSubs(filter), filter, groupBy), nil
+}
+
+func (s *MemSubRepo) SubsMonthlyCosts(ctx context.Context, filter domain.SubsFilter) ([]domain.MonthCosts, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := checkCostsFilter(filter); err != nil {
+		return nil, err
+	}
+	if filter.ProRata {
+		return nil, errProRataByMonth
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return monthlyCosts(s.costsSubs(filter), filter), nil
+}
+
+func (s *MemSubRepo) ListSubs(ctx context.Context, q domain.SubsListQuery) (domain.SubsPage, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.SubsPage{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if q.Filter.ServiceName != "" {
+		q.Filter.ServiceName = s.canonicalName(q.Filter.ServiceName)
+	}
+	matched := make([]domain.Subscription, 0)
+	for _, ms := range s.subs {
+		if sub := s.toDomain(ms); q.Filter.Matches(sub) {
+			matched = append(matched, sub)
+		}
+	}
+	var page domain.SubsPage
+	if !q.NoTotal {
+		page.Total = len(matched)
+	}
+
+	less := func(a, b domain.Subscription) bool {
+		c := compareSortKey(q.SortBy, a, b)
+		if c == 0 {
+			c = int(a.SubId - b.SubId)
+		}
+		if q.Desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return less(matched[i], matched[j])
+	})
+
+	if q.After != nil {
+		after := domain.Subscription{
+			SubId:       q.After.SubId,
+			Price:       q.After.Price,
+			StartDate:   q.After.StartDate,
+			ServiceName: q.After.ServiceName,
+		}
+		i := sort.Search(len(matched), func(i int) bool {
+			return less(after, matched[i])
+		})
+		matched = matched[i:]
+	}
+	if q.Offset >= len(matched) {
+		matched = matched[:0]
+	} else {
+		matched = matched[q.Offset:]
+	}
+	if len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+		page.Next = domain.CursorAfter(matched[q.Limit-1])
+	}
+	page.Subs = matched
+	return page, nil
+}
+
+func (s *MemSubRepo) userSubs(userId uuid.UUID, includeDeleted bool) []domain.Subscription {
+	res := make([]domain.Subscription, 0, 1)
+	for _, ms := range s.subs {
+		if ms.userId == userId && (includeDeleted || ms.deletedAt.IsZero()) {
+			res = append(res, s.toDomain(ms))
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].SubId < res[j].SubId
+	})
+	return res
+}
+
+// canonicalName resolves an alias to the name of its service, other
+// names are returned as they are.
+func (s *MemSubRepo) canonicalName(name string) string {
+	if id, ok := s.aliases[name]; ok {
+		return s.services[id].Name
+	}
+	return name
+}
+
+func (s *MemSubRepo) putServiceName(name string) int {
+	name = s.canonicalName(name)
+	if id, ok := s.serviceIds[name]; ok {
+		return id
+	}
+	s.lastServiceId++
+	s.services[s.lastServiceId] = domain.Service{Id: domain.ServiceID(s.lastServiceId), Name: name}
+	s.serviceIds[name] = s.lastServiceId
+	return s.lastServiceId
+}
+
+func (s *MemSubRepo) toDomain(ms memSub) domain.Subscription {
+	return domain.Subscription{
+		SubId:         ms.subId,
+		UserID:        ms.userId,
+		ServiceName:   s.services[ms.serviceId].Name,
+		Price:         ms.price,
+		Currency:      ms.currency,
+		BillingPeriod: ms.period,
+		StartDate:     ms.startDate,
+		EndDate:       ms.endDate,
+		DeletedAt:     ms.deletedAt,
+		Version:       ms.version,
+	}
+}
+
+func compareSortKey(sortBy domain.SubsSortField, a, b domain.Subscription) int {
+	switch sortBy {
+	case domain.SortByPrice:
+		return a.Price - b.Price
+	case domain.SortByStartDate:
+		return a.StartDate.Compare(b.StartDate)
+	case domain.SortByServiceName:
+		return strings.Compare(a.ServiceName, b.ServiceName)
+	}
+	return 0
+}
+
+// costsSubs returns subscriptions of filter's user and service ordered by
+// id, without the deleted ones.
+func (s *MemSubRepo) costsSubs(filter domain.SubsFilter) []domain.Subscription {
+	if filter.ServiceName != "" {
+		filter.ServiceName = s.canonicalName(filter.ServiceName)
+	}
+	res := make([]domain.Subscription, 0)
+	for _, ms := range s.subs {
+		sub := s.toDomain(ms)
+		if sub.Deleted() ||
+			filter.UserID != uuid.Nil && sub.UserID != filter.UserID ||
+			filter.ServiceName != "" && sub.ServiceName != filter.ServiceName {
+			continue
+		}
+		res = append(res, sub)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].SubId < res[j].SubId
+	})
+	return res
+}
+
+// selected reports whether costsBounds selects sub for the filter period,
+// charged or not.
+func selected(sub domain.Subscription, filter domain.SubsFilter) bool {
+	return !sub.StartDate.After(filter.EndDate) && (sub.EndDate.IsZero() || !sub.EndDate.Before(filter.StartDate))
+}
+
+func monthOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// subsCosts sums the cost of subs by currency like GetTotalCosts.
+func subsCosts(subs []domain.Subscription, filter domain.SubsFilter) (map[string]int, []domain.SubID) {
+	filter.EndDate = filter.PeriodEnd()
+
+	totals := make(map[string]int)
+	subIds := make([]domain.SubID, 0, len(subs))
+
+	for _, sub := range subs {
+		if !selected(sub, filter) {
+			continue
+		}
+		totals[sub.Currency] += sub.Cost(filter.StartDate, filter.EndDate, filter.ProRata)
+		subIds = append(subIds, sub.SubId)
+	}
+	return totals, subIds
+}
+
+// groupCosts breaks the cost of subs down like GetCostsByKey
+// and GetCostsByMonth.
+func groupCosts(subs []domain.Subscription, filter domain.SubsFilter, groupBy domain.CostsGroupBy) []domain.CostsGroup {
+	filter.EndDate = filter.PeriodEnd()
+
+	type groupKey struct{ key, currency string }
+	byKey := make(map[groupKey]*domain.CostsGroup)
+	months := make(map[string]time.Time)
+	add := func(key string, sub domain.Subscription, amount int) {
+		k := groupKey{key, sub.Currency}
+		g, ok := byKey[k]
+		if !ok {
+			g = &domain.CostsGroup{Key: key, Currency: sub.Currency, SubIds: []domain.SubID{}}
+			byKey[k] = g
+		}
+		g.Total += amount
+		if n := len(g.SubIds); n == 0 || g.SubIds[n-1] != sub.SubId {
+			g.SubIds = append(g.SubIds, sub.SubId)
+		}
+	}
+
+	for _, sub := range subs {
+		if !selected(sub, filter) {
+			continue
+		}
+		switch groupBy {
+		case domain.GroupByService:
+			add(sub.ServiceName, sub, sub.Cost(filter.StartDate, filter.EndDate, filter.ProRata))
+		case domain.GroupByUser:
+			add(sub.UserID.String(), sub, sub.Cost(filter.StartDate, filter.EndDate, filter.ProRata))
+		case domain.GroupByMonth:
+			for _, c := range sub.Charges(filter.StartDate, filter.EndDate) {
+				m := monthOf(c)
+				months[utils.DateString(m)] = m
+				add(utils.DateString(m), sub, sub.Price)
+			}
+		}
+	}
+
+	groups := make([]domain.CostsGroup, 0, len(byKey))
+	for _, g := range byKey {
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if a.Key != b.Key {
+			if groupBy == domain.GroupByMonth {
+				return months[a.Key].Before(months[b.Key])
+			}
+			return a.Key < b.Key
+		}
+		return a.Currency < b.Currency
+	})
+	return groups
+}
+
+// monthlyCosts lists charges of subs by month like GetMonthlyCosts.
+func monthlyCosts(subs []domain.Subscription, filter domain.SubsFilter) []domain.MonthCosts {
+	filter.EndDate = filter.PeriodEnd()
+
+	byMonth := make(map[time.Time]*domain.MonthCosts)
+	for _, sub := range subs {
+		for _, c := range sub.Charges(filter.StartDate, filter.EndDate) {
+			m := monthOf(c)
+			mc, ok := byMonth[m]
+			if !ok {
+				mc = &domain.MonthCosts{Month: m}
+				byMonth[m] = mc
+			}
+			if n := len(mc.Subs); n > 0 && mc.Subs[n-1].SubId == sub.SubId {
+				mc.Subs[n-1].Amount += sub.Price
+				continue
+			}
+			mc.Subs = append(mc.Subs, domain.SubCost{SubId: sub.SubId, Amount: sub.Price, Currency: sub.Currency})
+		}
+	}
+
+	res := make([]domain.MonthCosts, 0, len(byMonth))
+	for _, mc := range byMonth {
+		res = append(res, *mc)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Month.Before(res[j].Month)
+	})
+	return res
+}
+
+// currencyCode is the valid_currency constraint.
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// checkSubRow applies the CHECK constraints of the subscriptions table.
+func checkSubRow(ms memSub) error {
+	if ms.price < 0 {
+		return domain.NewValidationError("price", "must not be negative")
+	}
+	if !currencyCode.MatchString(ms.currency) {
+		return domain.NewValidationError("currency", "must be a 3-letter code")
+	}
+	if !ms.period.Valid() {
+		return domain.NewValidationError("billing_period", "unknown billing period")
+	}
+	if !ms.endDate.IsZero() && ms.endDate.Before(ms.startDate) {
+		return domain.NewValidationError("end_date", "must not be before start date")
+	}
+	return nil
+}
+
+// dateOnly drops the time part the same way a DATE column does.
+func dateOnly(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (s *MemSubRepo) Service(ctx context.Context, id domain.ServiceID) (domain.Service, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Service{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	svc, ok := s.services[int(id)]
+	if !ok {
+		return domain.Service{}, fmt.Errorf("service %d: %w", id, domain.ErrNotFound)
+	}
+	return s.withSubsCount(svc), nil
+}
+
+func (s *MemSubRepo) withSubsCount(svc domain.Service) domain.Service {
+	svc.SubsCount = 0
+	for _, ms := range s.subs {
+		if ms.serviceId == int(svc.Id) && ms.deletedAt.IsZero() {
+			svc.SubsCount++
+		}
+	}
+	return svc
+}
+
+func (s *MemSubRepo) Services(ctx context.Context, category string) ([]domain.Service, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	res := make([]domain.Service, 0)
+	for _, svc := range s.services {
+		if category == "" || svc.Category == category {
+			res = append(res, s.withSubsCount(svc))
+		}
+	}
+	slices.SortFunc(res, func(a, b domain.Service) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return res, nil
+}
+
+func (s *MemSubRepo) SearchServices(ctx context.Context, search domain.ServiceSearch) ([]domain.Service, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type match struct {
+		prefix bool
+		score  float64
+	}
+	matches := make(map[int]match)
+	add := func(id int, name string) {
+		m := matches[id]
+		m.prefix = m.prefix || strings.HasPrefix(name, search.Query)
+		m.score = max(m.score, similarity(name, search.Query))
+		matches[id] = m
+	}
+	for id, svc := range s.services {
+		add(id, svc.Name)
+	}
+	for alias, id := range s.aliases {
+		add(id, alias)
+	}
+
+	res := make([]domain.Service, 0)
+	for id, m := range matches {
+		if m.prefix || m.score >= trigramThreshold {
+			res = append(res, s.withSubsCount(s.services[id]))
+		}
+	}
+	slices.SortFunc(res, func(a, b domain.Service) int {
+		ma, mb := matches[int(a.Id)], matches[int(b.Id)]
+		if ma.prefix != mb.prefix {
+			if ma.prefix {
+				return -1
+			}
+			return 1
+		}
+		if !ma.prefix {
+			if c := cmp.Compare(mb.score, ma.score); c != 0 {
+				return c
+			}
+		}
+		if a.SubsCount != b.SubsCount {
+			return b.SubsCount - a.SubsCount
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	if len(res) > search.Limit {
+		res = res[:search.Limit]
+	}
+	return res, nil
+}
+
+// checkService checks svc the way the database constraints do, it may
+// take the name of the service id.
+func (s *MemSubRepo) checkService(svc domain.Service) error {
+	if err := checkServiceName(svc.Name); err != nil {
+		return err
+	}
+	if utf8.RuneCountInString(svc.Category) > domain.MaxCategoryLen {
+		return domain.NewValidationError("category", "value too long for type character varying(50)")
+	}
+	if id, ok := s.serviceIds[svc.Name]; ok && id != int(svc.Id) {
+		return domain.NewConflictError("service_name", fmt.Sprintf("service %q already exists", svc.Name))
+	}
+	if _, ok := s.aliases[svc.Name]; ok {
+		return aliasTaken(svc.Name)
+	}
+	return nil
+}
+
+func (s *MemSubRepo) StoreService(ctx context.Context, svc domain.Service) (domain.ServiceID, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	svc.Id = 0
+	if err := s.checkService(svc); err != nil {
+		return 0, err
+	}
+	s.lastServiceId++
+	svc.Id = domain.ServiceID(s.lastServiceId)
+	svc.SubsCount = 0
+	s.services[s.lastServiceId] = svc
+	s.serviceIds[svc.Name] = s.lastServiceId
+	return svc.Id, nil
+}
+
+func (s *MemSubRepo) UpdateService(ctx context.Context, svc domain.Service) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cur, ok := s.services[int(svc.Id)]
+	if !ok {
+		return fmt.Errorf("service %d: %w", svc.Id, domain.ErrNotFound)
+	}
+	if err := s.checkService(svc); err != nil {
+		return err
+	}
+	delete(s.serviceIds, cur.Name)
+	svc.SubsCount = 0
+	s.services[int(svc.Id)] = svc
+	s.serviceIds[svc.Name] = int(svc.Id)
+	return nil
+}
+
+func (s *MemSubRepo) DeleteService(ctx context.Context, id domain.ServiceID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	svc, ok := s.services[int(id)]
+	if !ok {
+		return fmt.Errorf("service %d: %w", id, domain.ErrNotFound)
+	}
+	subs := 0
+	for _, ms := range s.subs {
+		if ms.serviceId == int(id) {
+			subs++
+		}
+	}
+	if subs > 0 {
+		return serviceInUse(id, subs)
+	}
+	delete(s.services, int(id))
+	delete(s.serviceIds, svc.Name)
+	maps.DeleteFunc(s.aliases, func(_ string, serviceId int) bool {
+		return serviceId == int(id)
+	})
+	return nil
+}
+
+func (s *MemSubRepo) MergeServices(ctx context.Context, from, into domain.ServiceID) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if from == into {
+		return 0, domain.NewValidationError("into", "must be another service")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range []domain.ServiceID{from, into} {
+		if _, ok := s.services[int(id)]; !ok {
+			return 0, fmt.Errorf("service %d: %w", id, domain.ErrNotFound)
+		}
+	}
+	var ids []domain.SubID
+	for id, ms := range s.subs {
+		if ms.serviceId == int(from) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	meta := domain.AuditMetaFrom(ctx)
+	for _, id := range ids {
+		ms := s.subs[id]
+		old := s.toDomain(ms)
+		ms.serviceId = int(into)
+		ms.version++
+		s.subs[id] = ms
+		s.record(meta, domain.AuditUpdate, id, &old)
+	}
+	for alias, serviceId := range s.aliases {
+		if serviceId == int(from) {
+			s.aliases[alias] = int(into)
+		}
+	}
+	fromName := s.services[int(from)].Name
+	delete(s.serviceIds, fromName)
+	delete(s.services, int(from))
+	s.aliases[fromName] = int(into)
+	return len(ids), nil
+}
+
+// ServiceAliases of a service without any are empty, not ErrNotFound.
+func (s *MemSubRepo) ServiceAliases(ctx context.Context, id domain.ServiceID) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.services[int(id)]; !ok {
+		return nil, fmt.Errorf("service %d: %w", id, domain.ErrNotFound)
+	}
+	res := make([]string, 0)
+	for alias, serviceId := range s.aliases {
+		if serviceId == int(id) {
+			res = append(res, alias)
+		}
+	}
+	slices.Sort(res)
+	return res, nil
+}
+
+func (s *MemSubRepo) StoreServiceAlias(ctx context.Context, alias domain.ServiceAlias) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := checkServiceName(alias.Alias); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.services[int(alias.ServiceId)]; !ok {
+		return fmt.Errorf("service %d: %w", alias.ServiceId, domain.ErrNotFound)
+	}
+	if _, ok := s.serviceIds[alias.Alias]; ok {
+		return domain.NewConflictError("alias", fmt.Sprintf("%q is the name of a service", alias.Alias))
+	}
+	if _, ok := s.aliases[alias.Alias]; ok {
+		return domain.NewConflictError("alias", fmt.Sprintf("alias %q already exists", alias.Alias))
+	}
+	s.aliases[alias.Alias] = int(alias.ServiceId)
+	return nil
+}
+
+func (s *MemSubRepo) DeleteServiceAlias(ctx context.Context, alias domain.ServiceAlias) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id, ok := s.aliases[alias.Alias]; !ok || id != int(alias.ServiceId) {
+		return fmt.Errorf("alias %q of service %d: %w", alias.Alias, alias.ServiceId, domain.ErrNotFound)
+	}
+	delete(s.aliases, alias.Alias)
+	return nil
+}
+
+func (s *MemSubRepo) User(ctx context.Context, id uuid.UUID) (domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.User{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return domain.User{}, fmt.Errorf("user %s: %w", id, domain.ErrNotFound)
+	}
+	return u, nil
+}
+
+func (s *MemSubRepo) Users(ctx context.Context, limit, offset int) ([]domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	res := slices.SortedFunc(maps.Values(s.users), func(a, b domain.User) int {
+		return strings.Compare(a.Id.String(), b.Id.String())
+	})
+	if offset >= len(res) {
+		return []domain.User{}, nil
+	}
+	res = res[offset:]
+	return res[:min(limit, len(res))], nil
+}
+
+func (s *MemSubRepo) StoreUser(ctx context.Context, u domain.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[u.Id]; ok {
+		return domain.NewConflictError("user_id", fmt.Sprintf("user %s already exists", u.Id))
+	}
+	now := time.Now()
+	u.Metadata = maps.Clone(userMetadata(u))
+	u.CreatedAt, u.UpdatedAt = now, now
+	s.users[u.Id] = u
+	return nil
+}
+
+func (s *MemSubRepo) UpdateUser(ctx context.Context, u domain.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cur, ok := s.users[u.Id]
+	if !ok {
+		return fmt.Errorf("user %s: %w", u.Id, domain.ErrNotFound)
+	}
+	u.Metadata = maps.Clone(userMetadata(u))
+	u.CreatedAt, u.UpdatedAt = cur.CreatedAt, time.Now()
+	s.users[u.Id] = u
+	return nil
+}
+
+func (s *MemSubRepo) DeleteUser(ctx context.Context, id uuid.UUID) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return 0, fmt.Errorf("user %s: %w", id, domain.ErrNotFound)
+	}
+	meta := domain.AuditMetaFrom(ctx)
+	deleted := 0
+	for _, sub := range s.userSubs(id, true) {
+		if !sub.Deleted() {
+			if err := s.deleteSub(meta, sub.SubId, 0); err != nil {
+				return 0, err
+			}
+		}
+		delete(s.subs, sub.SubId)
+		deleted++
+	}
+	delete(s.users, id)
+	return deleted, nil
+}
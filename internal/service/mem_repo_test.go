@@ -0,0 +1,25 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/service"
+	"github.com/samantonio28/subscriber-inf/internal/service/repotest"
+)
+
+func newMemSubRepo(testing.TB) domain.SubscriptionRepository {
+	return service.NewMemSubRepo()
+}
+
+func TestMemSubRepo(t *testing.T) {
+	repotest.Run(t, newMemSubRepo)
+}
+
+func TestMemSubRepoCancellation(t *testing.T) {
+	repotest.RunCancellation(t, newMemSubRepo, nil)
+}
+
+func BenchmarkMemSubRepo(b *testing.B) {
+	repotest.RunBenchmarks(b, newMemSubRepo)
+}
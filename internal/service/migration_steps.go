@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/samantonio28/subscriber-inf/internal/migrate"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MigrationSteps are the Go steps of the migrations by version.
+var MigrationSteps = map[int]migrate.Step{
+	12: normalizeServiceNames,
+}
+
+// The queries of the steps are written against the schema of their
+// version, not against the current one the repository queries use.
+const (
+	lockServiceNames = `
+SELECT service_id, service_name FROM services ORDER BY service_id FOR UPDATE`
+	lockMergedSubs = `
+SELECT us.sub_id, us.user_id, sub.service_id, s.service_name, sub.price, sub.currency,
+    sub.billing_period, sub.start_date, sub.end_date, sub.deleted_at, sub.version
+FROM subscriptions sub
+JOIN users_subs us ON us.sub_id = sub.sub_id
+JOIN services s ON s.service_id = sub.service_id
+WHERE sub.service_id = ANY($1)
+ORDER BY sub.sub_id
+FOR UPDATE OF sub`
+	moveMergedSubs = `
+UPDATE subscriptions sub
+SET service_id = m.into_id, version = sub.version + 1
+FROM unnest($1::INTEGER[], $2::INTEGER[]) AS m(from_id, into_id)
+WHERE sub.service_id = m.from_id`
+	putMigrationAudit = `
+INSERT INTO audit_log (sub_id, user_id, action, actor, old_value, new_value)
+VALUES ($1, $2, 'update', $3, $4, $5)`
+	deleteMergedServices = `
+DELETE FROM services WHERE service_id = ANY($1)`
+	renameService = `
+UPDATE services
+SET display_name = CASE WHEN display_name = '' THEN service_name ELSE display_name END,
+    service_name = $2
+WHERE service_id = $1`
+)
+
+// normalizeServiceActor is the actor of the audit entries of
+// normalizeServiceNames.
+const normalizeServiceActor = "migration:012_service_aliases"
+
+// serviceNameLen12 is the length of services.service_name at version 12.
+const serviceNameLen12 = 50
+
+// normalizeServiceName12 is domain.NormalizeServiceName as of version 12.
+// It is a copy so that a later change of the rule leaves the migration
+// as it was run.
+func normalizeServiceName12(name string) string {
+	name = cases.Fold().String(norm.NFKC.String(name))
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// auditSub12 is the JSON of a subscription in audit_log as of version
+// 12, a copy of auditSub for the same reason.
+type auditSub12 struct {
+	SubId         int        `json:"sub_id"`
+	UserId        uuid.UUID  `json:"user_id"`
+	ServiceName   string     `json:"service_name"`
+	Price         int        `json:"price"`
+	Currency      string     `json:"currency"`
+	BillingPeriod string     `json:"billing_period"`
+	StartDate     string     `json:"start_date"`
+	EndDate       string     `json:"end_date,omitempty"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+	Version       int        `json:"version,omitempty"`
+}
+
+// normalizeServiceNames normalizes the service names with
+// normalizeServiceName12, SQL has no full case folding. Services that
+// differ only before normalization are merged into the oldest one,
+// which keeps its name as the display name; their subscriptions move
+// with a new version and an update audit entry. Names that normalize to
+// nothing or to more than serviceNameLen12 characters are left as they
+// are, the service_name column can't hold them.
+func normalizeServiceNames(ctx context.Context, tx pgx.Tx) error {
+	rows, err := tx.Query(ctx, lockServiceNames)
+	if err != nil {
+		return fmt.Errorf("failed to read services: %w", err)
+	}
+	type service struct {
+		id   int
+		name string
+	}
+	var services []service
+	for rows.Next() {
+		var s service
+		if err := rows.Scan(&s.id, &s.name); err != nil {
+			rows.Close()
+			return err
+		}
+		services = append(services, s)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	keptByName := make(map[string]int)
+	var renamed []service
+	var mergedFrom, mergedInto []int
+	// mergedNames are the names the merged services end up with.
+	mergedNames := make(map[int]string)
+	for _, s := range services {
+		name := normalizeServiceName12(s.name)
+		if name == "" || utf8.RuneCountInString(name) > serviceNameLen12 {
+			continue
+		}
+		if into, ok := keptByName[name]; ok {
+			mergedFrom = append(mergedFrom, s.id)
+			mergedInto = append(mergedInto, into)
+			mergedNames[s.id] = name
+			continue
+		}
+		keptByName[name] = s.id
+		if name != s.name {
+			renamed = append(renamed, service{id: s.id, name: name})
+		}
+	}
+
+	if len(mergedFrom) > 0 {
+		if err := moveSubsOfMerged(ctx, tx, mergedFrom, mergedInto, mergedNames); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, deleteMergedServices, mergedFrom); err != nil {
+			return fmt.Errorf("failed to delete merged services: %w", err)
+		}
+	}
+	for _, s := range renamed {
+		if _, err := tx.Exec(ctx, renameService, s.id, s.name); err != nil {
+			return fmt.Errorf("failed to rename service %d: %w", s.id, err)
+		}
+	}
+	return nil
+}
+
+// moveSubsOfMerged moves the subscriptions of services from to into,
+// pairwise, and writes their audit entries. names are the service names
+// the subscriptions end up with by the id of the service they leave.
+func moveSubsOfMerged(ctx context.Context, tx pgx.Tx, from, into []int, names map[int]string) error {
+	rows, err := tx.Query(ctx, lockMergedSubs, from)
+	if err != nil {
+		return fmt.Errorf("failed to read subscriptions of merged services: %w", err)
+	}
+	type move struct {
+		userId   uuid.UUID
+		old, new auditSub12
+	}
+	var moves []move
+	for rows.Next() {
+		var (
+			m         move
+			serviceId int
+			start     time.Time
+			end       *time.Time
+		)
+		if err := rows.Scan(&m.old.SubId, &m.userId, &serviceId, &m.old.ServiceName, &m.old.Price,
+			&m.old.Currency, &m.old.BillingPeriod, &start, &end, &m.old.DeletedAt, &m.old.Version); err != nil {
+			rows.Close()
+			return err
+		}
+		m.old.UserId = m.userId
+		m.old.StartDate = start.Format(time.DateOnly)
+		if end != nil {
+			m.old.EndDate = end.Format(time.DateOnly)
+		}
+		if m.old.DeletedAt != nil {
+			deletedAt := m.old.DeletedAt.UTC()
+			m.old.DeletedAt = &deletedAt
+		}
+		m.new = m.old
+		m.new.ServiceName = names[serviceId]
+		m.new.Version++
+		moves = append(moves, m)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, moveMergedSubs, from, into); err != nil {
+		return fmt.Errorf("failed to move subscriptions of merged services: %w", err)
+	}
+	for _, m := range moves {
+		oldVal, err := json.Marshal(m.old)
+		if err != nil {
+			return err
+		}
+		newVal, err := json.Marshal(m.new)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, putMigrationAudit, m.old.SubId, m.userId, normalizeServiceActor, oldVal, newVal); err != nil {
+			return fmt.Errorf("failed to audit subscription %d: %w", m.old.SubId, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samantonio28/subscriber-inf/internal/migrate"
+	"github.com/samantonio28/subscriber-inf/internal/service"
+	"github.com/samantonio28/subscriber-inf/internal/service/repotest"
+	"github.com/samantonio28/subscriber-inf/migrations"
+)
+
+func TestNormalizeServiceNames(t *testing.T) {
+	ctx := context.Background()
+	pool := repotest.PgDatabase(t)
+	m, err := migrate.NewMigrator(pool, migrations.FS, service.MigrationSteps)
+	if err != nil {
+		t.Fatalf("NewMigrator(): %v", err)
+	}
+	if _, err := m.To(ctx, 11); err != nil {
+		t.Fatalf("To(11): %v", err)
+	}
+
+	// ß folds to ss, which lower() doesn't do, so both Straße services
+	// merge. The last name is 100 letters long once folded.
+	overlong := strings.Repeat("ß", 50)
+	ids := make(map[string]int)
+	for _, name := range []string{"Straße", "STRASSE", "Netflix", " netflix ", "okko", overlong} {
+		var id int
+		if err := pool.QueryRow(ctx, `INSERT INTO services (service_name) VALUES ($1) RETURNING service_id`, name).Scan(&id); err != nil {
+			t.Fatalf("insert service %q: %v", name, err)
+		}
+		ids[name] = id
+	}
+	userId := uuid.New()
+	if _, err := pool.Exec(ctx, `INSERT INTO users (user_id) VALUES ($1)`, userId); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	subs := make(map[string]int)
+	for _, name := range []string{"STRASSE", " netflix ", "Netflix"} {
+		subs[name] = insertSub(t, pool, userId, ids[name])
+	}
+
+	if _, err := m.To(ctx, 12); err != nil {
+		t.Fatalf("To(12): %v", err)
+	}
+
+	want := map[int][2]string{
+		ids["Straße"]:  {"strasse", "Straße"},
+		ids["Netflix"]: {"netflix", "Netflix"},
+		ids["okko"]:    {"okko", ""},
+		ids[overlong]:  {overlong, ""},
+	}
+	rows, err := pool.Query(ctx, `SELECT service_id, service_name, display_name FROM services`)
+	if err != nil {
+		t.Fatalf("select services: %v", err)
+	}
+	got := make(map[int][2]string)
+	for rows.Next() {
+		var id int
+		var name, display string
+		if err := rows.Scan(&id, &name, &display); err != nil {
+			t.Fatalf("scan service: %v", err)
+		}
+		got[id] = [2]string{name, display}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("select services: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Errorf("services after the migration = %v, want %v", got, want)
+	}
+	for id, w := range want {
+		if got[id] != w {
+			t.Errorf("service %d = %q, want %q", id, got[id], w)
+		}
+	}
+
+	for name, wantService := range map[string]int{
+		"STRASSE":   ids["Straße"],
+		" netflix ": ids["Netflix"],
+		"Netflix":   ids["Netflix"],
+	} {
+		wantVersion := 2
+		if name == "Netflix" {
+			wantVersion = 1
+		}
+		var serviceId, version int
+		if err := pool.QueryRow(ctx, `SELECT service_id, version FROM subscriptions WHERE sub_id = $1`, subs[name]).Scan(&serviceId, &version); err != nil {
+			t.Fatalf("select subscription: %v", err)
+		}
+		if serviceId != wantService || version != wantVersion {
+			t.Errorf("subscription of %q: service %d version %d, want service %d version %d", name, serviceId, version, wantService, wantVersion)
+		}
+	}
+
+	type auditSub struct {
+		ServiceName string `json:"service_name"`
+		Version     int    `json:"version"`
+		StartDate   string `json:"start_date"`
+	}
+	entries, err := pool.Query(ctx, `SELECT sub_id, user_id, action, actor, old_value, new_value FROM audit_log ORDER BY sub_id`)
+	if err != nil {
+		t.Fatalf("select audit_log: %v", err)
+	}
+	var audited []int
+	for entries.Next() {
+		var subId int
+		var user uuid.UUID
+		var action, actor string
+		var oldVal, newVal []byte
+		if err := entries.Scan(&subId, &user, &action, &actor, &oldVal, &newVal); err != nil {
+			t.Fatalf("scan audit entry: %v", err)
+		}
+		audited = append(audited, subId)
+		var o, n auditSub
+		if err := json.Unmarshal(oldVal, &o); err != nil {
+			t.Fatalf("invalid old_value %s: %v", oldVal, err)
+		}
+		if err := json.Unmarshal(newVal, &n); err != nil {
+			t.Fatalf("invalid new_value %s: %v", newVal, err)
+		}
+		if user != userId || action != "update" || actor == "" {
+			t.Errorf("audit entry of %d: user %s action %q actor %q", subId, user, action, actor)
+		}
+		if o.Version != 1 || n.Version != 2 || o.StartDate != "2025-01-01" || n.StartDate != o.StartDate {
+			t.Errorf("audit entry of %d: %s -> %s", subId, oldVal, newVal)
+		}
+		wantOld, wantNew := "STRASSE", "strasse"
+		if subId == subs[" netflix "] {
+			wantOld, wantNew = " netflix ", "netflix"
+		}
+		if o.ServiceName != wantOld || n.ServiceName != wantNew {
+			t.Errorf("audit entry of %d: service %q -> %q, want %q -> %q", subId, o.ServiceName, n.ServiceName, wantOld, wantNew)
+		}
+	}
+	if err := entries.Err(); err != nil {
+		t.Fatalf("select audit_log: %v", err)
+	}
+	if len(audited) != 2 {
+		t.Errorf("audited subscriptions %v, want the 2 moved ones", audited)
+	}
+}
+
+func insertSub(t *testing.T, pool *pgxpool.Pool, userId uuid.UUID, serviceId int) int {
+	t.Helper()
+	ctx := context.Background()
+	var subId int
+	if err := pool.QueryRow(ctx,
+		`INSERT INTO subscriptions (service_id, price, start_date) VALUES ($1, 100, '2025-01-01') RETURNING sub_id`,
+		serviceId).Scan(&subId); err != nil {
+		t.Fatalf("insert subscription: %v", err)
+	}
+	if _, err := pool.Exec(ctx, `INSERT INTO users_subs (sub_id, user_id) VALUES ($1, $2)`, subId, userId); err != nil {
+		t.Fatalf("insert users_subs: %v", err)
+	}
+	return subId
+}
@@ -0,0 +1,81 @@
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+)
+
+// benchSizes are the numbers of subscriptions of the benchmarked user.
+var benchSizes = []int{10, 100, 500}
+
+// RunBenchmarks measures the read paths for a user with a growing number
+// of subscriptions, among subscriptions of other users. Compare runs of
+// two revisions with benchstat to see the effect of a change:
+//
+//	go test -run '^$' -bench SubRepo -count 10 ./internal/service > new.txt
+func RunBenchmarks(b *testing.B, newRepo Factory) {
+	for _, n := range benchSizes {
+		repo := newRepo(b)
+		userId := seedUser(b, repo, n)
+		filter := domain.SubsFilter{
+			StartDate:   month(time.January, 2020),
+			EndDate:     month(time.January, 2026),
+			UserID:      userId,
+			ServiceName: benchService(0),
+		}
+		q, err := domain.NewSubsListQuery(domain.SubsListFilter{UserID: userId}, domain.SortByPrice, false, 50, 0, nil)
+		if err != nil {
+			b.Fatalf("NewSubsListQuery(): %v", err)
+		}
+
+		b.Run(fmt.Sprintf("UserSubs/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := repo.UserSubs(context.Background(), userId, false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("SubsTotalCosts/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, _, err := repo.SubsTotalCosts(context.Background(), filter); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("ListSubs/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := repo.ListSubs(context.Background(), *q); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func benchService(i int) string {
+	return fmt.Sprintf("Service %d", i%5)
+}
+
+// seedUser stores n subscriptions of a new user and as many of other users.
+func seedUser(b *testing.B, repo domain.SubscriptionRepository, n int) uuid.UUID {
+	b.Helper()
+	userId := uuid.New()
+	for i := 0; i < n; i++ {
+		start := month(time.Month(1+i%12), 2020+i%5)
+		end := time.Time{}
+		if i%3 == 0 {
+			end = start.AddDate(1, 0, 0)
+		}
+		for _, u := range []uuid.UUID{userId, uuid.New()} {
+			if _, err := repo.StoreSub(context.Background(), newSub(u, benchService(i), 100+i, start, end)); err != nil {
+				b.Fatalf("StoreSub(): %v", err)
+			}
+		}
+	}
+	return userId
+}
@@ -0,0 +1,178 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+)
+
+// Blocker makes the queries of repo hang until release is called.
+type Blocker func(tb testing.TB, repo domain.SubscriptionRepository) (release func())
+
+// RunCancellation checks that every method gives up with the error of
+// its context. block may be nil for repositories without queries in
+// flight, the case with a hanging query is skipped then.
+func RunCancellation(t *testing.T, newRepo Factory, block Blocker) {
+	t.Run("Cancelled", func(t *testing.T) { testCancelled(t, newRepo(t)) })
+	t.Run("DeadlineExceeded", func(t *testing.T) { testDeadlineExceeded(t, newRepo(t)) })
+	t.Run("CancelInFlight", func(t *testing.T) {
+		if block == nil {
+			t.Skip("no Blocker")
+		}
+		testCancelInFlight(t, newRepo(t), block)
+	})
+}
+
+// PgLocker blocks the queries of a SubRepo on pool with an exclusive
+// lock on subscriptions held by another transaction.
+func PgLocker(pool *pgxpool.Pool) Blocker {
+	return func(tb testing.TB, _ domain.SubscriptionRepository) func() {
+		tb.Helper()
+		tx, err := pool.Begin(context.Background())
+		if err != nil {
+			tb.Fatalf("Begin(): %v", err)
+		}
+		if _, err := tx.Exec(context.Background(), "LOCK TABLE subscriptions IN ACCESS EXCLUSIVE MODE"); err != nil {
+			_ = tx.Rollback(context.Background())
+			tb.Fatalf("LOCK TABLE: %v", err)
+		}
+		return func() { _ = tx.Rollback(context.Background()) }
+	}
+}
+
+type repoCall struct {
+	name string
+	call func(ctx context.Context) error
+}
+
+func repoCalls(repo domain.SubscriptionRepository, id domain.SubID) []repoCall {
+	user := uuid.New()
+	filter := domain.SubsFilter{StartDate: month(time.January, 2025), EndDate: month(time.January, 2026)}
+	return []repoCall{
+		{"Sub", func(ctx context.Context) error {
+			_, err := repo.Sub(ctx, id, false)
+			return err
+		}},
+		{"UserSubs", func(ctx context.Context) error {
+			_, err := repo.UserSubs(ctx, user, false)
+			return err
+		}},
+		{"StoreSub", func(ctx context.Context) error {
+			_, err := repo.StoreSub(ctx, newSub(user, "Netflix", 100, month(time.March, 2025), time.Time{}))
+			return err
+		}},
+		{"StoreSubOnce", func(ctx context.Context) error {
+			key := domain.IdempotencyKey{Key: "cancelled", RequestHash: "hash", ExpiresAt: time.Now().Add(time.Hour)}
+			_, _, err := repo.StoreSubOnce(ctx, key, newSub(user, "Netflix", 100, month(time.March, 2025), time.Time{}))
+			return err
+		}},
+		{"StoreSubs", func(ctx context.Context) error {
+			_, err := repo.StoreSubs(ctx, []domain.Subscription{newSub(user, "Netflix", 100, month(time.March, 2025), time.Time{})}, domain.TxBestEffort, false)
+			return err
+		}},
+		{"UpdateSub", func(ctx context.Context) error {
+			return repo.UpdateSub(ctx, updateOf(domain.Subscription{SubId: id, Price: 200}))
+		}},
+		{"ApplySubs", func(ctx context.Context) error {
+			_, err := repo.ApplySubs(ctx, []domain.SubOp{{Kind: domain.SubOpUpdate, Update: updateOf(domain.Subscription{SubId: id, UserID: user, Price: 200})}}, domain.TxBestEffort)
+			return err
+		}},
+		{"DeleteSub", func(ctx context.Context) error {
+			return repo.DeleteSub(ctx, id, 0)
+		}},
+		{"RestoreSub", func(ctx context.Context) error {
+			return repo.RestoreSub(ctx, id)
+		}},
+		{"PurgeSubs", func(ctx context.Context) error {
+			_, err := repo.PurgeSubs(ctx, time.Now())
+			return err
+		}},
+		{"PurgeIdempotencyKeys", func(ctx context.Context) error {
+			_, err := repo.PurgeIdempotencyKeys(ctx, time.Now())
+			return err
+		}},
+		{"SubsTotalCosts", func(ctx context.Context) error {
+			_, _, err := repo.SubsTotalCosts(ctx, filter)
+			return err
+		}},
+		{"SubsCostsByGroup", func(ctx context.Context) error {
+			_, err := repo.SubsCostsByGroup(ctx, filter, domain.GroupByService)
+			return err
+		}},
+		{"SubsMonthlyCosts", func(ctx context.Context) error {
+			_, err := repo.SubsMonthlyCosts(ctx, filter)
+			return err
+		}},
+		{"ListSubs", func(ctx context.Context) error {
+			_, err := repo.ListSubs(ctx, domain.SubsListQuery{SortBy: domain.SortBySubId, Limit: 10})
+			return err
+		}},
+		{"SubHistory", func(ctx context.Context) error {
+			_, err := repo.SubHistory(ctx, id)
+			return err
+		}},
+		{"AuditLog", func(ctx context.Context) error {
+			_, err := repo.AuditLog(ctx, domain.AuditFilter{UserID: user, Limit: 10})
+			return err
+		}},
+	}
+}
+
+func testCancelled(t *testing.T, repo domain.SubscriptionRepository) {
+	id := mustStore(t, repo, newSub(uuid.New(), "Netflix", 100, month(time.January, 2025), time.Time{}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, c := range repoCalls(repo, id) {
+		if err := c.call(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s() with cancelled context = %v, want context.Canceled", c.name, err)
+		}
+	}
+	if sub := mustGet(t, repo, id); sub.Price != 100 {
+		t.Errorf("cancelled UpdateSub() changed the price to %d", sub.Price)
+	}
+}
+
+func testDeadlineExceeded(t *testing.T, repo domain.SubscriptionRepository) {
+	id := mustStore(t, repo, newSub(uuid.New(), "Netflix", 100, month(time.January, 2025), time.Time{}))
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	for _, c := range repoCalls(repo, id) {
+		if err := c.call(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s() past deadline = %v, want context.DeadlineExceeded", c.name, err)
+		}
+	}
+}
+
+func testCancelInFlight(t *testing.T, repo domain.SubscriptionRepository, block Blocker) {
+	id := mustStore(t, repo, newSub(uuid.New(), "Netflix", 100, month(time.January, 2025), time.Time{}))
+	release := block(t, repo)
+	defer release()
+
+	for _, c := range repoCalls(repo, id) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- c.call(ctx) }()
+
+		select {
+		case err := <-done:
+			cancel()
+			t.Errorf("%s() returned %v while blocked", c.name, err)
+			continue
+		case <-time.After(50 * time.Millisecond):
+		}
+		cancel()
+		select {
+		case err := <-done:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("%s() cancelled in flight = %v, want context.Canceled", c.name, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s() still running after cancel", c.name)
+		}
+	}
+}
@@ -0,0 +1,411 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+)
+
+func serviceRepo(t *testing.T, repo domain.SubscriptionRepository) domain.ServiceRepository {
+	servR, ok := repo.(domain.ServiceRepository)
+	if !ok {
+		t.Skip("not a domain.ServiceRepository")
+	}
+	return servR
+}
+
+func userRepo(t *testing.T, repo domain.SubscriptionRepository) domain.UserRepository {
+	userR, ok := repo.(domain.UserRepository)
+	if !ok {
+		t.Skip("not a domain.UserRepository")
+	}
+	return userR
+}
+
+func mustService(t *testing.T, servR domain.ServiceRepository, id domain.ServiceID) domain.Service {
+	t.Helper()
+	svc, err := servR.Service(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Service(%d): %v", id, err)
+	}
+	return svc
+}
+
+// serviceByName finds a service added with a subscription.
+func serviceByName(t *testing.T, servR domain.ServiceRepository, name string) domain.Service {
+	t.Helper()
+	services, err := servR.Services(context.Background(), "")
+	if err != nil {
+		t.Fatalf("Services(): %v", err)
+	}
+	for _, svc := range services {
+		if svc.Name == name {
+			return svc
+		}
+	}
+	t.Fatalf("no service %q in %+v", name, services)
+	return domain.Service{}
+}
+
+func testServices(t *testing.T, repo domain.SubscriptionRepository) {
+	servR := serviceRepo(t, repo)
+	ctx := context.Background()
+
+	id, err := servR.StoreService(ctx, domain.Service{
+		Name: "Kinopoisk", DisplayName: "Кинопоиск", Category: "video", DefaultPrice: 299, DefaultCurrency: "RUB",
+	})
+	if err != nil {
+		t.Fatalf("StoreService(): %v", err)
+	}
+	svc := mustService(t, servR, id)
+	if svc.DisplayName != "Кинопоиск" || svc.Category != "video" || svc.DefaultPrice != 299 || svc.DefaultCurrency != "RUB" || svc.SubsCount != 0 {
+		t.Errorf("Service() = %+v", svc)
+	}
+	if _, err := servR.StoreService(ctx, domain.Service{Name: "Kinopoisk"}); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("StoreService() of a taken name error = %v, want domain.ErrConflict", err)
+	}
+
+	// Subscriptions add their services and count in them.
+	mustStore(t, repo, newSub(uuid.New(), "Kinopoisk", 299, month(time.January, 2025), time.Time{}))
+	mustStore(t, repo, newSub(uuid.New(), "Spotify", 199, month(time.January, 2025), time.Time{}))
+	if n := mustService(t, servR, id).SubsCount; n != 1 {
+		t.Errorf("SubsCount = %d, want 1", n)
+	}
+	spotify := serviceByName(t, servR, "Spotify")
+
+	video, err := servR.Services(ctx, "video")
+	if err != nil {
+		t.Fatalf("Services(video): %v", err)
+	}
+	if len(video) != 1 || video[0].Id != id {
+		t.Errorf("Services(video) = %+v, want only service %d", video, id)
+	}
+
+	// Renaming renames the service of the subscriptions.
+	spotify.Name = "Spotify Premium"
+	spotify.Category = "music"
+	if err := servR.UpdateService(ctx, spotify); err != nil {
+		t.Fatalf("UpdateService(): %v", err)
+	}
+	sub := newSub(uuid.New(), "Spotify Premium", 199, month(time.January, 2025), time.Time{})
+	subId := mustStore(t, repo, sub)
+	if n := mustService(t, servR, spotify.Id).SubsCount; n != 2 {
+		t.Errorf("SubsCount after the rename = %d, want 2", n)
+	}
+	if name := mustGet(t, repo, subId).ServiceName; name != "Spotify Premium" {
+		t.Errorf("ServiceName = %q, want the new name", name)
+	}
+	spotify.Name = "Kinopoisk"
+	if err := servR.UpdateService(ctx, spotify); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("UpdateService() to a taken name error = %v, want domain.ErrConflict", err)
+	}
+	if err := servR.UpdateService(ctx, domain.Service{Id: 999999, Name: "Missing"}); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("UpdateService() of a missing service error = %v, want domain.ErrNotFound", err)
+	}
+
+	// Deleted subscriptions keep their service too.
+	if err := repo.DeleteSub(ctx, subId, 0); err != nil {
+		t.Fatalf("DeleteSub(): %v", err)
+	}
+	if err := servR.DeleteService(ctx, spotify.Id); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("DeleteService() of a used service error = %v, want domain.ErrConflict", err)
+	}
+	unused, err := servR.StoreService(ctx, domain.Service{Name: "Unused"})
+	if err != nil {
+		t.Fatalf("StoreService(): %v", err)
+	}
+	if err := servR.DeleteService(ctx, unused); err != nil {
+		t.Fatalf("DeleteService(): %v", err)
+	}
+	if _, err := servR.Service(ctx, unused); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Service() of a deleted service error = %v, want domain.ErrNotFound", err)
+	}
+}
+
+func testMergeServices(t *testing.T, repo domain.SubscriptionRepository) {
+	servR := serviceRepo(t, repo)
+	ctx := context.Background()
+	userId := uuid.New()
+
+	live := mustStore(t, repo, newSub(userId, "yandex plus", 300, month(time.January, 2025), time.Time{}))
+	deleted := mustStore(t, repo, newSub(userId, "yandex plus", 300, month(time.February, 2025), time.Time{}))
+	kept := mustStore(t, repo, newSub(userId, "Yandex Plus", 400, month(time.January, 2025), time.Time{}))
+	if err := repo.DeleteSub(ctx, deleted, 0); err != nil {
+		t.Fatalf("DeleteSub(): %v", err)
+	}
+	from := serviceByName(t, servR, "yandex plus")
+	into := serviceByName(t, servR, "Yandex Plus")
+
+	if _, err := servR.MergeServices(ctx, from.Id, from.Id); !errors.Is(err, domain.ErrValidation) {
+		t.Errorf("MergeServices() into itself error = %v, want domain.ErrValidation", err)
+	}
+	if _, err := servR.MergeServices(ctx, from.Id, 999999); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("MergeServices() into a missing service error = %v, want domain.ErrNotFound", err)
+	}
+
+	moved, err := servR.MergeServices(ctx, from.Id, into.Id)
+	if err != nil {
+		t.Fatalf("MergeServices(): %v", err)
+	}
+	if moved != 2 {
+		t.Errorf("MergeServices() = %d, want 2", moved)
+	}
+	if _, err := servR.Service(ctx, from.Id); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Service() of the merged service error = %v, want domain.ErrNotFound", err)
+	}
+	if n := mustService(t, servR, into.Id).SubsCount; n != 2 {
+		t.Errorf("SubsCount after the merge = %d, want 2", n)
+	}
+	for _, id := range []domain.SubID{live, deleted, kept} {
+		sub, err := repo.Sub(ctx, id, true)
+		if err != nil {
+			t.Fatalf("Sub(%d): %v", id, err)
+		}
+		if sub.ServiceName != "Yandex Plus" {
+			t.Errorf("ServiceName of %d = %q, want Yandex Plus", id, sub.ServiceName)
+		}
+	}
+	if v := mustGet(t, repo, live).Version; v != 2 {
+		t.Errorf("Version of a moved sub = %d, want 2", v)
+	}
+	history, err := repo.SubHistory(ctx, live)
+	if err != nil {
+		t.Fatalf("SubHistory(): %v", err)
+	}
+	wantActions(t, history, live, domain.AuditCreate, domain.AuditUpdate)
+	if last := history[len(history)-1]; last.Old.ServiceName != "yandex plus" || last.New.ServiceName != "Yandex Plus" {
+		t.Errorf("audit of the move = %q -> %q", last.Old.ServiceName, last.New.ServiceName)
+	}
+
+	// The merged name refers to into from now on.
+	if aliases, err := servR.ServiceAliases(ctx, into.Id); err != nil || !slices.Equal(aliases, []string{"yandex plus"}) {
+		t.Errorf("ServiceAliases() = %v, %v, want the merged name", aliases, err)
+	}
+	again := mustStore(t, repo, newSub(userId, "yandex plus", 300, month(time.March, 2025), time.Time{}))
+	if name := mustGet(t, repo, again).ServiceName; name != "Yandex Plus" {
+		t.Errorf("ServiceName by the merged name = %q, want Yandex Plus", name)
+	}
+}
+
+func testServiceAliases(t *testing.T, repo domain.SubscriptionRepository) {
+	servR := serviceRepo(t, repo)
+	ctx := context.Background()
+	userId := uuid.New()
+
+	mustStore(t, repo, newSub(userId, "yandex plus", 300, month(time.January, 2025), time.Time{}))
+	svc := serviceByName(t, servR, "yandex plus")
+	alias := domain.ServiceAlias{Alias: "яндекс плюс", ServiceId: svc.Id}
+	if err := servR.StoreServiceAlias(ctx, alias); err != nil {
+		t.Fatalf("StoreServiceAlias(): %v", err)
+	}
+
+	cases := map[string]struct {
+		alias domain.ServiceAlias
+		want  error
+	}{
+		"taken alias":     {alias, domain.ErrConflict},
+		"service name":    {domain.ServiceAlias{Alias: "yandex plus", ServiceId: svc.Id}, domain.ErrConflict},
+		"missing service": {domain.ServiceAlias{Alias: "kinopoisk", ServiceId: 999999}, domain.ErrNotFound},
+	}
+	for name, c := range cases {
+		if err := servR.StoreServiceAlias(ctx, c.alias); !errors.Is(err, c.want) {
+			t.Errorf("%s: StoreServiceAlias() error = %v, want %v", name, err, c.want)
+		}
+	}
+	if _, err := servR.StoreService(ctx, domain.Service{Name: "яндекс плюс"}); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("StoreService() named as an alias error = %v, want domain.ErrConflict", err)
+	}
+
+	// Subscriptions and filters with the alias refer to the service.
+	byAlias := mustStore(t, repo, newSub(userId, "яндекс плюс", 300, month(time.January, 2025), time.Time{}))
+	if name := mustGet(t, repo, byAlias).ServiceName; name != "yandex plus" {
+		t.Errorf("ServiceName by the alias = %q, want yandex plus", name)
+	}
+	if n := mustService(t, servR, svc.Id).SubsCount; n != 2 {
+		t.Errorf("SubsCount = %d, want 2", n)
+	}
+	filter := domain.SubsFilter{StartDate: month(time.January, 2025), EndDate: month(time.February, 2025), ServiceName: "яндекс плюс"}
+	if totals, _, err := repo.SubsTotalCosts(ctx, filter); err != nil || totals[domain.DefaultCurrency] != 600 {
+		t.Errorf("SubsTotalCosts() by the alias = %v, %v, want 600", totals, err)
+	}
+	got := mustList(t, repo, domain.SubsListFilter{ServiceName: "яндекс плюс"}, domain.SortBySubId, false, 0, 0, nil)
+	if len(got.Subs) != 2 {
+		t.Errorf("ListSubs() by the alias = %d subs, want 2", len(got.Subs))
+	}
+
+	if err := servR.DeleteServiceAlias(ctx, domain.ServiceAlias{Alias: alias.Alias, ServiceId: svc.Id + 1}); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("DeleteServiceAlias() of another service error = %v, want domain.ErrNotFound", err)
+	}
+	if err := servR.DeleteServiceAlias(ctx, alias); err != nil {
+		t.Fatalf("DeleteServiceAlias(): %v", err)
+	}
+	if aliases, err := servR.ServiceAliases(ctx, svc.Id); err != nil || len(aliases) != 0 {
+		t.Errorf("ServiceAliases() after the delete = %v, %v, want none", aliases, err)
+	}
+	if _, err := servR.ServiceAliases(ctx, 999999); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("ServiceAliases() of a missing service error = %v, want domain.ErrNotFound", err)
+	}
+}
+
+func testSearchServices(t *testing.T, repo domain.SubscriptionRepository) {
+	servR := serviceRepo(t, repo)
+	ctx := context.Background()
+	userId := uuid.New()
+
+	subs := map[string]int{"yandex plus": 3, "kinopoisk": 2, "yandex music": 1}
+	for name, n := range subs {
+		for i := 0; i < n; i++ {
+			mustStore(t, repo, newSub(userId, name, 100, month(time.January, 2025), time.Time{}))
+		}
+	}
+	if _, err := servR.StoreService(ctx, domain.Service{Name: "youtube premium"}); err != nil {
+		t.Fatalf("StoreService(): %v", err)
+	}
+	kinopoisk := serviceByName(t, servR, "kinopoisk")
+	if err := servR.StoreServiceAlias(ctx, domain.ServiceAlias{Alias: "кинопоиск", ServiceId: kinopoisk.Id}); err != nil {
+		t.Fatalf("StoreServiceAlias(): %v", err)
+	}
+
+	cases := map[string]struct {
+		query string
+		limit int
+		want  []string
+	}{
+		"prefix by subs": {"yandex", 10, []string{"yandex plus", "yandex music"}},
+		"short prefix":   {"y", 10, []string{"yandex plus", "yandex music", "youtube premium"}},
+		"limit":          {"y", 1, []string{"yandex plus"}},
+		"typo":           {"yandx plus", 10, []string{"yandex plus"}},
+		"closest first":  {"yandex musik", 10, []string{"yandex music", "yandex plus"}},
+		"alias":          {"кино", 10, []string{"kinopoisk"}},
+		"alias typo":     {"кинопоск", 10, []string{"kinopoisk"}},
+		"no match":       {"netflix", 10, []string{}},
+	}
+	for name, c := range cases {
+		services, err := servR.SearchServices(ctx, domain.ServiceSearch{Query: c.query, Limit: c.limit})
+		if err != nil {
+			t.Fatalf("%s: SearchServices(): %v", name, err)
+		}
+		got := make([]string, 0, len(services))
+		for _, svc := range services {
+			got = append(got, svc.Name)
+		}
+		if !slices.Equal(got, c.want) {
+			t.Errorf("%s: SearchServices(%q) = %v, want %v", name, c.query, got, c.want)
+		}
+	}
+	services, err := servR.SearchServices(ctx, domain.ServiceSearch{Query: "yandex plus", Limit: 1})
+	if err != nil || len(services) != 1 || services[0].SubsCount != 3 {
+		t.Errorf("SearchServices() = %+v, %v, want yandex plus with 3 subs", services, err)
+	}
+}
+
+func testUsers(t *testing.T, repo domain.SubscriptionRepository) {
+	userR := userRepo(t, repo)
+	ctx := context.Background()
+
+	id := uuid.New()
+	user := domain.User{Id: id, Name: "Ivan", Email: "ivan@example.com", Metadata: map[string]string{"plan": "family"}}
+	if err := userR.StoreUser(ctx, user); err != nil {
+		t.Fatalf("StoreUser(): %v", err)
+	}
+	if err := userR.StoreUser(ctx, user); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("StoreUser() of an existing user error = %v, want domain.ErrConflict", err)
+	}
+	got, err := userR.User(ctx, id)
+	if err != nil {
+		t.Fatalf("User(): %v", err)
+	}
+	if got.Name != "Ivan" || got.Email != "ivan@example.com" || got.Metadata["plan"] != "family" || got.CreatedAt.IsZero() {
+		t.Errorf("User() = %+v", got)
+	}
+
+	user.Name = "Ivan Petrov"
+	user.Metadata = nil
+	if err := userR.UpdateUser(ctx, user); err != nil {
+		t.Fatalf("UpdateUser(): %v", err)
+	}
+	got, err = userR.User(ctx, id)
+	if err != nil {
+		t.Fatalf("User(): %v", err)
+	}
+	if got.Name != "Ivan Petrov" || len(got.Metadata) != 0 || got.UpdatedAt.Before(got.CreatedAt) {
+		t.Errorf("User() after update = %+v", got)
+	}
+	if err := userR.UpdateUser(ctx, domain.User{Id: uuid.New()}); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("UpdateUser() of a missing user error = %v, want domain.ErrNotFound", err)
+	}
+
+	// The owners of subscriptions are users with an empty profile.
+	owner := uuid.New()
+	mustStore(t, repo, newSub(owner, "Okko", 100, month(time.January, 2025), time.Time{}))
+	got, err = userR.User(ctx, owner)
+	if err != nil {
+		t.Fatalf("User() of a subscription owner: %v", err)
+	}
+	if got.Name != "" || got.Metadata == nil {
+		t.Errorf("User() of a subscription owner = %+v", got)
+	}
+
+	users, err := userR.Users(ctx, 1, 0)
+	if err != nil {
+		t.Fatalf("Users(): %v", err)
+	}
+	rest, err := userR.Users(ctx, 10, 1)
+	if err != nil {
+		t.Fatalf("Users(): %v", err)
+	}
+	if len(users) != 1 || len(rest) != 1 || users[0].Id.String() > rest[0].Id.String() {
+		t.Errorf("Users() pages = %v and %v, want one user each by id", users, rest)
+	}
+}
+
+func testDeleteUser(t *testing.T, repo domain.SubscriptionRepository) {
+	userR := userRepo(t, repo)
+	ctx := context.Background()
+
+	userId := uuid.New()
+	live := mustStore(t, repo, newSub(userId, "Okko", 100, month(time.January, 2025), time.Time{}))
+	deleted := mustStore(t, repo, newSub(userId, "Wink", 200, month(time.January, 2025), time.Time{}))
+	if err := repo.DeleteSub(ctx, deleted, 0); err != nil {
+		t.Fatalf("DeleteSub(): %v", err)
+	}
+	other := mustStore(t, repo, newSub(uuid.New(), "Okko", 100, month(time.January, 2025), time.Time{}))
+
+	n, err := userR.DeleteUser(ctx, userId)
+	if err != nil {
+		t.Fatalf("DeleteUser(): %v", err)
+	}
+	if n != 2 {
+		t.Errorf("DeleteUser() = %d, want 2", n)
+	}
+	if _, err := userR.User(ctx, userId); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("User() of a deleted user error = %v, want domain.ErrNotFound", err)
+	}
+	for _, id := range []domain.SubID{live, deleted} {
+		if _, err := repo.Sub(ctx, id, true); !errors.Is(err, domain.ErrNotFound) {
+			t.Errorf("Sub(%d) of a deleted user error = %v, want domain.ErrNotFound", id, err)
+		}
+	}
+	mustGet(t, repo, other)
+
+	// The audit log outlives the subscriptions and shows their end.
+	history, err := repo.SubHistory(ctx, live)
+	if err != nil {
+		t.Fatalf("SubHistory(): %v", err)
+	}
+	wantActions(t, history, live, domain.AuditCreate, domain.AuditDelete)
+	history, err = repo.SubHistory(ctx, deleted)
+	if err != nil {
+		t.Fatalf("SubHistory(): %v", err)
+	}
+	wantActions(t, history, deleted, domain.AuditCreate, domain.AuditDelete)
+
+	if _, err := userR.DeleteUser(ctx, userId); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("DeleteUser() again error = %v, want domain.ErrNotFound", err)
+	}
+}
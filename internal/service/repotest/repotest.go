@@ -0,0 +1,1590 @@
+// Package repotest holds the conformance suite every
+// domain.SubscriptionRepository implementation has to pass.
+//
+// Call Run from a test of the implementation's package:
+//
+//	func TestMemSubRepo(t *testing.T) {
+//		repotest.Run(t, func(testing.TB) domain.SubscriptionRepository {
+//			return service.NewMemSubRepo()
+//		})
+//	}
+//
+// The factory must return an empty repository for every call. The
+// catalog tests run for repositories that are a domain.ServiceRepository
+// and a domain.UserRepository too.
+// RunBenchmarks and RunCancellation take the same factory.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+)
+
+type Factory func(tb testing.TB) domain.SubscriptionRepository
+
+func Run(t *testing.T, newRepo Factory) {
+	t.Run("StoreAndGet", func(t *testing.T) { testStoreAndGet(t, newRepo(t)) })
+	t.Run("IDGeneration", func(t *testing.T) { testIDGeneration(t, newRepo(t)) })
+	t.Run("ServiceNameDedup", func(t *testing.T) { testServiceNameDedup(t, newRepo(t)) })
+	t.Run("StoreConstraints", func(t *testing.T) { testStoreConstraints(t, newRepo(t)) })
+	t.Run("StoreSubs", func(t *testing.T) { testStoreSubs(t, newRepo(t)) })
+	t.Run("ApplySubs", func(t *testing.T) { testApplySubs(t, newRepo(t)) })
+	t.Run("SubNotFound", func(t *testing.T) { testSubNotFound(t, newRepo(t)) })
+	t.Run("UserSubsOrdering", func(t *testing.T) { testUserSubsOrdering(t, newRepo(t)) })
+	t.Run("Update", func(t *testing.T) { testUpdate(t, newRepo(t)) })
+	t.Run("UpdateErrors", func(t *testing.T) { testUpdateErrors(t, newRepo(t)) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, newRepo(t)) })
+	t.Run("SoftDelete", func(t *testing.T) { testSoftDelete(t, newRepo(t)) })
+	t.Run("Versions", func(t *testing.T) { testVersions(t, newRepo(t)) })
+	t.Run("ConcurrentVersionedUpdate", func(t *testing.T) { testConcurrentVersionedUpdate(t, newRepo(t)) })
+	t.Run("IdempotencyKeys", func(t *testing.T) { testIdempotencyKeys(t, newRepo(t)) })
+	t.Run("ConcurrentIdempotentStore", func(t *testing.T) { testConcurrentIdempotentStore(t, newRepo(t)) })
+	t.Run("Audit", func(t *testing.T) { testAudit(t, newRepo(t)) })
+	t.Run("Services", func(t *testing.T) { testServices(t, newRepo(t)) })
+	t.Run("MergeServices", func(t *testing.T) { testMergeServices(t, newRepo(t)) })
+	t.Run("ServiceAliases", func(t *testing.T) { testServiceAliases(t, newRepo(t)) })
+	t.Run("SearchServices", func(t *testing.T) { testSearchServices(t, newRepo(t)) })
+	t.Run("Users", func(t *testing.T) { testUsers(t, newRepo(t)) })
+	t.Run("DeleteUser", func(t *testing.T) { testDeleteUser(t, newRepo(t)) })
+	t.Run("AuditBatch", func(t *testing.T) { testAuditBatch(t, newRepo(t)) })
+	t.Run("TotalCosts", func(t *testing.T) { testTotalCosts(t, newRepo(t)) })
+	t.Run("TotalCostsErrors", func(t *testing.T) { testTotalCostsErrors(t, newRepo(t)) })
+	t.Run("TotalCostsOptionalFilters", func(t *testing.T) { testTotalCostsOptionalFilters(t, newRepo(t)) })
+	t.Run("CostsByGroup", func(t *testing.T) { testCostsByGroup(t, newRepo(t)) })
+	t.Run("MonthlyCosts", func(t *testing.T) { testMonthlyCosts(t, newRepo(t)) })
+	t.Run("CostsByCurrency", func(t *testing.T) { testCostsByCurrency(t, newRepo(t)) })
+	t.Run("BillingPeriods", func(t *testing.T) { testBillingPeriods(t, newRepo(t)) })
+	t.Run("DayPrecision", func(t *testing.T) { testDayPrecision(t, newRepo(t)) })
+	t.Run("ProRataCosts", func(t *testing.T) { testProRataCosts(t, newRepo(t)) })
+	t.Run("ConcurrentStore", func(t *testing.T) { testConcurrentStore(t, newRepo(t)) })
+	t.Run("ListFilters", func(t *testing.T) { testListFilters(t, newRepo(t)) })
+	t.Run("ListPagination", func(t *testing.T) { testListPagination(t, newRepo(t)) })
+}
+
+func month(m time.Month, year int) time.Time {
+	return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func newSub(userId uuid.UUID, serviceName string, price int, start, end time.Time) domain.Subscription {
+	return domain.Subscription{
+		UserID:        userId,
+		ServiceName:   serviceName,
+		Price:         price,
+		Currency:      domain.DefaultCurrency,
+		BillingPeriod: domain.DefaultBillingPeriod,
+		StartDate:     start,
+		EndDate:       end,
+	}
+}
+
+// updateOf is the update of the non-zero fields of sub, checked against
+// the user of sub.
+func updateOf(sub domain.Subscription) domain.SubUpdate {
+	upd := domain.SubUpdate{SubId: sub.SubId, UserID: &sub.UserID, Version: sub.Version}
+	if sub.ServiceName != "" {
+		upd.ServiceName = &sub.ServiceName
+	}
+	if sub.Price != 0 {
+		upd.Price = &sub.Price
+	}
+	if sub.Currency != "" {
+		upd.Currency = &sub.Currency
+	}
+	if sub.BillingPeriod != "" {
+		upd.BillingPeriod = &sub.BillingPeriod
+	}
+	if !sub.StartDate.IsZero() {
+		upd.StartDate = &sub.StartDate
+	}
+	if !sub.EndDate.IsZero() {
+		upd.EndDate = &sub.EndDate
+	}
+	return upd
+}
+
+func mustStore(t *testing.T, repo domain.SubscriptionRepository, sub domain.Subscription) domain.SubID {
+	t.Helper()
+	id, err := repo.StoreSub(context.Background(), sub)
+	if err != nil {
+		t.Fatalf("StoreSub(%+v): %v", sub, err)
+	}
+	return id
+}
+
+func mustGet(t *testing.T, repo domain.SubscriptionRepository, id domain.SubID) domain.Subscription {
+	t.Helper()
+	sub, err := repo.Sub(context.Background(), id, false)
+	if err != nil {
+		t.Fatalf("Sub(%d): %v", id, err)
+	}
+	return sub
+}
+
+func sameSub(a, b domain.Subscription) bool {
+	return a.SubId == b.SubId &&
+		a.UserID == b.UserID &&
+		a.ServiceName == b.ServiceName &&
+		a.Price == b.Price &&
+		a.Currency == b.Currency &&
+		a.BillingPeriod == b.BillingPeriod &&
+		a.StartDate.Equal(b.StartDate) &&
+		a.EndDate.Equal(b.EndDate)
+}
+
+func testStoreAndGet(t *testing.T, repo domain.SubscriptionRepository) {
+	userId := uuid.New()
+	want := newSub(userId, "Yandex Plus", 399, month(time.July, 2025), time.Time{})
+	want.SubId = mustStore(t, repo, want)
+
+	got := mustGet(t, repo, want.SubId)
+	if !sameSub(got, want) {
+		t.Errorf("Sub() = %+v, want %+v", got, want)
+	}
+	if !got.EndDate.IsZero() {
+		t.Errorf("open subscription has end date %v", got.EndDate)
+	}
+
+	withEnd := newSub(userId, "Yandex Plus", 399, month(time.July, 2025), month(time.August, 2025))
+	withEnd.SubId = mustStore(t, repo, withEnd)
+	if got := mustGet(t, repo, withEnd.SubId); !sameSub(got, withEnd) {
+		t.Errorf("Sub() = %+v, want %+v", got, withEnd)
+	}
+}
+
+func testIDGeneration(t *testing.T, repo domain.SubscriptionRepository) {
+	userId := uuid.New()
+	prev := domain.SubID(0)
+	for i := 0; i < 5; i++ {
+		id := mustStore(t, repo, newSub(userId, "Netflix", 100+i, month(time.January, 2025), time.Time{}))
+		if id <= prev {
+			t.Fatalf("StoreSub() id = %d, want greater than %d", id, prev)
+		}
+		prev = id
+	}
+}
+
+func testServiceNameDedup(t *testing.T, repo domain.SubscriptionRepository) {
+	first := mustStore(t, repo, newSub(uuid.New(), "Spotify", 199, month(time.March, 2025), time.Time{}))
+	second := mustStore(t, repo, newSub(uuid.New(), "Spotify", 299, month(time.April, 2025), time.Time{}))
+	other := mustStore(t, repo, newSub(uuid.New(), "spotify", 299, month(time.April, 2025), time.Time{}))
+
+	if got := mustGet(t, repo, first).ServiceName; got != "Spotify" {
+		t.Errorf("first ServiceName = %q", got)
+	}
+	if got := mustGet(t, repo, second).ServiceName; got != "Spotify" {
+		t.Errorf("second ServiceName = %q", got)
+	}
+	if got := mustGet(t, repo, other).ServiceName; got != "spotify" {
+		t.Errorf("service names must be compared exactly, got %q", got)
+	}
+}
+
+func testStoreConstraints(t *testing.T, repo domain.SubscriptionRepository) {
+	userId := uuid.New()
+	long := "Service with a name that is definitely longer than fifty characters"
+	badCurrency := newSub(userId, "Kion", 100, month(time.May, 2025), time.Time{})
+	badCurrency.Currency = "rub"
+	badPeriod := newSub(userId, "Kion", 100, month(time.May, 2025), time.Time{})
+	badPeriod.BillingPeriod = "daily"
+	cases := map[string]domain.Subscription{
+		"negative price":     newSub(userId, "Kion", -1, month(time.May, 2025), time.Time{}),
+		"end before start":   newSub(userId, "Kion", 100, month(time.May, 2025), month(time.April, 2025)),
+		"service name limit": newSub(userId, long, 100, month(time.May, 2025), time.Time{}),
+		"currency code":      badCurrency,
+		"billing period":     badPeriod,
+	}
+	for name, sub := range cases {
+		if _, err := repo.StoreSub(context.Background(), sub); !errors.Is(err, domain.ErrValidation) {
+			t.Errorf("%s: StoreSub() error = %v, want domain.ErrValidation", name, err)
+		}
+	}
+	subs, err := repo.UserSubs(context.Background(), userId, false)
+	if err != nil {
+		t.Fatalf("UserSubs(): %v", err)
+	}
+	if len(subs) != 0 {
+		t.Errorf("failed inserts left %d subscriptions", len(subs))
+	}
+}
+
+func testStoreSubs(t *testing.T, repo domain.SubscriptionRepository) {
+	userId := uuid.New()
+	subs := []domain.Subscription{
+		newSub(userId, "Netflix", 100, month(time.January, 2025), time.Time{}),
+		newSub(userId, "Kion", -1, month(time.January, 2025), time.Time{}),
+		newSub(userId, "Spotify", 200, month(time.February, 2025), month(time.March, 2025)),
+	}
+	stored := func() int {
+		t.Helper()
+		got, err := repo.UserSubs(context.Background(), userId, false)
+		if err != nil {
+			t.Fatalf("UserSubs(): %v", err)
+		}
+		return len(got)
+	}
+	check := func(name string, mode domain.TxMode, dryRun bool, wantIds bool) []domain.StoreResult {
+		t.Helper()
+		res, err := repo.StoreSubs(context.Background(), subs, mode, dryRun)
+		if err != nil {
+			t.Fatalf("%s: StoreSubs(): %v", name, err)
+		}
+		if len(res) != len(subs) {
+			t.Fatalf("%s: StoreSubs() returned %d results, want %d", name, len(res), len(subs))
+		}
+		if !errors.Is(res[1].Err, domain.ErrValidation) || res[1].SubId != 0 {
+			t.Errorf("%s: result of the negative price = %+v, want a validation error", name, res[1])
+		}
+		for _, i := range []int{0, 2} {
+			if res[i].Err != nil || (res[i].SubId != 0) != wantIds {
+				t.Errorf("%s: result %d = %+v, want no error and an id: %v", name, i, res[i], wantIds)
+			}
+		}
+		return res
+	}
+
+	check("dry run", domain.TxBestEffort, true, false)
+	check("all or nothing", domain.TxAllOrNothing, false, false)
+	if n := stored(); n != 0 {
+		t.Fatalf("dry run and failed all-or-nothing stored %d subscriptions", n)
+	}
+
+	res := check("best effort", domain.TxBestEffort, false, true)
+	if n := stored(); n != 2 {
+		t.Fatalf("best effort stored %d subscriptions, want 2", n)
+	}
+	for _, i := range []int{0, 2} {
+		want := subs[i]
+		want.SubId = res[i].SubId
+		if got := mustGet(t, repo, res[i].SubId); !sameSub(got, want) {
+			t.Errorf("Sub(%d) = %+v, want %+v", want.SubId, got, want)
+		}
+	}
+
+	valid := []domain.Subscription{subs[0], subs[2]}
+	res, err := repo.StoreSubs(context.Background(), valid, domain.TxAllOrNothing, false)
+	if err != nil {
+		t.Fatalf("StoreSubs(): %v", err)
+	}
+	if res[0].SubId == 0 || res[1].SubId <= res[0].SubId {
+		t.Errorf("all or nothing ids = %d, %d, want increasing ids", res[0].SubId, res[1].SubId)
+	}
+	if n := stored(); n != 4 {
+		t.Errorf("all or nothing stored %d subscriptions in total, want 4", n)
+	}
+}
+
+func testApplySubs(t *testing.T, repo domain.SubscriptionRepository) {
+	userId := uuid.New()
+	kept := newSub(userId, "Okko", 299, month(time.January, 2025), time.Time{})
+	kept.SubId = mustStore(t, repo, kept)
+	gone := newSub(userId, "Ivi", 199, month(time.January, 2025), time.Time{})
+	gone.SubId = mustStore(t, repo, gone)
+
+	created := newSub(userId, "Netflix", 100, month(time.March, 2025), time.Time{})
+	ops := []domain.SubOp{
+		{Kind: domain.SubOpCreate, Sub: created},
+		{Kind: domain.SubOpUpdate, Update: updateOf(domain.Subscription{SubId: kept.SubId, UserID: userId, Price: 399})},
+		{Kind: domain.SubOpDelete, Update: domain.SubUpdate{SubId: gone.SubId}},
+		{Kind: domain.SubOpDelete, Update: domain.SubUpdate{SubId: gone.SubId + 1000}},
+	}
+	apply := func(name string, ops []domain.SubOp, mode domain.TxMode) []domain.StoreResult {
+		t.Helper()
+		res, err := repo.ApplySubs(context.Background(), ops, mode)
+		if err != nil {
+			t.Fatalf("%s: ApplySubs(): %v", name, err)
+		}
+		if len(res) != len(ops) {
+			t.Fatalf("%s: ApplySubs() returned %d results, want %d", name, len(res), len(ops))
+		}
+		return res
+	}
+
+	res := apply("all or nothing", ops, domain.TxAllOrNothing)
+	if !errors.Is(res[3].Err, domain.ErrNotFound) {
+		t.Errorf("all or nothing: result of the missing sub = %+v, want domain.ErrNotFound", res[3])
+	}
+	for i, r := range res {
+		if r.SubId != 0 {
+			t.Errorf("all or nothing: result %d has id %d", i, r.SubId)
+		}
+	}
+	if got := mustGet(t, repo, kept.SubId); !sameSub(got, kept) {
+		t.Errorf("failed all or nothing changed sub: %+v, want %+v", got, kept)
+	}
+	mustGet(t, repo, gone.SubId)
+	if subs, err := repo.UserSubs(context.Background(), userId, false); err != nil || len(subs) != 2 {
+		t.Errorf("UserSubs() after failed all or nothing = %d subs, %v, want 2", len(subs), err)
+	}
+
+	res = apply("best effort", ops, domain.TxBestEffort)
+	for i, r := range res[:3] {
+		if r.Err != nil || r.SubId == 0 {
+			t.Errorf("best effort: result %d = %+v, want an id", i, r)
+		}
+	}
+	if !errors.Is(res[3].Err, domain.ErrNotFound) || res[3].SubId != 0 {
+		t.Errorf("best effort: result of the missing sub = %+v, want domain.ErrNotFound", res[3])
+	}
+	created.SubId = res[0].SubId
+	if got := mustGet(t, repo, created.SubId); !sameSub(got, created) {
+		t.Errorf("created Sub() = %+v, want %+v", got, created)
+	}
+	kept.Price = 399
+	if got := mustGet(t, repo, kept.SubId); !sameSub(got, kept) {
+		t.Errorf("updated Sub() = %+v, want %+v", got, kept)
+	}
+	if _, err := repo.Sub(context.Background(), gone.SubId, false); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Sub() of deleted sub error = %v, want domain.ErrNotFound", err)
+	}
+
+	// A later op sees the earlier ones.
+	again := []domain.SubOp{
+		{Kind: domain.SubOpDelete, Update: domain.SubUpdate{SubId: created.SubId}},
+		{Kind: domain.SubOpUpdate, Update: updateOf(domain.Subscription{SubId: created.SubId, UserID: userId, Price: 1})},
+	}
+	res = apply("update after delete", again, domain.TxBestEffort)
+	if res[0].Err != nil || !errors.Is(res[1].Err, domain.ErrNotFound) {
+		t.Errorf("update after delete = %+v, want the update to fail with domain.ErrNotFound", res)
+	}
+
+	res = apply("all or nothing", []domain.SubOp{
+		{Kind: domain.SubOpCreate, Sub: created},
+		{Kind: domain.SubOpUpdate, Update: updateOf(domain.Subscription{SubId: kept.SubId, UserID: userId, Price: 0, Currency: "USD"})},
+	}, domain.TxAllOrNothing)
+	for i, r := range res {
+		if r.Err != nil || r.SubId == 0 {
+			t.Errorf("all or nothing: result %d = %+v, want an id", i, r)
+		}
+	}
+	kept.Currency = "USD"
+	if got := mustGet(t, repo, kept.SubId); !sameSub(got, kept) {
+		t.Errorf("updated Sub() = %+v, want %+v", got, kept)
+	}
+
+	// Updates and deletes of a stale version fail on their own.
+	cur := mustGet(t, repo, kept.SubId).Version
+	res = apply("stale versions", []domain.SubOp{
+		{Kind: domain.SubOpUpdate, Update: updateOf(domain.Subscription{SubId: kept.SubId, UserID: userId, Price: 1, Version: cur - 1})},
+		{Kind: domain.SubOpDelete, Update: domain.SubUpdate{SubId: kept.SubId, Version: cur + 1}},
+		{Kind: domain.SubOpUpdate, Update: updateOf(domain.Subscription{SubId: kept.SubId, UserID: userId, Price: 499, Version: cur})},
+	}, domain.TxBestEffort)
+	for i, r := range res[:2] {
+		if !errors.Is(r.Err, domain.ErrPreconditionFailed) || r.SubId != 0 {
+			t.Errorf("stale versions: result %d = %+v, want domain.ErrPreconditionFailed", i, r)
+		}
+	}
+	if res[2].Err != nil || res[2].SubId != kept.SubId {
+		t.Errorf("stale versions: result of the current version = %+v, want the update", res[2])
+	}
+	if got := mustGet(t, repo, kept.SubId); got.Price != 499 || got.Version != cur+1 {
+		t.Errorf("Sub() after stale versions = %+v, want price 499 at version %d", got, cur+1)
+	}
+}
+
+func testSubNotFound(t *testing.T, repo domain.SubscriptionRepository) {
+	_, err := repo.Sub(context.Background(), 424242, false)
+	if !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Sub() of missing id error = %v, want domain.ErrNotFound", err)
+	}
+}
+
+func testUserSubsOrdering(t *testing.T, repo domain.SubscriptionRepository) {
+	userId := uuid.New()
+	otherId := uuid.New()
+	var want []domain.SubID
+	for i, name := range []string{"C", "A", "B"} {
+		want = append(want, mustStore(t, repo, newSub(userId, name, 10+i, month(time.January, 2024), time.Time{})))
+		mustStore(t, repo, newSub(otherId, name, 10+i, month(time.January, 2024), time.Time{}))
+	}
+
+	subs, err := repo.UserSubs(context.Background(), userId, false)
+	if err != nil {
+		t.Fatalf("UserSubs(): %v", err)
+	}
+	if len(subs) != len(want) {
+		t.Fatalf("UserSubs() returned %d subs, want %d", len(subs), len(want))
+	}
+	for i, s := range subs {
+		if s.SubId != want[i] {
+			t.Errorf("UserSubs()[%d].SubId = %d, want %d", i, s.SubId, want[i])
+		}
+		if s.UserID != userId {
+			t.Errorf("UserSubs()[%d] belongs to %v", i, s.UserID)
+		}
+	}
+
+	empty, err := repo.UserSubs(context.Background(), uuid.New(), false)
+	if err != nil {
+		t.Fatalf("UserSubs() of unknown user: %v", err)
+	}
+	if len(empty) != 0 {
+		t.Errorf("UserSubs() of unknown user returned %d subs", len(empty))
+	}
+}
+
+func testUpdate(t *testing.T, repo domain.SubscriptionRepository) {
+	userId := uuid.New()
+	sub := newSub(userId, "Okko", 299, month(time.February, 2025), time.Time{})
+	sub.SubId = mustStore(t, repo, sub)
+
+	upd := domain.Subscription{
+		SubId:       sub.SubId,
+		UserID:      userId,
+		ServiceName: "Okko Premium",
+		Price:       499,
+		EndDate:     month(time.December, 2025),
+	}
+	if err := repo.UpdateSub(context.Background(), updateOf(upd)); err != nil {
+		t.Fatalf("UpdateSub(): %v", err)
+	}
+	want := sub
+	want.ServiceName = "Okko Premium"
+	want.Price = 499
+	want.EndDate = month(time.December, 2025)
+	if got := mustGet(t, repo, sub.SubId); !sameSub(got, want) {
+		t.Errorf("after update Sub() = %+v, want %+v", got, want)
+	}
+
+	onlyStart := domain.Subscription{SubId: sub.SubId, UserID: userId, StartDate: month(time.March, 2025)}
+	if err := repo.UpdateSub(context.Background(), updateOf(onlyStart)); err != nil {
+		t.Fatalf("UpdateSub() of start date: %v", err)
+	}
+	want.StartDate = month(time.March, 2025)
+	if got := mustGet(t, repo, sub.SubId); !sameSub(got, want) {
+		t.Errorf("after start date update Sub() = %+v, want %+v", got, want)
+	}
+
+	// Zero values and a cleared end date are updates too, the user is
+	// not required.
+	free, noEnd := 0, time.Time{}
+	if err := repo.UpdateSub(context.Background(), domain.SubUpdate{SubId: sub.SubId, Price: &free, EndDate: &noEnd}); err != nil {
+		t.Fatalf("UpdateSub() to a free sub without end: %v", err)
+	}
+	want.Price = 0
+	want.EndDate = time.Time{}
+	if got := mustGet(t, repo, sub.SubId); !sameSub(got, want) {
+		t.Errorf("after clearing the end date Sub() = %+v, want %+v", got, want)
+	}
+}
+
+func testUpdateErrors(t *testing.T, repo domain.SubscriptionRepository) {
+	userId := uuid.New()
+	sub := newSub(userId, "Ivi", 199, month(time.February, 2025), month(time.June, 2025))
+	sub.SubId = mustStore(t, repo, sub)
+
+	cases := map[string]struct {
+		upd  domain.Subscription
+		kind error
+	}{
+		"missing sub":           {domain.Subscription{SubId: sub.SubId + 1000, UserID: userId, Price: 1}, domain.ErrNotFound},
+		"nil user":              {domain.Subscription{SubId: sub.SubId, Price: 1}, domain.ErrValidation},
+		"changed user":          {domain.Subscription{SubId: sub.SubId, UserID: uuid.New(), Price: 1}, domain.ErrImmutableField},
+		"nothing to update":     {domain.Subscription{SubId: sub.SubId, UserID: userId}, domain.ErrValidation},
+		"end before old start":  {domain.Subscription{SubId: sub.SubId, UserID: userId, EndDate: month(time.January, 2025)}, domain.ErrValidation},
+		"end before new start":  {domain.Subscription{SubId: sub.SubId, UserID: userId, StartDate: month(time.May, 2025), EndDate: month(time.April, 2025)}, domain.ErrValidation},
+		"start after old end":   {domain.Subscription{SubId: sub.SubId, UserID: userId, StartDate: month(time.July, 2025)}, domain.ErrValidation},
+		"negative price":        {domain.Subscription{SubId: sub.SubId, UserID: userId, Price: -1}, domain.ErrValidation},
+		"service name too long": {domain.Subscription{SubId: sub.SubId, UserID: userId, ServiceName: "Service with a name that is definitely longer than fifty characters"}, domain.ErrValidation},
+	}
+	for name, c := range cases {
+		if err := repo.UpdateSub(context.Background(), updateOf(c.upd)); !errors.Is(err, c.kind) {
+			t.Errorf("%s: UpdateSub() error = %v, want %v", name, err, c.kind)
+		}
+	}
+	if got := mustGet(t, repo, sub.SubId); !sameSub(got, sub) {
+		t.Errorf("failed updates changed sub: %+v, want %+v", got, sub)
+	}
+}
+
+func testDelete(t *testing.T, repo domain.SubscriptionRepository) {
+	userId := uuid.New()
+	id := mustStore(t, repo, newSub(userId, "Wink", 150, month(time.January, 2025), time.Time{}))
+
+	if err := repo.DeleteSub(context.Background(), id, 0); err != nil {
+		t.Fatalf("DeleteSub(): %v", err)
+	}
+	if _, err := repo.Sub(context.Background(), id, false); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Sub() after delete error = %v, want domain.ErrNotFound", err)
+	}
+	if err := repo.DeleteSub(context.Background(), id, 0); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("second DeleteSub() error = %v, want domain.ErrNotFound", err)
+	}
+	subs, err := repo.UserSubs(context.Background(), userId, false)
+	if err != nil {
+		t.Fatalf("UserSubs(): %v", err)
+	}
+	if len(subs) != 0 {
+		t.Errorf("UserSubs() after delete returned %d subs", len(subs))
+	}
+}
+
+func testSoftDelete(t *testing.T, repo domain.SubscriptionRepository) {
+	ctx := context.Background()
+	userId := uuid.New()
+	id := mustStore(t, repo, newSub(userId, "Wink", 150, month(time.January, 2025), time.Time{}))
+	mustStore(t, repo, newSub(userId, "Wink", 10, month(time.January, 2025), time.Time{}))
+
+	if err := repo.DeleteSub(ctx, id, 0); err != nil {
+		t.Fatalf("DeleteSub(): %v", err)
+	}
+	sub, err := repo.Sub(ctx, id, true)
+	if err != nil {
+		t.Fatalf("Sub() including deleted: %v", err)
+	}
+	if !sub.Deleted() {
+		t.Errorf("Sub() including deleted has no DeletedAt")
+	}
+	if subs, err := repo.UserSubs(ctx, userId, false); err != nil || len(subs) != 1 {
+		t.Errorf("UserSubs() = %d subs, %v, want 1 sub", len(subs), err)
+	}
+	if subs, err := repo.UserSubs(ctx, userId, true); err != nil || len(subs) != 2 {
+		t.Errorf("UserSubs() including deleted = %d subs, %v, want 2 subs", len(subs), err)
+	}
+	page, err := repo.ListSubs(ctx, domain.SubsListQuery{Filter: domain.SubsListFilter{UserID: userId}, SortBy: domain.SortBySubId, Limit: 10})
+	if err != nil || page.Total != 1 {
+		t.Errorf("ListSubs() total = %d, %v, want 1", page.Total, err)
+	}
+	page, err = repo.ListSubs(ctx, domain.SubsListQuery{Filter: domain.SubsListFilter{UserID: userId, IncludeDeleted: true}, SortBy: domain.SortBySubId, Limit: 10})
+	if err != nil || page.Total != 2 {
+		t.Errorf("ListSubs() including deleted total = %d, %v, want 2", page.Total, err)
+	}
+	filter := domain.SubsFilter{StartDate: month(time.January, 2025), EndDate: month(time.February, 2025), UserID: userId}
+	if totals, _, err := repo.SubsTotalCosts(ctx, filter); err != nil || totals[domain.DefaultCurrency] != 10 {
+		t.Errorf("SubsTotalCosts() = %v, %v, want only the active sub", totals, err)
+	}
+	if err := repo.UpdateSub(ctx, updateOf(domain.Subscription{SubId: id, Price: 200})); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("UpdateSub() of a deleted sub error = %v, want domain.ErrNotFound", err)
+	}
+
+	if err := repo.RestoreSub(ctx, id); err != nil {
+		t.Fatalf("RestoreSub(): %v", err)
+	}
+	if sub := mustGet(t, repo, id); sub.Deleted() || sub.Price != 150 {
+		t.Errorf("Sub() after restore = %+v", sub)
+	}
+	if err := repo.RestoreSub(ctx, id); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("RestoreSub() of an active sub error = %v, want domain.ErrConflict", err)
+	}
+	if err := repo.RestoreSub(ctx, id+1000); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("RestoreSub() of a missing sub error = %v, want domain.ErrNotFound", err)
+	}
+
+	if err := repo.DeleteSub(ctx, id, 0); err != nil {
+		t.Fatalf("DeleteSub() after restore: %v", err)
+	}
+	if purged, err := repo.PurgeSubs(ctx, time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+		t.Errorf("PurgeSubs() before the deletion = %d, %v, want 0", purged, err)
+	}
+	if purged, err := repo.PurgeSubs(ctx, time.Now().Add(time.Hour)); err != nil || purged != 1 {
+		t.Errorf("PurgeSubs() after the deletion = %d, %v, want 1", purged, err)
+	}
+	if _, err := repo.Sub(ctx, id, true); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Sub() including deleted after purge error = %v, want domain.ErrNotFound", err)
+	}
+}
+
+func testVersions(t *testing.T, repo domain.SubscriptionRepository) {
+	ctx := context.Background()
+	userId := uuid.New()
+	id := mustStore(t, repo, newSub(userId, "Wink", 100, month(time.January, 2025), time.Time{}))
+	if v := mustGet(t, repo, id).Version; v != 1 {
+		t.Fatalf("Version of a new sub = %d, want 1", v)
+	}
+
+	if err := repo.UpdateSub(ctx, updateOf(domain.Subscription{SubId: id, UserID: userId, Price: 200, Version: 1})); err != nil {
+		t.Fatalf("UpdateSub() of version 1: %v", err)
+	}
+	if sub := mustGet(t, repo, id); sub.Version != 2 || sub.Price != 200 {
+		t.Errorf("Sub() after update = version %d, price %d, want 2, 200", sub.Version, sub.Price)
+	}
+	err := repo.UpdateSub(ctx, updateOf(domain.Subscription{SubId: id, UserID: userId, Price: 300, Version: 1}))
+	if !errors.Is(err, domain.ErrPreconditionFailed) {
+		t.Errorf("UpdateSub() of a stale version error = %v, want domain.ErrPreconditionFailed", err)
+	}
+	if err := repo.DeleteSub(ctx, id, 1); !errors.Is(err, domain.ErrPreconditionFailed) {
+		t.Errorf("DeleteSub() of a stale version error = %v, want domain.ErrPreconditionFailed", err)
+	}
+	if sub := mustGet(t, repo, id); sub.Version != 2 || sub.Price != 200 {
+		t.Errorf("failed writes changed the sub: %+v", sub)
+	}
+	// Zero skips the check.
+	if err := repo.UpdateSub(ctx, updateOf(domain.Subscription{SubId: id, UserID: userId, Price: 300})); err != nil {
+		t.Fatalf("UpdateSub() of any version: %v", err)
+	}
+
+	if err := repo.DeleteSub(ctx, id, 3); err != nil {
+		t.Fatalf("DeleteSub() of version 3: %v", err)
+	}
+	if err := repo.RestoreSub(ctx, id); err != nil {
+		t.Fatalf("RestoreSub(): %v", err)
+	}
+	if v := mustGet(t, repo, id).Version; v != 5 {
+		t.Errorf("Version after delete and restore = %d, want 5", v)
+	}
+
+	results, err := repo.ApplySubs(ctx, []domain.SubOp{
+		{Kind: domain.SubOpUpdate, Update: updateOf(domain.Subscription{SubId: id, UserID: userId, Price: 400, Version: 4})},
+	}, domain.TxBestEffort)
+	if err != nil {
+		t.Fatalf("ApplySubs(): %v", err)
+	}
+	if !errors.Is(results[0].Err, domain.ErrPreconditionFailed) {
+		t.Errorf("ApplySubs() of a stale version error = %v, want domain.ErrPreconditionFailed", results[0].Err)
+	}
+	results, err = repo.ApplySubs(ctx, []domain.SubOp{
+		{Kind: domain.SubOpUpdate, Update: updateOf(domain.Subscription{SubId: id, UserID: userId, Price: 400, Version: 5})},
+		{Kind: domain.SubOpDelete, Update: domain.SubUpdate{SubId: id, Version: 5}},
+	}, domain.TxAllOrNothing)
+	if err != nil {
+		t.Fatalf("ApplySubs(): %v", err)
+	}
+	for i, r := range results {
+		if r.Err != nil {
+			t.Errorf("ApplySubs() op %d: %v", i, r.Err)
+		}
+	}
+	if sub, err := repo.Sub(ctx, id, true); err != nil || sub.Version != 7 {
+		t.Errorf("Sub() after the batch = version %d, %v, want 7", sub.Version, err)
+	}
+}
+
+// testConcurrentVersionedUpdate races updates of the same version, only
+// one of them may win.
+func testConcurrentVersionedUpdate(t *testing.T, repo domain.SubscriptionRepository) {
+	const n = 10
+	userId := uuid.New()
+	id := mustStore(t, repo, newSub(userId, "Shared", 100, month(time.January, 2025), time.Time{}))
+
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- repo.UpdateSub(context.Background(), updateOf(domain.Subscription{SubId: id, UserID: userId, Price: 200 + i, Version: 1}))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	won := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			won++
+		case !errors.Is(err, domain.ErrPreconditionFailed):
+			t.Errorf("UpdateSub() error = %v, want domain.ErrPreconditionFailed", err)
+		}
+	}
+	if won != 1 {
+		t.Errorf("%d updates of version 1 succeeded, want 1", won)
+	}
+	if v := mustGet(t, repo, id).Version; v != 2 {
+		t.Errorf("Version after the race = %d, want 2", v)
+	}
+}
+
+func idemKey(key, hash string, ttl time.Duration) domain.IdempotencyKey {
+	return domain.IdempotencyKey{Key: key, RequestHash: hash, ExpiresAt: time.Now().Add(ttl)}
+}
+
+func testIdempotencyKeys(t *testing.T, repo domain.SubscriptionRepository) {
+	ctx := context.Background()
+	userId := uuid.New()
+	sub := newSub(userId, "Okko", 100, month(time.January, 2025), time.Time{})
+
+	id, replayed, err := repo.StoreSubOnce(ctx, idemKey("k1", "h1", time.Hour), sub)
+	if err != nil || replayed {
+		t.Fatalf("StoreSubOnce() of a new key = %d, %v, %v, want stored", id, replayed, err)
+	}
+	again, replayed, err := repo.StoreSubOnce(ctx, idemKey("k1", "h1", time.Hour), sub)
+	if err != nil || !replayed || again != id {
+		t.Errorf("StoreSubOnce() repeated = %d, %v, %v, want %d replayed", again, replayed, err, id)
+	}
+	if _, _, err := repo.StoreSubOnce(ctx, idemKey("k1", "h2", time.Hour), sub); !errors.Is(err, domain.ErrKeyReused) {
+		t.Errorf("StoreSubOnce() with another hash error = %v, want domain.ErrKeyReused", err)
+	}
+	subs, err := repo.UserSubs(ctx, userId, false)
+	if err != nil {
+		t.Fatalf("UserSubs(): %v", err)
+	}
+	if len(subs) != 1 {
+		t.Errorf("%d subscriptions stored for one key, want 1", len(subs))
+	}
+
+	// The same key of another user is another key.
+	other := idemKey("k1", "h2", time.Hour)
+	other.Owner = uuid.New()
+	if otherId, replayed, err := repo.StoreSubOnce(ctx, other, sub); err != nil || replayed || otherId == id {
+		t.Errorf("StoreSubOnce() of the key of another user = %d, %v, %v, want a new sub", otherId, replayed, err)
+	}
+
+	// A failed store leaves the key free.
+	bad := newSub(userId, "Okko", -1, month(time.January, 2025), time.Time{})
+	if _, _, err := repo.StoreSubOnce(ctx, idemKey("k2", "h1", time.Hour), bad); !errors.Is(err, domain.ErrValidation) {
+		t.Fatalf("StoreSubOnce() of an invalid sub error = %v, want domain.ErrValidation", err)
+	}
+	if _, replayed, err := repo.StoreSubOnce(ctx, idemKey("k2", "h2", time.Hour), sub); err != nil || replayed {
+		t.Errorf("StoreSubOnce() after a failed store = %v, %v, want stored", replayed, err)
+	}
+
+	// An expired key is taken anew.
+	old, _, err := repo.StoreSubOnce(ctx, idemKey("k3", "h1", -time.Second), sub)
+	if err != nil {
+		t.Fatalf("StoreSubOnce(): %v", err)
+	}
+	fresh, replayed, err := repo.StoreSubOnce(ctx, idemKey("k3", "h2", time.Hour), sub)
+	if err != nil || replayed || fresh == old {
+		t.Errorf("StoreSubOnce() of an expired key = %d, %v, %v, want a new sub", fresh, replayed, err)
+	}
+
+	if _, _, err := repo.StoreSubOnce(ctx, idemKey("k4", "h1", -time.Second), sub); err != nil {
+		t.Fatalf("StoreSubOnce(): %v", err)
+	}
+	purged, err := repo.PurgeIdempotencyKeys(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("PurgeIdempotencyKeys(): %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("PurgeIdempotencyKeys() = %d, want 1", purged)
+	}
+	if _, replayed, err := repo.StoreSubOnce(ctx, idemKey("k1", "h1", time.Hour), sub); err != nil || !replayed {
+		t.Errorf("StoreSubOnce() of a live key after the purge = %v, %v, want replayed", replayed, err)
+	}
+}
+
+func testConcurrentIdempotentStore(t *testing.T, repo domain.SubscriptionRepository) {
+	const n = 10
+	userId := uuid.New()
+	sub := newSub(userId, "Retried", 100, month(time.January, 2025), time.Time{})
+
+	ids := make(chan domain.SubID, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, _, err := repo.StoreSubOnce(context.Background(), idemKey("retry", "h", time.Hour), sub)
+			if err != nil {
+				t.Errorf("StoreSubOnce(): %v", err)
+				return
+			}
+			ids <- id
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	first := <-ids
+	for id := range ids {
+		if id != first {
+			t.Errorf("StoreSubOnce() = %d and %d for one key", first, id)
+		}
+	}
+	subs, err := repo.UserSubs(context.Background(), userId, false)
+	if err != nil {
+		t.Fatalf("UserSubs(): %v", err)
+	}
+	if len(subs) != 1 {
+		t.Errorf("%d subscriptions stored by the retries, want 1", len(subs))
+	}
+}
+
+// wantActions checks the actions of entries, all of subscription id.
+func wantActions(t *testing.T, entries []domain.AuditEntry, id domain.SubID, want ...domain.AuditAction) {
+	t.Helper()
+	got := make([]domain.AuditAction, 0, len(entries))
+	for _, e := range entries {
+		if e.SubId != id {
+			t.Errorf("entry %d is of sub %d, want %d", e.Id, e.SubId, id)
+		}
+		got = append(got, e.Action)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("actions = %v, want %v", got, want)
+	}
+}
+
+func testAudit(t *testing.T, repo domain.SubscriptionRepository) {
+	meta := domain.AuditMeta{Actor: "alice", RequestID: "req-1"}
+	ctx := domain.WithAuditMeta(context.Background(), meta)
+	userId := uuid.New()
+	id, err := repo.StoreSub(ctx, newSub(userId, "Wink", 100, month(time.January, 2025), time.Time{}))
+	if err != nil {
+		t.Fatalf("StoreSub(): %v", err)
+	}
+	if err := repo.UpdateSub(ctx, updateOf(domain.Subscription{SubId: id, UserID: userId, Price: 200})); err != nil {
+		t.Fatalf("UpdateSub(): %v", err)
+	}
+	// Failed writes leave no entries.
+	if err := repo.UpdateSub(ctx, updateOf(domain.Subscription{SubId: id, UserID: uuid.New(), Price: 300})); err == nil {
+		t.Fatalf("UpdateSub() of another user succeeded")
+	}
+	if err := repo.DeleteSub(ctx, id, 0); err != nil {
+		t.Fatalf("DeleteSub(): %v", err)
+	}
+	if err := repo.RestoreSub(ctx, id); err != nil {
+		t.Fatalf("RestoreSub(): %v", err)
+	}
+	if _, err := repo.StoreSubs(ctx, []domain.Subscription{newSub(userId, "Wink", 5, month(time.January, 2025), time.Time{})}, domain.TxBestEffort, true); err != nil {
+		t.Fatalf("StoreSubs() dry run: %v", err)
+	}
+
+	entries, err := repo.SubHistory(ctx, id)
+	if err != nil {
+		t.Fatalf("SubHistory(): %v", err)
+	}
+	wantActions(t, entries, id, domain.AuditCreate, domain.AuditUpdate, domain.AuditDelete, domain.AuditRestore)
+	for i, e := range entries {
+		if e.Actor != meta.Actor || e.RequestID != meta.RequestID || e.UserID != userId {
+			t.Errorf("entry %d = actor %q, request %q, user %v", i, e.Actor, e.RequestID, e.UserID)
+		}
+		if e.New == nil || e.At.IsZero() {
+			t.Fatalf("entry %d has no new state or time", i)
+		}
+		if i > 0 && e.Id <= entries[i-1].Id {
+			t.Errorf("entry %d id %d is not after %d", i, e.Id, entries[i-1].Id)
+		}
+	}
+	if create := entries[0]; create.Old != nil || create.New.Price != 100 || create.New.ServiceName != "Wink" {
+		t.Errorf("create entry old = %v, new = %+v", create.Old, create.New)
+	}
+	if update := entries[1]; update.Old == nil || update.Old.Price != 100 || update.New.Price != 200 {
+		t.Errorf("update entry old = %+v, new = %+v", update.Old, update.New)
+	}
+	if del := entries[2]; del.Old == nil || del.Old.Deleted() || !del.New.Deleted() {
+		t.Errorf("delete entry old = %+v, new = %+v", del.Old, del.New)
+	}
+	if restore := entries[3]; restore.Old == nil || !restore.Old.Deleted() || restore.New.Deleted() {
+		t.Errorf("restore entry old = %+v, new = %+v", restore.Old, restore.New)
+	}
+
+	other := mustStore(t, repo, newSub(uuid.New(), "Wink", 100, month(time.January, 2025), time.Time{}))
+	userLog := func(from, to time.Time, afterId int64, limit int) []domain.AuditEntry {
+		t.Helper()
+		log, err := repo.AuditLog(ctx, domain.AuditFilter{UserID: userId, From: from, To: to, AfterId: afterId, Limit: limit})
+		if err != nil {
+			t.Fatalf("AuditLog(): %v", err)
+		}
+		return log
+	}
+	now := time.Now()
+	wantActions(t, userLog(now.Add(-time.Hour), now.Add(time.Hour), 0, 10), id,
+		domain.AuditCreate, domain.AuditUpdate, domain.AuditDelete, domain.AuditRestore)
+	if log := userLog(now.Add(time.Hour), time.Time{}, 0, 10); len(log) != 0 {
+		t.Errorf("AuditLog() from the future = %d entries", len(log))
+	}
+	page := userLog(time.Time{}, time.Time{}, 0, 2)
+	wantActions(t, page, id, domain.AuditCreate, domain.AuditUpdate)
+	wantActions(t, userLog(time.Time{}, time.Time{}, page[1].Id, 2), id, domain.AuditDelete, domain.AuditRestore)
+	all, err := repo.AuditLog(ctx, domain.AuditFilter{Limit: 10})
+	if err != nil || len(all) != 5 || all[4].SubId != other {
+		t.Errorf("AuditLog() of everyone = %d entries, %v, want 5 ending with sub %d", len(all), err, other)
+	}
+
+	if _, err := repo.SubHistory(ctx, other+1000); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("SubHistory() of a missing sub error = %v, want domain.ErrNotFound", err)
+	}
+	if err := repo.DeleteSub(ctx, id, 0); err != nil {
+		t.Fatalf("DeleteSub(): %v", err)
+	}
+	if _, err := repo.PurgeSubs(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("PurgeSubs(): %v", err)
+	}
+	if entries, err := repo.SubHistory(ctx, id); err != nil || len(entries) != 5 {
+		t.Errorf("SubHistory() after purge = %d entries, %v, want 5", len(entries), err)
+	}
+}
+
+func testAuditBatch(t *testing.T, repo domain.SubscriptionRepository) {
+	ctx := context.Background()
+	userId := uuid.New()
+	id := mustStore(t, repo, newSub(userId, "Wink", 100, month(time.January, 2025), time.Time{}))
+
+	for _, mode := range []domain.TxMode{domain.TxAllOrNothing, domain.TxBestEffort} {
+		ops := []domain.SubOp{
+			{Kind: domain.SubOpUpdate, Update: updateOf(domain.Subscription{SubId: id, UserID: userId, Price: 200})},
+			{Kind: domain.SubOpUpdate, Update: updateOf(domain.Subscription{SubId: id, UserID: userId, Price: 300})},
+			{Kind: domain.SubOpCreate, Sub: newSub(userId, "Netflix", 50, month(time.January, 2025), time.Time{})},
+		}
+		results, err := repo.ApplySubs(ctx, ops, mode)
+		if err != nil {
+			t.Fatalf("ApplySubs(%s): %v", mode, err)
+		}
+		entries, err := repo.SubHistory(ctx, id)
+		if err != nil {
+			t.Fatalf("SubHistory(): %v", err)
+		}
+		n := len(entries)
+		if n < 3 {
+			t.Fatalf("SubHistory() after ApplySubs(%s) = %d entries", mode, n)
+		}
+		first, second := entries[n-2], entries[n-1]
+		if first.New.Price != 200 || second.Old.Price != 200 || second.New.Price != 300 {
+			t.Errorf("ApplySubs(%s) entries = %d -> %d, %d -> %d, want 200 between", mode, first.Old.Price, first.New.Price, second.Old.Price, second.New.Price)
+		}
+		created, err := repo.SubHistory(ctx, results[2].SubId)
+		if err != nil {
+			t.Fatalf("SubHistory() of the created sub: %v", err)
+		}
+		wantActions(t, created, results[2].SubId, domain.AuditCreate)
+		if created[0].New.ServiceName != "Netflix" {
+			t.Errorf("created entry = %+v", created[0].New)
+		}
+		reset := domain.Subscription{SubId: id, UserID: userId, Price: 100}
+		if err := repo.UpdateSub(ctx, updateOf(reset)); err != nil {
+			t.Fatalf("UpdateSub(): %v", err)
+		}
+	}
+
+	before, err := repo.AuditLog(ctx, domain.AuditFilter{UserID: userId, Limit: domain.MaxListLimit})
+	if err != nil {
+		t.Fatalf("AuditLog(): %v", err)
+	}
+	failing := []domain.SubOp{
+		{Kind: domain.SubOpUpdate, Update: updateOf(domain.Subscription{SubId: id, UserID: userId, Price: 200})},
+		{Kind: domain.SubOpDelete, Update: domain.SubUpdate{SubId: id + 1000}},
+	}
+	if _, err := repo.ApplySubs(ctx, failing, domain.TxAllOrNothing); err != nil {
+		t.Fatalf("ApplySubs(): %v", err)
+	}
+	after, err := repo.AuditLog(ctx, domain.AuditFilter{UserID: userId, Limit: domain.MaxListLimit})
+	if err != nil {
+		t.Fatalf("AuditLog(): %v", err)
+	}
+	if len(after) != len(before) {
+		t.Errorf("failed ApplySubs() added %d entries", len(after)-len(before))
+	}
+}
+
+func testTotalCosts(t *testing.T, repo domain.SubscriptionRepository) {
+	userId := uuid.New()
+	// 02-2025 .. 05-2025 is charged for 3 months.
+	closed := mustStore(t, repo, newSub(userId, "Yandex Plus", 100, month(time.February, 2025), month(time.May, 2025)))
+	// Open subscriptions are charged up to the filter end.
+	open := mustStore(t, repo, newSub(userId, "Yandex Plus", 10, month(time.November, 2024), time.Time{}))
+	// Starts exactly at the filter end: included with zero months.
+	edge := mustStore(t, repo, newSub(userId, "Yandex Plus", 1000, month(time.July, 2025), time.Time{}))
+	// Starts after the filter end: excluded.
+	mustStore(t, repo, newSub(userId, "Yandex Plus", 1000, month(time.August, 2025), time.Time{}))
+	// Other service and other user: excluded.
+	mustStore(t, repo, newSub(userId, "Netflix", 1000, month(time.January, 2025), time.Time{}))
+	mustStore(t, repo, newSub(uuid.New(), "Yandex Plus", 1000, month(time.January, 2025), time.Time{}))
+
+	filter := domain.SubsFilter{
+		StartDate:   month(time.January, 2025),
+		EndDate:     month(time.July, 2025),
+		UserID:      userId,
+		ServiceName: "Yandex Plus",
+	}
+	totals, subIds, err := repo.SubsTotalCosts(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("SubsTotalCosts(): %v", err)
+	}
+	if want := 100*3 + 10*6; len(totals) != 1 || totals[domain.DefaultCurrency] != want {
+		t.Errorf("SubsTotalCosts() sums = %v, want %d", totals, want)
+	}
+	wantIds := map[domain.SubID]bool{closed: true, open: true, edge: true}
+	if len(subIds) != len(wantIds) {
+		t.Errorf("SubsTotalCosts() subIds = %v, want %d ids", subIds, len(wantIds))
+	}
+	for _, id := range subIds {
+		if !wantIds[id] {
+			t.Errorf("SubsTotalCosts() returned unexpected sub %d", id)
+		}
+	}
+
+	crossYear := filter
+	crossYear.StartDate = month(time.December, 2024)
+	crossYear.EndDate = month(time.March, 2025)
+	totals, _, err = repo.SubsTotalCosts(context.Background(), crossYear)
+	if err != nil {
+		t.Fatalf("SubsTotalCosts() across years: %v", err)
+	}
+	if want := 100*1 + 10*3; totals[domain.DefaultCurrency] != want {
+		t.Errorf("SubsTotalCosts() across years sums = %v, want %d", totals, want)
+	}
+}
+
+func testTotalCostsErrors(t *testing.T, repo domain.SubscriptionRepository) {
+	cases := map[string]domain.SubsFilter{
+		"zero start":       {UserID: uuid.New(), ServiceName: "A"},
+		"end before start": {StartDate: month(time.March, 2025), EndDate: month(time.January, 2025), UserID: uuid.New(), ServiceName: "A"},
+	}
+	for name, f := range cases {
+		if _, _, err := repo.SubsTotalCosts(context.Background(), f); !errors.Is(err, domain.ErrValidation) {
+			t.Errorf("%s: SubsTotalCosts() error = %v, want domain.ErrValidation", name, err)
+		}
+	}
+}
+
+func testTotalCostsOptionalFilters(t *testing.T, repo domain.SubscriptionRepository) {
+	alice, bob := uuid.New(), uuid.New()
+	mustStore(t, repo, newSub(alice, "Netflix", 100, month(time.January, 2025), time.Time{}))
+	mustStore(t, repo, newSub(alice, "Spotify", 10, month(time.February, 2025), month(time.March, 2025)))
+	mustStore(t, repo, newSub(bob, "Netflix", 1000, month(time.March, 2025), time.Time{}))
+
+	cases := map[string]struct {
+		filter domain.SubsFilter
+		want   int
+		subs   int
+	}{
+		"all":              {domain.SubsFilter{}, 100*4 + 10 + 1000*2, 3},
+		"one user":         {domain.SubsFilter{UserID: alice}, 100*4 + 10, 2},
+		"one service":      {domain.SubsFilter{ServiceName: "Netflix"}, 100*4 + 1000*2, 2},
+		"user and service": {domain.SubsFilter{UserID: bob, ServiceName: "Netflix"}, 1000 * 2, 1},
+	}
+	for name, c := range cases {
+		c.filter.StartDate = month(time.January, 2025)
+		c.filter.EndDate = month(time.May, 2025)
+		totals, subIds, err := repo.SubsTotalCosts(context.Background(), c.filter)
+		if err != nil {
+			t.Fatalf("%s: SubsTotalCosts(): %v", name, err)
+		}
+		if totals[domain.DefaultCurrency] != c.want || len(subIds) != c.subs {
+			t.Errorf("%s: SubsTotalCosts() = %v, %v, want %d and %d subs", name, totals, subIds, c.want, c.subs)
+		}
+	}
+}
+
+func testCostsByGroup(t *testing.T, repo domain.SubscriptionRepository) {
+	alice, bob := uuid.New(), uuid.New()
+	n1 := mustStore(t, repo, newSub(alice, "Netflix", 100, month(time.November, 2024), time.Time{}))
+	s1 := mustStore(t, repo, newSub(alice, "Spotify", 10, month(time.February, 2025), month(time.March, 2025)))
+	n2 := mustStore(t, repo, newSub(bob, "Netflix", 1000, month(time.January, 2025), time.Time{}))
+
+	filter := domain.SubsFilter{StartDate: month(time.December, 2024), EndDate: month(time.March, 2025)}
+	total, _, err := repo.SubsTotalCosts(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("SubsTotalCosts(): %v", err)
+	}
+
+	cases := map[domain.CostsGroupBy][]domain.CostsGroup{
+		domain.GroupByService: {
+			{Key: "Netflix", Total: 100*3 + 1000*2, SubIds: []domain.SubID{n1, n2}},
+			{Key: "Spotify", Total: 10, SubIds: []domain.SubID{s1}},
+		},
+		domain.GroupByMonth: {
+			{Key: "12-2024", Total: 100, SubIds: []domain.SubID{n1}},
+			{Key: "01-2025", Total: 1100, SubIds: []domain.SubID{n1, n2}},
+			{Key: "02-2025", Total: 1110, SubIds: []domain.SubID{n1, s1, n2}},
+		},
+	}
+	users := []domain.CostsGroup{
+		{Key: alice.String(), Total: 100*3 + 10, SubIds: []domain.SubID{n1, s1}},
+		{Key: bob.String(), Total: 1000 * 2, SubIds: []domain.SubID{n2}},
+	}
+	if users[1].Key < users[0].Key {
+		users[0], users[1] = users[1], users[0]
+	}
+	cases[domain.GroupByUser] = users
+
+	for groupBy, want := range cases {
+		got, err := repo.SubsCostsByGroup(context.Background(), filter, groupBy)
+		if err != nil {
+			t.Fatalf("SubsCostsByGroup(%s): %v", groupBy, err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("SubsCostsByGroup(%s) = %+v, want %+v", groupBy, got, want)
+		}
+		sum := 0
+		for i := range want {
+			sum += got[i].Total
+			if got[i].Key != want[i].Key || got[i].Currency != domain.DefaultCurrency || got[i].Total != want[i].Total || !sameIds(got[i].SubIds, want[i].SubIds) {
+				t.Errorf("SubsCostsByGroup(%s)[%d] = %+v, want %+v", groupBy, i, got[i], want[i])
+			}
+		}
+		if sum != total[domain.DefaultCurrency] {
+			t.Errorf("SubsCostsByGroup(%s) sums up to %d, totals are %v", groupBy, sum, total)
+		}
+	}
+
+	if _, err := repo.SubsCostsByGroup(context.Background(), filter, "year"); !errors.Is(err, domain.ErrValidation) {
+		t.Errorf("SubsCostsByGroup() of unknown grouping error = %v, want domain.ErrValidation", err)
+	}
+}
+
+func testMonthlyCosts(t *testing.T, repo domain.SubscriptionRepository) {
+	userId := uuid.New()
+	a := mustStore(t, repo, newSub(userId, "Netflix", 100, month(time.November, 2024), month(time.February, 2025)))
+	b := mustStore(t, repo, newSub(userId, "Spotify", 10, month(time.January, 2025), time.Time{}))
+	mustStore(t, repo, newSub(uuid.New(), "Netflix", 1000, month(time.January, 2025), time.Time{}))
+
+	filter := domain.SubsFilter{
+		StartDate: month(time.December, 2024),
+		EndDate:   month(time.April, 2025),
+		UserID:    userId,
+	}
+	got, err := repo.SubsMonthlyCosts(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("SubsMonthlyCosts(): %v", err)
+	}
+	costA := domain.SubCost{SubId: a, Amount: 100, Currency: domain.DefaultCurrency}
+	costB := domain.SubCost{SubId: b, Amount: 10, Currency: domain.DefaultCurrency}
+	want := []domain.MonthCosts{
+		{Month: month(time.December, 2024), Subs: []domain.SubCost{costA}},
+		{Month: month(time.January, 2025), Subs: []domain.SubCost{costA, costB}},
+		{Month: month(time.February, 2025), Subs: []domain.SubCost{costB}},
+		{Month: month(time.March, 2025), Subs: []domain.SubCost{costB}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("SubsMonthlyCosts() = %+v, want %+v", got, want)
+	}
+	sum := 0
+	for i := range want {
+		same := got[i].Month.Equal(want[i].Month) && len(got[i].Subs) == len(want[i].Subs)
+		for j := 0; same && j < len(want[i].Subs); j++ {
+			same = got[i].Subs[j] == want[i].Subs[j]
+			sum += got[i].Subs[j].Amount
+		}
+		if !same {
+			t.Errorf("SubsMonthlyCosts()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	total, _, err := repo.SubsTotalCosts(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("SubsTotalCosts(): %v", err)
+	}
+	if sum != total[domain.DefaultCurrency] {
+		t.Errorf("SubsMonthlyCosts() sums up to %d, totals are %v", sum, total)
+	}
+}
+
+func testCostsByCurrency(t *testing.T, repo domain.SubscriptionRepository) {
+	userId := uuid.New()
+	rub := mustStore(t, repo, newSub(userId, "Netflix", 1000, month(time.January, 2025), time.Time{}))
+	usdSub := newSub(userId, "Netflix", 10, month(time.February, 2025), time.Time{})
+	usdSub.Currency = "USD"
+	usd := mustStore(t, repo, usdSub)
+	if got := mustGet(t, repo, usd).Currency; got != "USD" {
+		t.Errorf("Sub().Currency = %q, want USD", got)
+	}
+
+	filter := domain.SubsFilter{StartDate: month(time.January, 2025), EndDate: month(time.April, 2025)}
+	totals, subIds, err := repo.SubsTotalCosts(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("SubsTotalCosts(): %v", err)
+	}
+	if len(totals) != 2 || totals[domain.DefaultCurrency] != 1000*3 || totals["USD"] != 10*2 {
+		t.Errorf("SubsTotalCosts() sums = %v, want 3000 RUB and 20 USD", totals)
+	}
+	if !sameIds(subIds, []domain.SubID{rub, usd}) {
+		t.Errorf("SubsTotalCosts() subIds = %v, want %v", subIds, []domain.SubID{rub, usd})
+	}
+
+	groups, err := repo.SubsCostsByGroup(context.Background(), filter, domain.GroupByService)
+	if err != nil {
+		t.Fatalf("SubsCostsByGroup(): %v", err)
+	}
+	want := []domain.CostsGroup{
+		{Key: "Netflix", Currency: "RUB", Total: 1000 * 3, SubIds: []domain.SubID{rub}},
+		{Key: "Netflix", Currency: "USD", Total: 10 * 2, SubIds: []domain.SubID{usd}},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("SubsCostsByGroup() = %+v, want %+v", groups, want)
+	}
+	for i := range want {
+		if groups[i].Key != want[i].Key || groups[i].Currency != want[i].Currency || groups[i].Total != want[i].Total || !sameIds(groups[i].SubIds, want[i].SubIds) {
+			t.Errorf("SubsCostsByGroup()[%d] = %+v, want %+v", i, groups[i], want[i])
+		}
+	}
+
+	months, err := repo.SubsMonthlyCosts(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("SubsMonthlyCosts(): %v", err)
+	}
+	if len(months) != 3 || len(months[1].Subs) != 2 || months[1].Subs[1].Currency != "USD" {
+		t.Errorf("SubsMonthlyCosts() = %+v, want USD charges from 02-2025", months)
+	}
+
+	upd := domain.Subscription{SubId: usd, UserID: userId, Currency: "EUR"}
+	if err := repo.UpdateSub(context.Background(), updateOf(upd)); err != nil {
+		t.Fatalf("UpdateSub() of currency: %v", err)
+	}
+	if got := mustGet(t, repo, usd).Currency; got != "EUR" {
+		t.Errorf("after update Sub().Currency = %q, want EUR", got)
+	}
+}
+
+func testBillingPeriods(t *testing.T, repo domain.SubscriptionRepository) {
+	userId := uuid.New()
+	store := func(service string, price int, period domain.BillingPeriod, start, end time.Time) domain.SubID {
+		sub := newSub(userId, service, price, start, end)
+		sub.BillingPeriod = period
+		return mustStore(t, repo, sub)
+	}
+	// Charged 03-2024 and 03-2025, only the second falls into the period.
+	yearly := store("Yearly", 1200, domain.BillingYearly, month(time.March, 2024), time.Time{})
+	// Charged 11-2024, 02-2025, 05-2025: two in the period.
+	quarterly := store("Quarterly", 300, domain.BillingQuarterly, month(time.November, 2024), time.Time{})
+	// Charged on the 1st, 8th, 15th and 22nd of February.
+	weekly := store("Weekly", 7, domain.BillingWeekly, month(time.February, 2025), month(time.March, 2025))
+	// Started before the period and not charged within it.
+	missed := store("Yearly", 5000, domain.BillingYearly, month(time.December, 2024), time.Time{})
+	if got := mustGet(t, repo, weekly).BillingPeriod; got != domain.BillingWeekly {
+		t.Errorf("Sub().BillingPeriod = %q, want %q", got, domain.BillingWeekly)
+	}
+
+	filter := domain.SubsFilter{StartDate: month(time.January, 2025), EndDate: month(time.June, 2025), UserID: userId}
+	totals, subIds, err := repo.SubsTotalCosts(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("SubsTotalCosts(): %v", err)
+	}
+	if want := 1200 + 300*2 + 7*4; totals[domain.DefaultCurrency] != want {
+		t.Errorf("SubsTotalCosts() sums = %v, want %d", totals, want)
+	}
+	if !sameIds(subIds, []domain.SubID{yearly, quarterly, weekly, missed}) {
+		t.Errorf("SubsTotalCosts() subIds = %v", subIds)
+	}
+
+	groups, err := repo.SubsCostsByGroup(context.Background(), filter, domain.GroupByMonth)
+	if err != nil {
+		t.Fatalf("SubsCostsByGroup(): %v", err)
+	}
+	want := []domain.CostsGroup{
+		{Key: "02-2025", Total: 300 + 7*4, SubIds: []domain.SubID{quarterly, weekly}},
+		{Key: "03-2025", Total: 1200, SubIds: []domain.SubID{yearly}},
+		{Key: "05-2025", Total: 300, SubIds: []domain.SubID{quarterly}},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("SubsCostsByGroup(month) = %+v, want %+v", groups, want)
+	}
+	for i := range want {
+		if groups[i].Key != want[i].Key || groups[i].Total != want[i].Total || !sameIds(groups[i].SubIds, want[i].SubIds) {
+			t.Errorf("SubsCostsByGroup(month)[%d] = %+v, want %+v", i, groups[i], want[i])
+		}
+	}
+
+	months, err := repo.SubsMonthlyCosts(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("SubsMonthlyCosts(): %v", err)
+	}
+	if len(months) != 3 || len(months[0].Subs) != 2 || months[0].Subs[1] != (domain.SubCost{SubId: weekly, Amount: 7 * 4, Currency: domain.DefaultCurrency}) {
+		t.Errorf("SubsMonthlyCosts() = %+v, want weekly charges summed up in 02-2025", months)
+	}
+
+	upd := domain.Subscription{SubId: missed, UserID: userId, BillingPeriod: domain.BillingMonthly}
+	if err := repo.UpdateSub(context.Background(), updateOf(upd)); err != nil {
+		t.Fatalf("UpdateSub() of billing period: %v", err)
+	}
+	totals, _, err = repo.SubsTotalCosts(context.Background(), domain.SubsFilter{StartDate: month(time.January, 2025), EndDate: month(time.March, 2025), ServiceName: "Yearly"})
+	if err != nil {
+		t.Fatalf("SubsTotalCosts(): %v", err)
+	}
+	if want := 5000 * 2; totals[domain.DefaultCurrency] != want {
+		t.Errorf("after switching to monthly SubsTotalCosts() sums = %v, want %d", totals, want)
+	}
+}
+
+func day(m time.Month, d, year int) time.Time {
+	return time.Date(year, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func testDayPrecision(t *testing.T, repo domain.SubscriptionRepository) {
+	userId := uuid.New()
+	sub := newSub(userId, "Kion", 100, day(time.January, 15, 2025), day(time.April, 10, 2025))
+	sub.SubId = mustStore(t, repo, sub)
+	if got := mustGet(t, repo, sub.SubId); !sameSub(got, sub) {
+		t.Errorf("Sub() = %+v, want %+v", got, sub)
+	}
+
+	upd := domain.Subscription{SubId: sub.SubId, UserID: userId, EndDate: day(time.April, 20, 2025)}
+	if err := repo.UpdateSub(context.Background(), updateOf(upd)); err != nil {
+		t.Fatalf("UpdateSub() of end date: %v", err)
+	}
+	sub.EndDate = upd.EndDate
+	if got := mustGet(t, repo, sub.SubId); !sameSub(got, sub) {
+		t.Errorf("after update Sub() = %+v, want %+v", got, sub)
+	}
+
+	// Charged on 15.01, 15.02, 15.03 and 15.04 before the end on 20.04.
+	cases := map[string]struct {
+		filter domain.SubsFilter
+		want   int
+	}{
+		"whole subscription": {domain.SubsFilter{StartDate: month(time.January, 2025), EndDate: month(time.May, 2025)}, 100 * 4},
+		"from the 16th":      {domain.SubsFilter{StartDate: day(time.January, 16, 2025), EndDate: month(time.May, 2025)}, 100 * 3},
+		"up to the 15th":     {domain.SubsFilter{StartDate: month(time.January, 2025), EndDate: day(time.March, 15, 2025)}, 100 * 2},
+	}
+	for name, c := range cases {
+		c.filter.UserID = userId
+		totals, _, err := repo.SubsTotalCosts(context.Background(), c.filter)
+		if err != nil {
+			t.Fatalf("%s: SubsTotalCosts(): %v", name, err)
+		}
+		if totals[domain.DefaultCurrency] != c.want {
+			t.Errorf("%s: SubsTotalCosts() sums = %v, want %d", name, totals, c.want)
+		}
+	}
+
+	// A subscription started on the 31st is charged on the last day of shorter months.
+	last := newSub(userId, "Okko", 10, day(time.January, 31, 2025), time.Time{})
+	mustStore(t, repo, last)
+	months, err := repo.SubsMonthlyCosts(context.Background(), domain.SubsFilter{
+		StartDate:   day(time.February, 28, 2025),
+		EndDate:     day(time.March, 31, 2025),
+		UserID:      userId,
+		ServiceName: "Okko",
+	})
+	if err != nil {
+		t.Fatalf("SubsMonthlyCosts(): %v", err)
+	}
+	if len(months) != 1 || !months[0].Month.Equal(month(time.February, 2025)) {
+		t.Errorf("SubsMonthlyCosts() = %+v, want a charge in 02-2025 only", months)
+	}
+}
+
+func testProRataCosts(t *testing.T, repo domain.SubscriptionRepository) {
+	userId := uuid.New()
+	// Cancelled after 15 days of 31 in March.
+	monthly := newSub(userId, "Monthly", 310, month(time.January, 2025), day(time.March, 16, 2025))
+	mustStore(t, repo, monthly)
+	// A year of 365 days started in the middle of 2024.
+	yearly := newSub(userId, "Yearly", 3650, day(time.July, 1, 2024), time.Time{})
+	yearly.BillingPeriod = domain.BillingYearly
+	mustStore(t, repo, yearly)
+
+	filter := domain.SubsFilter{StartDate: month(time.February, 2025), EndDate: month(time.April, 2025), UserID: userId}
+	full, _, err := repo.SubsTotalCosts(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("SubsTotalCosts(): %v", err)
+	}
+	// Whole charges on 01.02 and 01.03, the yearly one is not charged.
+	if want := 310 * 2; full[domain.DefaultCurrency] != want {
+		t.Errorf("SubsTotalCosts() sums = %v, want %d", full, want)
+	}
+
+	filter.ProRata = true
+	prorated, _, err := repo.SubsTotalCosts(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("pro-rata SubsTotalCosts(): %v", err)
+	}
+	// February in full, 15 days of March and 59 days of the year.
+	if want := 310 + 150 + 590; prorated[domain.DefaultCurrency] != want {
+		t.Errorf("pro-rata SubsTotalCosts() sums = %v, want %d", prorated, want)
+	}
+
+	groups, err := repo.SubsCostsByGroup(context.Background(), filter, domain.GroupByService)
+	if err != nil {
+		t.Fatalf("pro-rata SubsCostsByGroup(): %v", err)
+	}
+	if len(groups) != 2 || groups[0].Total != 310+150 || groups[1].Total != 590 {
+		t.Errorf("pro-rata SubsCostsByGroup() = %+v, want 460 and 590", groups)
+	}
+	if _, err := repo.SubsCostsByGroup(context.Background(), filter, domain.GroupByMonth); !errors.Is(err, domain.ErrValidation) {
+		t.Errorf("pro-rata SubsCostsByGroup(month) error = %v, want domain.ErrValidation", err)
+	}
+	if _, err := repo.SubsMonthlyCosts(context.Background(), filter); !errors.Is(err, domain.ErrValidation) {
+		t.Errorf("pro-rata SubsMonthlyCosts() error = %v, want domain.ErrValidation", err)
+	}
+
+	// Periods of a subscription started on the 31st long before the
+	// filter: 28.02-31.03 overlaps it by 16 days of 31, 31.03-30.04 by
+	// 15 days of 30.
+	old := newSub(uuid.New(), "Monthly", 3100, day(time.January, 31, 2024), time.Time{})
+	mustStore(t, repo, old)
+	filter = domain.SubsFilter{StartDate: day(time.March, 15, 2025), EndDate: day(time.April, 15, 2025), UserID: old.UserID}
+	if full, _, err = repo.SubsTotalCosts(context.Background(), filter); err != nil {
+		t.Fatalf("SubsTotalCosts(): %v", err)
+	}
+	if want := 3100; full[domain.DefaultCurrency] != want {
+		t.Errorf("SubsTotalCosts() of an old subscription = %v, want %d charged on 31.03", full, want)
+	}
+	filter.ProRata = true
+	if prorated, _, err = repo.SubsTotalCosts(context.Background(), filter); err != nil {
+		t.Fatalf("pro-rata SubsTotalCosts(): %v", err)
+	}
+	if want := 1600 + 1550; prorated[domain.DefaultCurrency] != want {
+		t.Errorf("pro-rata SubsTotalCosts() of an old subscription = %v, want %d", prorated, want)
+	}
+}
+
+func testConcurrentStore(t *testing.T, repo domain.SubscriptionRepository) {
+	const n = 20
+	userId := uuid.New()
+	ids := make(chan domain.SubID, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id, err := repo.StoreSub(context.Background(), newSub(userId, "Shared", 1+i, month(time.January, 2025), time.Time{}))
+			if err != nil {
+				t.Errorf("StoreSub(): %v", err)
+				return
+			}
+			ids <- id
+		}(i)
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[domain.SubID]bool, n)
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("StoreSub() returned duplicate id %d", id)
+		}
+		seen[id] = true
+	}
+	subs, err := repo.UserSubs(context.Background(), userId, false)
+	if err != nil {
+		t.Fatalf("UserSubs(): %v", err)
+	}
+	if len(subs) != n {
+		t.Errorf("UserSubs() returned %d subs, want %d", len(subs), n)
+	}
+}
+
+func mustList(t *testing.T, repo domain.SubscriptionRepository, filter domain.SubsListFilter, sortBy domain.SubsSortField, desc bool, limit, offset int, after *domain.SubsCursor) domain.SubsPage {
+	t.Helper()
+	q, err := domain.NewSubsListQuery(filter, sortBy, desc, limit, offset, after)
+	if err != nil {
+		t.Fatalf("NewSubsListQuery(): %v", err)
+	}
+	page, err := repo.ListSubs(context.Background(), *q)
+	if err != nil {
+		t.Fatalf("ListSubs(%+v): %v", q, err)
+	}
+	return page
+}
+
+func pageIds(page domain.SubsPage) []domain.SubID {
+	ids := make([]domain.SubID, 0, len(page.Subs))
+	for _, s := range page.Subs {
+		ids = append(ids, s.SubId)
+	}
+	return ids
+}
+
+func sameIds(a, b []domain.SubID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testListFilters(t *testing.T, repo domain.SubscriptionRepository) {
+	alice, bob := uuid.New(), uuid.New()
+	a1 := mustStore(t, repo, newSub(alice, "Netflix", 500, month(time.January, 2025), month(time.April, 2025)))
+	a2 := mustStore(t, repo, newSub(alice, "Spotify", 200, month(time.March, 2025), time.Time{}))
+	b1 := mustStore(t, repo, newSub(bob, "Netflix", 700, month(time.June, 2024), month(time.February, 2025)))
+	b2 := mustStore(t, repo, newSub(bob, "Okko", 100, month(time.May, 2025), time.Time{}))
+
+	cases := map[string]struct {
+		filter domain.SubsListFilter
+		want   []domain.SubID
+	}{
+		"no filter":     {domain.SubsListFilter{}, []domain.SubID{a1, a2, b1, b2}},
+		"user":          {domain.SubsListFilter{UserID: bob}, []domain.SubID{b1, b2}},
+		"service":       {domain.SubsListFilter{ServiceName: "Netflix"}, []domain.SubID{a1, b1}},
+		"price range":   {domain.SubsListFilter{MinPrice: 200, MaxPrice: 500}, []domain.SubID{a1, a2}},
+		"min price":     {domain.SubsListFilter{MinPrice: 600}, []domain.SubID{b1}},
+		"active at":     {domain.SubsListFilter{ActiveAt: month(time.March, 2025)}, []domain.SubID{a1, a2}},
+		"active at end": {domain.SubsListFilter{ActiveAt: month(time.April, 2025)}, []domain.SubID{a2}},
+		"start range":   {domain.SubsListFilter{StartFrom: month(time.January, 2025), StartTo: month(time.March, 2025)}, []domain.SubID{a1, a2}},
+		"end from":      {domain.SubsListFilter{EndFrom: month(time.March, 2025)}, []domain.SubID{a1, a2, b2}},
+		"end to":        {domain.SubsListFilter{EndTo: month(time.March, 2025)}, []domain.SubID{b1}},
+		"combined":      {domain.SubsListFilter{UserID: alice, ServiceName: "Spotify", ActiveAt: month(time.June, 2025)}, []domain.SubID{a2}},
+	}
+	for name, c := range cases {
+		page := mustList(t, repo, c.filter, domain.SortBySubId, false, 0, 0, nil)
+		if got := pageIds(page); !sameIds(got, c.want) {
+			t.Errorf("%s: ListSubs() ids = %v, want %v", name, got, c.want)
+		}
+		if page.Total != len(c.want) {
+			t.Errorf("%s: ListSubs() total = %d, want %d", name, page.Total, len(c.want))
+		}
+		if page.Next != nil {
+			t.Errorf("%s: single page has next cursor", name)
+		}
+	}
+
+	got := mustList(t, repo, domain.SubsListFilter{ServiceName: "Spotify"}, domain.SortBySubId, false, 0, 0, nil)
+	if len(got.Subs) != 1 || !sameSub(got.Subs[0], mustGet(t, repo, a2)) {
+		t.Errorf("ListSubs() = %+v, want the stored subscription", got.Subs)
+	}
+}
+
+func testListPagination(t *testing.T, repo domain.SubscriptionRepository) {
+	userId := uuid.New()
+	prices := []int{300, 100, 300, 200, 100, 400, 200}
+	for i, p := range prices {
+		mustStore(t, repo, newSub(userId, string(rune('G'-i)), p, month(time.Month(1+i), 2025), time.Time{}))
+	}
+	filter := domain.SubsListFilter{UserID: userId}
+
+	for _, sortBy := range []domain.SubsSortField{domain.SortBySubId, domain.SortByPrice, domain.SortByStartDate, domain.SortByServiceName} {
+		for _, desc := range []bool{false, true} {
+			all := pageIds(mustList(t, repo, filter, sortBy, desc, len(prices), 0, nil))
+			if len(all) != len(prices) {
+				t.Fatalf("%s desc=%v: ListSubs() returned %d subs", sortBy, desc, len(all))
+			}
+
+			var byCursor []domain.SubID
+			var after *domain.SubsCursor
+			for pages := 0; ; pages++ {
+				if pages > len(prices) {
+					t.Fatalf("%s desc=%v: cursor pagination does not end", sortBy, desc)
+				}
+				page := mustList(t, repo, filter, sortBy, desc, 3, 0, after)
+				byCursor = append(byCursor, pageIds(page)...)
+				if page.Total != len(prices) {
+					t.Errorf("%s desc=%v: total = %d, want %d", sortBy, desc, page.Total, len(prices))
+				}
+				if page.Next == nil {
+					break
+				}
+				after = page.Next
+			}
+			if !sameIds(byCursor, all) {
+				t.Errorf("%s desc=%v: cursor pages = %v, want %v", sortBy, desc, byCursor, all)
+			}
+
+			var byOffset []domain.SubID
+			for offset := 0; offset < len(prices); offset += 2 {
+				byOffset = append(byOffset, pageIds(mustList(t, repo, filter, sortBy, desc, 2, offset, nil))...)
+			}
+			if !sameIds(byOffset, all) {
+				t.Errorf("%s desc=%v: offset pages = %v, want %v", sortBy, desc, byOffset, all)
+			}
+		}
+	}
+
+	byPrice := mustList(t, repo, filter, domain.SortByPrice, false, len(prices), 0, nil).Subs
+	for i := 1; i < len(byPrice); i++ {
+		prev, cur := byPrice[i-1], byPrice[i]
+		if prev.Price > cur.Price || prev.Price == cur.Price && prev.SubId > cur.SubId {
+			t.Errorf("sort by price: %d(%d) goes before %d(%d)", prev.SubId, prev.Price, cur.SubId, cur.Price)
+		}
+	}
+
+	if page := mustList(t, repo, filter, domain.SortBySubId, false, 5, len(prices), nil); len(page.Subs) != 0 || page.Next != nil {
+		t.Errorf("offset past the end returned %+v", page)
+	}
+
+	q, err := domain.NewSubsListQuery(filter, domain.SortBySubId, false, 3, 0, nil)
+	if err != nil {
+		t.Fatalf("NewSubsListQuery(): %v", err)
+	}
+	q.NoTotal = true
+	page, err := repo.ListSubs(context.Background(), *q)
+	if err != nil {
+		t.Fatalf("ListSubs(NoTotal): %v", err)
+	}
+	if want := mustList(t, repo, filter, domain.SortBySubId, false, 3, 0, nil); page.Total != 0 || !sameIds(pageIds(page), pageIds(want)) || page.Next == nil {
+		t.Errorf("ListSubs(NoTotal) = %+v, want the subs of %+v without total", page, want)
+	}
+}
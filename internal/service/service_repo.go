@@ -0,0 +1,426 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+)
+
+const (
+	getServices = `
+SELECT
+    s.service_id,
+    s.service_name,
+    s.display_name,
+    s.category,
+    s.default_price,
+    s.default_currency,
+    (SELECT COUNT(*) FROM subscriptions sub
+     WHERE sub.service_id = s.service_id AND sub.deleted_at IS NULL) AS subs_count
+FROM services s`
+	GetService = getServices + `
+WHERE s.service_id = $1;
+`
+	// GetServices takes an empty $1 for all categories.
+	GetServices = getServices + `
+WHERE $1 = '' OR s.category = $1
+ORDER BY s.service_name COLLATE "C";
+`
+	// SearchServices takes the query $1, the LIKE pattern of its prefix
+	// $2 and the limit $3. The % operator matches by the similarity
+	// threshold of pg_trgm, 0.3 by default. Prefix matches are equally
+	// close, so only the similar ones are ordered by the score.
+	SearchServices = `
+WITH matches AS (
+    SELECT service_id, bool_or(name LIKE $2) AS prefix, max(similarity(name, $1)) AS score
+    FROM (
+        SELECT service_id, service_name AS name FROM services
+        UNION ALL
+        SELECT service_id, alias FROM service_aliases
+    ) names
+    WHERE name LIKE $2 OR name % $1
+    GROUP BY service_id
+)` + getServices + `
+JOIN matches m ON m.service_id = s.service_id
+ORDER BY m.prefix DESC, CASE WHEN m.prefix THEN 0 ELSE m.score END DESC, subs_count DESC, s.service_name COLLATE "C"
+LIMIT $3;
+`
+	PutService = `
+INSERT INTO services (service_name, display_name, category, default_price, default_currency)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING service_id;
+`
+	UpdateService = `
+UPDATE services
+SET service_name = $2, display_name = $3, category = $4, default_price = $5, default_currency = $6
+WHERE service_id = $1;
+`
+	// LockServices locks the services $1 in the order of their ids and
+	// returns the ones that exist.
+	LockServices = `
+SELECT service_id FROM services
+WHERE service_id = ANY($1)
+ORDER BY service_id
+FOR UPDATE;
+`
+	CountServiceSubs = `
+SELECT COUNT(*) FROM subscriptions WHERE service_id = $1;
+`
+	DeleteService = `
+DELETE FROM services WHERE service_id = $1;
+`
+	// LockServiceSubs locks the subscriptions of $1, deleted included.
+	LockServiceSubs = GetAllData + `
+WHERE sub.service_id = $1
+ORDER BY us.sub_id
+FOR UPDATE OF sub;
+`
+	MoveServiceSubs = `
+UPDATE subscriptions SET service_id = $2, version = version + 1
+WHERE service_id = $1;
+`
+	// IsServiceName tells whether $1 is the name of a service, aliases
+	// and names share one namespace.
+	IsServiceName = `
+SELECT EXISTS (SELECT 1 FROM services WHERE service_name = $1);
+`
+	IsServiceAlias = `
+SELECT EXISTS (SELECT 1 FROM service_aliases WHERE alias = $1);
+`
+	GetServiceAliases = `
+SELECT alias FROM service_aliases
+WHERE service_id = $1
+ORDER BY alias COLLATE "C";
+`
+	PutServiceAlias = `
+INSERT INTO service_aliases (alias, service_id) VALUES ($1, $2);
+`
+	DeleteServiceAlias = `
+DELETE FROM service_aliases WHERE alias = $1 AND service_id = $2;
+`
+	MoveServiceAliases = `
+UPDATE service_aliases SET service_id = $2 WHERE service_id = $1;
+`
+)
+
+func scanService(row pgx.Row) (domain.Service, error) {
+	var svc domain.Service
+	var defaultPrice *int
+	var defaultCurrency *string
+	if err := row.Scan(
+		&svc.Id,
+		&svc.Name,
+		&svc.DisplayName,
+		&svc.Category,
+		&defaultPrice,
+		&defaultCurrency,
+		&svc.SubsCount,
+	); err != nil {
+		return domain.Service{}, err
+	}
+	if defaultPrice != nil && defaultCurrency != nil {
+		svc.DefaultPrice = *defaultPrice
+		svc.DefaultCurrency = *defaultCurrency
+	}
+	return svc, nil
+}
+
+// serviceArgs are the columns of svc after the id, the default price
+// is NULL without a currency.
+func serviceArgs(svc domain.Service) []any {
+	var defaultPrice, defaultCurrency any
+	if svc.DefaultCurrency != "" {
+		defaultPrice, defaultCurrency = svc.DefaultPrice, svc.DefaultCurrency
+	}
+	return []any{svc.Name, svc.DisplayName, svc.Category, defaultPrice, defaultCurrency}
+}
+
+func (s *SubRepo) Service(ctx context.Context, id domain.ServiceID) (domain.Service, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	svc, err := scanService(s.p.QueryRow(ctx, GetService, int(id)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.Service{}, fmt.Errorf("service %d: %w", id, domain.ErrNotFound)
+	}
+	return svc, err
+}
+
+func (s *SubRepo) Services(ctx context.Context, category string) ([]domain.Service, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	rows, err := s.p.Query(ctx, GetServices, category)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return scanServices(rows)
+}
+
+func scanServices(rows pgx.Rows) ([]domain.Service, error) {
+	defer rows.Close()
+
+	res := make([]domain.Service, 0)
+	for rows.Next() {
+		svc, err := scanService(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, svc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return res, nil
+}
+
+// checkNotAlias fails with ErrConflict when name is an alias.
+func checkNotAlias(ctx context.Context, q queryRower, name string) error {
+	var isAlias bool
+	if err := q.QueryRow(ctx, IsServiceAlias, name).Scan(&isAlias); err != nil {
+		return fmt.Errorf("failed to check aliases: %w", err)
+	}
+	if isAlias {
+		return aliasTaken(name)
+	}
+	return nil
+}
+
+func aliasTaken(name string) error {
+	return domain.NewConflictError("service_name", fmt.Sprintf("%q is an alias of a service", name))
+}
+
+// likePrefix is the LIKE pattern of the strings starting with s.
+func likePrefix(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s) + "%"
+}
+
+func (s *SubRepo) SearchServices(ctx context.Context, search domain.ServiceSearch) ([]domain.Service, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	rows, err := s.p.Query(ctx, SearchServices, search.Query, likePrefix(search.Query), search.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return scanServices(rows)
+}
+
+func (s *SubRepo) StoreService(ctx context.Context, svc domain.Service) (domain.ServiceID, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	if err := checkServiceName(svc.Name); err != nil {
+		return 0, err
+	}
+	if err := checkNotAlias(ctx, s.p, svc.Name); err != nil {
+		return 0, err
+	}
+	var id int
+	if err := s.p.QueryRow(ctx, PutService, serviceArgs(svc)...).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to insert service: %w", pgError(err))
+	}
+	return domain.ServiceID(id), nil
+}
+
+func (s *SubRepo) UpdateService(ctx context.Context, svc domain.Service) error {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	if err := checkServiceName(svc.Name); err != nil {
+		return err
+	}
+	if err := checkNotAlias(ctx, s.p, svc.Name); err != nil {
+		return err
+	}
+	res, err := s.p.Exec(ctx, UpdateService, append([]any{int(svc.Id)}, serviceArgs(svc)...)...)
+	if err != nil {
+		return fmt.Errorf("failed to update service: %w", pgError(err))
+	}
+	if res.RowsAffected() == 0 {
+		return fmt.Errorf("service %d: %w", svc.Id, domain.ErrNotFound)
+	}
+	return nil
+}
+
+// lockServices locks ids within tx and fails with ErrNotFound for a
+// missing one.
+func lockServices(ctx context.Context, tx pgx.Tx, ids ...domain.ServiceID) error {
+	want := make([]int, len(ids))
+	for i, id := range ids {
+		want[i] = int(id)
+	}
+	rows, err := tx.Query(ctx, LockServices, want)
+	if err != nil {
+		return fmt.Errorf("failed to lock services: %w", err)
+	}
+	found, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return fmt.Errorf("failed to lock services: %w", err)
+	}
+	for _, id := range ids {
+		if !slices.Contains(found, int(id)) {
+			return fmt.Errorf("service %d: %w", id, domain.ErrNotFound)
+		}
+	}
+	return nil
+}
+
+func (s *SubRepo) DeleteService(ctx context.Context, id domain.ServiceID) error {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer rollback(ctx, tx)
+
+	if err := lockServices(ctx, tx, id); err != nil {
+		return err
+	}
+	var subs int
+	if err := tx.QueryRow(ctx, CountServiceSubs, int(id)).Scan(&subs); err != nil {
+		return fmt.Errorf("failed to count subscriptions: %w", err)
+	}
+	if subs > 0 {
+		return serviceInUse(id, subs)
+	}
+	if _, err := tx.Exec(ctx, DeleteService, int(id)); err != nil {
+		return fmt.Errorf("failed to delete service: %w", pgError(err))
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func serviceInUse(id domain.ServiceID, subs int) error {
+	return domain.NewConflictError("service_id", fmt.Sprintf("service %d has %d subscriptions, merge it into another one", id, subs))
+}
+
+func (s *SubRepo) MergeServices(ctx context.Context, from, into domain.ServiceID) (int, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	if from == into {
+		return 0, domain.NewValidationError("into", "must be another service")
+	}
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer rollback(ctx, tx)
+
+	if err := lockServices(ctx, tx, from, into); err != nil {
+		return 0, err
+	}
+	fromSvc, err := scanService(tx.QueryRow(ctx, GetService, int(from)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read service: %w", err)
+	}
+	rows, err := tx.Query(ctx, LockServiceSubs, int(from))
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock subscriptions: %w", err)
+	}
+	moved, err := scanSubs(rows, 0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock subscriptions: %w", err)
+	}
+	if _, err := tx.Exec(ctx, MoveServiceSubs, int(from), int(into)); err != nil {
+		return 0, fmt.Errorf("failed to move subscriptions: %w", err)
+	}
+	if _, err := tx.Exec(ctx, MoveServiceAliases, int(from), int(into)); err != nil {
+		return 0, fmt.Errorf("failed to move aliases: %w", err)
+	}
+	if _, err := tx.Exec(ctx, DeleteService, int(from)); err != nil {
+		return 0, fmt.Errorf("failed to delete service: %w", pgError(err))
+	}
+	if _, err := tx.Exec(ctx, PutServiceAlias, fromSvc.Name, int(into)); err != nil {
+		return 0, fmt.Errorf("failed to insert alias: %w", pgError(err))
+	}
+	entries := make([]domain.AuditEntry, len(moved))
+	for i := range moved {
+		entries[i] = domain.AuditEntry{SubId: moved[i].SubId, Action: domain.AuditUpdate, Old: &moved[i]}
+	}
+	if err := writeAudit(ctx, tx, entries); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return len(moved), nil
+}
+
+// ServiceAliases of a service without any are empty, not ErrNotFound.
+func (s *SubRepo) ServiceAliases(ctx context.Context, id domain.ServiceID) ([]string, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	rows, err := s.p.Query(ctx, GetServiceAliases, int(id))
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	aliases, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	if len(aliases) > 0 {
+		return aliases, nil
+	}
+	if _, err := s.Service(ctx, id); err != nil {
+		return nil, err
+	}
+	return []string{}, nil
+}
+
+func (s *SubRepo) StoreServiceAlias(ctx context.Context, alias domain.ServiceAlias) error {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	if err := checkServiceName(alias.Alias); err != nil {
+		return err
+	}
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer rollback(ctx, tx)
+
+	if err := lockServices(ctx, tx, alias.ServiceId); err != nil {
+		return err
+	}
+	var isName bool
+	if err := tx.QueryRow(ctx, IsServiceName, alias.Alias).Scan(&isName); err != nil {
+		return fmt.Errorf("failed to check services: %w", err)
+	}
+	if isName {
+		return domain.NewConflictError("alias", fmt.Sprintf("%q is the name of a service", alias.Alias))
+	}
+	if _, err := tx.Exec(ctx, PutServiceAlias, alias.Alias, int(alias.ServiceId)); err != nil {
+		return fmt.Errorf("failed to insert alias: %w", pgError(err))
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (s *SubRepo) DeleteServiceAlias(ctx context.Context, alias domain.ServiceAlias) error {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	res, err := s.p.Exec(ctx, DeleteServiceAlias, alias.Alias, int(alias.ServiceId))
+	if err != nil {
+		return fmt.Errorf("failed to delete alias: %w", err)
+	}
+	if res.RowsAffected() == 0 {
+		return fmt.Errorf("alias %q of service %d: %w", alias.Alias, alias.ServiceId, domain.ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/pkg/config"
+)
+
+// StaticRates is a domain.RateProvider with fixed rates read from the config.
+type StaticRates struct {
+	rates map[string]float64
+}
+
+func NewStaticRates(cfg config.RatesConfig) (*StaticRates, error) {
+	if cfg.Base == "" {
+		return nil, fmt.Errorf("rates: base currency is not set")
+	}
+	rates := map[string]float64{cfg.Base: 1}
+	for code, rate := range cfg.Rates {
+		if rate <= 0 {
+			return nil, fmt.Errorf("rates: %s rate must be positive", code)
+		}
+		rates[code] = rate
+	}
+	if rates[cfg.Base] != 1 {
+		return nil, fmt.Errorf("rates: base currency %s must have rate 1", cfg.Base)
+	}
+	return &StaticRates{rates: rates}, nil
+}
+
+func (r *StaticRates) Rate(ctx context.Context, from, to string) (float64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	fromRate, ok := r.rates[from]
+	if !ok {
+		return 0, domain.NewValidationError("currency", "no exchange rate for "+from)
+	}
+	toRate, ok := r.rates[to]
+	if !ok {
+		return 0, domain.NewValidationError("currency", "no exchange rate for "+to)
+	}
+	return fromRate / toRate, nil
+}
@@ -2,63 +2,111 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/samantonio28/subscriber-inf/internal/domain"
-	"github.com/samantonio28/subscriber-inf/pkg/utils"
 )
 
+// maxServiceNameLen mirrors services.service_name VARCHAR(50).
+const maxServiceNameLen = 50
+
 type SubRepo struct {
-	p *pgxpool.Pool
+	p            *pgxpool.Pool
+	queryTimeout time.Duration
 }
 
-func NewSubRepo(p *pgxpool.Pool) (*SubRepo, error) {
+// NewSubRepo returns a repository running every call within queryTimeout,
+// zero means no deadline other than the one of the caller's context.
+func NewSubRepo(p *pgxpool.Pool, queryTimeout time.Duration) (*SubRepo, error) {
 	if p == nil {
 		return nil, domain.ErrInvalidSubRepo
 	}
-	return &SubRepo{p: p}, nil
+	return &SubRepo{p: p, queryTimeout: queryTimeout}, nil
+}
+
+// queryCtx bounds ctx by the query timeout.
+func (s *SubRepo) queryCtx(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.queryTimeout)
+}
+
+// rollback ends tx unless it was committed. It outlives a cancelled ctx
+// so that the connection is not left in a transaction, failures caused
+// by the cancellation are expected and not logged.
+func rollback(ctx context.Context, tx pgx.Tx) {
+	err := tx.Rollback(context.WithoutCancel(ctx))
+	if err != nil && !errors.Is(err, pgx.ErrTxClosed) && ctx.Err() == nil {
+		log.Printf("failed to rollback transaction: %v", err)
+	}
 }
 
 const (
-	GetSubById = `
-SELECT sub_id, service_id, price, start_date, end_date 
-FROM subscriptions
-WHERE sub_id = $1;
-`
-	GetUserBySubId = `
-SELECT user_id FROM users_subs WHERE sub_id = $1;
+	// upsertService returns the service_id of $1 or of its alias,
+	// adding the service if it is new.
+	upsertService = `
+INSERT INTO services (service_name)
+VALUES (canonical_service_name($1))
+ON CONFLICT (service_name) DO UPDATE SET service_name = EXCLUDED.service_name
+RETURNING service_id`
+	// PutSub adds a subscription with its service and user in one
+	// statement, so that creates can be batched. A new user gets an
+	// empty profile.
+	PutSub = `
+WITH svc AS (` + upsertService + `
+), usr AS (
+    INSERT INTO users (user_id) VALUES ($7::uuid)
+    ON CONFLICT (user_id) DO NOTHING
+), ins AS (
+    INSERT INTO subscriptions
+    (service_id, price, currency, billing_period, start_date, end_date)
+    SELECT service_id, $2::integer, $3::text, $4::text, $5::date, $6::date FROM svc
+    RETURNING sub_id
+)
+INSERT INTO users_subs (sub_id, user_id)
+SELECT sub_id, $7::uuid FROM ins
+RETURNING sub_id;
 `
-	GetServiceNameById = `
-SELECT service_name FROM services WHERE service_id = $1;	
+	DeleteSub = `
+UPDATE subscriptions SET deleted_at = now(), version = version + 1
+WHERE sub_id = $1 AND deleted_at IS NULL;
 `
-	GetSubByUserId = `
-SELECT sub_id FROM users_subs WHERE user_id = $1;	
+	RestoreSub = `
+UPDATE subscriptions SET deleted_at = NULL, version = version + 1
+WHERE sub_id = $1 AND deleted_at IS NOT NULL;
 `
-	PutServiceName = `
-INSERT INTO services (service_name) 
-VALUES ($1)
-ON CONFLICT (service_name) DO UPDATE SET service_name = EXCLUDED.service_name
-RETURNING service_id;
+	// PurgeSubs removes the subscriptions deleted before $1, users_subs
+	// rows go with them.
+	PurgeSubs = `
+DELETE FROM subscriptions WHERE deleted_at < $1;
 `
-	PutSub = `
-INSERT INTO subscriptions
-(service_id, price, start_date, end_date)
-VALUES ($1, $2, $3, $4)
-RETURNING sub_id;
+	SubExists = `
+SELECT EXISTS (SELECT 1 FROM subscriptions WHERE sub_id = $1);
 `
-	PutSubIdUserId = `
-INSERT INTO users_subs
-(sub_id, user_id)
-VALUES ($1, $2);
+	// LockSubs locks the subscriptions $1 for the writes of a batch.
+	LockSubs = GetAllData + `
+WHERE us.sub_id = ANY($1) AND sub.deleted_at IS NULL
+FOR UPDATE OF sub;
 `
-	DeleteSub = `
-DELETE FROM subscriptions WHERE sub_id = $1;
+	allDataJoins = `
+FROM 
+    users_subs us
+JOIN 
+    subscriptions sub ON us.sub_id = sub.sub_id
+JOIN 
+    services s ON sub.service_id = s.service_id
 `
 	GetAllData = `
 SELECT 
@@ -66,252 +114,1121 @@ SELECT
     us.user_id,
     s.service_name,
     sub.price,
+    sub.currency,
+    sub.billing_period,
     sub.start_date,
-    sub.end_date
-FROM 
-    users_subs us
-LEFT JOIN 
-    subscriptions sub ON us.sub_id = sub.sub_id
-LEFT JOIN 
-    services s ON sub.service_id = s.service_id
-ORDER BY 
-    us.sub_id;	
+    sub.end_date,
+    sub.deleted_at,
+    sub.version` + allDataJoins
+	CountAllData = `
+SELECT COUNT(*)` + allDataJoins
+	// $2 includes the soft-deleted subscriptions.
+	GetSubById = GetAllData + `
+WHERE us.sub_id = $1 AND ($2 OR sub.deleted_at IS NULL);
+`
+	// LockSub is GetSubById locking the subscription for a write.
+	LockSub = GetAllData + `
+WHERE us.sub_id = $1 AND ($2 OR sub.deleted_at IS NULL)
+FOR UPDATE OF sub;
+`
+	GetSubsByUserId = GetAllData + `
+WHERE us.user_id = $1 AND ($2 OR sub.deleted_at IS NULL)
+ORDER BY us.sub_id;
+`
+	// costsBounds selects the subscriptions charged between $1 and $2
+	// with the later of the starts as st and the earlier of the ends as en.
+	// The end is exclusive. %s takes extra conditions of costsConds.
+	costsBounds = `
+WITH bounds AS (
+    SELECT
+        us.sub_id,
+        us.user_id,
+        s.service_name,
+        sub.price,
+        sub.currency,
+        sub.billing_period,
+        sub.start_date,
+        GREATEST(sub.start_date, $1::date) AS st,
+        LEAST(COALESCE(sub.end_date, $2::date), $2::date) AS en` + allDataJoins + `
+    WHERE sub.start_date <= $2::date
+      AND (sub.end_date IS NULL OR sub.end_date >= $1::date)
+      AND sub.deleted_at IS NULL%s
+)`
+	// costsSteps adds the billing period of bounds as step_months or
+	// step_days, the number of a period starting no later than st as
+	// first_n and the number of the last period starting before en as
+	// last_n. The n-th period starts n steps after the start, months are
+	// added to the start date itself so that the 31st stays the last day.
+	// The month of st is left out of first_n, as the period starting in it
+	// may start after st.
+	costsSteps = `,
+steps AS (
+    SELECT
+        *,
+        CASE
+            WHEN step_days > 0 THEN (st - start_date) / step_days
+            ELSE GREATEST(((EXTRACT(YEAR FROM st) - EXTRACT(YEAR FROM start_date)) * 12
+                + EXTRACT(MONTH FROM st) - EXTRACT(MONTH FROM start_date))::int - 1, 0) / step_months
+        END AS first_n,
+        CASE
+            WHEN step_days > 0 THEN (en - start_date) / step_days
+            ELSE ((EXTRACT(YEAR FROM en) - EXTRACT(YEAR FROM start_date)) * 12
+                + EXTRACT(MONTH FROM en) - EXTRACT(MONTH FROM start_date))::int / step_months
+        END AS last_n
+    FROM (
+        SELECT
+            *,
+            CASE billing_period WHEN 'weekly' THEN 0 WHEN 'quarterly' THEN 3 WHEN 'yearly' THEN 12 ELSE 1 END AS step_months,
+            CASE billing_period WHEN 'weekly' THEN 7 ELSE 0 END AS step_days
+        FROM bounds
+    ) b
+)`
+	// costsCharges expands bounds into one row per charge in [st, en).
+	costsCharges = costsSteps + `,
+charges AS (
+    SELECT sub_id, price, currency, charged_at
+    FROM (
+        SELECT
+            steps.*,
+            (start_date + make_interval(months => n * step_months, days => n * step_days))::date AS charged_at
+        FROM steps, generate_series(first_n, last_n) AS n
+    ) c
+    WHERE charged_at >= st AND charged_at < en
+)`
+	// chargedFull sums up the charges of every subscription as cost.
+	chargedFull = costsCharges + `,
+charged AS (
+    SELECT sub_id, SUM(price)::bigint AS cost
+    FROM charges
+    GROUP BY sub_id
+)`
+	// chargedProRata bills the days of every billing period within [st, en)
+	// as a share of the price and rounds the sum up to cost.
+	chargedProRata = costsSteps + `,
+periods AS (
+    SELECT
+        sub_id,
+        price,
+        LEAST(period_end, en) - GREATEST(period_start, st) AS days,
+        period_end - period_start AS period_days
+    FROM (
+        SELECT
+            steps.*,
+            (start_date + make_interval(months => n * step_months, days => n * step_days))::date AS period_start,
+            (start_date + make_interval(months => (n + 1) * step_months, days => (n + 1) * step_days))::date AS period_end
+        FROM steps, generate_series(first_n, last_n) AS n
+    ) p
+    WHERE period_start < en AND period_end > st
+),
+charged AS (
+    SELECT sub_id, ROUND(SUM(price * days::numeric / period_days))::bigint AS cost
+    FROM periods
+    GROUP BY sub_id
+)`
+	// GetTotalCosts follows chargedFull or chargedProRata.
+	GetTotalCosts = `
+SELECT
+    b.currency,
+    COALESCE(SUM(c.cost), 0)::bigint,
+    array_agg(b.sub_id ORDER BY b.sub_id)
+FROM bounds b
+LEFT JOIN charged c ON c.sub_id = b.sub_id
+GROUP BY b.currency
+ORDER BY b.currency;
+`
+	// GetCostsByKey follows chargedFull or chargedProRata and groups
+	// by the column in %[1]s.
+	GetCostsByKey = `
+SELECT
+    %[1]s,
+    currency,
+    COALESCE(SUM(cost), 0)::bigint,
+    array_agg(b.sub_id ORDER BY b.sub_id)
+FROM bounds b
+LEFT JOIN charged c ON c.sub_id = b.sub_id
+GROUP BY %[1]s, currency
+ORDER BY %[1]s, currency;
+`
+	GetCostsByMonth = costsCharges + `
+SELECT
+    to_char(date_trunc('month', charged_at::timestamp), 'MM-YYYY'),
+    currency,
+    SUM(price)::bigint,
+    array_agg(DISTINCT sub_id ORDER BY sub_id)
+FROM charges
+GROUP BY date_trunc('month', charged_at::timestamp), currency
+ORDER BY date_trunc('month', charged_at::timestamp), currency;
+`
+	GetMonthlyCosts = costsCharges + `
+SELECT
+    date_trunc('month', charged_at::timestamp)::date,
+    sub_id,
+    SUM(price)::bigint,
+    currency
+FROM charges
+GROUP BY date_trunc('month', charged_at::timestamp), sub_id, currency
+ORDER BY 1, sub_id;
 `
 )
 
-func (s *SubRepo) Sub(ctx context.Context, subId domain.SubID) (domain.Subscription, error) {
-	tx, err := s.p.Begin(ctx)
+func (s *SubRepo) Sub(ctx context.Context, subId domain.SubID, includeDeleted bool) (domain.Subscription, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	return getSub(ctx, s.p, subId, includeDeleted)
+}
+
+// queryRower is the pool or a transaction.
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func getSub(ctx context.Context, q queryRower, subId domain.SubID, includeDeleted bool) (domain.Subscription, error) {
+	return readSub(ctx, q, GetSubById, subId, includeDeleted)
+}
+
+// lockSub is getSub locking the subscription until the end of tx.
+func lockSub(ctx context.Context, tx pgx.Tx, subId domain.SubID, includeDeleted bool) (domain.Subscription, error) {
+	return readSub(ctx, tx, LockSub, subId, includeDeleted)
+}
+
+func readSub(ctx context.Context, q queryRower, query string, subId domain.SubID, includeDeleted bool) (domain.Subscription, error) {
+	sub, err := scanSub(q.QueryRow(ctx, query, int(subId), includeDeleted))
 	if err != nil {
-		return domain.Subscription{}, fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer func() {
-		if err := tx.Rollback(ctx); err != nil {
-			log.Printf("failed to rollback transaction: %v", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.Subscription{}, fmt.Errorf("subscription %d: %w", subId, domain.ErrNotFound)
 		}
-	}()
-
-	var sub domain.Subscription
-	var enDate pgtype.Date
-	var serviceId int
-	if err := tx.QueryRow(ctx, GetSubById, int(subId)).Scan(
-		&sub.SubId,
-		&serviceId,
-		&sub.Price,
-		&sub.StartDate,
-		&enDate,
-	); err != nil {
 		return domain.Subscription{}, err
 	}
-	if enDate.Valid {
-		sub.EndDate = enDate.Time
+	return sub, nil
+}
+
+func (s *SubRepo) UserSubs(ctx context.Context, userId uuid.UUID, includeDeleted bool) ([]domain.Subscription, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	rows, err := s.p.Query(ctx, GetSubsByUserId, userId, includeDeleted)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
 	}
-	if err := tx.QueryRow(ctx, GetUserBySubId, int(subId)).Scan(&sub.UserID); err != nil {
-		return domain.Subscription{}, err
+	return scanSubs(rows, 1)
+}
+
+func (s *SubRepo) StoreSub(ctx context.Context, sub domain.Subscription) (domain.SubID, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	if err := tx.QueryRow(ctx, GetServiceNameById, serviceId).Scan(&sub.ServiceName); err != nil {
-		return domain.Subscription{}, err
+	defer rollback(ctx, tx)
+
+	subId, err := storeSub(ctx, tx, sub)
+	if err != nil {
+		return 0, err
+	}
+	if err := writeAudit(ctx, tx, []domain.AuditEntry{{SubId: subId, Action: domain.AuditCreate}}); err != nil {
+		return 0, err
 	}
 	if err := tx.Commit(ctx); err != nil {
-		return domain.Subscription{}, fmt.Errorf("failed to commit transaction: %w", err)
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	return subId, nil
+}
 
-	return sub, nil
+// storeSub inserts sub within tx.
+func storeSub(ctx context.Context, tx pgx.Tx, sub domain.Subscription) (domain.SubID, error) {
+	if err := checkServiceName(sub.ServiceName); err != nil {
+		return 0, err
+	}
+	var subId int
+	if err := tx.QueryRow(ctx, PutSub, putSubArgs(sub)...).Scan(&subId); err != nil {
+		return 0, fmt.Errorf("failed to insert sub: %w", pgError(err))
+	}
+	return domain.SubID(subId), nil
+}
+
+func putSubArgs(sub domain.Subscription) []any {
+	var enDateOrNil any = sub.EndDate
+	if sub.EndDate.IsZero() {
+		enDateOrNil = nil
+	}
+	return []any{sub.ServiceName, sub.Price, sub.Currency, string(sub.BillingPeriod), sub.StartDate, enDateOrNil, sub.UserID}
 }
 
-func (s *SubRepo) UserSubs(ctx context.Context, userId uuid.UUID) ([]domain.Subscription, error) {
-	res := make([]domain.Subscription, 0, 1)
-	rows, err := s.p.Query(ctx, GetSubByUserId, userId)
+// StoreSubs stores every subscription under a savepoint, so that a
+// failed one doesn't abort the transaction and the rest are checked
+// against the database as well.
+func (s *SubRepo) StoreSubs(ctx context.Context, subs []domain.Subscription, mode domain.TxMode, dryRun bool) ([]domain.StoreResult, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	tx, err := s.p.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("query failed: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	defer rows.Close()
+	defer rollback(ctx, tx)
 
-	for rows.Next() {
-		var subId int
-		if err := rows.Scan(&subId); err != nil {
-			return nil, err
+	results := make([]domain.StoreResult, len(subs))
+	entries := make([]domain.AuditEntry, 0, len(subs))
+	failed := false
+	for i, sub := range subs {
+		sp, err := tx.Begin(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create savepoint: %w", err)
 		}
-
-		sub, err := s.Sub(ctx, domain.SubID(subId))
+		subId, err := storeSub(ctx, sp, sub)
 		if err != nil {
-			return nil, err
+			rollback(ctx, sp)
+			if !isRowError(err) {
+				return nil, err
+			}
+			results[i].Err = err
+			failed = true
+			continue
 		}
-		res = append(res, sub)
+		if err := sp.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("failed to release savepoint: %w", err)
+		}
+		results[i].SubId = subId
+		entries = append(entries, domain.AuditEntry{SubId: subId, Action: domain.AuditCreate})
 	}
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("rows error: %w", err)
+
+	if dryRun || (failed && mode == domain.TxAllOrNothing) {
+		return withoutIds(results), nil
 	}
-	return res, nil
+	if err := writeAudit(ctx, tx, entries); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return results, nil
 }
 
-func (s *SubRepo) StoreSub(ctx context.Context, sub domain.Subscription) (domain.SubID, error) {
+// isRowError tells the errors of a subscription from the ones of the
+// connection or the context.
+func isRowError(err error) bool {
+	return errors.Is(err, domain.ErrValidation) || errors.Is(err, domain.ErrConflict) ||
+		errors.Is(err, domain.ErrNotFound) || errors.Is(err, domain.ErrPreconditionFailed)
+}
+
+func withoutIds(results []domain.StoreResult) []domain.StoreResult {
+	for i := range results {
+		results[i].SubId = 0
+	}
+	return results
+}
+
+// ApplySubs checks ops against the subscriptions they change first.
+// In TxAllOrNothing mode all of them are then sent as one batch, which
+// stops at the first failed op; in TxBestEffort mode every op runs
+// under a savepoint. The audit log gets the state of a subscription
+// right before and after each op, even when a batch changes it twice.
+func (s *SubRepo) ApplySubs(ctx context.Context, ops []domain.SubOp, mode domain.TxMode) ([]domain.StoreResult, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
 	tx, err := s.p.Begin(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer rollback(ctx, tx)
+
+	cur, err := lockSubs(ctx, tx, ops)
+	if err != nil {
+		return nil, err
 	}
-	defer func() {
-		if err := tx.Rollback(ctx); err != nil {
-			log.Printf("failed to rollback transaction: %v", err)
+	results := make([]domain.StoreResult, len(ops))
+	failed := false
+	for i, op := range ops {
+		if err := checkOp(op, cur); err != nil {
+			results[i].Err = err
+			failed = true
 		}
-	}()
+	}
 
-	var serviceId int
+	var entries []domain.AuditEntry
+	if mode == domain.TxAllOrNothing {
+		if !failed {
+			entries, failed, err = sendOps(ctx, tx, ops, results)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if failed {
+			return withoutIds(results), nil
+		}
+	} else {
+		for i, op := range ops {
+			if results[i].Err != nil {
+				continue
+			}
+			sp, err := tx.Begin(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create savepoint: %w", err)
+			}
+			entry, err := applyOp(ctx, sp, op)
+			if err != nil {
+				rollback(ctx, sp)
+				if !isRowError(err) {
+					return nil, err
+				}
+				results[i].Err = err
+				continue
+			}
+			if err := sp.Commit(ctx); err != nil {
+				return nil, fmt.Errorf("failed to release savepoint: %w", err)
+			}
+			results[i].SubId = entry.SubId
+			entries = append(entries, entry)
+		}
+	}
+	if err := writeAudit(ctx, tx, entries); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return results, nil
+}
 
-	if err := tx.QueryRow(ctx, PutServiceName, sub.ServiceName).Scan(&serviceId); err != nil {
-		return 0, fmt.Errorf("failed to get service_id: %w", err)
+// lockSubs locks the subscriptions updated or deleted by ops and
+// returns them.
+func lockSubs(ctx context.Context, tx pgx.Tx, ops []domain.SubOp) (map[domain.SubID]domain.Subscription, error) {
+	var ids []int
+	for _, op := range ops {
+		if op.Kind == domain.SubOpUpdate || op.Kind == domain.SubOpDelete {
+			ids = append(ids, int(op.Update.SubId))
+		}
 	}
-	var subId int
-	var enDateOrNil any = sub.EndDate
-	if sub.EndDate.IsZero() {
-		enDateOrNil = nil
+	cur := make(map[domain.SubID]domain.Subscription, len(ids))
+	if len(ids) == 0 {
+		return cur, nil
 	}
-	if err := tx.QueryRow(ctx, PutSub, serviceId, sub.Price, sub.StartDate, enDateOrNil).Scan(&subId); err != nil {
-		return 0, fmt.Errorf("failed to insert sub: %w", err)
+	rows, err := tx.Query(ctx, LockSubs, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock subscriptions: %w", err)
 	}
-	_, err = tx.Exec(ctx, PutSubIdUserId, subId, sub.UserID)
+	subs, err := scanSubs(rows, len(ids))
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert user subscription: %w", err)
+		return nil, fmt.Errorf("failed to lock subscriptions: %w", err)
 	}
-	if err := tx.Commit(ctx); err != nil {
-		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	for _, sub := range subs {
+		cur[sub.SubId] = sub
 	}
-	return domain.SubID(subId), nil
+	return cur, nil
 }
 
-func (s *SubRepo) UpdateSub(ctx context.Context, sub domain.Subscription) error {
-	tx, err := s.p.Begin(ctx)
+// checkOp checks op before it is run, cur are the subscriptions from
+// lockSubs.
+func checkOp(op domain.SubOp, cur map[domain.SubID]domain.Subscription) error {
+	switch op.Kind {
+	case domain.SubOpCreate:
+		return checkServiceName(op.Sub.ServiceName)
+	case domain.SubOpUpdate, domain.SubOpDelete:
+		stored, ok := cur[op.Update.SubId]
+		if !ok {
+			return fmt.Errorf("subscription %d: %w", op.Update.SubId, domain.ErrNotFound)
+		}
+		if err := checkVersion(stored, op.Update.Version); err != nil {
+			return err
+		}
+		if op.Kind == domain.SubOpUpdate {
+			return checkUpdate(op.Update, stored)
+		}
+		return nil
+	}
+	return domain.NewValidationError("op", "unknown operation "+string(op.Kind))
+}
+
+func opQuery(op domain.SubOp) (string, []any) {
+	switch op.Kind {
+	case domain.SubOpCreate:
+		return PutSub, putSubArgs(op.Sub)
+	case domain.SubOpUpdate:
+		return updateQuery(op.Update)
+	}
+	return DeleteSub, []any{int(op.Update.SubId)}
+}
+
+// opResult is the result of a checked op from the error of its query
+// and, for updates and deletes, the command tag.
+func opResult(op domain.SubOp, subId int, tag pgconn.CommandTag, err error) (domain.SubID, error) {
 	if err != nil {
-		return fmt.Errorf("failed to start transaction: %w", err)
+		return 0, fmt.Errorf("failed to %s subscription: %w", op.Kind, pgError(err))
+	}
+	if op.Kind == domain.SubOpCreate {
+		return domain.SubID(subId), nil
 	}
-	defer func() {
-		if err := tx.Rollback(ctx); err != nil {
-			log.Printf("failed to rollback transaction: %v", err)
+	if tag.RowsAffected() == 0 {
+		// Deleted by an earlier op of the batch.
+		return 0, fmt.Errorf("subscription %d: %w", op.Update.SubId, domain.ErrNotFound)
+	}
+	return op.Update.SubId, nil
+}
+
+// applyOp runs a checked op within tx and returns its audit entry.
+func applyOp(ctx context.Context, tx pgx.Tx, op domain.SubOp) (domain.AuditEntry, error) {
+	var old *domain.Subscription
+	if op.Kind != domain.SubOpCreate {
+		sub, err := getSub(ctx, tx, op.Update.SubId, true)
+		if err != nil {
+			return domain.AuditEntry{}, err
 		}
-	}()
+		old = &sub
+	}
+
+	query, args := opQuery(op)
+	var subId domain.SubID
+	var err error
+	if op.Kind == domain.SubOpCreate {
+		var id int
+		err = tx.QueryRow(ctx, query, args...).Scan(&id)
+		subId, err = opResult(op, id, pgconn.CommandTag{}, err)
+	} else {
+		tag, execErr := tx.Exec(ctx, query, args...)
+		subId, err = opResult(op, 0, tag, execErr)
+	}
+	if err != nil {
+		return domain.AuditEntry{}, err
+	}
 
-	subToCheck, err := s.Sub(ctx, sub.SubId)
+	sub, err := getSub(ctx, tx, subId, true)
 	if err != nil {
-		return fmt.Errorf("sub does not exist: %w", err)
+		return domain.AuditEntry{}, err
 	}
+	return domain.AuditEntry{SubId: subId, Action: auditAction(op.Kind), Old: old, New: &sub}, nil
+}
 
-	serviceId := -1
-	if sub.ServiceName != "" {
-		if err := tx.QueryRow(ctx, PutServiceName, sub.ServiceName).Scan(&serviceId); err != nil {
-			return fmt.Errorf("failed to get service_id: %w", err)
+// sendOps runs checked ops as one batch, fills their results and
+// returns their audit entries. Every op is sent between two reads of
+// its subscription. It stops at the first failed op, the transaction
+// is aborted then.
+func sendOps(ctx context.Context, tx pgx.Tx, ops []domain.SubOp, results []domain.StoreResult) ([]domain.AuditEntry, bool, error) {
+	batch := &pgx.Batch{}
+	for _, op := range ops {
+		if op.Kind != domain.SubOpCreate {
+			batch.Queue(GetSubById, int(op.Update.SubId), true)
+		}
+		query, args := opQuery(op)
+		batch.Queue(query, args...)
+		if op.Kind == domain.SubOpCreate {
+			batch.Queue(GetCreatedSub)
+		} else {
+			batch.Queue(GetSubById, int(op.Update.SubId), true)
 		}
 	}
-	if sub.UserID == uuid.Nil {
-		return fmt.Errorf("bad data: user_id cannot be nil")
+	br := tx.SendBatch(ctx, batch)
+	defer br.Close()
+
+	entries := make([]domain.AuditEntry, 0, len(ops))
+	for i, op := range ops {
+		var old *domain.Subscription
+		if op.Kind != domain.SubOpCreate {
+			sub, err := scanSub(br.QueryRow())
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to read subscription %d: %w", op.Update.SubId, err)
+			}
+			old = &sub
+		}
+
+		var subId domain.SubID
+		var err error
+		if op.Kind == domain.SubOpCreate {
+			var id int
+			err = br.QueryRow().Scan(&id)
+			subId, err = opResult(op, id, pgconn.CommandTag{}, err)
+		} else {
+			tag, execErr := br.Exec()
+			subId, err = opResult(op, 0, tag, execErr)
+		}
+		if err != nil {
+			if !isRowError(err) {
+				return nil, false, err
+			}
+			results[i].Err = err
+			return nil, true, nil
+		}
+		results[i].SubId = subId
+
+		sub, err := scanSub(br.QueryRow())
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read subscription %d: %w", subId, err)
+		}
+		entries = append(entries, domain.AuditEntry{SubId: subId, Action: auditAction(op.Kind), Old: old, New: &sub})
 	}
-	if sub.UserID != subToCheck.UserID {
-		return fmt.Errorf("bad data: user_id cannot be changed")
+	return entries, false, nil
+}
+
+func (s *SubRepo) UpdateSub(ctx context.Context, upd domain.SubUpdate) error {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
 	}
+	defer rollback(ctx, tx)
 
-	query := `UPDATE subscriptions SET`
-	args := []any{}
-	argPos := 1
+	old, err := lockSub(ctx, tx, upd.SubId, false)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(old, upd.Version); err != nil {
+		return err
+	}
+	if err := checkUpdate(upd, old); err != nil {
+		return err
+	}
+	query, args := updateQuery(upd)
+	res, err := tx.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("fail: %w", pgError(err))
+	}
+	if res.RowsAffected() == 0 {
+		return fmt.Errorf("subscription %d: %w", upd.SubId, domain.ErrNotFound)
+	}
+	if err := writeAudit(ctx, tx, []domain.AuditEntry{{SubId: upd.SubId, Action: domain.AuditUpdate, Old: &old}}); err != nil {
+		return err
+	}
 
-	if serviceId != -1 {
-		query += fmt.Sprintf(" service_id = $%d,", argPos)
-		args = append(args, serviceId)
-		argPos++
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("can't finish transaction: %w", err)
 	}
+	return nil
+}
 
-	if sub.Price > 0 {
-		query += fmt.Sprintf(" price = $%d,", argPos)
-		args = append(args, sub.Price)
-		argPos++
+// checkVersion checks that cur is at version want, zero matches any.
+func checkVersion(cur domain.Subscription, want int) error {
+	if want != 0 && want != cur.Version {
+		return domain.NewVersionMismatchError(cur.SubId, want, cur.Version)
 	}
+	return nil
+}
 
-	if !sub.StartDate.IsZero() {
-		if sub.StartDate.Day() != 1 {
-			return fmt.Errorf("bad data: day must be 1st (start)")
+// checkUpdate checks upd against the stored subscription cur the way
+// the database can't.
+func checkUpdate(upd domain.SubUpdate, cur domain.Subscription) error {
+	if upd.ServiceName != nil {
+		if err := checkServiceName(*upd.ServiceName); err != nil {
+			return err
 		}
-		query += fmt.Sprintf(" start_date = $%d,", argPos)
-		args = append(args, sub.StartDate)
-		argPos++
 	}
-
-	if !sub.EndDate.IsZero() {
-		if sub.EndDate.Day() != 1 {
-			return fmt.Errorf("bad data: day must be 1st (end)")
+	if upd.UserID != nil {
+		if *upd.UserID == uuid.Nil {
+			return domain.NewValidationError("user_id", "cannot be nil")
 		}
-		if !sub.StartDate.IsZero() && sub.EndDate.Before(sub.StartDate) ||
-			sub.StartDate.IsZero() && sub.EndDate.Before(subToCheck.StartDate) {
-			return fmt.Errorf("bad data: end date must be after start date")
+		if *upd.UserID != cur.UserID {
+			return domain.NewImmutableFieldError("user_id")
 		}
-		query += fmt.Sprintf(" end_date = $%d,", argPos)
-		args = append(args, sub.EndDate)
-		argPos++
+	}
+	if upd.Empty() {
+		return domain.NewValidationError("", "no arguments to update")
+	}
+	if next := upd.Apply(cur); !next.EndDate.IsZero() && next.EndDate.Before(next.StartDate) {
+		return domain.NewValidationError("end_date", "must be after start date")
+	}
+	return nil
+}
+
+// updateQuery sets the given fields of upd and bumps the version in one
+// statement.
+func updateQuery(upd domain.SubUpdate) (string, []any) {
+	query := `UPDATE subscriptions SET version = version + 1,`
+	args := []any{}
+	set := func(column string, arg any) {
+		args = append(args, arg)
+		query += fmt.Sprintf(" %s = $%d,", column, len(args))
 	}
 
-	if argPos == 1 {
-		return fmt.Errorf("no arguments to update")
+	if upd.ServiceName != nil {
+		query = `WITH svc AS (` + upsertService + `)
+` + query + ` service_id = (SELECT service_id FROM svc),`
+		args = append(args, *upd.ServiceName)
+	}
+	if upd.Price != nil {
+		set("price", *upd.Price)
+	}
+	if upd.Currency != nil {
+		set("currency", *upd.Currency)
+	}
+	if upd.BillingPeriod != nil {
+		set("billing_period", string(*upd.BillingPeriod))
+	}
+	if upd.StartDate != nil {
+		set("start_date", *upd.StartDate)
+	}
+	if upd.EndDate != nil {
+		var enDateOrNil any = *upd.EndDate
+		if upd.EndDate.IsZero() {
+			enDateOrNil = nil
+		}
+		set("end_date", enDateOrNil)
 	}
 	query = strings.TrimSuffix(query, ",")
 
-	query += fmt.Sprintf(" WHERE sub_id = $%d", argPos)
-	args = append(args, int(sub.SubId))
+	query += fmt.Sprintf(" WHERE sub_id = $%d AND deleted_at IS NULL", len(args)+1)
+	args = append(args, int(upd.SubId))
+	return query, args
+}
+
+func (s *SubRepo) DeleteSub(ctx context.Context, subId domain.SubID, version int) error {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
 
-	_, err = tx.Exec(ctx, query, args...)
+	tx, err := s.p.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("fail: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer rollback(ctx, tx)
 
+	old, err := lockSub(ctx, tx, subId, false)
+	if err != nil {
+		return fmt.Errorf("no subs deleted: %w", err)
+	}
+	if err := checkVersion(old, version); err != nil {
+		return err
+	}
+	res, err := tx.Exec(ctx, DeleteSub, int(subId))
+	if err != nil {
+		return err
+	}
+	rowsAffected := res.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("no subs deleted: subscription %d: %w", subId, domain.ErrNotFound)
+	}
+	if err := writeAudit(ctx, tx, []domain.AuditEntry{{SubId: subId, Action: domain.AuditDelete, Old: &old}}); err != nil {
+		return err
+	}
 	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf("can't finish transaction: %w", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 	return nil
 }
 
-func (s *SubRepo) DeleteSub(ctx context.Context, subId domain.SubID) error {
-	res, err := s.p.Exec(ctx, DeleteSub, int(subId))
+func (s *SubRepo) RestoreSub(ctx context.Context, subId domain.SubID) error {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer rollback(ctx, tx)
+
+	old, err := lockSub(ctx, tx, subId, true)
 	if err != nil {
 		return err
 	}
-	rowsAffected := res.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("no subs deleted")
+	notDeleted := domain.NewConflictError("", fmt.Sprintf("subscription %d is not deleted", subId))
+	if !old.Deleted() {
+		return notDeleted
+	}
+	res, err := tx.Exec(ctx, RestoreSub, int(subId))
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		// Restored by a concurrent call.
+		return notDeleted
+	}
+	if err := writeAudit(ctx, tx, []domain.AuditEntry{{SubId: subId, Action: domain.AuditRestore, Old: &old}}); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 	return nil
 }
 
-func (s *SubRepo) SubsTotalCosts(ctx context.Context, filter domain.SubsFilter) (int, []domain.SubID, error) {
-	if filter.UserID == uuid.Nil || filter.StartDate.IsZero() || !filter.EndDate.IsZero() && filter.EndDate.Before(filter.StartDate) {
-		return 0, nil, fmt.Errorf("user id and start date is required || end date must be after start date")
+func (s *SubRepo) PurgeSubs(ctx context.Context, deletedBefore time.Time) (int, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	res, err := s.p.Exec(ctx, PurgeSubs, deletedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge subscriptions: %w", err)
 	}
+	return int(res.RowsAffected()), nil
+}
+
+func (s *SubRepo) SubsTotalCosts(ctx context.Context, filter domain.SubsFilter) (map[string]int, []domain.SubID, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
 
-	allSubs, err := s.UserSubs(ctx, filter.UserID)
+	if err := checkCostsFilter(filter); err != nil {
+		return nil, nil, err
+	}
+
+	query, args := costsQuery(filter, chargedQuery(filter, GetTotalCosts))
+	rows, err := s.p.Query(ctx, query, args...)
 	if err != nil {
-		return 0, nil, fmt.Errorf("can't get user subs: %w", err)
+		return nil, nil, fmt.Errorf("can't count total costs: %w", err)
 	}
+	defer rows.Close()
 
-	if filter.EndDate.IsZero() {
-		filter.EndDate = time.Date(time.Now().Year(), time.Now().Month(), 1, 0, 0, 0, 0, time.UTC)
+	totals := make(map[string]int)
+	var ids []int
+	for rows.Next() {
+		var currency string
+		var sum int
+		var currencyIds []int
+		if err := rows.Scan(&currency, &sum, &currencyIds); err != nil {
+			return nil, nil, fmt.Errorf("can't count total costs: %w", err)
+		}
+		totals[currency] = sum
+		ids = append(ids, currencyIds...)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("rows error: %w", err)
 	}
+	sort.Ints(ids)
+	return totals, toSubIds(ids), nil
+}
 
-	sumCost := 0
-	subIds := make([]domain.SubID, 0, len(allSubs))
+// groupColumns are the bounds columns behind domain.CostsGroupBy.
+var groupColumns = map[domain.CostsGroupBy]string{
+	domain.GroupByService: `service_name COLLATE "C"`,
+	domain.GroupByUser:    "user_id::text",
+}
 
-	for _, sub := range allSubs {
-		if sub.ServiceName != filter.ServiceName {
-			continue
+func (s *SubRepo) SubsCostsByGroup(ctx context.Context, filter domain.SubsFilter, groupBy domain.CostsGroupBy) ([]domain.CostsGroup, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	if err := checkCostsFilter(filter); err != nil {
+		return nil, err
+	}
+
+	var query string
+	var args []any
+	switch groupBy {
+	case domain.GroupByService, domain.GroupByUser:
+		query, args = costsQuery(filter, chargedQuery(filter, fmt.Sprintf(GetCostsByKey, groupColumns[groupBy])))
+	case domain.GroupByMonth:
+		if filter.ProRata {
+			return nil, errProRataByMonth
 		}
-		st := sub.StartDate
-		en := sub.EndDate
-		if st.Before(filter.StartDate) {
-			st = filter.StartDate
+		query, args = costsQuery(filter, GetCostsByMonth)
+	default:
+		return nil, domain.NewValidationError("group_by", "unknown grouping "+string(groupBy))
+	}
+
+	rows, err := s.p.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("can't group costs: %w", err)
+	}
+	defer rows.Close()
+
+	groups := make([]domain.CostsGroup, 0)
+	for rows.Next() {
+		var g domain.CostsGroup
+		var ids []int
+		if err := rows.Scan(&g.Key, &g.Currency, &g.Total, &ids); err != nil {
+			return nil, err
 		}
-		if en.IsZero() || filter.EndDate.Before(en) {
-			en = filter.EndDate
+		g.SubIds = toSubIds(ids)
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return groups, nil
+}
+
+func (s *SubRepo) SubsMonthlyCosts(ctx context.Context, filter domain.SubsFilter) ([]domain.MonthCosts, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	if err := checkCostsFilter(filter); err != nil {
+		return nil, err
+	}
+
+	if filter.ProRata {
+		return nil, errProRataByMonth
+	}
+
+	query, args := costsQuery(filter, GetMonthlyCosts)
+	rows, err := s.p.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("can't get monthly costs: %w", err)
+	}
+	defer rows.Close()
+
+	res := make([]domain.MonthCosts, 0)
+	for rows.Next() {
+		var m time.Time
+		var c domain.SubCost
+		if err := rows.Scan(&m, &c.SubId, &c.Amount, &c.Currency); err != nil {
+			return nil, err
+		}
+		if len(res) == 0 || !res[len(res)-1].Month.Equal(m) {
+			res = append(res, domain.MonthCosts{Month: m})
 		}
+		last := &res[len(res)-1]
+		last.Subs = append(last.Subs, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return res, nil
+}
 
-		months := utils.MonthToInt(en.Month()) - utils.MonthToInt(st.Month()) + 12*(en.Year()-st.Year())
-		if months < 0 {
-			continue
+// errProRataByMonth rejects pro-rated costs broken down by month:
+// billing periods are not split between months.
+var errProRataByMonth = domain.NewValidationError("pro_rata", "can't be broken down by month")
+
+// chargedQuery prepends the charged CTE for the billing mode of filter.
+func chargedQuery(filter domain.SubsFilter, query string) string {
+	if filter.ProRata {
+		return chargedProRata + query
+	}
+	return chargedFull + query
+}
+
+// costsQuery prepends costsBounds narrowed down by filter to query.
+func costsQuery(filter domain.SubsFilter, query string) (string, []any) {
+	args := []any{filter.StartDate, filter.PeriodEnd()}
+	conds := ""
+	if filter.UserID != uuid.Nil {
+		args = append(args, filter.UserID)
+		conds += fmt.Sprintf("\n      AND us.user_id = $%d", len(args))
+	}
+	if filter.ServiceName != "" {
+		args = append(args, filter.ServiceName)
+		conds += fmt.Sprintf("\n      AND s.service_name = canonical_service_name($%d)", len(args))
+	}
+	return fmt.Sprintf(costsBounds, conds) + query, args
+}
+
+func checkCostsFilter(filter domain.SubsFilter) error {
+	if filter.StartDate.IsZero() || !filter.EndDate.IsZero() && filter.EndDate.Before(filter.StartDate) {
+		return domain.NewValidationError("", "start date is required || end date must be after start date")
+	}
+	return nil
+}
+
+func toSubIds(ids []int) []domain.SubID {
+	subIds := make([]domain.SubID, 0, len(ids))
+	for _, id := range ids {
+		subIds = append(subIds, domain.SubID(id))
+	}
+	return subIds
+}
+
+// scanSub reads a GetAllData row.
+func scanSub(row pgx.Row) (domain.Subscription, error) {
+	var sub domain.Subscription
+	var enDate pgtype.Date
+	var deletedAt pgtype.Timestamptz
+	if err := row.Scan(
+		&sub.SubId,
+		&sub.UserID,
+		&sub.ServiceName,
+		&sub.Price,
+		&sub.Currency,
+		&sub.BillingPeriod,
+		&sub.StartDate,
+		&enDate,
+		&deletedAt,
+		&sub.Version,
+	); err != nil {
+		return domain.Subscription{}, err
+	}
+	if enDate.Valid {
+		sub.EndDate = enDate.Time
+	}
+	if deletedAt.Valid {
+		sub.DeletedAt = deletedAt.Time
+	}
+	return sub, nil
+}
+
+// scanSubs reads GetAllData rows and closes them.
+func scanSubs(rows pgx.Rows, capacity int) ([]domain.Subscription, error) {
+	defer rows.Close()
+
+	res := make([]domain.Subscription, 0, capacity)
+	for rows.Next() {
+		sub, err := scanSub(rows)
+		if err != nil {
+			return nil, err
 		}
-		sumCost += sub.Price * months
-		subIds = append(subIds, sub.SubId)
+		res = append(res, sub)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return res, nil
+}
+
+// Postgres error codes translated by pgError.
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+	pgCheckViolation      = "23514"
+	pgStringTooLong       = "22001"
+)
+
+// constraintFields maps schema constraints to the fields they guard.
+var constraintFields = map[string]string{
+	"subscriptions_price_check": "price",
+	"valid_start_date":          "start_date",
+	"valid_end_date":            "end_date",
+	"valid_currency":            "currency",
+	"valid_billing_period":      "billing_period",
+	"services_service_name_key": "service_name",
+	"service_aliases_pkey":      "alias",
+	"valid_default_price":       "default_price",
+	"valid_default_currency":    "default_currency",
+}
+
+// pgError translates constraint violations into domain errors and returns
+// any other error as is.
+func pgError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch pgErr.Code {
+	case pgUniqueViolation, pgForeignKeyViolation:
+		return domain.NewConflictError(constraintFields[pgErr.ConstraintName], pgErr.Message)
+	case pgCheckViolation:
+		return domain.NewValidationError(constraintFields[pgErr.ConstraintName], pgErr.Message)
+	case pgStringTooLong:
+		return domain.NewValidationError(pgErr.ColumnName, pgErr.Message)
+	}
+	return err
+}
+
+func checkServiceName(name string) error {
+	if utf8.RuneCountInString(name) > maxServiceNameLen {
+		return domain.NewValidationError("service_name", fmt.Sprintf("must not be longer than %d characters", maxServiceNameLen))
+	}
+	return nil
+}
+
+// sortColumns are the GetAllData columns behind domain.SubsSortField.
+// Service names are compared bytewise to keep pages stable across locales.
+var sortColumns = map[domain.SubsSortField]string{
+	domain.SortBySubId:       "us.sub_id",
+	domain.SortByPrice:       "sub.price",
+	domain.SortByStartDate:   "sub.start_date",
+	domain.SortByServiceName: `s.service_name COLLATE "C"`,
+}
+
+func (s *SubRepo) ListSubs(ctx context.Context, q domain.SubsListQuery) (domain.SubsPage, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	conds, args := listFilterConds(q.Filter)
+
+	var page domain.SubsPage
+	if !q.NoTotal {
+		if err := s.p.QueryRow(ctx, CountAllData+whereSQL(conds), args...).Scan(&page.Total); err != nil {
+			return domain.SubsPage{}, fmt.Errorf("count failed: %w", err)
+		}
+	}
+
+	col := sortColumns[q.SortBy]
+	dir, cmp := "ASC", ">"
+	if q.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	if q.After != nil {
+		if q.SortBy == domain.SortBySubId {
+			conds = append(conds, fmt.Sprintf("us.sub_id %s $%d", cmp, len(args)+1))
+			args = append(args, int(q.After.SubId))
+		} else {
+			conds = append(conds, fmt.Sprintf("(%s, us.sub_id) %s ($%d, $%d)", col, cmp, len(args)+1, len(args)+2))
+			args = append(args, cursorValue(q.SortBy, q.After), int(q.After.SubId))
+		}
+	}
+
+	query := GetAllData + whereSQL(conds)
+	if q.SortBy == domain.SortBySubId {
+		query += fmt.Sprintf(" ORDER BY us.sub_id %s", dir)
+	} else {
+		query += fmt.Sprintf(" ORDER BY %s %s, us.sub_id %s", col, dir, dir)
+	}
+	// One extra row tells whether there is a next page.
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, q.Limit+1, q.Offset)
+
+	rows, err := s.p.Query(ctx, query, args...)
+	if err != nil {
+		return domain.SubsPage{}, fmt.Errorf("query failed: %w", err)
+	}
+	page.Subs, err = scanSubs(rows, q.Limit+1)
+	if err != nil {
+		return domain.SubsPage{}, err
+	}
+
+	if len(page.Subs) > q.Limit {
+		page.Subs = page.Subs[:q.Limit]
+		page.Next = domain.CursorAfter(page.Subs[q.Limit-1])
+	}
+	return page, nil
+}
+
+func listFilterConds(f domain.SubsListFilter) ([]string, []any) {
+	conds := []string{}
+	args := []any{}
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if !f.IncludeDeleted {
+		conds = append(conds, "sub.deleted_at IS NULL")
+	}
+	if f.UserID != uuid.Nil {
+		add("us.user_id = $%d", f.UserID)
+	}
+	if f.ServiceName != "" {
+		add("s.service_name = canonical_service_name($%d)", f.ServiceName)
+	}
+	if f.MinPrice != 0 {
+		add("sub.price >= $%d", f.MinPrice)
+	}
+	if f.MaxPrice != 0 {
+		add("sub.price <= $%d", f.MaxPrice)
+	}
+	if !f.ActiveAt.IsZero() {
+		add("sub.start_date <= $%[1]d AND (sub.end_date IS NULL OR sub.end_date > $%[1]d)", f.ActiveAt)
+	}
+	if !f.StartFrom.IsZero() {
+		add("sub.start_date >= $%d", f.StartFrom)
+	}
+	if !f.StartTo.IsZero() {
+		add("sub.start_date <= $%d", f.StartTo)
+	}
+	if !f.EndFrom.IsZero() {
+		add("(sub.end_date IS NULL OR sub.end_date >= $%d)", f.EndFrom)
+	}
+	if !f.EndTo.IsZero() {
+		add("sub.end_date <= $%d", f.EndTo)
+	}
+	return conds, args
+}
+
+func whereSQL(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+func cursorValue(sortBy domain.SubsSortField, c *domain.SubsCursor) any {
+	switch sortBy {
+	case domain.SortByPrice:
+		return c.Price
+	case domain.SortByStartDate:
+		return c.StartDate
+	case domain.SortByServiceName:
+		return c.ServiceName
 	}
-	return sumCost, subIds, nil
+	return int(c.SubId)
 }
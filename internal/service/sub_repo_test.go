@@ -0,0 +1,73 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/service"
+	"github.com/samantonio28/subscriber-inf/internal/service/repotest"
+)
+
+const testQueryTimeout = 5 * time.Second
+
+// newSubRepo returns a SubRepo on a database of its own.
+func newSubRepo(tb testing.TB) domain.SubscriptionRepository {
+	tb.Helper()
+	repo, err := service.NewSubRepo(repotest.PgPool(tb), testQueryTimeout)
+	if err != nil {
+		tb.Fatalf("NewSubRepo(): %v", err)
+	}
+	return repo
+}
+
+func TestSubRepo(t *testing.T) {
+	repotest.RequirePostgres(t)
+	repotest.Run(t, newSubRepo)
+}
+
+func TestSubRepoCancellation(t *testing.T) {
+	repotest.RequirePostgres(t)
+	// The locker has to lock the database of the repositories.
+	pool := repotest.PgPool(t)
+	newRepo := func(tb testing.TB) domain.SubscriptionRepository {
+		tb.Helper()
+		repo, err := service.NewSubRepo(pool, testQueryTimeout)
+		if err != nil {
+			tb.Fatalf("NewSubRepo(): %v", err)
+		}
+		return repo
+	}
+	repotest.RunCancellation(t, newRepo, repotest.PgLocker(pool))
+}
+
+func BenchmarkSubRepo(b *testing.B) {
+	repotest.RequirePostgres(b)
+	repotest.RunBenchmarks(b, newSubRepo)
+}
+
+func TestCanonicalServiceName(t *testing.T) {
+	ctx := context.Background()
+	pool := repotest.PgPool(t)
+	var id int
+	if err := pool.QueryRow(ctx, `INSERT INTO services (service_name) VALUES ('yandex plus') RETURNING service_id`).Scan(&id); err != nil {
+		t.Fatalf("insert service: %v", err)
+	}
+	if _, err := pool.Exec(ctx, `INSERT INTO service_aliases (alias, service_id) VALUES ('яндекс плюс', $1)`, id); err != nil {
+		t.Fatalf("insert alias: %v", err)
+	}
+	for name, want := range map[string]string{
+		"яндекс плюс": "yandex plus",
+		"yandex plus": "yandex plus",
+		"kinopoisk":   "kinopoisk",
+	} {
+		var got string
+		if err := pool.QueryRow(ctx, `SELECT canonical_service_name($1)`, name).Scan(&got); err != nil {
+			t.Fatalf("canonical_service_name(%q): %v", name, err)
+		}
+		if got != want {
+			t.Errorf("canonical_service_name(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"strings"
+	"unicode"
+)
+
+// trigramThreshold is the default pg_trgm.similarity_threshold, the
+// least similarity of a match of the % operator.
+const trigramThreshold = 0.3
+
+// trigrams returns the trigrams of s the way pg_trgm does: every word of
+// letters and digits is lowercased and padded with two spaces in front
+// and one behind.
+func trigrams(s string) map[string]struct{} {
+	res := make(map[string]struct{})
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		r := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(r); i++ {
+			res[string(r[i:i+3])] = struct{}{}
+		}
+	}
+	return res
+}
+
+// similarity is the similarity() of pg_trgm: the share of the trigrams
+// of a and b they have in common.
+func similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	common := 0
+	for t := range ta {
+		if _, ok := tb[t]; ok {
+			common++
+		}
+	}
+	return float64(common) / float64(len(ta)+len(tb)-common)
+}
@@ -0,0 +1,37 @@
+package service_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/samantonio28/subscriber-inf/internal/service"
+	"github.com/samantonio28/subscriber-inf/internal/service/repotest"
+)
+
+// TestSimilarity checks that MemSubRepo ranks the searches like pg_trgm.
+func TestSimilarity(t *testing.T) {
+	ctx := context.Background()
+	pool := repotest.PgPool(t)
+	pairs := [][2]string{
+		{"yandex plus", "yandx plus"},
+		{"yandex plus", "yandex music"},
+		{"yandex musik", "yandex music"},
+		{"кинопоиск", "кинопоск"},
+		{"КИНО", "кинопоиск"},
+		{"okko", "okko tv"},
+		{"a", "a b"},
+		{"hbo max", "hbo-max"},
+		{"netflix", "spotify"},
+		{"", "netflix"},
+	}
+	for _, p := range pairs {
+		var want float64
+		if err := pool.QueryRow(ctx, `SELECT similarity($1, $2)`, p[0], p[1]).Scan(&want); err != nil {
+			t.Fatalf("similarity(%q, %q): %v", p[0], p[1], err)
+		}
+		if got := service.Similarity(p[0], p[1]); math.Abs(got-want) > 1e-6 {
+			t.Errorf("Similarity(%q, %q) = %v, pg_trgm has %v", p[0], p[1], got, want)
+		}
+	}
+}
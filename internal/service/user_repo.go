@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+)
+
+const (
+	getUsers = `
+SELECT user_id, name, email, metadata, created_at, updated_at
+FROM users`
+	GetUser = getUsers + `
+WHERE user_id = $1;
+`
+	GetUsers = getUsers + `
+ORDER BY user_id
+LIMIT $1 OFFSET $2;
+`
+	PutUser = `
+INSERT INTO users (user_id, name, email, metadata)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id) DO NOTHING;
+`
+	UpdateUser = `
+UPDATE users SET name = $2, email = $3, metadata = $4, updated_at = now()
+WHERE user_id = $1;
+`
+	LockUser = `
+SELECT user_id FROM users WHERE user_id = $1 FOR UPDATE;
+`
+	// LockUserSubs locks the live subscriptions of $1.
+	LockUserSubs = GetAllData + `
+WHERE us.user_id = $1 AND sub.deleted_at IS NULL
+ORDER BY us.sub_id
+FOR UPDATE OF sub;
+`
+	DeleteUserSubs = `
+UPDATE subscriptions SET deleted_at = now(), version = version + 1
+WHERE sub_id = ANY($1);
+`
+	// PurgeUserSubs removes all the subscriptions of $1, users_subs
+	// rows go with them.
+	PurgeUserSubs = `
+DELETE FROM subscriptions
+WHERE sub_id IN (SELECT sub_id FROM users_subs WHERE user_id = $1);
+`
+	DeleteUser = `
+DELETE FROM users WHERE user_id = $1;
+`
+)
+
+func scanUser(row pgx.Row) (domain.User, error) {
+	var u domain.User
+	if err := row.Scan(&u.Id, &u.Name, &u.Email, &u.Metadata, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		return domain.User{}, err
+	}
+	if u.Metadata == nil {
+		u.Metadata = map[string]string{}
+	}
+	return u, nil
+}
+
+// userMetadata is the metadata column of u, never NULL.
+func userMetadata(u domain.User) map[string]string {
+	if u.Metadata == nil {
+		return map[string]string{}
+	}
+	return u.Metadata
+}
+
+func (s *SubRepo) User(ctx context.Context, id uuid.UUID) (domain.User, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	u, err := scanUser(s.p.QueryRow(ctx, GetUser, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.User{}, fmt.Errorf("user %s: %w", id, domain.ErrNotFound)
+	}
+	return u, err
+}
+
+func (s *SubRepo) Users(ctx context.Context, limit, offset int) ([]domain.User, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	rows, err := s.p.Query(ctx, GetUsers, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	res := make([]domain.User, 0, limit)
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return res, nil
+}
+
+func (s *SubRepo) StoreUser(ctx context.Context, u domain.User) error {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	res, err := s.p.Exec(ctx, PutUser, u.Id, u.Name, u.Email, userMetadata(u))
+	if err != nil {
+		return fmt.Errorf("failed to insert user: %w", pgError(err))
+	}
+	if res.RowsAffected() == 0 {
+		return domain.NewConflictError("user_id", fmt.Sprintf("user %s already exists", u.Id))
+	}
+	return nil
+}
+
+func (s *SubRepo) UpdateUser(ctx context.Context, u domain.User) error {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	res, err := s.p.Exec(ctx, UpdateUser, u.Id, u.Name, u.Email, userMetadata(u))
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", pgError(err))
+	}
+	if res.RowsAffected() == 0 {
+		return fmt.Errorf("user %s: %w", u.Id, domain.ErrNotFound)
+	}
+	return nil
+}
+
+func (s *SubRepo) DeleteUser(ctx context.Context, id uuid.UUID) (int, error) {
+	ctx, cancel := s.queryCtx(ctx)
+	defer cancel()
+
+	tx, err := s.p.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer rollback(ctx, tx)
+
+	err = tx.QueryRow(ctx, LockUser, id).Scan(new(uuid.UUID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("user %s: %w", id, domain.ErrNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	// The live subscriptions are deleted first, so that the audit log
+	// shows their end.
+	rows, err := tx.Query(ctx, LockUserSubs, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock subscriptions: %w", err)
+	}
+	live, err := scanSubs(rows, 0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock subscriptions: %w", err)
+	}
+	ids := make([]int, len(live))
+	entries := make([]domain.AuditEntry, len(live))
+	for i := range live {
+		ids[i] = int(live[i].SubId)
+		entries[i] = domain.AuditEntry{SubId: live[i].SubId, Action: domain.AuditDelete, Old: &live[i]}
+	}
+	if _, err := tx.Exec(ctx, DeleteUserSubs, ids); err != nil {
+		return 0, fmt.Errorf("failed to delete subscriptions: %w", err)
+	}
+	if err := writeAudit(ctx, tx, entries); err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec(ctx, PurgeUserSubs, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge subscriptions: %w", err)
+	}
+	if _, err := tx.Exec(ctx, DeleteUser, id); err != nil {
+		return 0, fmt.Errorf("failed to delete user: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return int(res.RowsAffected()), nil
+}
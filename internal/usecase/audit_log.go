@@ -0,0 +1,46 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/logger"
+)
+
+type AuditLogUC struct {
+	subR   domain.SubscriptionRepository
+	logger *logger.LogrusLogger
+}
+
+func NewAuditLogUC(subR domain.SubscriptionRepository, logger *logger.LogrusLogger) (*AuditLogUC, error) {
+	if subR == nil {
+		return nil, domain.ErrInvalidSubRepo
+	}
+	if logger == nil {
+		return nil, domain.ErrInvalidLogger
+	}
+	return &AuditLogUC{subR: subR, logger: logger}, nil
+}
+
+// AuditLog returns a page of the changes of all subscriptions in the
+// order they were made, of the caller's own ones for a restricted
+// caller.
+func (u *AuditLogUC) AuditLog(ctx context.Context, input AuditQueryDTO) ([]AuditEntryDTO, error) {
+	u.logger.Info("AuditLog", "input", input)
+	var err error
+	if input.UserID, err = scopeUser(ctx, input.UserID); err != nil {
+		return nil, err
+	}
+	filter, err := domain.NewAuditFilter(input.UserID, input.From, input.To, input.AfterId, input.Limit)
+	if err != nil {
+		u.logger.Error("AuditLog", "input", input, "error", err)
+		return nil, err
+	}
+	entries, err := u.subR.AuditLog(ctx, *filter)
+	if err != nil {
+		u.logger.Error("AuditLog", "input", input, "error", err)
+		return nil, err
+	}
+	u.logger.Info("AuditLog", "input", input, "got", len(entries))
+	return AuditEntriesToDTO(entries), nil
+}
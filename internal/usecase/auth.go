@@ -0,0 +1,75 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+)
+
+// subOwner returns the owner of a subscription created by the caller of
+// ctx: userId, the caller's own user when it is nil. A restricted caller
+// can't create subscriptions of other users.
+func subOwner(ctx context.Context, userId uuid.UUID) (uuid.UUID, error) {
+	p, ok := domain.PrincipalFrom(ctx)
+	if !ok {
+		return userId, nil
+	}
+	if userId == uuid.Nil {
+		return p.UserID, nil
+	}
+	if !p.Admin && userId != p.UserID {
+		return uuid.Nil, domain.NewForbiddenError("user_id", "belongs to another user")
+	}
+	return userId, nil
+}
+
+// keyOwner is the user the idempotency keys of the caller of ctx belong
+// to: the caller's own, or userId of the request without a caller.
+func keyOwner(ctx context.Context, userId uuid.UUID) uuid.UUID {
+	if p, ok := domain.PrincipalFrom(ctx); ok {
+		return p.UserID
+	}
+	return userId
+}
+
+// scopeUser returns the user a filter of the caller of ctx applies to. A
+// restricted caller gets its own user for nil and is forbidden others,
+// the rest get userId as is.
+func scopeUser(ctx context.Context, userId uuid.UUID) (uuid.UUID, error) {
+	own, ok := domain.RestrictedTo(ctx)
+	if !ok {
+		return userId, nil
+	}
+	if userId != uuid.Nil && userId != own {
+		return uuid.Nil, domain.NewForbiddenError("user_id", "belongs to another user")
+	}
+	return own, nil
+}
+
+// checkSubAccess fails unless the caller of ctx may act on subscription
+// subId. The subscriptions of other users are not found for a restricted
+// caller, so it can't tell them from missing ones.
+func checkSubAccess(ctx context.Context, subR domain.SubscriptionRepository, subId domain.SubID) error {
+	own, ok := domain.RestrictedTo(ctx)
+	if !ok {
+		return nil
+	}
+	sub, err := subR.Sub(ctx, subId, true)
+	if err != nil {
+		return err
+	}
+	if sub.UserID != own {
+		return fmt.Errorf("subscription %d: %w", subId, domain.ErrNotFound)
+	}
+	return nil
+}
+
+// requireAdmin fails for restricted callers.
+func requireAdmin(ctx context.Context) error {
+	if _, ok := domain.RestrictedTo(ctx); ok {
+		return domain.NewForbiddenError("", "admin role required")
+	}
+	return nil
+}
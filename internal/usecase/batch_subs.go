@@ -0,0 +1,131 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/logger"
+)
+
+// Modes of BatchSubs: atomic writes nothing when any operation fails,
+// partial writes the operations that succeed.
+const (
+	BatchAtomic  = "atomic"
+	BatchPartial = "partial"
+)
+
+var batchTxModes = map[string]domain.TxMode{
+	BatchAtomic:  domain.TxAllOrNothing,
+	BatchPartial: domain.TxBestEffort,
+}
+
+type BatchSubsUC struct {
+	subR   domain.SubscriptionRepository
+	logger *logger.LogrusLogger
+}
+
+func NewBatchSubsUC(subR domain.SubscriptionRepository, logger *logger.LogrusLogger) (*BatchSubsUC, error) {
+	if subR == nil {
+		return nil, domain.ErrInvalidSubRepo
+	}
+	if logger == nil {
+		return nil, domain.ErrInvalidLogger
+	}
+	return &BatchSubsUC{subR: subR, logger: logger}, nil
+}
+
+// BatchSubs runs the operations in one transaction. Operations that came
+// with an error fail the same way as the invalid ones, in atomic mode
+// nothing is sent to the repository then. Empty mode is atomic.
+func (u *BatchSubsUC) BatchSubs(ctx context.Context, input []SubOpDTO, mode string) (BatchDTO, error) {
+	if mode == "" {
+		mode = BatchAtomic
+	}
+	txMode, ok := batchTxModes[mode]
+	if !ok {
+		return BatchDTO{}, domain.NewValidationError("mode", "must be atomic or partial")
+	}
+
+	res := BatchDTO{Rows: make([]RowResultDTO, len(input)), Mode: mode}
+	ops := make([]domain.SubOp, 0, len(input))
+	rows := make([]int, 0, len(input))
+	for i, in := range input {
+		op, err := u.dtoToSubOp(ctx, in)
+		if err != nil {
+			res.Rows[i].Err = err
+			res.Failed++
+			continue
+		}
+		ops = append(ops, op)
+		rows = append(rows, i)
+	}
+
+	if res.Failed > 0 && txMode == domain.TxAllOrNothing {
+		u.logger.Info("BatchSubs", "ops", len(input), "failed", res.Failed, "mode", mode)
+		return res, nil
+	}
+	applied, err := u.subR.ApplySubs(ctx, ops, txMode)
+	if err != nil {
+		u.logger.Error("BatchSubs", "ops", len(input), "error", err)
+		return BatchDTO{}, err
+	}
+	for i, r := range applied {
+		res.Rows[rows[i]] = RowResultDTO{SubId: int(r.SubId), Err: r.Err}
+		if r.Err != nil {
+			res.Failed++
+		} else if r.SubId != 0 {
+			res.Applied++
+		}
+	}
+	res.Committed = res.Applied > 0
+	u.logger.Info("BatchSubs", "ops", len(input), "applied", res.Applied, "failed", res.Failed, "mode", mode)
+	return res, nil
+}
+
+// dtoToSubOp checks the access of the caller of ctx too, so the
+// operations on other users' subscriptions fail row by row.
+func (u *BatchSubsUC) dtoToSubOp(ctx context.Context, in SubOpDTO) (domain.SubOp, error) {
+	if in.Err != nil {
+		return domain.SubOp{}, in.Err
+	}
+	op := domain.SubOp{Kind: domain.SubOpKind(in.Op)}
+	if in.Version < 0 {
+		return domain.SubOp{}, domain.NewValidationError("version", "must not be negative")
+	}
+	switch op.Kind {
+	case domain.SubOpCreate:
+		sub, err := DTOToSub(in.Sub)
+		if err != nil {
+			return domain.SubOp{}, err
+		}
+		if sub.UserID, err = subOwner(ctx, sub.UserID); err != nil {
+			return domain.SubOp{}, err
+		}
+		if sub.UserID == uuid.Nil {
+			sub.UserID = uuid.New()
+		}
+		op.Sub = sub
+	case domain.SubOpUpdate:
+		in.Patch.Version = in.Version
+		upd, err := DTOToSubUpdate(in.SubId, in.Patch)
+		if err != nil {
+			return domain.SubOp{}, err
+		}
+		if err := checkSubAccess(ctx, u.subR, upd.SubId); err != nil {
+			return domain.SubOp{}, err
+		}
+		op.Update = upd
+	case domain.SubOpDelete:
+		if in.SubId <= 0 {
+			return domain.SubOp{}, domain.NewValidationError("sub_id", "must be greater than 0")
+		}
+		if err := checkSubAccess(ctx, u.subR, domain.SubID(in.SubId)); err != nil {
+			return domain.SubOp{}, err
+		}
+		op.Update = domain.SubUpdate{SubId: domain.SubID(in.SubId), Version: in.Version}
+	default:
+		return domain.SubOp{}, domain.NewValidationError("op", "must be create, update or delete")
+	}
+	return op, nil
+}
@@ -2,6 +2,10 @@ package usecase
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/samantonio28/subscriber-inf/internal/domain"
@@ -11,24 +15,35 @@ import (
 type CreateSubUC struct {
 	subR   domain.SubscriptionRepository
 	logger *logger.LogrusLogger
+	keyTTL time.Duration
 }
 
-func NewCreateSubUC(subR domain.SubscriptionRepository, logger *logger.LogrusLogger) (*CreateSubUC, error) {
+// NewCreateSubUC returns a use case creating subscriptions, keyTTL is
+// how long an idempotency key replays its creation.
+func NewCreateSubUC(subR domain.SubscriptionRepository, logger *logger.LogrusLogger, keyTTL time.Duration) (*CreateSubUC, error) {
 	if subR == nil {
 		return nil, domain.ErrInvalidSubRepo
 	}
 	if logger == nil {
 		return nil, domain.ErrInvalidLogger
 	}
-	return &CreateSubUC{subR: subR, logger: logger}, nil
+	if keyTTL <= 0 {
+		return nil, domain.NewValidationError("key_ttl", "must be positive")
+	}
+	return &CreateSubUC{subR: subR, logger: logger, keyTTL: keyTTL}, nil
 }
 
+// NewSub stores a subscription of the user of input, the caller's own
+// user when it is nil. Without a caller a missing user id is generated.
 func (u *CreateSubUC) NewSub(ctx context.Context, input SubscriptionDTO) (int, error) {
 	sub, err := DTOToSub(input)
 	if err != nil {
 		u.logger.WithFields(map[string]any{"error": err})
 		return 0, err
 	}
+	if sub.UserID, err = subOwner(ctx, sub.UserID); err != nil {
+		return 0, err
+	}
 	if sub.UserID == uuid.Nil {
 		u.logger.Info("there was no user id")
 		sub.UserID = uuid.New()
@@ -41,3 +56,48 @@ func (u *CreateSubUC) NewSub(ctx context.Context, input SubscriptionDTO) (int, e
 	u.logger.Info("subscription created")
 	return int(subId), nil
 }
+
+// NewSubOnce is NewSub retried safely with the idempotency key: a repeat
+// of the request returns the id of the first one and replayed set. The
+// key is checked before a missing user id is generated, so a repeat
+// without one gets the first subscription too. Keys belong to the caller,
+// see keyOwner: the same key of another user is another key.
+func (u *CreateSubUC) NewSubOnce(ctx context.Context, key string, input SubscriptionDTO) (subId int, replayed bool, err error) {
+	sub, err := DTOToSub(input)
+	if err != nil {
+		u.logger.Error("NewSubOnce", "input", input, "error", err)
+		return 0, false, err
+	}
+	if sub.UserID, err = subOwner(ctx, sub.UserID); err != nil {
+		return 0, false, err
+	}
+	hash, err := requestHash(sub)
+	if err != nil {
+		return 0, false, err
+	}
+	idemKey, err := domain.NewIdempotencyKey(keyOwner(ctx, sub.UserID), key, hash, time.Now().Add(u.keyTTL))
+	if err != nil {
+		return 0, false, err
+	}
+	if sub.UserID == uuid.Nil {
+		sub.UserID = uuid.New()
+	}
+	id, replayed, err := u.subR.StoreSubOnce(ctx, *idemKey, sub)
+	if err != nil {
+		u.logger.Error("NewSubOnce", "error", err)
+		return 0, false, err
+	}
+	u.logger.Info("NewSubOnce", "sub_id", id, "replayed", replayed)
+	return int(id), replayed, nil
+}
+
+// requestHash identifies the request of sub for its idempotency key,
+// the same fields give the same hash.
+func requestHash(sub domain.Subscription) (string, error) {
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -22,8 +22,12 @@ func NewDeleteSubUC(subR domain.SubscriptionRepository, logger *logger.LogrusLog
 	return &DeleteSubUC{subR: subR, logger: logger}, nil
 }
 
-func (u *DeleteSubUC) DeleteSub(ctx context.Context, subId int) error {
-	err := u.subR.DeleteSub(ctx, domain.SubID(subId))
+// DeleteSub deletes version of the subscription, zero deletes any.
+func (u *DeleteSubUC) DeleteSub(ctx context.Context, subId int, version int) error {
+	if err := checkSubAccess(ctx, u.subR, domain.SubID(subId)); err != nil {
+		return err
+	}
+	err := u.subR.DeleteSub(ctx, domain.SubID(subId), version)
 	if err != nil {
 		u.logger.WithFields(map[string]interface{}{
 			"subId": subId,
@@ -8,12 +8,32 @@ import (
 )
 
 type SubscriptionDTO struct {
-	SubId       int
-	UserId      uuid.UUID
-	ServiceName string
-	Price       int
-	StartDate   time.Time
-	EndDate     time.Time
+	SubId         int
+	UserId        uuid.UUID
+	ServiceName   string
+	Price         int
+	Currency      string
+	BillingPeriod string
+	StartDate     time.Time
+	EndDate       time.Time
+	// DeletedAt is zero unless the subscription was soft-deleted.
+	DeletedAt time.Time
+	Version   int
+}
+
+// SubscriptionPatchDTO is an update of a subscription: nil fields are
+// left as they are and EndDate pointing to the zero time clears the end
+// date. A non-nil UserId has to be the owner. Version is the version to
+// change, zero for any.
+type SubscriptionPatchDTO struct {
+	UserId        *uuid.UUID
+	ServiceName   *string
+	Price         *int
+	Currency      *string
+	BillingPeriod *string
+	StartDate     *time.Time
+	EndDate       *time.Time
+	Version       int
 }
 
 type SubsFilterDTO struct {
@@ -21,16 +41,21 @@ type SubsFilterDTO struct {
 	EndDate     time.Time
 	UserID      uuid.UUID
 	ServiceName string
+	ProRata     bool
 }
 
 func SubToDTO(sub domain.Subscription) SubscriptionDTO {
 	return SubscriptionDTO{
-		SubId:       int(sub.SubId),
-		UserId:      sub.UserID,
-		ServiceName: sub.ServiceName,
-		Price:       sub.Price,
-		StartDate:   sub.StartDate,
-		EndDate:     sub.EndDate,
+		SubId:         int(sub.SubId),
+		UserId:        sub.UserID,
+		ServiceName:   sub.ServiceName,
+		Price:         sub.Price,
+		Currency:      sub.Currency,
+		BillingPeriod: string(sub.BillingPeriod),
+		StartDate:     sub.StartDate,
+		EndDate:       sub.EndDate,
+		DeletedAt:     sub.DeletedAt,
+		Version:       sub.Version,
 	}
 }
 
@@ -40,6 +65,8 @@ func DTOToSub(dto SubscriptionDTO) (domain.Subscription, error) {
 		dto.UserId,
 		dto.ServiceName,
 		dto.Price,
+		dto.Currency,
+		domain.BillingPeriod(dto.BillingPeriod),
 		dto.StartDate,
 		dto.EndDate,
 	)
@@ -55,6 +82,7 @@ func FilterToDTO(fil domain.SubsFilter) SubsFilterDTO {
 		EndDate:     fil.EndDate,
 		UserID:      fil.UserID,
 		ServiceName: fil.ServiceName,
+		ProRata:     fil.ProRata,
 	}
 }
 
@@ -64,9 +92,235 @@ func DTOToFilter(dto SubsFilterDTO) (domain.SubsFilter, error) {
 		dto.EndDate,
 		dto.UserID,
 		dto.ServiceName,
+		dto.ProRata,
 	)
 	if err != nil {
 		return domain.SubsFilter{}, err
 	}
 	return *f, nil
 }
+
+type SubsListDTO struct {
+	UserID      uuid.UUID
+	ServiceName string
+	MinPrice    int
+	MaxPrice    int
+	ActiveAt    time.Time
+	StartFrom   time.Time
+	StartTo     time.Time
+	EndFrom     time.Time
+	EndTo       time.Time
+	SortBy      string
+	Desc        bool
+	Limit       int
+	Offset      int
+	After       *domain.SubsCursor
+	// IncludeDeleted lists the soft-deleted subscriptions too.
+	IncludeDeleted bool
+	// NoTotal leaves Total of the page 0 instead of counting the matches.
+	NoTotal bool
+}
+
+type SubsPageDTO struct {
+	Subs  []SubscriptionDTO
+	Next  *domain.SubsCursor
+	Total int
+}
+
+func DTOToListQuery(dto SubsListDTO) (domain.SubsListQuery, error) {
+	q, err := domain.NewSubsListQuery(
+		domain.SubsListFilter{
+			UserID:         dto.UserID,
+			ServiceName:    domain.NormalizeServiceName(dto.ServiceName),
+			MinPrice:       dto.MinPrice,
+			MaxPrice:       dto.MaxPrice,
+			ActiveAt:       dto.ActiveAt,
+			StartFrom:      dto.StartFrom,
+			StartTo:        dto.StartTo,
+			EndFrom:        dto.EndFrom,
+			EndTo:          dto.EndTo,
+			IncludeDeleted: dto.IncludeDeleted,
+		},
+		domain.SubsSortField(dto.SortBy),
+		dto.Desc,
+		dto.Limit,
+		dto.Offset,
+		dto.After,
+	)
+	if err != nil {
+		return domain.SubsListQuery{}, err
+	}
+	q.NoTotal = dto.NoTotal
+	return *q, nil
+}
+
+func PageToDTO(page domain.SubsPage) SubsPageDTO {
+	subs := make([]SubscriptionDTO, 0, len(page.Subs))
+	for _, s := range page.Subs {
+		subs = append(subs, SubToDTO(s))
+	}
+	return SubsPageDTO{
+		Subs:  subs,
+		Next:  page.Next,
+		Total: page.Total,
+	}
+}
+
+// CostsDTO is a cost converted into Currency with the exchange rates
+// from the currencies of the subscriptions.
+type CostsDTO struct {
+	Total    float64
+	Currency string
+	Rates    map[string]float64
+	SubIds   []int
+}
+
+type CostsGroupDTO struct {
+	Key    string
+	Total  float64
+	SubIds []int
+}
+
+func subIdsToInts(ids []domain.SubID) []int {
+	res := make([]int, 0, len(ids))
+	for _, s := range ids {
+		res = append(res, int(s))
+	}
+	return res
+}
+
+type SubCostDTO struct {
+	SubId    int
+	Amount   int
+	Currency string
+}
+
+type MonthCostsDTO struct {
+	Month time.Time
+	// Total is in the currency of the series.
+	Total float64
+	Subs  []SubCostDTO
+}
+
+type TimeSeriesDTO struct {
+	Total    float64
+	Currency string
+	Rates    map[string]float64
+	Months   []MonthCostsDTO
+}
+
+// ImportRowInputDTO is a row to import or the error it could not be
+// read with.
+type ImportRowInputDTO struct {
+	Sub SubscriptionDTO
+	Err error
+}
+
+// RowResultDTO is the id of a written row of an import or a batch, or
+// the error of the row. Valid rows have no id when nothing was written.
+type RowResultDTO struct {
+	SubId int
+	Err   error
+}
+
+type ImportDTO struct {
+	Rows      []RowResultDTO
+	Mode      string
+	DryRun    bool
+	Imported  int
+	Failed    int
+	Committed bool
+}
+
+// DTOToSubUpdate checks an update of subId without the current
+// subscription.
+func DTOToSubUpdate(subId int, dto SubscriptionPatchDTO) (domain.SubUpdate, error) {
+	upd := domain.SubUpdate{
+		SubId:       domain.SubID(subId),
+		UserID:      dto.UserId,
+		ServiceName: dto.ServiceName,
+		Price:       dto.Price,
+		Currency:    dto.Currency,
+		StartDate:   dto.StartDate,
+		EndDate:     dto.EndDate,
+		Version:     dto.Version,
+	}
+	if dto.BillingPeriod != nil {
+		period := domain.BillingPeriod(*dto.BillingPeriod)
+		upd.BillingPeriod = &period
+	}
+	checked, err := domain.NewSubscriptionUpdate(upd)
+	if err != nil {
+		return domain.SubUpdate{}, err
+	}
+	return *checked, nil
+}
+
+// SubOpDTO is an operation of a batch: Sub is the subscription to
+// create, SubId the one to update with Patch or to delete. A non-zero
+// Version is the one the update or delete expects. Err is the error it
+// could not be read with.
+type SubOpDTO struct {
+	Op      string
+	SubId   int
+	Sub     SubscriptionDTO
+	Patch   SubscriptionPatchDTO
+	Version int
+	Err     error
+}
+
+// BatchDTO holds the outcome of every operation of a batch, in their
+// order.
+type BatchDTO struct {
+	Rows      []RowResultDTO
+	Mode      string
+	Applied   int
+	Failed    int
+	Committed bool
+}
+
+// AuditEntryDTO is a change of a subscription, Old is nil for creations.
+type AuditEntryDTO struct {
+	Id        int64
+	SubId     int
+	UserId    uuid.UUID
+	Action    string
+	Actor     string
+	RequestId string
+	Old       *SubscriptionDTO
+	New       *SubscriptionDTO
+	At        time.Time
+}
+
+type AuditQueryDTO struct {
+	UserID  uuid.UUID
+	From    time.Time
+	To      time.Time
+	AfterId int64
+	Limit   int
+}
+
+func AuditEntriesToDTO(entries []domain.AuditEntry) []AuditEntryDTO {
+	res := make([]AuditEntryDTO, 0, len(entries))
+	for _, e := range entries {
+		dto := AuditEntryDTO{
+			Id:        e.Id,
+			SubId:     int(e.SubId),
+			UserId:    e.UserID,
+			Action:    string(e.Action),
+			Actor:     e.Actor,
+			RequestId: e.RequestID,
+			At:        e.At,
+		}
+		if e.Old != nil {
+			old := SubToDTO(*e.Old)
+			dto.Old = &old
+		}
+		if e.New != nil {
+			cur := SubToDTO(*e.New)
+			dto.New = &cur
+		}
+		res = append(res, dto)
+	}
+	return res
+}
@@ -2,6 +2,7 @@ package usecase
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/samantonio28/subscriber-inf/internal/domain"
 	"github.com/samantonio28/subscriber-inf/internal/logger"
@@ -22,13 +23,16 @@ func NewGetSubUC(subR domain.SubscriptionRepository, logger *logger.LogrusLogger
 	return &GetSubUC{subR: subR, logger: logger}, nil
 }
 
-func (u *GetSubUC) SubById(ctx context.Context, subId int) (SubscriptionDTO, error) {
+func (u *GetSubUC) SubById(ctx context.Context, subId int, includeDeleted bool) (SubscriptionDTO, error) {
 	u.logger.Info("getting subscription by id", subId)
-	sub, err := u.subR.Sub(ctx, domain.SubID(subId))
+	sub, err := u.subR.Sub(ctx, domain.SubID(subId), includeDeleted)
 	if err != nil {
 		u.logger.Error("error getting subscription by id", subId, err)
 		return SubscriptionDTO{}, err
 	}
+	if own, ok := domain.RestrictedTo(ctx); ok && sub.UserID != own {
+		return SubscriptionDTO{}, fmt.Errorf("subscription %d: %w", subId, domain.ErrNotFound)
+	}
 	u.logger.Info("got subscription by id", subId, ": ", sub)
 	return SubToDTO(sub), nil
 }
@@ -23,9 +23,12 @@ func NewGetSubsUC(subR domain.SubscriptionRepository, logger *logger.LogrusLogge
 	return &GetSubsUC{subR: subR, logger: logger}, nil
 }
 
-func (u *GetSubsUC) SubsByUserId(ctx context.Context, userId uuid.UUID) ([]SubscriptionDTO, error) {
+func (u *GetSubsUC) SubsByUserId(ctx context.Context, userId uuid.UUID, includeDeleted bool) ([]SubscriptionDTO, error) {
 	u.logger.Info("getting subscriptions by user id", userId)
-	subs, err := u.subR.UserSubs(ctx, userId)
+	if _, err := scopeUser(ctx, userId); err != nil {
+		return nil, err
+	}
+	subs, err := u.subR.UserSubs(ctx, userId, includeDeleted)
 	if err != nil {
 		u.logger.Error("error getting subscriptions by user id", userId, err)
 		return nil, err
@@ -0,0 +1,85 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/logger"
+)
+
+type ImportSubsUC struct {
+	subR   domain.SubscriptionRepository
+	logger *logger.LogrusLogger
+}
+
+func NewImportSubsUC(subR domain.SubscriptionRepository, logger *logger.LogrusLogger) (*ImportSubsUC, error) {
+	if subR == nil {
+		return nil, domain.ErrInvalidSubRepo
+	}
+	if logger == nil {
+		return nil, domain.ErrInvalidLogger
+	}
+	return &ImportSubsUC{subR: subR, logger: logger}, nil
+}
+
+// ImportSubs stores the rows in one transaction. Rows that came with
+// an error fail the same way as the invalid ones. Nothing is stored on
+// a dry run or, in all-or-nothing mode, when any row fails. Empty mode
+// is all-or-nothing.
+func (u *ImportSubsUC) ImportSubs(ctx context.Context, input []ImportRowInputDTO, mode string, dryRun bool) (ImportDTO, error) {
+	txMode := domain.TxMode(mode)
+	if mode == "" {
+		txMode = domain.TxAllOrNothing
+	}
+	if !txMode.Valid() {
+		return ImportDTO{}, domain.NewValidationError("mode", "must be all_or_nothing or best_effort")
+	}
+
+	res := ImportDTO{Rows: make([]RowResultDTO, len(input)), Mode: string(txMode), DryRun: dryRun}
+	subs := make([]domain.Subscription, 0, len(input))
+	rows := make([]int, 0, len(input))
+	for i, in := range input {
+		if in.Err != nil {
+			res.Rows[i].Err = in.Err
+			continue
+		}
+		sub, err := DTOToSub(in.Sub)
+		if err != nil {
+			res.Rows[i].Err = err
+			continue
+		}
+		if sub.UserID, err = subOwner(ctx, sub.UserID); err != nil {
+			res.Rows[i].Err = err
+			continue
+		}
+		if sub.UserID == uuid.Nil {
+			sub.UserID = uuid.New()
+		}
+		subs = append(subs, sub)
+		rows = append(rows, i)
+	}
+	failedBefore := len(input) - len(subs)
+
+	// A failed row already rules out writing in all-or-nothing mode,
+	// the others are still checked against the repository.
+	check := dryRun || (failedBefore > 0 && txMode == domain.TxAllOrNothing)
+	stored, err := u.subR.StoreSubs(ctx, subs, txMode, check)
+	if err != nil {
+		u.logger.Error("ImportSubs", "rows", len(input), "error", err)
+		return ImportDTO{}, err
+	}
+	for i, r := range stored {
+		res.Rows[rows[i]] = RowResultDTO{SubId: int(r.SubId), Err: r.Err}
+	}
+	for _, r := range res.Rows {
+		if r.Err != nil {
+			res.Failed++
+		} else if r.SubId != 0 {
+			res.Imported++
+		}
+	}
+	res.Committed = res.Imported > 0
+	u.logger.Info("ImportSubs", "rows", len(input), "imported", res.Imported, "failed", res.Failed, "mode", txMode, "dry_run", dryRun)
+	return res, nil
+}
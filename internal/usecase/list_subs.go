@@ -0,0 +1,58 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/logger"
+)
+
+type ListSubsUC struct {
+	subR   domain.SubscriptionRepository
+	logger *logger.LogrusLogger
+}
+
+func NewListSubsUC(subR domain.SubscriptionRepository, logger *logger.LogrusLogger) (*ListSubsUC, error) {
+	if subR == nil {
+		return nil, domain.ErrInvalidSubRepo
+	}
+	if logger == nil {
+		return nil, domain.ErrInvalidLogger
+	}
+	return &ListSubsUC{subR: subR, logger: logger}, nil
+}
+
+// ListSubs lists the subscriptions of every user, for admins only.
+func (u *ListSubsUC) ListSubs(ctx context.Context, input SubsListDTO) (SubsPageDTO, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return SubsPageDTO{}, err
+	}
+	return u.list(ctx, input)
+}
+
+// ExportSubs lists the subscriptions of an export, restricted callers
+// get only their own.
+func (u *ListSubsUC) ExportSubs(ctx context.Context, input SubsListDTO) (SubsPageDTO, error) {
+	return u.list(ctx, input)
+}
+
+func (u *ListSubsUC) list(ctx context.Context, input SubsListDTO) (SubsPageDTO, error) {
+	u.logger.Info("ListSubs", "input", input)
+	var err error
+	if input.UserID, err = scopeUser(ctx, input.UserID); err != nil {
+		return SubsPageDTO{}, err
+	}
+	q, err := DTOToListQuery(input)
+	if err != nil {
+		u.logger.Error("ListSubs", "input", input, "error", err)
+		return SubsPageDTO{}, err
+	}
+
+	page, err := u.subR.ListSubs(ctx, q)
+	if err != nil {
+		u.logger.Error("ListSubs", "input", input, "error", err)
+		return SubsPageDTO{}, err
+	}
+	u.logger.Info("ListSubs", "input", input, "got", len(page.Subs), "total", page.Total)
+	return PageToDTO(page), nil
+}
@@ -0,0 +1,53 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/logger"
+)
+
+type PurgeKeysUC struct {
+	subR   domain.SubscriptionRepository
+	logger *logger.LogrusLogger
+}
+
+// NewPurgeKeysUC returns a use case removing the expired idempotency
+// keys. Expired keys never replay, the purge only keeps their table
+// small.
+func NewPurgeKeysUC(subR domain.SubscriptionRepository, logger *logger.LogrusLogger) (*PurgeKeysUC, error) {
+	if subR == nil {
+		return nil, domain.ErrInvalidSubRepo
+	}
+	if logger == nil {
+		return nil, domain.ErrInvalidLogger
+	}
+	return &PurgeKeysUC{subR: subR, logger: logger}, nil
+}
+
+// Purge removes the keys expired before now and returns their number.
+func (u *PurgeKeysUC) Purge(ctx context.Context, now time.Time) (int, error) {
+	purged, err := u.subR.PurgeIdempotencyKeys(ctx, now)
+	if err != nil {
+		u.logger.Error("PurgeIdempotencyKeys", "error", err)
+		return 0, err
+	}
+	u.logger.Info("PurgeIdempotencyKeys", "purged", purged)
+	return purged, nil
+}
+
+// Run purges every interval until ctx is done, starting right away.
+func (u *PurgeKeysUC) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// Failures are logged by Purge, the next tick retries.
+		_, _ = u.Purge(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/logger"
+)
+
+type PurgeSubsUC struct {
+	subR      domain.SubscriptionRepository
+	logger    *logger.LogrusLogger
+	retention time.Duration
+}
+
+// NewPurgeSubsUC returns a use case removing the subscriptions deleted
+// more than retention ago.
+func NewPurgeSubsUC(subR domain.SubscriptionRepository, logger *logger.LogrusLogger, retention time.Duration) (*PurgeSubsUC, error) {
+	if subR == nil {
+		return nil, domain.ErrInvalidSubRepo
+	}
+	if logger == nil {
+		return nil, domain.ErrInvalidLogger
+	}
+	if retention <= 0 {
+		return nil, domain.NewValidationError("retention", "must be positive")
+	}
+	return &PurgeSubsUC{subR: subR, logger: logger, retention: retention}, nil
+}
+
+// Purge removes the subscriptions deleted before now minus the
+// retention and returns their number.
+func (u *PurgeSubsUC) Purge(ctx context.Context, now time.Time) (int, error) {
+	purged, err := u.subR.PurgeSubs(ctx, now.Add(-u.retention))
+	if err != nil {
+		u.logger.Error("PurgeSubs", "retention", u.retention, "error", err)
+		return 0, err
+	}
+	u.logger.Info("PurgeSubs", "retention", u.retention, "purged", purged)
+	return purged, nil
+}
+
+// Run purges every interval until ctx is done, starting right away.
+func (u *PurgeSubsUC) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// Failures are logged by Purge, the next tick retries.
+		_, _ = u.Purge(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
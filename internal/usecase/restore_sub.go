@@ -0,0 +1,41 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/logger"
+)
+
+type RestoreSubUC struct {
+	subR   domain.SubscriptionRepository
+	logger *logger.LogrusLogger
+}
+
+func NewRestoreSubUC(subR domain.SubscriptionRepository, logger *logger.LogrusLogger) (*RestoreSubUC, error) {
+	if subR == nil {
+		return nil, domain.ErrInvalidSubRepo
+	}
+	if logger == nil {
+		return nil, domain.ErrInvalidLogger
+	}
+	return &RestoreSubUC{subR: subR, logger: logger}, nil
+}
+
+// RestoreSub brings back a soft-deleted subscription and returns it.
+func (u *RestoreSubUC) RestoreSub(ctx context.Context, subId int) (SubscriptionDTO, error) {
+	if err := checkSubAccess(ctx, u.subR, domain.SubID(subId)); err != nil {
+		return SubscriptionDTO{}, err
+	}
+	if err := u.subR.RestoreSub(ctx, domain.SubID(subId)); err != nil {
+		u.logger.Error("error restoring subscription", subId, err)
+		return SubscriptionDTO{}, err
+	}
+	sub, err := u.subR.Sub(ctx, domain.SubID(subId), false)
+	if err != nil {
+		u.logger.Error("error getting restored subscription", subId, err)
+		return SubscriptionDTO{}, err
+	}
+	u.logger.Info("subscription restored:", subId)
+	return SubToDTO(sub), nil
+}
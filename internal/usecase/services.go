@@ -0,0 +1,213 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/logger"
+)
+
+// ServiceDTO is a service of the catalog, empty DefaultCurrency means
+// it has no default price.
+type ServiceDTO struct {
+	Id              int
+	Name            string
+	DisplayName     string
+	Category        string
+	DefaultPrice    int
+	DefaultCurrency string
+	SubsCount       int
+}
+
+func ServiceToDTO(svc domain.Service) ServiceDTO {
+	return ServiceDTO{
+		Id:              int(svc.Id),
+		Name:            svc.Name,
+		DisplayName:     svc.DisplayName,
+		Category:        svc.Category,
+		DefaultPrice:    svc.DefaultPrice,
+		DefaultCurrency: svc.DefaultCurrency,
+		SubsCount:       svc.SubsCount,
+	}
+}
+
+func DTOToService(dto ServiceDTO) (domain.Service, error) {
+	svc, err := domain.NewService(
+		domain.ServiceID(dto.Id),
+		dto.Name,
+		dto.DisplayName,
+		dto.Category,
+		dto.DefaultPrice,
+		dto.DefaultCurrency,
+	)
+	if err != nil {
+		return domain.Service{}, err
+	}
+	return *svc, nil
+}
+
+// ServicesUC manages the service catalog. Everybody reads it, only
+// admins change it.
+type ServicesUC struct {
+	servR  domain.ServiceRepository
+	logger *logger.LogrusLogger
+}
+
+func NewServicesUC(servR domain.ServiceRepository, logger *logger.LogrusLogger) (*ServicesUC, error) {
+	if servR == nil {
+		return nil, domain.ErrInvalidServiceRepo
+	}
+	if logger == nil {
+		return nil, domain.ErrInvalidLogger
+	}
+	return &ServicesUC{servR: servR, logger: logger}, nil
+}
+
+func (u *ServicesUC) Service(ctx context.Context, id int) (ServiceDTO, error) {
+	svc, err := u.servR.Service(ctx, domain.ServiceID(id))
+	if err != nil {
+		u.logger.Error("Service", "id", id, "error", err)
+		return ServiceDTO{}, err
+	}
+	return ServiceToDTO(svc), nil
+}
+
+func (u *ServicesUC) Services(ctx context.Context, category string) ([]ServiceDTO, error) {
+	services, err := u.servR.Services(ctx, category)
+	if err != nil {
+		u.logger.Error("Services", "category", category, "error", err)
+		return nil, err
+	}
+	res := make([]ServiceDTO, 0, len(services))
+	for _, svc := range services {
+		res = append(res, ServiceToDTO(svc))
+	}
+	return res, nil
+}
+
+// SearchServices finds the services a client may mean by query, for
+// autocomplete. A zero limit is the default one.
+func (u *ServicesUC) SearchServices(ctx context.Context, query string, limit int) ([]ServiceDTO, error) {
+	search, err := domain.NewServiceSearch(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	services, err := u.servR.SearchServices(ctx, *search)
+	if err != nil {
+		u.logger.Error("SearchServices", "query", search.Query, "error", err)
+		return nil, err
+	}
+	res := make([]ServiceDTO, 0, len(services))
+	for _, svc := range services {
+		res = append(res, ServiceToDTO(svc))
+	}
+	return res, nil
+}
+
+func (u *ServicesUC) NewService(ctx context.Context, input ServiceDTO) (int, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return 0, err
+	}
+	input.Id = 0
+	svc, err := DTOToService(input)
+	if err != nil {
+		return 0, err
+	}
+	id, err := u.servR.StoreService(ctx, svc)
+	if err != nil {
+		u.logger.Error("NewService", "input", input, "error", err)
+		return 0, err
+	}
+	u.logger.Info("NewService", "id", id)
+	return int(id), nil
+}
+
+// UpdateService replaces the fields of service id with input, a new
+// name renames the service.
+func (u *ServicesUC) UpdateService(ctx context.Context, id int, input ServiceDTO) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	input.Id = id
+	svc, err := DTOToService(input)
+	if err != nil {
+		return err
+	}
+	if err := u.servR.UpdateService(ctx, svc); err != nil {
+		u.logger.Error("UpdateService", "input", input, "error", err)
+		return err
+	}
+	u.logger.Info("UpdateService", "id", id)
+	return nil
+}
+
+func (u *ServicesUC) DeleteService(ctx context.Context, id int) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	if err := u.servR.DeleteService(ctx, domain.ServiceID(id)); err != nil {
+		u.logger.Error("DeleteService", "id", id, "error", err)
+		return err
+	}
+	u.logger.Info("DeleteService", "id", id)
+	return nil
+}
+
+// MergeServices moves the subscriptions of from to into, deletes from
+// and returns into with the number of the moved subscriptions. The name
+// of from becomes an alias of into.
+func (u *ServicesUC) MergeServices(ctx context.Context, from, into int) (ServiceDTO, int, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return ServiceDTO{}, 0, err
+	}
+	moved, err := u.servR.MergeServices(ctx, domain.ServiceID(from), domain.ServiceID(into))
+	if err != nil {
+		u.logger.Error("MergeServices", "from", from, "into", into, "error", err)
+		return ServiceDTO{}, 0, err
+	}
+	u.logger.Info("MergeServices", "from", from, "into", into, "moved", moved)
+	svc, err := u.Service(ctx, into)
+	return svc, moved, err
+}
+
+func (u *ServicesUC) ServiceAliases(ctx context.Context, id int) ([]string, error) {
+	aliases, err := u.servR.ServiceAliases(ctx, domain.ServiceID(id))
+	if err != nil {
+		u.logger.Error("ServiceAliases", "id", id, "error", err)
+		return nil, err
+	}
+	return aliases, nil
+}
+
+// NewServiceAlias adds an alias of service id and returns it normalized.
+func (u *ServicesUC) NewServiceAlias(ctx context.Context, id int, alias string) (string, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return "", err
+	}
+	a, err := domain.NewServiceAlias(domain.ServiceID(id), alias)
+	if err != nil {
+		return "", err
+	}
+	if err := u.servR.StoreServiceAlias(ctx, *a); err != nil {
+		u.logger.Error("NewServiceAlias", "id", id, "alias", a.Alias, "error", err)
+		return "", err
+	}
+	u.logger.Info("NewServiceAlias", "id", id, "alias", a.Alias)
+	return a.Alias, nil
+}
+
+func (u *ServicesUC) DeleteServiceAlias(ctx context.Context, id int, alias string) error {
+	if err := requireAdmin(ctx); err != nil {
+		return err
+	}
+	a, err := domain.NewServiceAlias(domain.ServiceID(id), alias)
+	if err != nil {
+		return err
+	}
+	if err := u.servR.DeleteServiceAlias(ctx, *a); err != nil {
+		u.logger.Error("DeleteServiceAlias", "id", id, "alias", a.Alias, "error", err)
+		return err
+	}
+	u.logger.Info("DeleteServiceAlias", "id", id, "alias", a.Alias)
+	return nil
+}
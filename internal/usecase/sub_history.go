@@ -0,0 +1,45 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/logger"
+)
+
+type SubHistoryUC struct {
+	subR   domain.SubscriptionRepository
+	logger *logger.LogrusLogger
+}
+
+func NewSubHistoryUC(subR domain.SubscriptionRepository, logger *logger.LogrusLogger) (*SubHistoryUC, error) {
+	if subR == nil {
+		return nil, domain.ErrInvalidSubRepo
+	}
+	if logger == nil {
+		return nil, domain.ErrInvalidLogger
+	}
+	return &SubHistoryUC{subR: subR, logger: logger}, nil
+}
+
+// SubHistory returns the changes of a subscription, the oldest first.
+// The history outlives a purged subscription, so its owner is the one
+// of the entries.
+func (u *SubHistoryUC) SubHistory(ctx context.Context, subId int) ([]AuditEntryDTO, error) {
+	entries, err := u.subR.SubHistory(ctx, domain.SubID(subId))
+	if err != nil {
+		u.logger.Error("SubHistory", "sub_id", subId, "error", err)
+		return nil, err
+	}
+	if len(entries) == 0 {
+		// Stored before the audit log, the subscription is still there.
+		if err := checkSubAccess(ctx, u.subR, domain.SubID(subId)); err != nil {
+			return nil, err
+		}
+	} else if own, ok := domain.RestrictedTo(ctx); ok && entries[0].UserID != own {
+		return nil, fmt.Errorf("subscription %d: %w", subId, domain.ErrNotFound)
+	}
+	u.logger.Info("SubHistory", "sub_id", subId, "got", len(entries))
+	return AuditEntriesToDTO(entries), nil
+}
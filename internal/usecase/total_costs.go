@@ -2,6 +2,9 @@ package usecase
 
 import (
 	"context"
+	"math"
+	"sort"
+	"time"
 
 	"github.com/samantonio28/subscriber-inf/internal/domain"
 	"github.com/samantonio28/subscriber-inf/internal/logger"
@@ -9,36 +12,219 @@ import (
 
 type TotalCostsUC struct {
 	subR   domain.SubscriptionRepository
+	rates  domain.RateProvider
 	logger *logger.LogrusLogger
 }
 
-func NewTotalCostsUC(subR domain.SubscriptionRepository, logger *logger.LogrusLogger) (*TotalCostsUC, error) {
+func NewTotalCostsUC(subR domain.SubscriptionRepository, rates domain.RateProvider, logger *logger.LogrusLogger) (*TotalCostsUC, error) {
 	if subR == nil {
 		return nil, domain.ErrInvalidSubRepo
 	}
+	if rates == nil {
+		return nil, domain.ErrInvalidRateProvider
+	}
 	if logger == nil {
 		return nil, domain.ErrInvalidLogger
 	}
-	return &TotalCostsUC{subR: subR, logger: logger}, nil
+	return &TotalCostsUC{subR: subR, rates: rates, logger: logger}, nil
+}
+
+// converter converts amounts into one currency and keeps the rates it used.
+type converter struct {
+	rates domain.RateProvider
+	to    string
+	used  map[string]float64
+}
+
+func (u *TotalCostsUC) newConverter(currency string) (*converter, error) {
+	if currency == "" {
+		currency = domain.DefaultCurrency
+	}
+	if !domain.ValidCurrency(currency) {
+		return nil, domain.NewValidationError("currency", "unsupported currency "+currency)
+	}
+	return &converter{rates: u.rates, to: currency, used: make(map[string]float64)}, nil
+}
+
+func (c *converter) convert(ctx context.Context, amount int, from string) (float64, error) {
+	rate, ok := c.used[from]
+	if !ok {
+		var err error
+		if rate, err = c.rates.Rate(ctx, from, c.to); err != nil {
+			return 0, err
+		}
+		c.used[from] = rate
+	}
+	return float64(amount) * rate, nil
+}
+
+// roundCents rounds a converted amount to hundredths.
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
 }
 
-func (u *TotalCostsUC) TotalCosts(ctx context.Context, input SubsFilterDTO) (int, []int, error) {
-	u.logger.Info("TotalCosts", "input", input)
+// TotalCosts sums the costs converted into currency, the default one if
+// empty. The costs of a restricted caller are the ones of its user.
+func (u *TotalCostsUC) TotalCosts(ctx context.Context, input SubsFilterDTO, currency string) (CostsDTO, error) {
+	u.logger.Info("TotalCosts", "input", input, "currency", currency)
+	conv, err := u.newConverter(currency)
+	if err != nil {
+		u.logger.Error("TotalCosts", "input", input, "error", err)
+		return CostsDTO{}, err
+	}
+	if input.UserID, err = scopeUser(ctx, input.UserID); err != nil {
+		return CostsDTO{}, err
+	}
 	f, err := DTOToFilter(input)
 	if err != nil {
 		u.logger.Error("TotalCosts", "input", input, "error", err)
-		return 0, nil, err
+		return CostsDTO{}, err
 	}
 
-	sum, subIds, err := u.subR.SubsTotalCosts(ctx, f)
+	totals, subIds, err := u.subR.SubsTotalCosts(ctx, f)
 	if err != nil {
 		u.logger.Error("TotalCosts", "input", input, "error", err)
-		return 0, nil, err
+		return CostsDTO{}, err
+	}
+	var sum float64
+	for from, amount := range totals {
+		converted, err := conv.convert(ctx, amount, from)
+		if err != nil {
+			u.logger.Error("TotalCosts", "input", input, "error", err)
+			return CostsDTO{}, err
+		}
+		sum += converted
+	}
+	res := CostsDTO{
+		Total:    roundCents(sum),
+		Currency: conv.to,
+		Rates:    conv.used,
+		SubIds:   subIdsToInts(subIds),
+	}
+	u.logger.Info("TotalCosts", "input", input, "output", res.Total, "subIds len", len(res.SubIds))
+	return res, nil
+}
+
+// CostsByGroup breaks the costs down by groupBy, converting them into
+// currency. The total is the sum of the groups rather than a query of
+// its own, so both come from one snapshot and always agree.
+func (u *TotalCostsUC) CostsByGroup(ctx context.Context, input SubsFilterDTO, groupBy, currency string) (CostsDTO, []CostsGroupDTO, error) {
+	u.logger.Info("CostsByGroup", "input", input, "groupBy", groupBy, "currency", currency)
+	by := domain.CostsGroupBy(groupBy)
+	if by == domain.GroupByNone || !by.Valid() {
+		err := domain.NewValidationError("group_by", "must be one of service, user, month")
+		u.logger.Error("CostsByGroup", "input", input, "error", err)
+		return CostsDTO{}, nil, err
+	}
+	conv, err := u.newConverter(currency)
+	if err != nil {
+		u.logger.Error("CostsByGroup", "input", input, "error", err)
+		return CostsDTO{}, nil, err
+	}
+	if input.UserID, err = scopeUser(ctx, input.UserID); err != nil {
+		return CostsDTO{}, nil, err
+	}
+	f, err := DTOToFilter(input)
+	if err != nil {
+		u.logger.Error("CostsByGroup", "input", input, "error", err)
+		return CostsDTO{}, nil, err
+	}
+
+	groups, err := u.subR.SubsCostsByGroup(ctx, f, by)
+	if err != nil {
+		u.logger.Error("CostsByGroup", "input", input, "error", err)
+		return CostsDTO{}, nil, err
+	}
+	// Groups of one key in different currencies come one after another.
+	var sum float64
+	subIds := make(map[int]struct{})
+	dto := make([]CostsGroupDTO, 0, len(groups))
+	for _, g := range groups {
+		converted, err := conv.convert(ctx, g.Total, g.Currency)
+		if err != nil {
+			u.logger.Error("CostsByGroup", "input", input, "error", err)
+			return CostsDTO{}, nil, err
+		}
+		sum += converted
+		for _, id := range g.SubIds {
+			subIds[int(id)] = struct{}{}
+		}
+		if n := len(dto); n > 0 && dto[n-1].Key == g.Key {
+			dto[n-1].Total += converted
+			dto[n-1].SubIds = append(dto[n-1].SubIds, subIdsToInts(g.SubIds)...)
+			sort.Ints(dto[n-1].SubIds)
+			continue
+		}
+		dto = append(dto, CostsGroupDTO{Key: g.Key, Total: converted, SubIds: subIdsToInts(g.SubIds)})
+	}
+	for i := range dto {
+		dto[i].Total = roundCents(dto[i].Total)
+	}
+	total := CostsDTO{
+		Total:    roundCents(sum),
+		Currency: conv.to,
+		Rates:    conv.used,
+		SubIds:   make([]int, 0, len(subIds)),
+	}
+	for id := range subIds {
+		total.SubIds = append(total.SubIds, id)
+	}
+	sort.Ints(total.SubIds)
+	u.logger.Info("CostsByGroup", "input", input, "output", total.Total, "groups", len(dto))
+	return total, dto, nil
+}
+
+// TimeSeries returns costs for every month of the period,
+// months without charges included. Month totals are converted into
+// currency, charges of subscriptions stay in their own currencies.
+func (u *TotalCostsUC) TimeSeries(ctx context.Context, input SubsFilterDTO, currency string) (TimeSeriesDTO, error) {
+	u.logger.Info("TimeSeries", "input", input, "currency", currency)
+	conv, err := u.newConverter(currency)
+	if err != nil {
+		u.logger.Error("TimeSeries", "input", input, "error", err)
+		return TimeSeriesDTO{}, err
+	}
+	if input.UserID, err = scopeUser(ctx, input.UserID); err != nil {
+		return TimeSeriesDTO{}, err
+	}
+	f, err := DTOToFilter(input)
+	if err != nil {
+		u.logger.Error("TimeSeries", "input", input, "error", err)
+		return TimeSeriesDTO{}, err
+	}
+
+	months, err := u.subR.SubsMonthlyCosts(ctx, f)
+	if err != nil {
+		u.logger.Error("TimeSeries", "input", input, "error", err)
+		return TimeSeriesDTO{}, err
+	}
+	byMonth := make(map[time.Time]domain.MonthCosts, len(months))
+	for _, mc := range months {
+		byMonth[mc.Month] = mc
+	}
+
+	series := TimeSeriesDTO{
+		Currency: conv.to,
+		Rates:    conv.used,
+		Months:   make([]MonthCostsDTO, 0, len(months)),
 	}
-	subIdsI := make([]int, 0, len(subIds))
-	for _, s := range subIds {
-		subIdsI = append(subIdsI, int(s))
+	first := time.Date(f.StartDate.Year(), f.StartDate.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for m := first; m.Before(f.PeriodEnd()); m = m.AddDate(0, 1, 0) {
+		mc := MonthCostsDTO{Month: m, Subs: make([]SubCostDTO, 0, len(byMonth[m].Subs))}
+		for _, c := range byMonth[m].Subs {
+			converted, err := conv.convert(ctx, c.Amount, c.Currency)
+			if err != nil {
+				u.logger.Error("TimeSeries", "input", input, "error", err)
+				return TimeSeriesDTO{}, err
+			}
+			mc.Total += converted
+			mc.Subs = append(mc.Subs, SubCostDTO{SubId: int(c.SubId), Amount: c.Amount, Currency: c.Currency})
+		}
+		series.Total += mc.Total
+		mc.Total = roundCents(mc.Total)
+		series.Months = append(series.Months, mc)
 	}
-	u.logger.Info("TotalCosts", "input", input, "output", sum, "subIds len", len(subIdsI))
-	return sum, subIdsI, nil
+	series.Total = roundCents(series.Total)
+	u.logger.Info("TimeSeries", "input", input, "months", len(series.Months))
+	return series, nil
 }
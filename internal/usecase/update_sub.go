@@ -22,25 +22,18 @@ func NewUpdateSubUC(subR domain.SubscriptionRepository, logger *logger.LogrusLog
 	return &UpdateSubUC{subR: subR, logger: logger}, nil
 }
 
-func (u *UpdateSubUC) UpdateSub(ctx context.Context, subId int, input SubscriptionDTO) error {
+// UpdateSub writes the given fields of input. The repository checks the
+// result against the current subscription under its lock.
+func (u *UpdateSubUC) UpdateSub(ctx context.Context, subId int, input SubscriptionPatchDTO) error {
 	u.logger.Info("Updating subscription", subId)
-	subToCheck, err := u.subR.Sub(ctx, domain.SubID(subId))
+	s, err := DTOToSubUpdate(subId, input)
 	if err != nil {
-		u.logger.Error("not exists:", subId, err)
+		u.logger.Error("invalid input:", input, err)
 		return err
 	}
-	if input.StartDate.IsZero() {
-		input.StartDate = subToCheck.StartDate
-	}
-	if input.ServiceName == " " {
-		input.ServiceName = subToCheck.ServiceName
-	}
-	s, err := DTOToSub(input)
-	if err != nil {
-		u.logger.Error("invalid input:", input, err)
+	if err := checkSubAccess(ctx, u.subR, s.SubId); err != nil {
 		return err
 	}
-	s.SubId = domain.SubID(subId)
 	err = u.subR.UpdateSub(ctx, s)
 	if err != nil {
 		u.logger.Error("error updating subscription:", subId, err)
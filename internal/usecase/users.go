@@ -0,0 +1,150 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samantonio28/subscriber-inf/internal/domain"
+	"github.com/samantonio28/subscriber-inf/internal/logger"
+)
+
+type UserDTO struct {
+	Id        uuid.UUID
+	Name      string
+	Email     string
+	Metadata  map[string]string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func UserToDTO(u domain.User) UserDTO {
+	return UserDTO{
+		Id:        u.Id,
+		Name:      u.Name,
+		Email:     u.Email,
+		Metadata:  u.Metadata,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+	}
+}
+
+func DTOToUser(dto UserDTO) (domain.User, error) {
+	u, err := domain.NewUser(dto.Id, dto.Name, dto.Email, dto.Metadata)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return *u, nil
+}
+
+// UsersUC manages the users and their profiles. A restricted caller
+// manages its own profile only.
+type UsersUC struct {
+	userR  domain.UserRepository
+	logger *logger.LogrusLogger
+}
+
+func NewUsersUC(userR domain.UserRepository, logger *logger.LogrusLogger) (*UsersUC, error) {
+	if userR == nil {
+		return nil, domain.ErrInvalidUserRepo
+	}
+	if logger == nil {
+		return nil, domain.ErrInvalidLogger
+	}
+	return &UsersUC{userR: userR, logger: logger}, nil
+}
+
+func (u *UsersUC) User(ctx context.Context, id uuid.UUID) (UserDTO, error) {
+	if _, err := scopeUser(ctx, id); err != nil {
+		return UserDTO{}, err
+	}
+	user, err := u.userR.User(ctx, id)
+	if err != nil {
+		u.logger.Error("User", "id", id, "error", err)
+		return UserDTO{}, err
+	}
+	return UserToDTO(user), nil
+}
+
+// Users returns a page of the users by id, zero limit is the default
+// one.
+func (u *UsersUC) Users(ctx context.Context, limit, offset int) ([]UserDTO, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if limit == 0 {
+		limit = domain.DefaultListLimit
+	}
+	if limit < 0 || limit > domain.MaxListLimit {
+		return nil, domain.NewValidationError("limit", "must be between 1 and 500")
+	}
+	if offset < 0 {
+		return nil, domain.NewValidationError("offset", "must not be negative")
+	}
+	users, err := u.userR.Users(ctx, limit, offset)
+	if err != nil {
+		u.logger.Error("Users", "limit", limit, "offset", offset, "error", err)
+		return nil, err
+	}
+	res := make([]UserDTO, 0, len(users))
+	for _, user := range users {
+		res = append(res, UserToDTO(user))
+	}
+	return res, nil
+}
+
+// NewUser stores the profile of a new user, a nil id is the caller's
+// own user for a restricted caller and is generated otherwise. It
+// returns the id.
+func (u *UsersUC) NewUser(ctx context.Context, input UserDTO) (uuid.UUID, error) {
+	var err error
+	if input.Id, err = scopeUser(ctx, input.Id); err != nil {
+		return uuid.Nil, err
+	}
+	if input.Id == uuid.Nil {
+		input.Id = uuid.New()
+	}
+	user, err := DTOToUser(input)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err := u.userR.StoreUser(ctx, user); err != nil {
+		u.logger.Error("NewUser", "id", user.Id, "error", err)
+		return uuid.Nil, err
+	}
+	u.logger.Info("NewUser", "id", user.Id)
+	return user.Id, nil
+}
+
+// UpdateUser replaces the profile of user id with input.
+func (u *UsersUC) UpdateUser(ctx context.Context, id uuid.UUID, input UserDTO) error {
+	if _, err := scopeUser(ctx, id); err != nil {
+		return err
+	}
+	input.Id = id
+	user, err := DTOToUser(input)
+	if err != nil {
+		return err
+	}
+	if err := u.userR.UpdateUser(ctx, user); err != nil {
+		u.logger.Error("UpdateUser", "id", id, "error", err)
+		return err
+	}
+	u.logger.Info("UpdateUser", "id", id)
+	return nil
+}
+
+// DeleteUser removes the user with all their subscriptions and returns
+// the number of the subscriptions.
+func (u *UsersUC) DeleteUser(ctx context.Context, id uuid.UUID) (int, error) {
+	if _, err := scopeUser(ctx, id); err != nil {
+		return 0, err
+	}
+	deleted, err := u.userR.DeleteUser(ctx, id)
+	if err != nil {
+		u.logger.Error("DeleteUser", "id", id, "error", err)
+		return 0, err
+	}
+	u.logger.Info("DeleteUser", "id", id, "subs", deleted)
+	return deleted, nil
+}
@@ -1,5 +1,3 @@
-BEGIN;
-
 DROP INDEX IF EXISTS idx_subscriptions_dates;
 DROP INDEX IF EXISTS idx_users_subs_user;
 DROP INDEX IF EXISTS idx_subscriptions_service;
@@ -7,5 +5,3 @@ DROP INDEX IF EXISTS idx_subscriptions_service;
 DROP TABLE IF EXISTS users_subs;
 DROP TABLE IF EXISTS subscriptions;
 DROP TABLE IF EXISTS services;
-
-COMMIT;
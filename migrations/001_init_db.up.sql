@@ -1,5 +1,3 @@
-BEGIN;
-
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 
 -- CREATE DATABASE IF NOT EXISTS dev;
@@ -31,5 +29,3 @@ CREATE TABLE users_subs (
 CREATE INDEX idx_subscriptions_service ON subscriptions(service_id);
 CREATE INDEX idx_users_subs_user ON users_subs(user_id);
 CREATE INDEX idx_subscriptions_dates ON subscriptions(start_date, end_date);
-
-COMMIT;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_subscriptions_service_dates;
+
+CREATE INDEX IF NOT EXISTS idx_users_subs_user ON users_subs(user_id);
+DROP INDEX IF EXISTS idx_users_subs_user_sub;
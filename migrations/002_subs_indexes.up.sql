@@ -0,0 +1,6 @@
+-- Covers UserSubs and the per-user costs: the join key comes with the filter.
+CREATE INDEX IF NOT EXISTS idx_users_subs_user_sub ON users_subs(user_id, sub_id);
+DROP INDEX IF EXISTS idx_users_subs_user;
+
+-- Costs filter by service and period together.
+CREATE INDEX IF NOT EXISTS idx_subscriptions_service_dates ON subscriptions(service_id, start_date, end_date);
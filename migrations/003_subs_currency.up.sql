@@ -0,0 +1,4 @@
+-- Prices are kept in the currency of the subscription. Existing rows were in roubles.
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'RUB',
+    ADD CONSTRAINT valid_currency CHECK (currency ~ '^[A-Z]{3}$');
@@ -0,0 +1,4 @@
+-- Price is charged once per billing period starting at start_date.
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS billing_period VARCHAR(10) NOT NULL DEFAULT 'monthly',
+    ADD CONSTRAINT valid_billing_period CHECK (billing_period IN ('weekly', 'monthly', 'quarterly', 'yearly'));
@@ -0,0 +1,9 @@
+-- Fails if any subscription has a date other than the first day of a month.
+ALTER TABLE subscriptions
+    DROP CONSTRAINT IF EXISTS valid_start_date,
+    DROP CONSTRAINT IF EXISTS valid_end_date,
+    ADD CONSTRAINT valid_start_date CHECK (EXTRACT(DAY FROM start_date) = 1),
+    ADD CONSTRAINT valid_end_date CHECK (
+        end_date IS NULL OR
+        (EXTRACT(DAY FROM end_date) = 1 AND end_date >= start_date)
+    );
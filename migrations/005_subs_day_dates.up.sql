@@ -0,0 +1,5 @@
+-- Dates are no longer pinned to the first day of a month.
+ALTER TABLE subscriptions
+    DROP CONSTRAINT IF EXISTS valid_start_date,
+    DROP CONSTRAINT IF EXISTS valid_end_date,
+    ADD CONSTRAINT valid_end_date CHECK (end_date IS NULL OR end_date >= start_date);
@@ -0,0 +1,5 @@
+-- Deleted subscriptions are kept until the purge job removes them.
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_deleted_at ON subscriptions(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,4 @@
+-- Every write of a subscription bumps its version, clients send it back
+-- in If-Match to not overwrite the changes they haven't seen.
+ALTER TABLE subscriptions
+    ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
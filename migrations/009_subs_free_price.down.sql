@@ -0,0 +1,6 @@
+-- Free subscriptions would break the constraint.
+DELETE FROM subscriptions WHERE price = 0;
+
+ALTER TABLE subscriptions
+    DROP CONSTRAINT IF EXISTS subscriptions_price_check,
+    ADD CONSTRAINT subscriptions_price_check CHECK (price > 0);
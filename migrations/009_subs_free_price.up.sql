@@ -0,0 +1,4 @@
+-- Free subscriptions have a price of 0.
+ALTER TABLE subscriptions
+    DROP CONSTRAINT IF EXISTS subscriptions_price_check,
+    ADD CONSTRAINT subscriptions_price_check CHECK (price >= 0);
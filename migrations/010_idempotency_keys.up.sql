@@ -0,0 +1,15 @@
+-- Keys of the retried creations of subscriptions. A key is bound to the
+-- hash of its first request and answers with the same sub_id until it
+-- expires. Keys are per user: user_id is the caller sending the key.
+-- sub_id is not a foreign key, a replay outlives the purge.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id UUID NOT NULL,
+    idem_key TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    sub_id INTEGER,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, idem_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
@@ -0,0 +1,13 @@
+ALTER TABLE users_subs DROP CONSTRAINT IF EXISTS users_subs_user_id_fkey;
+
+DROP TABLE IF EXISTS users;
+
+DROP INDEX IF EXISTS idx_services_category;
+
+ALTER TABLE services
+    DROP CONSTRAINT IF EXISTS valid_default_currency,
+    DROP CONSTRAINT IF EXISTS valid_default_price,
+    DROP COLUMN IF EXISTS default_currency,
+    DROP COLUMN IF EXISTS default_price,
+    DROP COLUMN IF EXISTS category,
+    DROP COLUMN IF EXISTS display_name;
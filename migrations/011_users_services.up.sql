@@ -0,0 +1,31 @@
+-- Services are managed resources: a display name, a category and an
+-- optional default price that comes with its currency.
+ALTER TABLE services
+    ADD COLUMN IF NOT EXISTS display_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS category VARCHAR(50) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS default_price INTEGER,
+    ADD COLUMN IF NOT EXISTS default_currency CHAR(3),
+    ADD CONSTRAINT valid_default_price CHECK (
+        (default_price IS NULL) = (default_currency IS NULL) AND default_price >= 0
+    ),
+    ADD CONSTRAINT valid_default_currency CHECK (default_currency ~ '^[A-Z]{3}$');
+
+CREATE INDEX IF NOT EXISTS idx_services_category ON services(category);
+
+-- Users with their profiles. Every user of users_subs has a row, the
+-- ones added with subscriptions have an empty profile.
+CREATE TABLE IF NOT EXISTS users (
+    user_id UUID PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    email TEXT NOT NULL DEFAULT '',
+    metadata JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO users (user_id)
+SELECT DISTINCT user_id FROM users_subs
+ON CONFLICT (user_id) DO NOTHING;
+
+ALTER TABLE users_subs
+    ADD CONSTRAINT users_subs_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(user_id);
@@ -0,0 +1,3 @@
+-- The merged services and the normalized names are not restored.
+DROP FUNCTION IF EXISTS canonical_service_name(TEXT);
+DROP TABLE IF EXISTS service_aliases;
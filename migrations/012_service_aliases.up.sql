@@ -0,0 +1,22 @@
+-- Other names of services, stored normalized like the service names.
+CREATE TABLE IF NOT EXISTS service_aliases (
+    alias TEXT PRIMARY KEY,
+    service_id INTEGER NOT NULL REFERENCES services(service_id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_service_aliases_service_id ON service_aliases(service_id);
+
+-- canonical_service_name resolves an alias to the name of its service,
+-- other names are returned as they are.
+CREATE OR REPLACE FUNCTION canonical_service_name(name TEXT) RETURNS TEXT
+LANGUAGE sql STABLE AS $$
+    SELECT COALESCE(
+        (SELECT s.service_name FROM service_aliases a
+         JOIN services s ON s.service_id = a.service_id
+         WHERE a.alias = name),
+        name)
+$$;
+
+-- Service names become normalized by the Go step of this migration,
+-- normalizeServiceNames of internal/service: SQL has no full case folding.
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_service_aliases_alias_trgm;
+DROP INDEX IF EXISTS idx_services_name_trgm;
+
+DROP EXTENSION IF EXISTS pg_trgm;
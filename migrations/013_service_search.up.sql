@@ -0,0 +1,6 @@
+-- Trigram indexes behind the service search, they serve both the prefix
+-- (LIKE 'q%') and the similarity (%) matches.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_services_name_trgm ON services USING gin (service_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_service_aliases_alias_trgm ON service_aliases USING gin (alias gin_trgm_ops);
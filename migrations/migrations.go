@@ -0,0 +1,12 @@
+// Package migrations embeds the SQL migrations of the database.
+//
+// Every version NNN has NNN_name.up.sql and NNN_name.down.sql. The runner
+// in internal/migrate wraps each file in a transaction, so the files must
+// not contain BEGIN or COMMIT. What SQL can't express goes into a Go
+// step of the version, see service.MigrationSteps.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,24 @@
+package config
+
+import "time"
+
+// AuthConfig sets up the JWT bearer tokens of the API, verified with the
+// keys of the JWKS file. JWKSFile is required unless Disabled is set,
+// which trusts every request. Empty Issuer and Audience are not checked.
+// Leeway is the clock skew allowed for exp and nbf.
+type AuthConfig struct {
+	Disabled  bool   `yaml:"disabled"`
+	JWKSFile  string `yaml:"jwks_file"`
+	Issuer    string `yaml:"issuer"`
+	Audience  string `yaml:"audience"`
+	AdminRole string `yaml:"admin_role"`
+	Leeway    string `yaml:"leeway"`
+}
+
+func (c AuthConfig) Enabled() bool {
+	return !c.Disabled
+}
+
+func (c AuthConfig) ParseLeeway() (time.Duration, error) {
+	return time.ParseDuration(c.Leeway)
+}
@@ -0,0 +1,24 @@
+package config
+
+type HTTPConfig struct {
+	Addr         string `yaml:"addr"`
+	ReadTimeout  string `yaml:"read_timeout"`
+	WriteTimeout string `yaml:"write_timeout"`
+	// DrainTimeout bounds waiting for in-flight requests on shutdown.
+	DrainTimeout string `yaml:"drain_timeout"`
+	// RequestTimeout is the deadline of handling a request, RouteTimeouts
+	// override it for route path templates like /subscriptions/{id}.
+	RequestTimeout string            `yaml:"request_timeout"`
+	RouteTimeouts  map[string]string `yaml:"route_timeouts"`
+	TLS            TLSConfig         `yaml:"tls"`
+}
+
+// TLSConfig switches the server to HTTPS when both files are set.
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
@@ -0,0 +1,19 @@
+package config
+
+import "time"
+
+// IdempotencyConfig sets up the Idempotency-Key of the creations: a key
+// replays its creation for TTL, the server removes the expired keys
+// every Interval.
+type IdempotencyConfig struct {
+	TTL      string `yaml:"ttl"`
+	Interval string `yaml:"interval"`
+}
+
+func (c IdempotencyConfig) ParseTTL() (time.Duration, error) {
+	return time.ParseDuration(c.TTL)
+}
+
+func (c IdempotencyConfig) ParseInterval() (time.Duration, error) {
+	return time.ParseDuration(c.Interval)
+}
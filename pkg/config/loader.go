@@ -1,25 +1,143 @@
 package config
 
 import (
+	"flag"
+	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Postgres PostgresConfig `yaml:"postgres"`
+	Postgres    PostgresConfig    `yaml:"postgres"`
+	Rates       RatesConfig       `yaml:"rates"`
+	HTTP        HTTPConfig        `yaml:"http"`
+	Log         LogConfig         `yaml:"log"`
+	Purge       PurgeConfig       `yaml:"purge"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	Auth        AuthConfig        `yaml:"auth"`
 }
 
-func LoadConfig(path string) (*Config, error) {
+// DefaultFiles are read when neither --config nor CONFIG_FILES is given.
+var DefaultFiles = []string{"configs/postgres.yaml", "configs/rates.yaml", "configs/server.yaml"}
+
+// Default is the config before any file, variable or flag is applied.
+func Default() *Config {
+	var cfg Config
+	cfg.Postgres.Port = 5432
+	cfg.Postgres.SSLMode = "disable"
+	cfg.Rates.Base = "RUB"
+	cfg.HTTP = HTTPConfig{
+		Addr:           ":8080",
+		ReadTimeout:    "10s",
+		WriteTimeout:   "10s",
+		DrainTimeout:   "5s",
+		RequestTimeout: "8s",
+	}
+	cfg.Log = LogConfig{Path: "logs/access.log", Level: "info", Format: "json"}
+	cfg.Purge = PurgeConfig{Retention: "720h", Interval: "1h"}
+	cfg.Idempotency = IdempotencyConfig{TTL: "24h", Interval: "1h"}
+	cfg.Auth = AuthConfig{AdminRole: "admin", Leeway: "30s"}
+	return &cfg
+}
+
+// Options are the flags of Load that are not settings and the
+// positional arguments.
+type Options struct {
+	Files       []string
+	PrintConfig bool
+	Args        []string
+}
+
+// Load builds the config from, in increasing precedence: the defaults,
+// the YAML files, the environment variables and the flags in args.
+// Later files override earlier ones key by key. The result is not
+// validated, call Validate. Flags may follow positional arguments, which
+// end up in Options.Args. fs may have flags of its own defined.
+func Load(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (*Config, Options, error) {
+	var opts Options
+	fs.Func("config", "YAML config `file`, may be repeated (default "+strings.Join(DefaultFiles, ",")+")", func(v string) error {
+		opts.Files = append(opts.Files, v)
+		return nil
+	})
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the resulting config with secrets redacted and exit")
+	flagVals := make([]*string, len(settings))
+	for i, s := range settings {
+		flagVals[i] = fs.String(s.flagName(), "", s.usage())
+	}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, opts, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		opts.Args = append(opts.Args, args[0])
+		args = args[1:]
+	}
+
+	if len(opts.Files) == 0 {
+		if v, ok := lookupEnv("CONFIG_FILES"); ok && v != "" {
+			opts.Files = strings.Split(v, ",")
+		} else {
+			opts.Files = DefaultFiles
+		}
+	}
+	cfg := Default()
+	for _, path := range opts.Files {
+		if err := mergeFile(cfg, path); err != nil {
+			return nil, opts, err
+		}
+	}
+	for _, s := range settings {
+		if v, ok := lookupEnv(s.env); ok && v != "" {
+			if err := s.set(cfg, v); err != nil {
+				return nil, opts, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+	passed := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { passed[f.Name] = true })
+	for i, s := range settings {
+		if passed[s.flagName()] {
+			if err := s.set(cfg, *flagVals[i]); err != nil {
+				return nil, opts, fmt.Errorf("--%s: %w", s.flagName(), err)
+			}
+		}
+	}
+	return cfg, opts, nil
+}
+
+func mergeFile(cfg *Config, path string) error {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
 	}
+	return nil
+}
 
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, err
+const redacted = "********"
+
+// Redacted is a copy of the config safe to print.
+func (c Config) Redacted() Config {
+	if c.Postgres.Password != "" {
+		c.Postgres.Password = redacted
 	}
+	return c
+}
 
-	return &cfg, nil
+// Print writes the redacted config as YAML.
+func (c Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
 }
@@ -0,0 +1,276 @@
+package config_test
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/samantonio28/subscriber-inf/pkg/config"
+)
+
+// writeFile writes a YAML config into the temporary directory of t and
+// returns its path.
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// load runs config.Load on a flag set of its own with env as the
+// environment.
+func load(args []string, env map[string]string) (*config.Config, config.Options, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return config.Load(fs, args, func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	})
+}
+
+func TestLoad(t *testing.T) {
+	base := writeFile(t, "base.yaml", `
+postgres:
+  host: yaml-host
+  port: 5433
+  user: yaml-user
+http:
+  addr: ":7000"
+log:
+  level: warn
+`)
+	override := writeFile(t, "override.yaml", `
+postgres:
+  port: 6000
+`)
+
+	cases := []struct {
+		name  string
+		args  []string
+		env   map[string]string
+		check func(t *testing.T, cfg *config.Config, opts config.Options)
+	}{
+		{
+			name: "Defaults",
+			args: []string{"--config", base},
+			check: func(t *testing.T, cfg *config.Config, opts config.Options) {
+				if cfg.Postgres.SSLMode != "disable" || cfg.HTTP.ReadTimeout != "10s" || cfg.Log.Format != "json" {
+					t.Errorf("defaults not kept: %+v", cfg)
+				}
+			},
+		},
+		{
+			name: "YAML",
+			args: []string{"--config", base},
+			check: func(t *testing.T, cfg *config.Config, opts config.Options) {
+				if cfg.Postgres.Host != "yaml-host" || cfg.Postgres.Port != 5433 || cfg.HTTP.Addr != ":7000" || cfg.Log.Level != "warn" {
+					t.Errorf("YAML values not applied: %+v", cfg)
+				}
+			},
+		},
+		{
+			name: "LaterFileKeyByKey",
+			args: []string{"--config", base, "--config", override},
+			check: func(t *testing.T, cfg *config.Config, opts config.Options) {
+				if cfg.Postgres.Port != 6000 || cfg.Postgres.Host != "yaml-host" {
+					t.Errorf("postgres = %+v, want the port of the second file and the host of the first", cfg.Postgres)
+				}
+			},
+		},
+		{
+			name: "EnvOverYAML",
+			args: []string{"--config", base},
+			env:  map[string]string{"POSTGRES_HOST": "env-host", "HTTP_ADDR": ":7001", "POSTGRES_USER": ""},
+			check: func(t *testing.T, cfg *config.Config, opts config.Options) {
+				if cfg.Postgres.Host != "env-host" || cfg.HTTP.Addr != ":7001" {
+					t.Errorf("environment not applied: %+v", cfg)
+				}
+				// Empty variables are ignored.
+				if cfg.Postgres.User != "yaml-user" {
+					t.Errorf("postgres.user = %q, want the one of the file", cfg.Postgres.User)
+				}
+			},
+		},
+		{
+			name: "FlagOverEnv",
+			args: []string{"--config", base, "--postgres-host", "flag-host", "--postgres-port=7777"},
+			env:  map[string]string{"POSTGRES_HOST": "env-host", "POSTGRES_PORT": "6666"},
+			check: func(t *testing.T, cfg *config.Config, opts config.Options) {
+				if cfg.Postgres.Host != "flag-host" || cfg.Postgres.Port != 7777 {
+					t.Errorf("flags not applied: %+v", cfg.Postgres)
+				}
+			},
+		},
+		{
+			name: "FlagsAfterArgs",
+			args: []string{"migrate", "--config", base, "to", "--log-level", "debug", "3"},
+			check: func(t *testing.T, cfg *config.Config, opts config.Options) {
+				if !slices.Equal(opts.Args, []string{"migrate", "to", "3"}) {
+					t.Errorf("Args = %q, want migrate to 3", opts.Args)
+				}
+				if cfg.Log.Level != "debug" || cfg.Postgres.Host != "yaml-host" {
+					t.Errorf("flags after the arguments not applied: %+v", cfg)
+				}
+			},
+		},
+		{
+			name: "ConfigFiles",
+			env:  map[string]string{"CONFIG_FILES": base + "," + override},
+			check: func(t *testing.T, cfg *config.Config, opts config.Options) {
+				if !slices.Equal(opts.Files, []string{base, override}) || cfg.Postgres.Port != 6000 {
+					t.Errorf("Files = %q, port %d, want both files of CONFIG_FILES", opts.Files, cfg.Postgres.Port)
+				}
+			},
+		},
+		{
+			name: "ConfigFlagOverConfigFiles",
+			args: []string{"--config", base},
+			env:  map[string]string{"CONFIG_FILES": override},
+			check: func(t *testing.T, cfg *config.Config, opts config.Options) {
+				if !slices.Equal(opts.Files, []string{base}) || cfg.Postgres.Port != 5433 {
+					t.Errorf("Files = %q, port %d, want only the file of --config", opts.Files, cfg.Postgres.Port)
+				}
+			},
+		},
+		{
+			name: "AuthDisabled",
+			args: []string{"--config", base},
+			env:  map[string]string{"AUTH_DISABLED": "true"},
+			check: func(t *testing.T, cfg *config.Config, opts config.Options) {
+				if cfg.Auth.Enabled() {
+					t.Errorf("auth = %+v, want it disabled by AUTH_DISABLED", cfg.Auth)
+				}
+			},
+		},
+		{
+			name: "PrintConfig",
+			args: []string{"--config", base, "--print-config"},
+			check: func(t *testing.T, cfg *config.Config, opts config.Options) {
+				if !opts.PrintConfig {
+					t.Errorf("PrintConfig = false")
+				}
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, opts, err := load(tc.args, tc.env)
+			if err != nil {
+				t.Fatalf("Load(): %v", err)
+			}
+			tc.check(t, cfg, opts)
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	base := writeFile(t, "base.yaml", "postgres:\n  host: h\n")
+	broken := writeFile(t, "broken.yaml", "postgres: [\n")
+
+	cases := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{"MissingFile", []string{"--config", filepath.Join(t.TempDir(), "none.yaml")}, nil, "failed to read config"},
+		{"InvalidYAML", []string{"--config", broken}, nil, broken},
+		{"EnvNotInt", []string{"--config", base}, map[string]string{"POSTGRES_PORT": "x"}, "POSTGRES_PORT"},
+		{"FlagNotBool", []string{"--config", base, "--postgres-auto-migrate", "maybe"}, nil, "--postgres-auto-migrate"},
+		{"UnknownFlag", []string{"--config", base, "--no-such-flag"}, nil, "no-such-flag"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := load(tc.args, tc.env)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Load() error = %v, want one about %s", err, tc.want)
+			}
+		})
+	}
+}
+
+// validConfig is the default config with the required settings.
+func validConfig() *config.Config {
+	cfg := config.Default()
+	cfg.Postgres.Host = "localhost"
+	cfg.Postgres.User = "postgres"
+	cfg.Postgres.DBName = "dev"
+	cfg.Auth.JWKSFile = "jwks.json"
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("Validate() of a valid config: %v", err)
+	}
+	disabled := validConfig()
+	disabled.Auth.Disabled, disabled.Auth.JWKSFile = true, ""
+	if err := disabled.Validate(); err != nil {
+		t.Errorf("Validate() with auth disabled: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		change func(c *config.Config)
+		want   []string
+	}{
+		{"Required", func(c *config.Config) { c.Postgres.Host, c.Postgres.DBName = "", "" }, []string{"postgres.host", "postgres.dbname"}},
+		{"Port", func(c *config.Config) { c.Postgres.Port = 70000 }, []string{"postgres.port"}},
+		{"SSLMode", func(c *config.Config) { c.Postgres.SSLMode = "sometimes" }, []string{"postgres.sslmode"}},
+		{"Duration", func(c *config.Config) { c.HTTP.ReadTimeout = "soon" }, []string{"http.read_timeout"}},
+		{"NegativeDuration", func(c *config.Config) { c.Postgres.QueryTimeout = "-1s" }, []string{"postgres.query_timeout"}},
+		{"PoolLimits", func(c *config.Config) { c.Postgres.Pool.MinConns, c.Postgres.Pool.MaxConns = 5, 2 }, []string{"postgres.pool.min_conns"}},
+		{"Rates", func(c *config.Config) { c.Rates.Rates = map[string]float64{"USD": 0} }, []string{"rates.rates.USD"}},
+		{"TLS", func(c *config.Config) { c.HTTP.TLS.CertFile = "cert.pem" }, []string{"http.tls"}},
+		{"Log", func(c *config.Config) { c.Log.Level, c.Log.Format = "loud", "xml" }, []string{"log.level", "log.format"}},
+		{"IdempotencyTTL", func(c *config.Config) { c.Idempotency.TTL = "0s" }, []string{"idempotency.ttl"}},
+		{"NoJWKS", func(c *config.Config) { c.Auth.JWKSFile = "" }, []string{"auth.jwks_file"}},
+		{"All", func(c *config.Config) { c.HTTP.Addr, c.Log.Path = "", "" }, []string{"http.addr", "log.path"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := validConfig()
+			tc.change(cfg)
+			err := cfg.Validate()
+			if err == nil {
+				t.Fatalf("Validate() = nil, want errors about %v", tc.want)
+			}
+			for _, key := range tc.want {
+				if !strings.Contains(err.Error(), key+":") {
+					t.Errorf("Validate() = %v, want an error about %s", err, key)
+				}
+			}
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := validConfig()
+	cfg.Postgres.Password = "s3cret-password"
+
+	if got := cfg.Redacted().Postgres.Password; got == cfg.Postgres.Password || got == "" {
+		t.Errorf("Redacted().Postgres.Password = %q, want it hidden", got)
+	}
+	if cfg.Postgres.Password != "s3cret-password" {
+		t.Errorf("Redacted() changed the config: %q", cfg.Postgres.Password)
+	}
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatalf("Print(): %v", err)
+	}
+	if strings.Contains(out.String(), "s3cret-password") || !strings.Contains(out.String(), "host: localhost") {
+		t.Errorf("Print() =\n%s\nwant the config without the password", out.String())
+	}
+
+	cfg.Postgres.Password = ""
+	if got := cfg.Redacted().Postgres.Password; got != "" {
+		t.Errorf("Redacted() of an empty password = %q, want it empty", got)
+	}
+}
@@ -0,0 +1,9 @@
+package config
+
+// LogConfig sets up the access log. Path "stdout" writes to the standard
+// output instead of a file.
+type LogConfig struct {
+	Path   string `yaml:"path"`
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
@@ -8,18 +8,21 @@ import (
 )
 
 type PostgresConfig struct {
-	Host     string `yaml:"host"`
-	Port     int    `yaml:"port"`
-	User     string `yaml:"user"`
-	Password string `yaml:"password"`
-	DBName   string `yaml:"dbname"`
-	SSLMode  string `yaml:"sslmode"`
-	Pool     struct {
+	Host         string `yaml:"host"`
+	Port         int    `yaml:"port"`
+	User         string `yaml:"user"`
+	Password     string `yaml:"password"`
+	DBName       string `yaml:"dbname"`
+	SSLMode      string `yaml:"sslmode"`
+	QueryTimeout string `yaml:"query_timeout"`
+	Pool         struct {
 		MaxConns        int    `yaml:"max_conns"`
 		MinConns        int    `yaml:"min_conns"`
 		MaxConnLifetime string `yaml:"max_conn_lifetime"`
 		MaxConnIdleTime string `yaml:"max_conn_idle_time"`
 	} `yaml:"pool"`
+	// AutoMigrate applies the pending migrations on startup.
+	AutoMigrate bool `yaml:"auto_migrate"`
 }
 
 func (c *PostgresConfig) ToConnectionString() string {
@@ -62,3 +65,11 @@ func (c *PostgresConfig) ToPgxPoolConfig() (*pgxpool.Config, error) {
 
 	return poolConfig, nil
 }
+
+// ParseQueryTimeout returns the bound of every repository call, zero for none.
+func (c *PostgresConfig) ParseQueryTimeout() (time.Duration, error) {
+	if c.QueryTimeout == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(c.QueryTimeout)
+}
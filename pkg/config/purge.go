@@ -0,0 +1,23 @@
+package config
+
+import "time"
+
+// PurgeConfig sets up removing soft-deleted subscriptions for good once
+// they are older than Retention. Empty Retention disables the purge.
+type PurgeConfig struct {
+	Retention string `yaml:"retention"`
+	// Interval is the pause between purges of the server.
+	Interval string `yaml:"interval"`
+}
+
+func (c PurgeConfig) Enabled() bool {
+	return c.Retention != ""
+}
+
+func (c PurgeConfig) ParseRetention() (time.Duration, error) {
+	return time.ParseDuration(c.Retention)
+}
+
+func (c PurgeConfig) ParseInterval() (time.Duration, error) {
+	return time.ParseDuration(c.Interval)
+}
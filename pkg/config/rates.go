@@ -0,0 +1,8 @@
+package config
+
+// RatesConfig holds static exchange rates: the price of one unit of each
+// currency in units of Base.
+type RatesConfig struct {
+	Base  string             `yaml:"base"`
+	Rates map[string]float64 `yaml:"rates"`
+}
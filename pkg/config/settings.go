@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// setting is a config value that can be overridden by the environment
+// variable env and by the flag named after key: http.read_timeout is
+// set by --http-read-timeout.
+type setting struct {
+	key   string
+	env   string
+	field func(c *Config) any
+}
+
+// settings are the keys without a map value. The POSTGRES_ variables are
+// the ones of the postgres image in docker-compose.yml.
+var settings = []setting{
+	{"postgres.host", "POSTGRES_HOST", func(c *Config) any { return &c.Postgres.Host }},
+	{"postgres.port", "POSTGRES_PORT", func(c *Config) any { return &c.Postgres.Port }},
+	{"postgres.user", "POSTGRES_USER", func(c *Config) any { return &c.Postgres.User }},
+	{"postgres.password", "POSTGRES_PASSWORD", func(c *Config) any { return &c.Postgres.Password }},
+	{"postgres.dbname", "POSTGRES_DB", func(c *Config) any { return &c.Postgres.DBName }},
+	{"postgres.sslmode", "POSTGRES_SSLMODE", func(c *Config) any { return &c.Postgres.SSLMode }},
+	{"postgres.query_timeout", "POSTGRES_QUERY_TIMEOUT", func(c *Config) any { return &c.Postgres.QueryTimeout }},
+	{"postgres.auto_migrate", "POSTGRES_AUTO_MIGRATE", func(c *Config) any { return &c.Postgres.AutoMigrate }},
+	{"postgres.pool.max_conns", "POSTGRES_POOL_MAX_CONNS", func(c *Config) any { return &c.Postgres.Pool.MaxConns }},
+	{"postgres.pool.min_conns", "POSTGRES_POOL_MIN_CONNS", func(c *Config) any { return &c.Postgres.Pool.MinConns }},
+	{"postgres.pool.max_conn_lifetime", "POSTGRES_POOL_MAX_CONN_LIFETIME", func(c *Config) any { return &c.Postgres.Pool.MaxConnLifetime }},
+	{"postgres.pool.max_conn_idle_time", "POSTGRES_POOL_MAX_CONN_IDLE_TIME", func(c *Config) any { return &c.Postgres.Pool.MaxConnIdleTime }},
+	{"rates.base", "RATES_BASE", func(c *Config) any { return &c.Rates.Base }},
+	{"http.addr", "HTTP_ADDR", func(c *Config) any { return &c.HTTP.Addr }},
+	{"http.read_timeout", "HTTP_READ_TIMEOUT", func(c *Config) any { return &c.HTTP.ReadTimeout }},
+	{"http.write_timeout", "HTTP_WRITE_TIMEOUT", func(c *Config) any { return &c.HTTP.WriteTimeout }},
+	{"http.drain_timeout", "HTTP_DRAIN_TIMEOUT", func(c *Config) any { return &c.HTTP.DrainTimeout }},
+	{"http.request_timeout", "HTTP_REQUEST_TIMEOUT", func(c *Config) any { return &c.HTTP.RequestTimeout }},
+	{"http.tls.cert_file", "HTTP_TLS_CERT_FILE", func(c *Config) any { return &c.HTTP.TLS.CertFile }},
+	{"http.tls.key_file", "HTTP_TLS_KEY_FILE", func(c *Config) any { return &c.HTTP.TLS.KeyFile }},
+	{"log.path", "LOG_PATH", func(c *Config) any { return &c.Log.Path }},
+	{"log.level", "LOG_LEVEL", func(c *Config) any { return &c.Log.Level }},
+	{"log.format", "LOG_FORMAT", func(c *Config) any { return &c.Log.Format }},
+	{"purge.retention", "PURGE_RETENTION", func(c *Config) any { return &c.Purge.Retention }},
+	{"purge.interval", "PURGE_INTERVAL", func(c *Config) any { return &c.Purge.Interval }},
+	{"idempotency.ttl", "IDEMPOTENCY_TTL", func(c *Config) any { return &c.Idempotency.TTL }},
+	{"idempotency.interval", "IDEMPOTENCY_INTERVAL", func(c *Config) any { return &c.Idempotency.Interval }},
+	{"auth.disabled", "AUTH_DISABLED", func(c *Config) any { return &c.Auth.Disabled }},
+	{"auth.jwks_file", "AUTH_JWKS_FILE", func(c *Config) any { return &c.Auth.JWKSFile }},
+	{"auth.issuer", "AUTH_ISSUER", func(c *Config) any { return &c.Auth.Issuer }},
+	{"auth.audience", "AUTH_AUDIENCE", func(c *Config) any { return &c.Auth.Audience }},
+	{"auth.admin_role", "AUTH_ADMIN_ROLE", func(c *Config) any { return &c.Auth.AdminRole }},
+	{"auth.leeway", "AUTH_LEEWAY", func(c *Config) any { return &c.Auth.Leeway }},
+}
+
+func (s setting) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(s.key)
+}
+
+func (s setting) usage() string {
+	return fmt.Sprintf("%s, overrides $%s", s.key, s.env)
+}
+
+func (s setting) set(c *Config, val string) error {
+	switch p := s.field(c).(type) {
+	case *string:
+		*p = val
+	case *int:
+		v, err := strconv.Atoi(val)
+		if err != nil {
+			return fmt.Errorf("%s must be an integer, got %q", s.key, val)
+		}
+		*p = v
+	case *bool:
+		v, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false, got %q", s.key, val)
+		}
+		*p = v
+	default:
+		panic("config: unsupported setting type of " + s.key)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+var (
+	sslModes   = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+	logLevels  = []string{"debug", "info", "warn", "error"}
+	logFormats = []string{"json", "text"}
+)
+
+// Validate reports every invalid value of the config at once.
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+	}
+	duration := func(key, val string) {
+		if val == "" {
+			return
+		}
+		if d, err := time.ParseDuration(val); err != nil {
+			add(key, "invalid duration %q", val)
+		} else if d < 0 {
+			add(key, "must not be negative")
+		}
+	}
+
+	pg := c.Postgres
+	for _, f := range []struct{ key, val string }{{"postgres.host", pg.Host}, {"postgres.user", pg.User}, {"postgres.dbname", pg.DBName}} {
+		if f.val == "" {
+			add(f.key, "must be set")
+		}
+	}
+	if pg.Port < 1 || pg.Port > 65535 {
+		add("postgres.port", "must be in 1..65535, got %d", pg.Port)
+	}
+	if !slices.Contains(sslModes, pg.SSLMode) {
+		add("postgres.sslmode", "must be one of %v, got %q", sslModes, pg.SSLMode)
+	}
+	duration("postgres.query_timeout", pg.QueryTimeout)
+	duration("postgres.pool.max_conn_lifetime", pg.Pool.MaxConnLifetime)
+	duration("postgres.pool.max_conn_idle_time", pg.Pool.MaxConnIdleTime)
+	if pg.Pool.MinConns < 0 || pg.Pool.MaxConns < 0 {
+		add("postgres.pool", "connection limits must not be negative")
+	} else if pg.Pool.MaxConns > 0 && pg.Pool.MinConns > pg.Pool.MaxConns {
+		add("postgres.pool.min_conns", "must not be greater than max_conns")
+	}
+
+	for _, cur := range slices.Sorted(maps.Keys(c.Rates.Rates)) {
+		if c.Rates.Rates[cur] <= 0 {
+			add("rates.rates."+cur, "must be positive")
+		}
+	}
+
+	if c.HTTP.Addr == "" {
+		add("http.addr", "must be set")
+	}
+	duration("http.read_timeout", c.HTTP.ReadTimeout)
+	duration("http.write_timeout", c.HTTP.WriteTimeout)
+	duration("http.drain_timeout", c.HTTP.DrainTimeout)
+	duration("http.request_timeout", c.HTTP.RequestTimeout)
+	for _, route := range slices.Sorted(maps.Keys(c.HTTP.RouteTimeouts)) {
+		duration("http.route_timeouts."+route, c.HTTP.RouteTimeouts[route])
+	}
+	if (c.HTTP.TLS.CertFile == "") != (c.HTTP.TLS.KeyFile == "") {
+		add("http.tls", "cert_file and key_file must be set together")
+	}
+
+	if c.Log.Path == "" {
+		add("log.path", "must be set")
+	}
+	if !slices.Contains(logLevels, c.Log.Level) {
+		add("log.level", "must be one of %v, got %q", logLevels, c.Log.Level)
+	}
+	if !slices.Contains(logFormats, c.Log.Format) {
+		add("log.format", "must be one of %v, got %q", logFormats, c.Log.Format)
+	}
+
+	if c.Purge.Enabled() {
+		if d, err := c.Purge.ParseRetention(); err != nil {
+			add("purge.retention", "invalid duration %q", c.Purge.Retention)
+		} else if d <= 0 {
+			add("purge.retention", "must be positive")
+		}
+		if d, err := c.Purge.ParseInterval(); err != nil {
+			add("purge.interval", "invalid duration %q", c.Purge.Interval)
+		} else if d <= 0 {
+			add("purge.interval", "must be positive")
+		}
+	}
+	if d, err := c.Idempotency.ParseTTL(); err != nil {
+		add("idempotency.ttl", "invalid duration %q", c.Idempotency.TTL)
+	} else if d <= 0 {
+		add("idempotency.ttl", "must be positive")
+	}
+	if d, err := c.Idempotency.ParseInterval(); err != nil {
+		add("idempotency.interval", "invalid duration %q", c.Idempotency.Interval)
+	} else if d <= 0 {
+		add("idempotency.interval", "must be positive")
+	}
+	if c.Auth.Enabled() {
+		if c.Auth.JWKSFile == "" {
+			add("auth.jwks_file", "must be set unless auth.disabled is true")
+		}
+		if c.Auth.AdminRole == "" {
+			add("auth.admin_role", "must be set")
+		}
+		if d, err := c.Auth.ParseLeeway(); err != nil {
+			add("auth.leeway", "invalid duration %q", c.Auth.Leeway)
+		} else if d < 0 {
+			add("auth.leeway", "must not be negative")
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"regexp"
@@ -9,6 +10,8 @@ import (
 	"time"
 )
 
+var ErrEmptyDate = errors.New("empty date")
+
 func MakeResponse(w http.ResponseWriter, statusCode int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
@@ -48,7 +51,7 @@ func MonthToInt(m time.Month) int {
 
 func ParseMonthYear(s string) (time.Time, error) {
 	if s == "" {
-		return time.Time{}, fmt.Errorf("empty date")
+		return time.Time{}, ErrEmptyDate
 	}
 	re := regexp.MustCompile(`^\d{2}-\d{4}$`)
 	if !re.MatchString(s) {
@@ -65,6 +68,9 @@ func ParseMonthYear(s string) (time.Time, error) {
 	if err != nil {
 		return time.Time{}, fmt.Errorf("not number 2")
 	}
+	if first < 1 || first > 12 {
+		return time.Time{}, fmt.Errorf("month out of range")
+	}
 
 	t := time.Date(second, time.Month(first), 1, 0, 0, 0, 0, time.UTC)
 	return t, nil
@@ -83,3 +89,31 @@ func DateString(t time.Time) string {
 	s += "-" + strconv.Itoa(t.Year())
 	return s
 }
+
+// ParseDate reads a date in one of the formats accepted by the API:
+// MM-YYYY for the first day of a month, YYYY-MM-DD or RFC 3339.
+// The time of day of RFC 3339 dates is dropped.
+func ParseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, ErrEmptyDate
+	}
+	if t, err := ParseMonthYear(s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+	return time.Time{}, fmt.Errorf("expected MM-YYYY, YYYY-MM-DD or RFC 3339 date")
+}
+
+// FormatDate is the reverse of ParseDate: first days of months are
+// written as MM-YYYY, other days as YYYY-MM-DD.
+func FormatDate(t time.Time) string {
+	if t.IsZero() || t.Day() == 1 {
+		return DateString(t)
+	}
+	return t.Format(time.DateOnly)
+}
@@ -0,0 +1,102 @@
+package utils_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/samantonio28/subscriber-inf/pkg/utils"
+)
+
+func TestParseDate(t *testing.T) {
+	cases := []struct {
+		in   string
+		want time.Time
+	}{
+		{"07-2025", time.Date(2025, time.July, 1, 0, 0, 0, 0, time.UTC)},
+		{"12-1999", time.Date(1999, time.December, 1, 0, 0, 0, 0, time.UTC)},
+		{"2025-07-15", time.Date(2025, time.July, 15, 0, 0, 0, 0, time.UTC)},
+		{"2024-02-29", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"2025-07-15T10:20:30Z", time.Date(2025, time.July, 15, 0, 0, 0, 0, time.UTC)},
+		// The day is the one of the offset, not of UTC.
+		{"2025-07-15T23:30:00-05:00", time.Date(2025, time.July, 15, 0, 0, 0, 0, time.UTC)},
+		{"2025-07-15T01:00:00+03:00", time.Date(2025, time.July, 15, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		got, err := utils.ParseDate(c.in)
+		if err != nil {
+			t.Errorf("ParseDate(%q): %v", c.in, err)
+			continue
+		}
+		if !got.Equal(c.want) || got.Location() != time.UTC {
+			t.Errorf("ParseDate(%q) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestParseDateInvalid(t *testing.T) {
+	if _, err := utils.ParseDate(""); !errors.Is(err, utils.ErrEmptyDate) {
+		t.Errorf("ParseDate(\"\") error = %v, want ErrEmptyDate", err)
+	}
+	for _, in := range []string{
+		"7-2025",
+		"13-2025",
+		"00-2025",
+		"2025-7-15",
+		"2025-02-30",
+		"2025-13-01",
+		"15.07.2025",
+		"2025-07-15T10:20:30",
+		"07-2025 ",
+		"july",
+	} {
+		if got, err := utils.ParseDate(in); err == nil {
+			t.Errorf("ParseDate(%q) = %v, want an error", in, got)
+		}
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	cases := []struct {
+		in   time.Time
+		want string
+	}{
+		{time.Time{}, ""},
+		{time.Date(2025, time.July, 1, 0, 0, 0, 0, time.UTC), "07-2025"},
+		{time.Date(2025, time.December, 1, 0, 0, 0, 0, time.UTC), "12-2025"},
+		{time.Date(2025, time.July, 15, 0, 0, 0, 0, time.UTC), "2025-07-15"},
+		{time.Date(2025, time.January, 2, 0, 0, 0, 0, time.UTC), "2025-01-02"},
+	}
+	for _, c := range cases {
+		if got := utils.FormatDate(c.in); got != c.want {
+			t.Errorf("FormatDate(%v) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+// TestDateRoundTrip checks that FormatDate writes what ParseDate reads:
+// first days of months come back as MM-YYYY even when given as
+// YYYY-MM-DD, other days as YYYY-MM-DD.
+func TestDateRoundTrip(t *testing.T) {
+	cases := map[string]string{
+		"07-2025":                   "07-2025",
+		"2025-07-01":                "07-2025",
+		"2025-07-01T12:00:00+03:00": "07-2025",
+		"2025-07-15":                "2025-07-15",
+		"2025-07-31T23:59:59-12:00": "2025-07-31",
+	}
+	for in, want := range cases {
+		d, err := utils.ParseDate(in)
+		if err != nil {
+			t.Fatalf("ParseDate(%q): %v", in, err)
+		}
+		out := utils.FormatDate(d)
+		if out != want {
+			t.Errorf("FormatDate(ParseDate(%q)) = %q, want %q", in, out, want)
+		}
+		again, err := utils.ParseDate(out)
+		if err != nil || !again.Equal(d) {
+			t.Errorf("ParseDate(%q) = %v, %v, want %v", out, again, err, d)
+		}
+	}
+}